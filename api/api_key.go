@@ -0,0 +1,300 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	defaultAPIKeyDuration = 90 * 24 * time.Hour
+	maxAPIKeyDuration     = 365 * 24 * time.Hour
+)
+
+// unknown, revoked and expired keys, and keys made before their owner's password changed, are refused alike,
+// so the response doesn't tell which prefixes exist
+var errInvalidAPIKey = errors.New("API key is invalid, expired or revoked")
+
+// verifyAPIKey returns the payload of a request made with an API key, or the status to respond with if
+// it's refused. The payload belongs to the user who owns the key, but only grants the scopes of the key
+// that the user's role still grants.
+func verifyAPIKey(ctx *gin.Context, store db.Store, key string) (*token.Payload, int, error) {
+	prefix, err := util.APIKeyPrefix(key)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errInvalidAPIKey
+	}
+
+	apiKey, err := store.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusUnauthorized, errInvalidAPIKey
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(util.HashAPIKey(key)), []byte(apiKey.KeyHash)) != 1 {
+		return nil, http.StatusUnauthorized, errInvalidAPIKey
+	}
+	if apiKey.RevokedAt.Valid || time.Now().After(apiKey.ExpiresAt) {
+		return nil, http.StatusUnauthorized, errInvalidAPIKey
+	}
+
+	user, err := store.GetUserById(ctx, apiKey.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, http.StatusUnauthorized, errInvalidAPIKey
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// a password change signs the user out everywhere, which includes the keys they had made until then
+	if apiKey.CreatedAt.Before(user.PasswordChangedAt) {
+		return nil, http.StatusUnauthorized, errInvalidAPIKey
+	}
+
+	// the query only writes once a minute, and a failed write shouldn't refuse a valid key
+	err = store.TouchAPIKey(ctx, apiKey.ID)
+	if err != nil {
+		log.Error().Err(err).Int64("api_key_id", apiKey.ID).Msg("unable to record API key use")
+	}
+
+	payload := &token.Payload{
+		ID:          uuid.New(),
+		UserId:      user.ID,
+		Role:        user.Role,
+		Permissions: scopedPermissions(apiKey.Scopes, user.Role),
+		APIKeyID:    apiKey.ID,
+		IssuedAt:    apiKey.CreatedAt,
+		ExpiredAt:   apiKey.ExpiresAt,
+	}
+	return payload, http.StatusOK, nil
+}
+
+// scopedPermissions returns the scopes of a key that a role grants, so a key never outranks its owner
+// after their role changes
+func scopedPermissions(scopes []string, role string) []string {
+	permissions := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if util.RoleHasPermission(role, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	return permissions
+}
+
+type apiKeyResponse struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// newAPIKeyResponse returns the fields of an API key that are safe to show to its owner
+func newAPIKeyResponse(apiKey db.ApiKeys) apiKeyResponse {
+	res := apiKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		ExpiresAt: apiKey.ExpiresAt,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		res.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.RevokedAt.Valid {
+		res.RevokedAt = &apiKey.RevokedAt.Time
+	}
+	return res
+}
+
+type userAPIKeysParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,required"`
+	// ExpiresAt defaults to defaultAPIKeyDuration from now
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type createAPIKeyResponse struct {
+	// Key is only ever shown in this response
+	Key    string         `json:"key"`
+	APIKey apiKeyResponse `json:"api_key"`
+}
+
+// createAPIKey creates an API key for a user. The key can only be granted permissions the user's role grants.
+// Only the user can create their keys, so that an admin can't mint a key that acts as someone else. Admins can
+// still list and revoke them.
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	var req createAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var urlParam userAPIKeysParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	now := time.Now()
+	expiresAt := req.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(defaultAPIKeyDuration)
+	}
+	if !expiresAt.After(now) || expiresAt.After(now.Add(maxAPIKeyDuration)) {
+		err := fmt.Errorf("expires_at must be in the future and at most %d days away", maxAPIKeyDuration/(24*time.Hour))
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	scopes := uniqueStrings(req.Scopes)
+	for _, scope := range scopes {
+		if !util.RoleHasPermission(user.Role, scope) {
+			err := fmt.Errorf("scope %s is not granted to the %s role", scope, user.Role)
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+
+	key, prefix, keyHash, err := util.GenerateAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	apiKey, err := server.store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		UserID:    user.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionAPIKeyCreate
+	event.TargetType = db.AuditTargetAPIKey
+	event.TargetID = strconv.FormatInt(apiKey.ID, 10)
+	event.After = apiKey
+	server.recordAuditEvent(ctx, event)
+
+	ctx.JSON(http.StatusOK, createAPIKeyResponse{
+		Key:    key,
+		APIKey: newAPIKeyResponse(apiKey),
+	})
+}
+
+// listAPIKeys lists the API keys of a user, including revoked and expired ones
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	var urlParam userAPIKeysParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionAPIKeysManage) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	apiKeys, err := server.store.ListAPIKeys(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]apiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		res = append(res, newAPIKeyResponse(apiKey))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type revokeAPIKeyParam struct {
+	ID       int64 `uri:"id" binding:"required,min=1"`
+	APIKeyID int64 `uri:"key_id" binding:"required,min=1"`
+}
+
+// revokeAPIKey revokes an API key of a user. The key is kept so that it still shows up in listings.
+func (server *Server) revokeAPIKey(ctx *gin.Context) {
+	var urlParam revokeAPIKeyParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionAPIKeysManage) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	// keys of other users and keys that are already revoked are both not found
+	apiKey, err := server.store.RevokeAPIKey(ctx, db.RevokeAPIKeyParams{
+		ID:     urlParam.APIKeyID,
+		UserID: urlParam.ID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// only keys that weren't revoked are revoked, so the key was the same apart from revoked_at before
+	before := apiKey
+	before.RevokedAt = sql.NullTime{}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionAPIKeyRevoke
+	event.TargetType = db.AuditTargetAPIKey
+	event.TargetID = strconv.FormatInt(apiKey.ID, 10)
+	event.Before = before
+	event.After = apiKey
+	server.recordAuditEvent(ctx, event)
+
+	ctx.Status(http.StatusNoContent)
+}
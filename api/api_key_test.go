@@ -0,0 +1,722 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// randomAPIKey returns a new API key of a user, along with the row it is stored as
+func randomAPIKey(t *testing.T, user db.Users, scopes ...string) (string, db.ApiKeys) {
+	key, prefix, keyHash, err := util.GenerateAPIKey()
+	require.NoError(t, err)
+
+	return key, db.ApiKeys{
+		ID:        util.RandomInt(1, 1000),
+		UserID:    user.ID,
+		Name:      util.RandomString(8),
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now(),
+	}
+}
+
+func addAPIKeyAuthorization(request *http.Request, key string) {
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("ApiKey %s", key))
+}
+
+func TestAPIKeyAuthMiddleware(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.AgentRole
+
+	key, apiKey := randomAPIKey(t, user, util.PermissionBookingsRead, util.PermissionUsersRead)
+
+	testCases := []struct {
+		name          string
+		key           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(apiKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(apiKey.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				payload := requireAPIKeyPayload(t, recorder)
+				require.Equal(t, user.ID, payload.UserId)
+				require.Equal(t, apiKey.ID, payload.APIKeyID)
+				require.Equal(t, user.Role, payload.Role)
+				require.Equal(t, apiKey.Scopes, payload.Permissions)
+			},
+		},
+		{
+			name: "Role Downgraded",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				traveler := user
+				traveler.Role = util.TravelerRole
+
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(apiKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(traveler, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				// a traveler can't read other users, so the key can't either
+				payload := requireAPIKeyPayload(t, recorder)
+				require.Equal(t, []string{util.PermissionBookingsRead}, payload.Permissions)
+			},
+		},
+		{
+			name: "Password Changed",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				changed := user
+				changed.PasswordChangedAt = apiKey.CreatedAt.Add(time.Second)
+
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(apiKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(changed, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Touch Error",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(apiKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Malformed Key",
+			key:  "not-an-api-key",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Unknown Key",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKeys{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Secret",
+			key:  apiKey.Prefix + "_" + util.RandomString(43),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Eq(apiKey.Prefix)).
+					Times(1).
+					Return(apiKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Revoked Key",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				revokedKey := apiKey
+				revokedKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(revokedKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Key",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				expiredKey := apiKey
+				expiredKey.ExpiresAt = time.Now().Add(-time.Minute)
+
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(expiredKey, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Internal Error",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKeys{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			authPath := "/auth"
+			server.router.GET(
+				authPath,
+				authMiddleware(server.tokenMaker, server.revocations, server.store),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, ctx.MustGet(authorizationPayloadKey))
+				},
+			)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, authPath, nil)
+			require.NoError(t, err)
+
+			addAPIKeyAuthorization(request, tc.key)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestAPIKeyCannotActAsOwner(t *testing.T) {
+	user, _ := randomUser(t)
+	key, apiKey := randomAPIKey(t, user, util.PermissionBookingsRead)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(apiKey, nil)
+	store.EXPECT().
+		GetUserById(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(user, nil)
+	store.EXPECT().
+		TouchAPIKey(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	server := newTestServer(t, store)
+
+	requests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPut, fmt.Sprintf("/api/v1/users/%d", user.ID), http.StatusUnauthorized},
+		{http.MethodPost, fmt.Sprintf("/api/v1/users/%d/2fa/totp", user.ID), http.StatusForbidden},
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d/sessions", user.ID), http.StatusForbidden},
+		{http.MethodPost, fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID), http.StatusForbidden},
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID), http.StatusForbidden},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(req.method, req.path, bytes.NewReader([]byte("{}")))
+		require.NoError(t, err)
+
+		addAPIKeyAuthorization(request, key)
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, req.status, recorder.Code, "%s %s", req.method, req.path)
+	}
+}
+
+func TestAPIKeyCannotChangeRoles(t *testing.T) {
+	admin, _ := randomUser(t)
+	admin.Role = util.AdminRole
+	key, apiKey := randomAPIKey(t, admin, util.PermissionUsersManageRole)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetAPIKeyByPrefix(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(apiKey, nil)
+	store.EXPECT().
+		GetUserById(gomock.Any(), gomock.Eq(admin.ID)).
+		Times(1).
+		Return(admin, nil)
+	store.EXPECT().
+		TouchAPIKey(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil)
+	store.EXPECT().
+		UpdateUserRoleTx(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+
+	data, err := json.Marshal(gin.H{"role": util.AdminRole})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	url := fmt.Sprintf("/api/v1/users/%d/role", admin.ID+1)
+	request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// even a key with the scope can't hand out roles
+	addAPIKeyAuthorization(request, key)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestCreateAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.AgentRole
+	scopes := []string{util.PermissionBookingsRead, util.PermissionUsersRead}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"name":   "partner integration",
+				"scopes": append(scopes, util.PermissionBookingsRead),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateAPIKeyParams) (db.ApiKeys, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, "partner integration", arg.Name)
+						require.Equal(t, scopes, arg.Scopes)
+						require.WithinDuration(t, time.Now().Add(defaultAPIKeyDuration), arg.ExpiresAt, time.Minute)
+
+						return db.ApiKeys{
+							ID:        1,
+							UserID:    arg.UserID,
+							Name:      arg.Name,
+							Prefix:    arg.Prefix,
+							KeyHash:   arg.KeyHash,
+							Scopes:    arg.Scopes,
+							ExpiresAt: arg.ExpiresAt,
+							CreatedAt: time.Now(),
+						}, nil
+					})
+				expectAuditEvent(t, store, db.AuditActionAPIKeyCreate, db.AuditTargetAPIKey, "1")
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res createAPIKeyResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+
+				prefix, err := util.APIKeyPrefix(res.Key)
+				require.NoError(t, err)
+				require.Equal(t, prefix, res.APIKey.Prefix)
+				require.Equal(t, scopes, res.APIKey.Scopes)
+				require.NotContains(t, recorder.Body.String(), "key_hash")
+			},
+		},
+		{
+			// an admin could otherwise mint a key that acts as the user
+			name: "Admin For Other User",
+			body: gin.H{
+				"name":   "partner integration",
+				"scopes": scopes,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Scope Not Granted",
+			body: gin.H{
+				"name":   "partner integration",
+				"scopes": []string{util.PermissionUsersWrite},
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "No Scopes",
+			body: gin.H{
+				"name":   "partner integration",
+				"scopes": []string{},
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expiry Too Far",
+			body: gin.H{
+				"name":       "partner integration",
+				"scopes":     scopes,
+				"expires_at": time.Now().Add(2 * maxAPIKeyDuration),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired",
+			body: gin.H{
+				"name":       "partner integration",
+				"scopes":     scopes,
+				"expires_at": time.Now().Add(-time.Hour),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Foreign User",
+			body: gin.H{
+				"name":   "partner integration",
+				"scopes": scopes,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AgentRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListAPIKeysAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, apiKey := randomAPIKey(t, user, util.PermissionBookingsRead)
+	_, revokedKey := randomAPIKey(t, user, util.PermissionBookingsWrite)
+	revokedKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ListAPIKeys(gomock.Any(), gomock.Eq(user.ID)).
+		Times(1).
+		Return([]db.ApiKeys{apiKey, revokedKey}, nil)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+
+	url := fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID)
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res []apiKeyResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	require.Equal(t, apiKey.Prefix, res[0].Prefix)
+	require.Nil(t, res[0].RevokedAt)
+	require.NotNil(t, res[1].RevokedAt)
+	require.NotContains(t, recorder.Body.String(), apiKey.KeyHash)
+}
+
+func TestRevokeAPIKeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, apiKey := randomAPIKey(t, user, util.PermissionBookingsRead)
+	revokedKey := apiKey
+	revokedKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name          string
+		userID        int64
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Eq(db.RevokeAPIKeyParams{
+						ID:     apiKey.ID,
+						UserID: user.ID,
+					})).
+					Times(1).
+					Return(revokedKey, nil)
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionAPIKeyRevoke, arg.Action)
+						require.Equal(t, db.AuditTargetAPIKey, arg.TargetType)
+						require.Equal(t, strconv.FormatInt(apiKey.ID, 10), arg.TargetID)
+						require.False(t, arg.Before.(db.ApiKeys).RevokedAt.Valid)
+						require.Equal(t, revokedKey, arg.After)
+						return db.AuditEvents{}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Found",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKeys{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Foreign User",
+			userID: user.ID + 1,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Internal Error",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ApiKeys{}, errors.New("connection reset"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/api-keys/%d", tc.userID, apiKey.ID)
+			request, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func requireAPIKeyPayload(t *testing.T, recorder *httptest.ResponseRecorder) token.Payload {
+	var payload token.Payload
+	err := json.Unmarshal(recorder.Body.Bytes(), &payload)
+	require.NoError(t, err)
+	return payload
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+)
+
+const defaultAuditEventsPageSize = 50
+
+// newAuditEvent describes who is acting in a request, for an audit event. It must run after requestIDMiddleware,
+// and after authMiddleware on routes that have it.
+func newAuditEvent(ctx *gin.Context) db.AuditEventParams {
+	event := db.AuditEventParams{
+		ClientIp:  ctx.ClientIP(),
+		RequestID: ctx.GetString(requestIDKey),
+	}
+
+	if value, ok := ctx.Get(authorizationPayloadKey); ok {
+		payload := value.(*token.Payload)
+		event.ActorID = sql.NullInt64{Int64: payload.UserId, Valid: true}
+		if payload.IsImpersonated() {
+			event.ImpersonatorID = sql.NullInt64{Int64: payload.ImpersonatorID, Valid: true}
+		}
+	}
+	return event
+}
+
+// recordAuditEvent appends an audit event for an action that has already been taken. The action can't be taken
+// back by then, so an event that can't be recorded is logged instead.
+func (server *Server) recordAuditEvent(ctx *gin.Context, event db.AuditEventParams) {
+	_, err := server.store.CreateAuditEventTx(ctx, event)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("action", event.Action).
+			Str("target_type", event.TargetType).
+			Str("target_id", event.TargetID).
+			Str("request_id", event.RequestID).
+			Msg("unable to record audit event")
+	}
+}
+
+// recordUserAuditEvent records an action taken on a user, with the user before and after it
+func (server *Server) recordUserAuditEvent(ctx *gin.Context, action string, before db.Users, after db.Users) {
+	event := newAuditEvent(ctx)
+	event.Action = action
+	event.TargetType = db.AuditTargetUser
+	event.TargetID = strconv.FormatInt(after.ID, 10)
+	event.Before = before
+	event.After = after
+	server.recordAuditEvent(ctx, event)
+}
+
+type listAuditEventsRequest struct {
+	ActorID    int64     `form:"actor_id" binding:"omitempty,min=1"`
+	Action     string    `form:"action"`
+	TargetType string    `form:"target_type"`
+	TargetID   string    `form:"target_id"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	PageID     int32     `form:"page_id" binding:"omitempty,min=1"`
+	PageSize   int32     `form:"page_size" binding:"omitempty,min=1,max=100"`
+}
+
+type auditEventResponse struct {
+	ID             int64           `json:"id"`
+	ActorID        *int64          `json:"actor_id,omitempty"`
+	ImpersonatorID *int64          `json:"impersonator_id,omitempty"`
+	Action         string          `json:"action"`
+	TargetType     string          `json:"target_type"`
+	TargetID       string          `json:"target_id"`
+	Changes        json.RawMessage `json:"changes"`
+	ClientIP       string          `json:"client_ip"`
+	RequestID      string          `json:"request_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	PrevHash       string          `json:"prev_hash"`
+	Hash           string          `json:"hash"`
+}
+
+func newAuditEventResponse(event db.AuditEvents) auditEventResponse {
+	res := auditEventResponse{
+		ID:         event.ID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Changes:    json.RawMessage(event.Changes),
+		ClientIP:   event.ClientIp,
+		RequestID:  event.RequestID,
+		CreatedAt:  event.CreatedAt,
+		PrevHash:   event.PrevHash,
+		Hash:       event.Hash,
+	}
+	if event.ActorID.Valid {
+		res.ActorID = &event.ActorID.Int64
+	}
+	if event.ImpersonatorID.Valid {
+		res.ImpersonatorID = &event.ImpersonatorID.Int64
+	}
+	return res
+}
+
+// listAuditEvents lists audit events, newest first. Every filter is optional and they all have to match.
+// from is inclusive and to is exclusive.
+func (server *Server) listAuditEvents(ctx *gin.Context) {
+	var req listAuditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if req.PageID == 0 {
+		req.PageID = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultAuditEventsPageSize
+	}
+
+	events, err := server.store.ListAuditEvents(ctx, db.ListAuditEventsParams{
+		ActorID:       sql.NullInt64{Int64: req.ActorID, Valid: req.ActorID != 0},
+		Action:        sql.NullString{String: req.Action, Valid: req.Action != ""},
+		TargetType:    sql.NullString{String: req.TargetType, Valid: req.TargetType != ""},
+		TargetID:      sql.NullString{String: req.TargetID, Valid: req.TargetID != ""},
+		CreatedAfter:  sql.NullTime{Time: req.From, Valid: !req.From.IsZero()},
+		CreatedBefore: sql.NullTime{Time: req.To, Valid: !req.To.IsZero()},
+		LimitCount:    req.PageSize,
+		OffsetCount:   (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		res = append(res, newAuditEventResponse(event))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func randomAuditEvent() db.AuditEvents {
+	actorID := util.RandomInt(1, 1000)
+	return db.AuditEvents{
+		ID:         util.RandomInt(1, 1000),
+		ActorID:    sql.NullInt64{Int64: actorID, Valid: true},
+		Action:     db.AuditActionUserUpdate,
+		TargetType: db.AuditTargetUser,
+		TargetID:   strconv.FormatInt(actorID, 10),
+		Changes:    `{"first_name":{"before":"Jane","after":"Janet"}}`,
+		ClientIp:   "127.0.0.1",
+		RequestID:  util.RandomString(16),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+		PrevHash:   util.RandomString(64),
+		Hash:       util.RandomString(64),
+	}
+}
+
+func expectAuditEvent(t *testing.T, store *mockdb.MockStore, action string, targetType string, targetID string) {
+	store.EXPECT().
+		CreateAuditEventTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+			require.Equal(t, action, arg.Action)
+			require.Equal(t, targetType, arg.TargetType)
+			require.Equal(t, targetID, arg.TargetID)
+			return db.AuditEvents{}, nil
+		})
+}
+
+func TestListAuditEventsAPI(t *testing.T) {
+	event := randomAuditEvent()
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: url.Values{
+				"actor_id":    {strconv.FormatInt(event.ActorID.Int64, 10)},
+				"target_type": {db.AuditTargetUser},
+				"from":        {from.Format(time.RFC3339)},
+				"page_id":     {"2"},
+				"page_size":   {"10"},
+			},
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAuditEventsParams{
+					ActorID:      event.ActorID,
+					TargetType:   sql.NullString{String: db.AuditTargetUser, Valid: true},
+					CreatedAfter: sql.NullTime{Time: from, Valid: true},
+					LimitCount:   10,
+					OffsetCount:  10,
+				}
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]db.AuditEvents{event}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res []auditEventResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Len(t, res, 1)
+				require.Equal(t, event.ID, res[0].ID)
+				require.Equal(t, event.ActorID.Int64, *res[0].ActorID)
+				require.Nil(t, res[0].ImpersonatorID)
+				require.Equal(t, event.Hash, res[0].Hash)
+				// the changes are returned as JSON rather than as a string of it
+				require.JSONEq(t, event.Changes, string(res[0].Changes))
+			},
+		},
+		{
+			name:  "Default Page",
+			query: url.Values{},
+			role:  util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAuditEventsParams{
+					LimitCount:  defaultAuditEventsPageSize,
+					OffsetCount: 0,
+				}
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]db.AuditEvents{}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, "[]", recorder.Body.String())
+			},
+		},
+		{
+			name:  "Agent",
+			query: url.Values{},
+			role:  util.AgentRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:  "Page Too Large",
+			query: url.Values{"page_size": {"1000"}},
+			role:  util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Invalid Time",
+			query: url.Values{"from": {"yesterday"}},
+			role:  util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "Internal Error",
+			query: url.Values{},
+			role:  util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAuditEvents(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, errors.New("connection refused"))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/audit-events?"+tc.query.Encode(), nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(tc.role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
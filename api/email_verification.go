@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	emailVerificationPurpose  = "email_verification"
+	defaultEmailTokenDuration = 24 * time.Hour
+)
+
+// createEmailToken replaces the pending tokens of a user for a purpose with a new one.
+// Only the hash of the token is stored, the token itself is meant to be emailed.
+func (server *Server) createEmailToken(ctx context.Context, user db.Users, purpose string, duration time.Duration) (string, error) {
+	err := server.store.InvalidateVerificationTokens(ctx, db.InvalidateVerificationTokensParams{
+		UserID:  user.ID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rawToken, tokenHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = server.store.CreateVerificationToken(ctx, db.CreateVerificationTokenParams{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(duration),
+	})
+	if err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// appLink returns a link to a page of the app
+func (server *Server) appLink(path string, rawToken string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimRight(server.config.AppBaseURL, "/"), path, rawToken)
+}
+
+// sendVerificationEmail emails a user a link to verify their email address
+func (server *Server) sendVerificationEmail(ctx context.Context, user db.Users) error {
+	duration := server.config.EmailTokenDuration
+	if duration == 0 {
+		duration = defaultEmailTokenDuration
+	}
+
+	rawToken, err := server.createEmailToken(ctx, user, emailVerificationPurpose, duration)
+	if err != nil {
+		return err
+	}
+
+	return server.mailer.Send(ctx, mailer.Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease verify your email address by opening the link below.\n\n%s\n",
+			user.FirstName,
+			server.appLink("/verify-email", rawToken),
+		),
+	})
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// verifyEmail marks the email of a user as verified using the token sent to it
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	verificationToken, err := server.store.GetVerificationToken(ctx, db.GetVerificationTokenParams{
+		TokenHash: util.HashVerificationToken(req.Token),
+		Purpose:   emailVerificationPurpose,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if verificationToken.UsedAt.Valid {
+		err := errors.New("token has already been used")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	if time.Now().After(verificationToken.ExpiresAt) {
+		err := errors.New("token has expired")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.VerifyEmailTx(ctx, verificationToken.ID)
+	if err != nil {
+		// the token was used by a concurrent request
+		if err == sql.ErrNoRows {
+			err := errors.New("token has already been used")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := newUserResponse(user)
+	ctx.JSON(http.StatusOK, res)
+}
+
+type resendVerificationEmailParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// resendVerificationEmail sends a new verification email. Earlier links stop working.
+func (server *Server) resendVerificationEmail(ctx *gin.Context) {
+	var urlParam resendVerificationEmailParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		err := errors.New("email address has already been verified")
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
+	result, err := server.rateLimiter.Allow(ctx, verifyEmailRateLimit, strconv.FormatInt(user.ID, 10))
+	if err := applyRateLimit(ctx, verifyEmailRateLimit, result, err); err != nil {
+		ctx.JSON(rateLimitStatus(err), errorResponse(err))
+		return
+	}
+
+	err = server.sendVerificationEmail(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmailAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	rawToken, tokenHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	verificationToken := db.VerificationTokens{
+		ID:        util.RandomInt(1, 1000),
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		Purpose:   emailVerificationPurpose,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"token": rawToken,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.GetVerificationTokenParams{
+					TokenHash: tokenHash,
+					Purpose:   emailVerificationPurpose,
+				}
+				verifiedUser := user
+				verifiedUser.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(verificationToken, nil)
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Eq(verificationToken.ID)).
+					Times(1).
+					Return(verifiedUser, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res userResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.EmailVerified)
+			},
+		},
+		{
+			name: "Unknown Token",
+			body: gin.H{
+				"token": "unknown",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerificationTokens{}, sql.ErrNoRows)
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Used Token",
+			body: gin.H{
+				"token": rawToken,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				usedToken := verificationToken
+				usedToken.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(usedToken, nil)
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Token",
+			body: gin.H{
+				"token": rawToken,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expiredToken := verificationToken
+				expiredToken.ExpiresAt = time.Now().Add(-time.Minute)
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(expiredToken, nil)
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Concurrent Use",
+			body: gin.H{
+				"token": rawToken,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(verificationToken, nil)
+				store.EXPECT().
+					VerifyEmailTx(gomock.Any(), gomock.Eq(verificationToken.ID)).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Missing Token",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/api/v1/users/verify-email"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestResendVerificationEmailAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Eq(db.InvalidateVerificationTokensParams{
+						UserID:  user.ID,
+						Purpose: emailVerificationPurpose,
+					})).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.CreateVerificationTokenParams) (db.VerificationTokens, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, emailVerificationPurpose, arg.Purpose)
+						require.WithinDuration(t, time.Now().Add(defaultEmailTokenDuration), arg.ExpiresAt, time.Minute)
+						return db.VerificationTokens{UserID: arg.UserID, TokenHash: arg.TokenHash}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+
+				files, err := os.ReadDir(mailDir)
+				require.NoError(t, err)
+				require.Len(t, files, 1)
+
+				data, err := os.ReadFile(filepath.Join(mailDir, files[0].Name()))
+				require.NoError(t, err)
+				require.Contains(t, string(data), "To: "+user.Email)
+				require.Regexp(t, regexp.MustCompile(`https://travel\.agency/verify-email\?token=[\w-]{43}`), string(data))
+			},
+		},
+		{
+			name: "Already Verified",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				verifiedUser := user
+				verifiedUser.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(verifiedUser, nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "Foreign User",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.AppBaseURL = "https://travel.agency/"
+
+			mailDir := t.TempDir()
+			fileMailer, err := mailer.NewFileMailer(mailDir, "no-reply@travel.agency")
+			require.NoError(t, err)
+			server.mailer = fileMailer
+
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/verify-email/resend", user.ID)
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, mailDir)
+		})
+	}
+}
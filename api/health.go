@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// Statuses reported by the health check
+const (
+	healthStatusUp   = "up"
+	healthStatusDown = "down"
+)
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// health reports whether the server and its dependencies are up. It responds with a 503 when any
+// dependency is down, so that monitoring picks up an outage instead of the server quietly degrading.
+func (server *Server) health(ctx *gin.Context) {
+	res := healthResponse{
+		Status: healthStatusUp,
+		Checks: map[string]string{},
+	}
+
+	if server.redis != nil {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+
+		res.Checks["redis"] = healthStatusUp
+		if err := server.redis.Ping(checkCtx).Err(); err != nil {
+			log.Error().Err(err).Msg("redis health check failed")
+			res.Status = healthStatusDown
+			res.Checks["redis"] = healthStatusDown
+		}
+	}
+
+	if res.Status != healthStatusUp {
+		ctx.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
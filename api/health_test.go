@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisServer(t *testing.T) (*Server, *miniredis.Miniredis) {
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+
+	config := util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+		MailerType:           mailerTypeLog,
+	}
+
+	server, err := NewServer(config, nil, redisClient)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	return server, redisServer
+}
+
+func TestHealthAPI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		setupServer   func(t *testing.T) *Server
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Without Redis",
+			setupServer: func(t *testing.T) *Server {
+				return newTestServer(t, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				res := requireHealthResponse(t, recorder)
+				require.Equal(t, healthStatusUp, res.Status)
+				require.Empty(t, res.Checks)
+			},
+		},
+		{
+			name: "Redis Up",
+			setupServer: func(t *testing.T) *Server {
+				server, _ := newTestRedisServer(t)
+				return server
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				res := requireHealthResponse(t, recorder)
+				require.Equal(t, healthStatusUp, res.Status)
+				require.Equal(t, healthStatusUp, res.Checks["redis"])
+			},
+		},
+		{
+			name: "Redis Down",
+			setupServer: func(t *testing.T) *Server {
+				server, redisServer := newTestRedisServer(t)
+				redisServer.Close()
+				return server
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+				res := requireHealthResponse(t, recorder)
+				require.Equal(t, healthStatusDown, res.Status)
+				require.Equal(t, healthStatusDown, res.Checks["redis"])
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := tc.setupServer(t)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/health", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestShutdownClosesRedis(t *testing.T) {
+	server, _ := newTestRedisServer(t)
+
+	err := server.Shutdown(context.Background())
+	require.NoError(t, err)
+
+	err = server.redis.Ping(context.Background()).Err()
+	require.ErrorIs(t, err, redis.ErrClosed)
+}
+
+func requireHealthResponse(t *testing.T, recorder *httptest.ResponseRecorder) healthResponse {
+	var res healthResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	return res
+}
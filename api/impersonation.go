@@ -0,0 +1,171 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+// Impersonation tokens are short-lived, as they can't be revoked by the impersonated user
+const (
+	defaultImpersonationDuration = 15 * time.Minute
+	maxImpersonationDuration     = time.Hour
+)
+
+var (
+	errImpersonateSelf     = errors.New("unable to impersonate yourself")
+	errImpersonateAdmin    = errors.New("users who can impersonate others can't be impersonated")
+	errImpersonationDenied = errors.New("this action is not allowed while impersonating a user")
+)
+
+func (server *Server) impersonationDuration() time.Duration {
+	if server.config.ImpersonationDuration == 0 {
+		return defaultImpersonationDuration
+	}
+	return server.config.ImpersonationDuration
+}
+
+type impersonateUserParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type impersonateUserRequest struct {
+	// Reason is kept for the audit, such as the support ticket being worked on
+	Reason string `json:"reason" binding:"required,min=5,max=500"`
+}
+
+type impersonateUserResponse struct {
+	ImpersonationID      uuid.UUID    `json:"impersonation_id"`
+	AccessToken          string       `json:"access_token"`
+	AccessTokenExpiresAt time.Time    `json:"access_token_expires_at"`
+	User                 userResponse `json:"user"`
+}
+
+// impersonateUser gives an admin an access token to act as a user, so that support can see the app as the
+// user does. The token carries the user's rights and the admin's ID. It comes without a refresh token, so it
+// can't outlive its short duration, and every request made with it is audited.
+func (server *Server) impersonateUser(ctx *gin.Context) {
+	var urlParam impersonateUserParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req impersonateUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId == urlParam.ID {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errImpersonateSelf))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// otherwise an admin could act with the rights of another admin under their name
+	if util.RoleHasPermission(user.Role, util.PermissionUsersImpersonate) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errImpersonateAdmin))
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.ID,
+		server.impersonationDuration(),
+		token.WithRole(user.Role, util.PermissionsForRole(user.Role)),
+		token.WithImpersonator(authPayload.UserId),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the token ID doubles as the impersonation ID
+	impersonation, err := server.store.CreateImpersonation(ctx, db.CreateImpersonationParams{
+		ID:             accessPayload.ID,
+		ImpersonatorID: authPayload.UserId,
+		UserID:         user.ID,
+		Reason:         req.Reason,
+		ClientIp:       ctx.ClientIP(),
+		ExpiresAt:      accessPayload.ExpiredAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionUserImpersonate
+	event.TargetType = db.AuditTargetUser
+	event.TargetID = strconv.FormatInt(user.ID, 10)
+	event.After = impersonation
+	server.recordAuditEvent(ctx, event)
+
+	log.Warn().
+		Str("impersonation_id", impersonation.ID.String()).
+		Int64("impersonator_id", impersonation.ImpersonatorID).
+		Int64("user_id", impersonation.UserID).
+		Str("reason", impersonation.Reason).
+		Msg("impersonation started")
+
+	ctx.JSON(http.StatusOK, impersonateUserResponse{
+		ImpersonationID:      impersonation.ID,
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		User:                 newUserResponse(user),
+	})
+}
+
+// auditImpersonation records a request made while impersonating, before it's handled. A request that can't
+// be recorded is refused, so that nothing done as a user goes unaudited. It must run after authMiddleware.
+func auditImpersonation(store db.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if !payload.IsImpersonated() {
+			ctx.Next()
+			return
+		}
+
+		_, err := store.CreateImpersonationRequest(ctx, db.CreateImpersonationRequestParams{
+			ImpersonationID: payload.ID,
+			Method:          ctx.Request.Method,
+			Path:            ctx.Request.URL.Path,
+			ClientIp:        ctx.ClientIP(),
+		})
+		if err != nil {
+			log.Error().Err(err).Str("impersonation_id", payload.ID.String()).Msg("unable to audit impersonated request")
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+
+		log.Warn().
+			Str("impersonation_id", payload.ID.String()).
+			Int64("impersonator_id", payload.ImpersonatorID).
+			Int64("user_id", payload.UserId).
+			Str("method", ctx.Request.Method).
+			Str("path", ctx.Request.URL.Path).
+			Int("status", ctx.Writer.Status()).
+			Msg("impersonated request")
+	}
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// addImpersonation authorizes a request with a token an admin uses to act as the user
+func addImpersonation(t *testing.T, request *http.Request, tokenMaker token.Maker, user db.Users, impersonatorID int64) *token.Payload {
+	accessToken, payload, err := tokenMaker.CreateToken(
+		user.ID,
+		time.Minute,
+		withTestRole(user.Role),
+		token.WithImpersonator(impersonatorID),
+	)
+	require.NoError(t, err)
+
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+	return payload
+}
+
+func TestImpersonateUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.TravelerRole
+	adminID := user.ID + 100
+
+	testCases := []struct {
+		name          string
+		userID        int64
+		body          gin.H
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker)
+	}{
+		{
+			name:   "OK",
+			userID: user.ID,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateImpersonationParams) (db.Impersonations, error) {
+						require.Equal(t, adminID, arg.ImpersonatorID)
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, "ticket 4521, booking stuck", arg.Reason)
+						require.WithinDuration(t, time.Now().Add(defaultImpersonationDuration), arg.ExpiresAt, time.Second)
+
+						return db.Impersonations{
+							ID:             arg.ID,
+							ImpersonatorID: arg.ImpersonatorID,
+							UserID:         arg.UserID,
+							Reason:         arg.Reason,
+							ExpiresAt:      arg.ExpiresAt,
+						}, nil
+					})
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionUserImpersonate, arg.Action)
+						require.Equal(t, sql.NullInt64{Int64: adminID, Valid: true}, arg.ActorID)
+						require.Equal(t, strconv.FormatInt(user.ID, 10), arg.TargetID)
+						// the impersonation is recorded already, so it goes ahead without the event
+						return db.AuditEvents{}, errors.New("connection refused")
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res impersonateUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Equal(t, user.Email, res.User.Email)
+
+				payload, err := tokenMaker.VerifyToken(res.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, res.ImpersonationID, payload.ID)
+				require.Equal(t, user.ID, payload.UserId)
+				require.Equal(t, adminID, payload.ImpersonatorID)
+				require.Equal(t, util.TravelerRole, payload.Role)
+				require.False(t, payload.HasPermission(util.PermissionUsersImpersonate))
+
+				// there is nothing to renew the token with
+				require.NotContains(t, recorder.Body.String(), "refresh_token")
+			},
+		},
+		{
+			name:   "Not Admin",
+			userID: user.ID,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AgentRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "While Impersonating",
+			userID: user.ID + 1,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addImpersonation(t, request, tokenMaker, db.Users{ID: user.ID, Role: util.AdminRole}, adminID)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateImpersonationRequest(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Self",
+			userID: adminID,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "Another Admin",
+			userID: user.ID,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				admin := user
+				admin.Role = util.AdminRole
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(admin, nil)
+				store.EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Found",
+			userID: user.ID,
+			body:   gin.H{"reason": "ticket 4521, booking stuck"},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Missing Reason",
+			userID: user.ID,
+			body:   gin.H{},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, adminID, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/api/v1/users/%d/impersonate", tc.userID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server.tokenMaker)
+		})
+	}
+}
+
+func TestImpersonatedRequestsAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.TravelerRole
+	adminID := user.ID + 100
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore, payload *token.Payload)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Audited",
+			method: http.MethodPut,
+			url:    fmt.Sprintf("/api/v1/users/%d", user.ID),
+			body:   gin.H{"first_name": "Jane"},
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				arg := db.CreateImpersonationRequestParams{
+					ImpersonationID: payload.ID,
+					Method:          http.MethodPut,
+					Path:            fmt.Sprintf("/api/v1/users/%d", user.ID),
+				}
+				store.EXPECT().
+					CreateImpersonationRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, got db.CreateImpersonationRequestParams) (db.ImpersonationRequests, error) {
+						got.ClientIp = ""
+						require.Equal(t, arg, got)
+						return db.ImpersonationRequests{ID: 1, ImpersonationID: got.ImpersonationID}, nil
+					})
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, got db.UpdateUserTxParams) (db.Users, error) {
+						// the change is audited under the user, along with the admin acting as them
+						require.Equal(t, sql.NullInt64{Int64: user.ID, Valid: true}, got.Audit.ActorID)
+						require.Equal(t, sql.NullInt64{Int64: payload.ImpersonatorID, Valid: true}, got.Audit.ImpersonatorID)
+						return user, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Audit Unavailable",
+			method: http.MethodPut,
+			url:    fmt.Sprintf("/api/v1/users/%d", user.ID),
+			body:   gin.H{"first_name": "Jane"},
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				store.EXPECT().
+					CreateImpersonationRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.ImpersonationRequests{}, errors.New("connection refused"))
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name:   "Change Email",
+			method: http.MethodPut,
+			url:    fmt.Sprintf("/api/v1/users/%d", user.ID),
+			body:   gin.H{"email": util.RandomEmail()},
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				store.EXPECT().
+					CreateImpersonationRequest(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Account Security",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID),
+			body:   gin.H{"name": "support"},
+			buildStubs: func(store *mockdb.MockStore, payload *token.Payload) {
+				store.EXPECT().
+					CreateImpersonationRequest(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(tc.method, tc.url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			payload := addImpersonation(t, request, server.tokenMaker, user, adminID)
+			tc.buildStubs(store, payload)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestRenewImpersonationToken(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+	impersonationToken, _, err := server.tokenMaker.CreateToken(user.ID, time.Minute, token.WithImpersonator(user.ID+1))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(gin.H{"refresh_token": impersonationToken})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/users/renew-token", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestImpersonationDurationConfig(t *testing.T) {
+	config := util.Config{
+		TokenSymmetricKey:     util.RandomString(32),
+		TOTPEncryptionKey:     util.RandomString(32),
+		ImpersonationDuration: 2 * time.Hour,
+		MailerType:            mailerTypeLog,
+	}
+
+	_, err := NewServer(config, nil, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+)
+
+type introspectTokenRequest struct {
+	Token string `form:"token" binding:"required"`
+	// TokenTypeHint is accepted as RFC 7662 asks, but only access tokens can be introspected
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type introspectSessionResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Active    bool      `json:"active"`
+	Blocked   bool      `json:"blocked"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newIntrospectSessionResponse returns the state of a session. The session ID is the one tokens carry, which
+// stays the same as the refresh token is rotated.
+func newIntrospectSessionResponse(session db.Sessions) *introspectSessionResponse {
+	return &introspectSessionResponse{
+		ID:        session.FamilyID,
+		Active:    !session.IsBlocked && time.Now().Before(session.ExpiresAt),
+		Blocked:   session.IsBlocked,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+// introspectTokenResponse holds the claims RFC 7662 defines, followed by the claims of the token as the token
+// package has them. Only active is set for inactive tokens.
+type introspectTokenResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	// Claims is the payload of the token
+	Claims *token.Payload `json:"claims,omitempty"`
+	// Session is the state of the session the token was issued for, if it was issued for one
+	Session *introspectSessionResponse `json:"session,omitempty"`
+}
+
+// introspectToken tells other services whether an access token is active and what it grants, so that they don't
+// have to verify tokens themselves. A token is inactive if it's invalid, expired, revoked or meant for something
+// other than access, or if its session has ended, and no reason is given. Only confidential clients listed in
+// the config may call it.
+func (server *Server) introspectToken(ctx *gin.Context) {
+	var req introspectTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, err.Error()))
+		return
+	}
+
+	client, ok := server.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if !ok {
+		return
+	}
+
+	// any user can register a client, so introspection is limited to the services it's meant for
+	if !client.SecretHash.Valid || !containsString(server.config.IntrospectionClients, client.ID) {
+		ctx.JSON(http.StatusForbidden, oauthErrorResponse(oauthErrorUnauthorizedClient, "the client may not introspect tokens"))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	inactive := introspectTokenResponse{Active: false}
+
+	// refresh tokens and other tokens with a purpose are refused here
+	payload, status, err := verifyAccessToken(ctx, server.tokenMaker, server.revocations, server.store, req.Token)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	// access tokens are issued for a session, an OAuth client or an impersonation. Refresh tokens issued before
+	// they were given a purpose are none of these.
+	if payload.SessionID == uuid.Nil && !payload.IsDelegated() && !payload.IsImpersonated() {
+		ctx.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	res := introspectTokenResponse{
+		Active:    true,
+		Scope:     strings.Join(payload.Permissions, " "),
+		ClientID:  payload.ClientID,
+		TokenType: "Bearer",
+		Exp:       payload.ExpiredAt.Unix(),
+		Iat:       payload.IssuedAt.Unix(),
+		Sub:       strconv.FormatInt(payload.UserId, 10),
+		Jti:       payload.ID.String(),
+		Claims:    payload,
+	}
+
+	if payload.SessionID != uuid.Nil {
+		session, err := server.store.GetLatestFamilySession(ctx, payload.SessionID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.JSON(http.StatusOK, inactive)
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		res.Session = newIntrospectSessionResponse(session)
+		if !res.Session.Active {
+			ctx.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospectTokenAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	secret, serviceClient := randomOAuthClient(t, user, true, oauthGrantClientCredentials)
+	otherSecret, otherClient := randomOAuthClient(t, user, true, oauthGrantClientCredentials)
+	sessionID := uuid.New()
+
+	session := db.Sessions{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	createAccessToken := func(t *testing.T, server *Server, opts ...token.PayloadOption) string {
+		accessToken, _, err := server.tokenMaker.CreateToken(user.ID, time.Minute, opts...)
+		require.NoError(t, err)
+		return accessToken
+	}
+
+	testCases := []struct {
+		name          string
+		buildToken    func(t *testing.T, server *Server) string
+		setupAuth     func(request *http.Request)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Active",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, token.WithSessionID(sessionID), withTestRole(util.AgentRole))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(serviceClient.ID)).
+					Times(1).
+					Return(serviceClient, nil)
+				store.EXPECT().
+					GetLatestFamilySession(gomock.Any(), gomock.Eq(sessionID)).
+					Times(1).
+					Return(session, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+				var res introspectTokenResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.Active)
+				require.Equal(t, "Bearer", res.TokenType)
+				require.Equal(t, strconv.FormatInt(user.ID, 10), res.Sub)
+				require.Equal(t, strings.Join(util.PermissionsForRole(util.AgentRole), " "), res.Scope)
+				require.Equal(t, res.Jti, res.Claims.ID.String())
+				require.Equal(t, res.Exp, res.Claims.ExpiredAt.Unix())
+
+				require.Equal(t, user.ID, res.Claims.UserId)
+				require.Equal(t, util.AgentRole, res.Claims.Role)
+				require.Equal(t, sessionID, res.Claims.SessionID)
+
+				require.NotNil(t, res.Session)
+				require.Equal(t, sessionID, res.Session.ID)
+				require.True(t, res.Session.Active)
+			},
+		},
+		{
+			name: "OAuth Token",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, token.WithClientID(otherClient.ID), token.WithRole(util.TravelerRole, []string{util.PermissionBookingsRead}))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+				store.EXPECT().
+					GetLatestFamilySession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res introspectTokenResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.Active)
+				require.Equal(t, otherClient.ID, res.ClientID)
+				require.Equal(t, util.PermissionBookingsRead, res.Scope)
+				require.Nil(t, res.Session)
+			},
+		},
+		{
+			name: "Session Ended",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, token.WithSessionID(sessionID), withTestRole(util.AgentRole))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				blocked := session
+				blocked.IsBlocked = true
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+				store.EXPECT().
+					GetLatestFamilySession(gomock.Any(), gomock.Eq(sessionID)).
+					Times(1).
+					Return(blocked, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Revoked",
+			buildToken: func(t *testing.T, server *Server) string {
+				accessToken, payload, err := server.tokenMaker.CreateToken(user.ID, time.Minute, withTestRole(util.AgentRole))
+				require.NoError(t, err)
+
+				err = server.revocations.RevokeToken(context.Background(), payload.ID, payload.ExpiredAt)
+				require.NoError(t, err)
+				return accessToken
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Challenge Token",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, token.WithPurpose(token.PurposeTwoFactorChallenge))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Refresh Token",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, refreshTokenOptions(sessionID)...)
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+				store.EXPECT().
+					GetLatestFamilySession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Refresh Token Without Purpose",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server)
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Invalid Token",
+			buildToken: func(t *testing.T, server *Server) string {
+				return util.RandomString(40)
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `{"active": false}`, recorder.Body.String())
+			},
+		},
+		{
+			name: "Client Not Allowed",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, withTestRole(util.AgentRole))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(otherClient.ID, otherSecret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(otherClient.ID)).
+					Times(1).
+					Return(otherClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireOAuthError(t, recorder, http.StatusForbidden, oauthErrorUnauthorizedClient)
+			},
+		},
+		{
+			name: "Wrong Secret",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, withTestRole(util.AgentRole))
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, util.RandomString(32))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(serviceClient, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireOAuthError(t, recorder, http.StatusUnauthorized, oauthErrorInvalidClient)
+			},
+		},
+		{
+			name: "No Client",
+			buildToken: func(t *testing.T, server *Server) string {
+				return createAccessToken(t, server, withTestRole(util.AgentRole))
+			},
+			setupAuth: func(request *http.Request) {},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireOAuthError(t, recorder, http.StatusUnauthorized, oauthErrorInvalidClient)
+			},
+		},
+		{
+			name: "Missing Token",
+			buildToken: func(t *testing.T, server *Server) string {
+				return ""
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(serviceClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.IntrospectionClients = []string{serviceClient.ID}
+			recorder := httptest.NewRecorder()
+
+			form := url.Values{"token": {tc.buildToken(t, server)}}
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/oauth/introspect", strings.NewReader(form.Encode()))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			tc.setupAuth(request)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sajitron/travel-agency/token"
+)
+
+// getJWKS publishes the public keys that verify our access tokens.
+// The set is empty when tokens are signed with a symmetric key.
+func (server *Server) getJWKS(ctx *gin.Context) {
+	keySet := token.JSONWebKeySet{Keys: []token.JSONWebKey{}}
+	if provider, ok := server.tokenMaker.(token.KeySetProvider); ok {
+		keySet = provider.PublicKeys()
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, keySet)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetJWKSAPI(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		updateConfig  func(config *util.Config)
+		checkResponse func(t *testing.T, keySet token.JSONWebKeySet)
+	}{
+		{
+			name: "Asymmetric",
+			updateConfig: func(config *util.Config) {
+				config.TokenPrivateKey = base64.StdEncoding.EncodeToString(privateKey.Seed())
+				config.TokenKeyID = "test-key"
+			},
+			checkResponse: func(t *testing.T, keySet token.JSONWebKeySet) {
+				require.Len(t, keySet.Keys, 1)
+				require.Equal(t, "test-key", keySet.Keys[0].KeyID)
+				require.Equal(t, "OKP", keySet.Keys[0].KeyType)
+
+				publicKey, err := base64.RawURLEncoding.DecodeString(keySet.Keys[0].X)
+				require.NoError(t, err)
+				require.Equal(t, privateKey.Public(), ed25519.PublicKey(publicKey))
+			},
+		},
+		{
+			name:         "Symmetric",
+			updateConfig: func(config *util.Config) {},
+			checkResponse: func(t *testing.T, keySet token.JSONWebKeySet) {
+				require.Empty(t, keySet.Keys)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			config := util.Config{
+				TokenSymmetricKey:   util.RandomString(32),
+				AccessTokenDuration: time.Minute,
+				MailerType:          mailerTypeLog,
+			}
+			tc.updateConfig(&config)
+
+			server, err := NewServer(config, nil, nil)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var keySet token.JSONWebKeySet
+			err = json.Unmarshal(recorder.Body.Bytes(), &keySet)
+			require.NoError(t, err)
+			tc.checkResponse(t, keySet)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+)
+
+// Once a user has failed lockoutThreshold logins in a row, their account is locked for lockoutBaseDuration.
+// Every further failure doubles the lockout, up to lockoutMaxDuration. The threshold is below the login rate
+// limit, so that the lockout starts before the rate limit refuses further guesses.
+const (
+	lockoutThreshold    = 3
+	lockoutBaseDuration = time.Minute
+	lockoutMaxDuration  = 24 * time.Hour
+)
+
+// lockoutDuration returns how long an account is locked after a number of failed logins in a row
+func lockoutDuration(failedLoginCount int32) time.Duration {
+	if failedLoginCount < lockoutThreshold {
+		return 0
+	}
+
+	duration := float64(lockoutBaseDuration) * math.Pow(2, float64(failedLoginCount-lockoutThreshold))
+	if duration > float64(lockoutMaxDuration) {
+		return lockoutMaxDuration
+	}
+	return time.Duration(duration)
+}
+
+// isLockedOut checks if an account is currently locked
+func isLockedOut(user db.Users) bool {
+	return user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now())
+}
+
+// recordFailedLogin counts a failed login of a user and locks their account once they have failed too many
+func (server *Server) recordFailedLogin(ctx *gin.Context, user db.Users) error {
+	user, err := server.store.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	duration := lockoutDuration(user.FailedLoginCount)
+	if duration == 0 {
+		return nil
+	}
+
+	_, err = server.store.LockUser(ctx, db.LockUserParams{
+		LockedUntil: time.Now().Add(duration),
+		ID:          user.ID,
+	})
+	return err
+}
+
+// rejectLockedLogin refuses a login to a locked account. It responds like the login rate limit does,
+// with a Retry-After header set to when the lockout ends. It is only used once the user has proven who they
+// are, a password login refuses a locked account like a wrong password so as not to reveal that it exists.
+func rejectLockedLogin(ctx *gin.Context, lockedUntil time.Time) {
+	ctx.Header("Retry-After", formatSeconds(time.Until(lockedUntil)))
+	ctx.JSON(http.StatusTooManyRequests, errorResponse(errRateLimited))
+}
+
+type lockoutResponse struct {
+	UserID            int64      `json:"user_id"`
+	Locked            bool       `json:"locked"`
+	FailedLoginCount  int32      `json:"failed_login_count"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty"`
+	LastFailedLoginAt *time.Time `json:"last_failed_login_at,omitempty"`
+}
+
+// newLockoutResponse returns the lockout state of a user
+func newLockoutResponse(user db.Users) lockoutResponse {
+	res := lockoutResponse{
+		UserID:           user.ID,
+		Locked:           isLockedOut(user),
+		FailedLoginCount: user.FailedLoginCount,
+	}
+	if user.LockedUntil.Valid {
+		res.LockedUntil = &user.LockedUntil.Time
+	}
+	if user.LastFailedLoginAt.Valid {
+		res.LastFailedLoginAt = &user.LastFailedLoginAt.Time
+	}
+	return res
+}
+
+type userLockoutParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// getUserLockout shows an admin whether an account is locked and how many logins have failed
+func (server *Server) getUserLockout(ctx *gin.Context) {
+	var urlParam userLockoutParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newLockoutResponse(user))
+}
+
+// unlockUser lets an admin lift a lockout. The failed login counters and the login rate limit of the
+// account are cleared along with it.
+func (server *Server) unlockUser(ctx *gin.Context) {
+	var urlParam userLockoutParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.ResetFailedLogins(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionUserUnlock
+	event.TargetType = db.AuditTargetUser
+	event.TargetID = strconv.FormatInt(user.ID, 10)
+	server.recordAuditEvent(ctx, event)
+
+	err = server.rateLimiter.Reset(ctx, loginRateLimit, strings.ToLower(strings.TrimSpace(user.Email)))
+	if err != nil {
+		log.Error().Err(err).Str("policy", loginRateLimit.Name).Msg("unable to reset rate limit")
+	}
+
+	ctx.JSON(http.StatusOK, newLockoutResponse(user))
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	require.Zero(t, lockoutDuration(0))
+	require.Zero(t, lockoutDuration(lockoutThreshold-1))
+	require.Equal(t, lockoutBaseDuration, lockoutDuration(lockoutThreshold))
+	require.Equal(t, 2*lockoutBaseDuration, lockoutDuration(lockoutThreshold+1))
+	require.Equal(t, 8*lockoutBaseDuration, lockoutDuration(lockoutThreshold+3))
+	require.Equal(t, lockoutMaxDuration, lockoutDuration(lockoutThreshold+20))
+	require.Equal(t, lockoutMaxDuration, lockoutDuration(1000))
+
+	// the lockout has to start before the login rate limit refuses further guesses
+	require.Less(t, lockoutThreshold, loginRateLimit.Limit)
+}
+
+func TestLockedLoginIndistinguishable(t *testing.T) {
+	lockedUser, password := randomUser(t)
+	lockedUser.FailedLoginCount = lockoutThreshold
+	lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+	login := func(email string, buildStubs func(store *mockdb.MockStore)) *httptest.ResponseRecorder {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mockdb.NewMockStore(ctrl)
+		buildStubs(store)
+		server := newTestServer(t, store)
+
+		data, err := json.Marshal(gin.H{"email": email, "password": password})
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(data))
+		require.NoError(t, err)
+
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	unknown := login(util.RandomEmail(), func(store *mockdb.MockStore) {
+		store.EXPECT().
+			GetUser(gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(db.Users{}, sql.ErrNoRows)
+	})
+	locked := login(lockedUser.Email, func(store *mockdb.MockStore) {
+		store.EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(lockedUser.Email)).
+			Times(1).
+			Return(lockedUser, nil)
+		store.EXPECT().
+			RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Times(0)
+	})
+
+	// request IDs differ between any two requests
+	unknown.Header().Del("X-Request-Id")
+	locked.Header().Del("X-Request-Id")
+
+	require.Equal(t, http.StatusUnauthorized, locked.Code)
+	require.Equal(t, unknown.Code, locked.Code)
+	require.Equal(t, unknown.Header(), locked.Header())
+	require.Equal(t, unknown.Body.String(), locked.Body.String())
+}
+
+func TestGetUserLockoutAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.FailedLoginCount = lockoutThreshold
+	user.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+	user.LastFailedLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name          string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			role: util.AgentRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				res := requireLockoutResponse(t, recorder)
+				require.Equal(t, user.ID, res.UserID)
+				require.True(t, res.Locked)
+				require.Equal(t, user.FailedLoginCount, res.FailedLoginCount)
+				require.WithinDuration(t, user.LockedUntil.Time, *res.LockedUntil, time.Second)
+				require.WithinDuration(t, user.LastFailedLoginAt.Time, *res.LastFailedLoginAt, time.Second)
+			},
+		},
+		{
+			name: "Not Found",
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Traveler",
+			role: util.TravelerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/lockout", user.ID)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(tc.role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUnlockUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server)
+	}{
+		{
+			name: "OK",
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetFailedLogins(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionUserUnlock, arg.Action)
+						require.Equal(t, db.AuditTargetUser, arg.TargetType)
+						require.Equal(t, strconv.FormatInt(user.ID, 10), arg.TargetID)
+						// the forwarded IP isn't believed without a trusted proxy
+						require.Equal(t, "192.0.2.10", arg.ClientIp)
+						return db.AuditEvents{}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				res := requireLockoutResponse(t, recorder)
+				require.False(t, res.Locked)
+				require.Zero(t, res.FailedLoginCount)
+				require.Nil(t, res.LockedUntil)
+
+				// the login rate limit of the account is lifted as well
+				result, err := server.rateLimiter.Peek(context.Background(), loginRateLimit, strings.ToLower(user.Email))
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+			},
+		},
+		{
+			name: "Not Found",
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetFailedLogins(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "Agent",
+			role: util.AgentRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ResetFailedLogins(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			for i := 0; i < loginRateLimit.Limit; i++ {
+				_, err := server.rateLimiter.Allow(context.Background(), loginRateLimit, strings.ToLower(user.Email))
+				require.NoError(t, err)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/unlock", user.ID)
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			request.RemoteAddr = "192.0.2.10:4321"
+			request.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(tc.role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server)
+		})
+	}
+}
+
+func requireLockoutResponse(t *testing.T, recorder *httptest.ResponseRecorder) lockoutResponse {
+	var res lockoutResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	return res
+}
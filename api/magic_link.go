@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	magicLinkPurpose         = token.PurposeMagicLink
+	defaultMagicLinkDuration = 15 * time.Minute
+	// magicLinkCookie holds the secret a magic link is bound to, in the browser that asked for the link
+	magicLinkCookie     = "magic_link_binding"
+	magicLinkCookiePath = "/api/v1/users/login/magic-link"
+)
+
+var (
+	errInvalidMagicLink      = errors.New("sign in link is invalid or has expired")
+	errMagicLinkOtherBrowser = errors.New("sign in link must be opened in the browser it was requested from")
+)
+
+type sendMagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type sendMagicLinkResponse struct {
+	Message string `json:"message"`
+}
+
+// sendMagicLink emails a link that signs the user in without their password. The link only works in the
+// browser that asked for it, which is given a cookie to prove it. It responds the same way whether or not the
+// email belongs to a user, so that it can't be used to find out who has an account.
+func (server *Server) sendMagicLink(ctx *gin.Context) {
+	var req sendMagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	res := sendMagicLinkResponse{
+		Message: "if an account exists for this email, a sign in link has been sent to it",
+	}
+
+	binding, bindingHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// every request gets a cookie, so its absence doesn't reveal anything either
+	server.setMagicLinkCookie(ctx, binding, int(server.magicLinkDuration().Seconds()))
+
+	// limited requests get the same response so the limit doesn't reveal anything either
+	rateLimitIdentity := strings.ToLower(strings.TrimSpace(req.Email))
+	result, err := server.rateLimiter.Allow(ctx, magicLinkRateLimit, rateLimitIdentity)
+	if applyRateLimit(ctx, magicLinkRateLimit, result, err) != nil {
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, req.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the email is sent after responding, so that the response time doesn't reveal that the account exists
+	ctx.JSON(http.StatusOK, res)
+	server.runInBackground(func(ctx context.Context) {
+		err := server.sendMagicLinkEmail(ctx, user, bindingHash)
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to send magic link email")
+		}
+	})
+}
+
+func (server *Server) magicLinkDuration() time.Duration {
+	if server.config.MagicLinkDuration == 0 {
+		return defaultMagicLinkDuration
+	}
+	return server.config.MagicLinkDuration
+}
+
+// setMagicLinkCookie sets the cookie a magic link is bound to, for maxAge seconds. A negative maxAge removes it.
+func (server *Server) setMagicLinkCookie(ctx *gin.Context, value string, maxAge int) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     magicLinkCookie,
+		Value:    value,
+		Path:     magicLinkCookiePath,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sendMagicLinkEmail emails a user a signed link to sign in with. Earlier links stop working, and the
+// new one only works with the binding whose hash is given.
+func (server *Server) sendMagicLinkEmail(ctx context.Context, user db.Users, bindingHash string) error {
+	err := server.store.InvalidateVerificationTokens(ctx, db.InvalidateVerificationTokensParams{
+		UserID:  user.ID,
+		Purpose: magicLinkPurpose,
+	})
+	if err != nil {
+		return err
+	}
+
+	duration := server.magicLinkDuration()
+	rawToken, payload, err := server.tokenMaker.CreateToken(user.ID, duration, token.WithPurpose(token.PurposeMagicLink))
+	if err != nil {
+		return err
+	}
+
+	// the token is signed, and also stored so that it can only be used once
+	_, err = server.store.CreateVerificationToken(ctx, db.CreateVerificationTokenParams{
+		UserID:      user.ID,
+		TokenHash:   util.HashVerificationToken(rawToken),
+		Purpose:     magicLinkPurpose,
+		ExpiresAt:   payload.ExpiredAt,
+		BindingHash: sql.NullString{String: bindingHash, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	return server.mailer.Send(ctx, mailer.Email{
+		To:      user.Email,
+		Subject: "Your sign in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYou can sign in by opening the link below in the browser you asked for it from. "+
+				"It works once and expires in %d minutes. If you didn't ask for this, you can ignore this email.\n\n%s\n",
+			user.FirstName,
+			int(duration.Minutes()),
+			server.appLink("/magic-link", rawToken),
+		),
+	})
+}
+
+type loginMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// loginMagicLink signs a user in with the token of a magic link. The link stands in for the password, so the
+// response is the same as for a password login.
+func (server *Server) loginMagicLink(ctx *gin.Context) {
+	var req loginMagicLinkRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(req.Token)
+	if err != nil || payload.Purpose != token.PurposeMagicLink {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+		return
+	}
+
+	magicLink, err := server.store.GetVerificationToken(ctx, db.GetVerificationTokenParams{
+		TokenHash: util.HashVerificationToken(req.Token),
+		Purpose:   magicLinkPurpose,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if magicLink.UsedAt.Valid || time.Now().After(magicLink.ExpiresAt) || magicLink.UserID != payload.UserId {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+		return
+	}
+
+	// a link that leaked from the inbox is no use without the cookie of the browser that asked for it. The
+	// link isn't used up, so the right browser can still open it.
+	binding, err := ctx.Cookie(magicLinkCookie)
+	if err != nil || !magicLink.BindingHash.Valid ||
+		subtle.ConstantTimeCompare([]byte(util.HashVerificationToken(binding)), []byte(magicLink.BindingHash.String)) != 1 {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errMagicLinkOtherBrowser))
+		return
+	}
+
+	_, err = server.store.UseVerificationToken(ctx, magicLink.ID)
+	if err != nil {
+		// the link was used by a concurrent request
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidMagicLink))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.setMagicLinkCookie(ctx, "", -1)
+
+	user, err := server.store.GetUserById(ctx, magicLink.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.loginFederatedUser(ctx, user)
+}
@@ -0,0 +1,457 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// magicLinkCookieOf returns the binding cookie set by a response
+func magicLinkCookieOf(t *testing.T, recorder *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == magicLinkCookie {
+			return cookie
+		}
+	}
+	require.FailNow(t, "magic link cookie not set")
+	return nil
+}
+
+func TestSendMagicLinkAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore, bindingHash *string)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, bindingHash string, mailDir string)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"email": user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore, bindingHash *string) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Eq(db.InvalidateVerificationTokensParams{
+						UserID:  user.ID,
+						Purpose: magicLinkPurpose,
+					})).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.CreateVerificationTokenParams) (db.VerificationTokens, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, magicLinkPurpose, arg.Purpose)
+						require.WithinDuration(t, time.Now().Add(defaultMagicLinkDuration), arg.ExpiresAt, time.Minute)
+						require.True(t, arg.BindingHash.Valid)
+						*bindingHash = arg.BindingHash.String
+						return db.VerificationTokens{UserID: arg.UserID, TokenHash: arg.TokenHash}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, bindingHash string, mailDir string) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				cookie := magicLinkCookieOf(t, recorder)
+				require.Equal(t, bindingHash, util.HashVerificationToken(cookie.Value))
+				require.True(t, cookie.HttpOnly)
+				require.True(t, cookie.Secure)
+
+				files, err := os.ReadDir(mailDir)
+				require.NoError(t, err)
+				require.Len(t, files, 1)
+
+				data, err := os.ReadFile(filepath.Join(mailDir, files[0].Name()))
+				require.NoError(t, err)
+				require.Contains(t, string(data), "/magic-link?token=")
+			},
+		},
+		{
+			name: "Unknown Email",
+			body: gin.H{
+				"email": "randomuser@email.com",
+			},
+			buildStubs: func(store *mockdb.MockStore, bindingHash *string) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, bindingHash string, mailDir string) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				magicLinkCookieOf(t, recorder)
+
+				files, err := os.ReadDir(mailDir)
+				require.NoError(t, err)
+				require.Empty(t, files)
+			},
+		},
+		{
+			name: "Invalid Email",
+			body: gin.H{
+				"email": "invalid-email",
+			},
+			buildStubs: func(store *mockdb.MockStore, bindingHash *string) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, bindingHash string, mailDir string) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var bindingHash string
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store, &bindingHash)
+
+			server := newTestServer(t, store)
+
+			mailDir := t.TempDir()
+			fileMailer, err := mailer.NewFileMailer(mailDir, "no-reply@travel.agency")
+			require.NoError(t, err)
+			server.mailer = fileMailer
+
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login/magic-link/send", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			server.background.Wait()
+			tc.checkResponse(t, recorder, bindingHash, mailDir)
+		})
+	}
+}
+
+func TestLoginMagicLinkAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	binding, bindingHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		createToken   func(t *testing.T, tokenMaker token.Maker) string
+		cookie        string
+		buildStubs    func(store *mockdb.MockStore, magicLink db.VerificationTokens)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Eq(db.GetVerificationTokenParams{
+						TokenHash: magicLink.TokenHash,
+						Purpose:   magicLinkPurpose,
+					})).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Eq(magicLink.ID)).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res loginUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.Equal(t, user.Email, res.User.Email)
+
+				// the binding is removed with the link
+				require.True(t, magicLinkCookieOf(t, recorder).MaxAge < 0)
+			},
+		},
+		{
+			name:   "Two Factor Enabled",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				twoFactorUser := user
+				twoFactorUser.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(twoFactorUser, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res twoFactorChallengeResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.ChallengeToken)
+			},
+		},
+		{
+			name:   "Other Browser",
+			cookie: "another-browser",
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Contains(t, recorder.Body.String(), errMagicLinkOtherBrowser.Error())
+			},
+		},
+		{
+			name: "No Cookie",
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Used Link",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				magicLink.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Contains(t, recorder.Body.String(), errInvalidMagicLink.Error())
+			},
+		},
+		{
+			name:   "Used Concurrently",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerificationTokens{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Unknown Link",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerificationTokens{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Expired Token",
+			cookie: binding,
+			createToken: func(t *testing.T, tokenMaker token.Maker) string {
+				rawToken, _, err := tokenMaker.CreateToken(user.ID, -time.Minute, token.WithPurpose(token.PurposeMagicLink))
+				require.NoError(t, err)
+				return rawToken
+			},
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Access Token",
+			cookie: binding,
+			createToken: func(t *testing.T, tokenMaker token.Maker) string {
+				rawToken, _, err := tokenMaker.CreateToken(user.ID, time.Minute, withTestRole(user.Role))
+				require.NoError(t, err)
+				return rawToken
+			},
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Locked Out",
+			cookie: binding,
+			buildStubs: func(store *mockdb.MockStore, magicLink db.VerificationTokens) {
+				lockedUser := user
+				lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					UseVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(magicLink, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(lockedUser, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			var rawToken string
+			if tc.createToken != nil {
+				rawToken = tc.createToken(t, server.tokenMaker)
+			} else {
+				rawToken, _, err = server.tokenMaker.CreateToken(user.ID, time.Minute, token.WithPurpose(token.PurposeMagicLink))
+				require.NoError(t, err)
+			}
+
+			magicLink := db.VerificationTokens{
+				ID:          util.RandomInt(1, 1000),
+				UserID:      user.ID,
+				TokenHash:   util.HashVerificationToken(rawToken),
+				Purpose:     magicLinkPurpose,
+				ExpiresAt:   time.Now().Add(time.Minute),
+				BindingHash: sql.NullString{String: bindingHash, Valid: true},
+			}
+			tc.buildStubs(store, magicLink)
+
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(gin.H{"token": rawToken})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login/magic-link", bytes.NewReader(data))
+			require.NoError(t, err)
+			if tc.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: magicLinkCookie, Value: tc.cookie})
+			}
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestMagicLinkIsNotAnAccessToken(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUserById(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+	rawToken, _, err := server.tokenMaker.CreateToken(user.ID, time.Minute, token.WithPurpose(token.PurposeMagicLink))
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/users/%d", user.ID), nil)
+	require.NoError(t, err)
+	request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" "+rawToken)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
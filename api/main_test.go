@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
 	db "github.com/sajitron/travel-agency/db/sqlc"
 	"github.com/sajitron/travel-agency/util"
 	"github.com/stretchr/testify/require"
@@ -13,11 +15,23 @@ import (
 
 func newTestServer(t *testing.T, store db.Store) *Server {
 	config := util.Config{
-		TokenSymmetricKey:   util.RandomString(32),
-		AccessTokenDuration: time.Minute,
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+		TOTPEncryptionKey:    util.RandomString(32),
+		MailerType:           mailerTypeLog,
 	}
 
-	server, err := NewServer(config, store)
+	// tokens are checked against the last password change on every request. Most tests aren't about it,
+	// so unless a test expects the lookup itself, every password is taken to be unchanged.
+	if mockStore, ok := store.(*mockdb.MockStore); ok {
+		mockStore.EXPECT().
+			GetUserPasswordChangedAt(gomock.Any(), gomock.Any()).
+			AnyTimes().
+			Return(time.Time{}, nil)
+	}
+
+	server, err := NewServer(config, store, nil)
 	require.NoError(t, err)
 
 	return server
@@ -1,23 +1,32 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/ratelimit"
 	"github.com/sajitron/travel-agency/token"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
+	authorizationTypeAPIKey = "apikey"
 	authorizationPayloadKey = "authorization_payload"
+	requestIDHeaderKey      = "X-Request-ID"
+	requestIDKey            = "request_id"
+	maxRequestIDLength      = 64
 )
 
-// authMiddleware creates a gin middleware for authorization
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+// authMiddleware creates a gin middleware for authorization. Requests are authorized either with an access token
+// or with an API key, and both put a payload into the context under authorizationPayloadKey.
+func authMiddleware(tokenMaker token.Maker, revocations token.RevocationStore, store db.Store) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -36,21 +45,181 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 		}
 
 		// check authentication type
+		var payload *token.Payload
+		var status int
+		var err error
+
 		authorizationType := strings.ToLower(fields[0])
-		if authorizationType != authorizationTypeBearer {
-			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		switch authorizationType {
+		case authorizationTypeBearer:
+			payload, status, err = verifyAccessToken(ctx, tokenMaker, revocations, store, fields[1])
+		case authorizationTypeAPIKey:
+			payload, status, err = verifyAPIKey(ctx, store, fields[1])
+		default:
+			status, err = http.StatusUnauthorized, fmt.Errorf("unsupported authorization type %s", authorizationType)
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(status, errorResponse(err))
 			return
 		}
 
-		accessToken := fields[1]
-		payload, err := tokenMaker.VerifyToken(accessToken)
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// verifyAccessToken returns the payload of an access token, or the status to respond with if it's refused
+func verifyAccessToken(
+	ctx *gin.Context,
+	tokenMaker token.Maker,
+	revocations token.RevocationStore,
+	store db.Store,
+	accessToken string,
+) (*token.Payload, int, error) {
+	payload, err := tokenMaker.VerifyToken(accessToken)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	// refresh tokens, challenge tokens and other single purpose tokens don't grant access
+	if payload.Purpose != "" {
+		return nil, http.StatusUnauthorized, errors.New("token cannot be used for authorization")
+	}
+
+	revoked, err := token.IsPayloadRevoked(ctx, revocations, payload)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if revoked {
+		return nil, http.StatusUnauthorized, errors.New("token has been revoked")
+	}
+
+	// the revocation store may have lost a password change, as the memory one does on restart, so the
+	// database has the last word. An impersonation ends with a password change of the admin too.
+	userIds := []int64{payload.UserId}
+	if payload.IsImpersonated() {
+		userIds = append(userIds, payload.ImpersonatorID)
+	}
+	for _, userId := range userIds {
+		passwordChangedAt, err := store.GetUserPasswordChangedAt(ctx, userId)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			if err == sql.ErrNoRows {
+				return nil, http.StatusUnauthorized, errors.New("user of the token no longer exists")
+			}
+			return nil, http.StatusInternalServerError, err
+		}
+		if payload.IssuedAt.Before(passwordChangedAt) {
+			return nil, http.StatusUnauthorized, errors.New("token has been revoked")
+		}
+	}
+	return payload, http.StatusOK, nil
+}
+
+// requirePermission creates a gin middleware that rejects tokens which don't grant a permission.
+// It must run after authMiddleware.
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if !payload.HasPermission(permission) {
+			err := fmt.Errorf("missing permission %s", permission)
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requireFirstParty creates a gin middleware that rejects requests made with an API key or an OAuth client's
+// token, for routes that must stay out of reach of a leaked key whatever its scopes. Admins impersonating the
+// user are rejected too. It must run after authMiddleware.
+func requireFirstParty() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		if payload.IsDelegated() {
+			err := errors.New("this endpoint cannot be used with an API key or an OAuth token")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		if payload.IsImpersonated() {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errImpersonationDenied))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requireVerifiedEmail creates a gin middleware that rejects users who haven't verified their email.
+// It must run after authMiddleware.
+func requireVerifiedEmail(store db.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+		user, err := store.GetUserById(ctx, payload.UserId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		if !user.EmailVerifiedAt.Valid {
+			err := errors.New("email address has not been verified")
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(err))
 			return
 		}
 
-		ctx.Set(authorizationPayloadKey, payload)
 		ctx.Next()
 	}
 }
+
+// canAccessUser checks if a token belongs to a user or grants a permission over every user.
+// API keys and OAuth clients only reach what their scopes grant, even on the account of the user they act for.
+func canAccessUser(payload *token.Payload, userId int64, permission string) bool {
+	return (payload.UserId == userId && !payload.IsDelegated()) || payload.HasPermission(permission)
+}
+
+// rateLimitMiddleware creates a gin middleware that counts every request against a policy.
+// keyFunc picks what requests are counted together, e.g. clientIPKey.
+func rateLimitMiddleware(limiter ratelimit.RateLimiter, policy ratelimit.Policy, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result, err := limiter.Allow(ctx, policy, keyFunc(ctx))
+		if err := applyRateLimit(ctx, policy, result, err); err != nil {
+			ctx.AbortWithStatusJSON(rateLimitStatus(err), errorResponse(err))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// requestIDMiddleware creates a gin middleware that gives every request an ID, to tie its logs and audit events
+// together. An ID sent by a proxy in front of the server is kept if it looks sane, otherwise a new one is made.
+// The ID is echoed in the response and put into the context under requestIDKey.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(requestIDHeaderKey)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		ctx.Set(requestIDKey, requestID)
+		ctx.Header(requestIDHeaderKey, requestID)
+		ctx.Next()
+	}
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,517 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+// Supported OAuth grant types
+const (
+	oauthGrantAuthorizationCode = "authorization_code"
+	oauthGrantClientCredentials = "client_credentials"
+)
+
+// OAuth error codes, see RFC 6749 sections 4.1.2.1 and 5.2
+const (
+	oauthErrorInvalidRequest          = "invalid_request"
+	oauthErrorInvalidClient           = "invalid_client"
+	oauthErrorInvalidGrant            = "invalid_grant"
+	oauthErrorInvalidScope            = "invalid_scope"
+	oauthErrorUnauthorizedClient      = "unauthorized_client"
+	oauthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	oauthErrorUnsupportedResponseType = "unsupported_response_type"
+	oauthErrorAccessDenied            = "access_denied"
+)
+
+// oauthCodeDuration is how long an authorization code can be exchanged for a token
+const oauthCodeDuration = 5 * time.Minute
+
+// oauthScopes are the permissions third-party apps can ask for. A scope grants the permission of the same name.
+// Permissions over the account itself, such as managing roles, sessions or API keys, are never delegated.
+var oauthScopes = map[string]bool{
+	util.PermissionBookingsRead:  true,
+	util.PermissionBookingsWrite: true,
+	util.PermissionUsersRead:     true,
+}
+
+// oauthErrorResponse formats an error the way OAuth clients expect it
+func oauthErrorResponse(code string, description string) gin.H {
+	return gin.H{"error": code, "error_description": description}
+}
+
+type oauthAuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type" binding:"required"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+type oauthConsentRequest struct {
+	oauthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+type oauthClientSummary struct {
+	ClientID string `json:"client_id"`
+	Name     string `json:"name"`
+}
+
+type oauthAuthorizeResponse struct {
+	// RedirectTo is where the user's browser should go next, with either a code or an error
+	RedirectTo      string              `json:"redirect_to,omitempty"`
+	ConsentRequired bool                `json:"consent_required"`
+	Client          *oauthClientSummary `json:"client,omitempty"`
+	Scopes          []string            `json:"scopes,omitempty"`
+}
+
+// oauthAuthorization is an authorization request that has been checked
+type oauthAuthorization struct {
+	client        db.OauthClients
+	redirectURI   string
+	scopes        []string
+	state         string
+	codeChallenge string
+}
+
+// oauthAuthorize starts the authorization code flow for the signed in user. It issues a code right away if the
+// user already consented to every scope asked for, and otherwise describes the consent the user has to give.
+func (server *Server) oauthAuthorize(ctx *gin.Context) {
+	var req oauthAuthorizeRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, err.Error()))
+		return
+	}
+
+	authorization, ok := server.checkAuthorizeRequest(ctx, req)
+	if !ok {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	consent, err := server.store.GetOAuthConsent(ctx, db.GetOAuthConsentParams{
+		UserID:   authPayload.UserId,
+		ClientID: authorization.client.ID,
+	})
+	if err != nil && err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if err == nil && containsAllStrings(consent.Scopes, authorization.scopes) {
+		server.issueAuthorizationCode(ctx, authPayload.UserId, authorization)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, oauthAuthorizeResponse{
+		ConsentRequired: true,
+		Client: &oauthClientSummary{
+			ClientID: authorization.client.ID,
+			Name:     authorization.client.Name,
+		},
+		Scopes: authorization.scopes,
+	})
+}
+
+// oauthConsent records the signed in user's answer to an authorization request. An approval is remembered, so the
+// app isn't asked about the same scopes again, and a code is issued.
+func (server *Server) oauthConsent(ctx *gin.Context) {
+	var req oauthConsentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, err.Error()))
+		return
+	}
+
+	authorization, ok := server.checkAuthorizeRequest(ctx, req.oauthAuthorizeRequest)
+	if !ok {
+		return
+	}
+
+	if !req.Approve {
+		ctx.JSON(http.StatusOK, oauthAuthorizeResponse{
+			RedirectTo: oauthRedirect(authorization.redirectURI, authorization.state, url.Values{
+				"error":             {oauthErrorAccessDenied},
+				"error_description": {"the user denied the request"},
+			}),
+		})
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// scopes consented to earlier are kept, so approving a narrower request doesn't take any away
+	scopes := authorization.scopes
+	consent, err := server.store.GetOAuthConsent(ctx, db.GetOAuthConsentParams{
+		UserID:   authPayload.UserId,
+		ClientID: authorization.client.ID,
+	})
+	if err == nil {
+		scopes = uniqueStrings(append(consent.Scopes, scopes...))
+	} else if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = server.store.UpsertOAuthConsent(ctx, db.UpsertOAuthConsentParams{
+		UserID:   authPayload.UserId,
+		ClientID: authorization.client.ID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.issueAuthorizationCode(ctx, authPayload.UserId, authorization)
+}
+
+// checkAuthorizeRequest checks an authorization request and responds with an error if it's refused.
+// Until the client and its redirect URI are known good, errors are shown to the user instead of being
+// sent to the redirect URI, so that they can't be used to send users anywhere.
+func (server *Server) checkAuthorizeRequest(ctx *gin.Context, req oauthAuthorizeRequest) (oauthAuthorization, bool) {
+	client, err := server.store.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidClient, "unknown client"))
+			return oauthAuthorization{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return oauthAuthorization{}, false
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !containsString(client.RedirectUris, redirectURI) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, "redirect_uri is not registered for this client"))
+		return oauthAuthorization{}, false
+	}
+
+	redirectError := func(code string, description string) (oauthAuthorization, bool) {
+		res := oauthErrorResponse(code, description)
+		res["redirect_to"] = oauthRedirect(redirectURI, req.State, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		})
+		ctx.JSON(http.StatusBadRequest, res)
+		return oauthAuthorization{}, false
+	}
+
+	if req.ResponseType != "code" {
+		return redirectError(oauthErrorUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !containsString(client.GrantTypes, oauthGrantAuthorizationCode) {
+		return redirectError(oauthErrorUnauthorizedClient, "the client may not use the authorization code grant")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != util.PKCEMethodS256 {
+		return redirectError(oauthErrorInvalidRequest, "PKCE with the S256 method is required")
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = uniqueStrings(strings.Fields(req.Scope))
+		if !containsAllStrings(client.Scopes, scopes) {
+			return redirectError(oauthErrorInvalidScope, "the client may not ask for some of the scopes")
+		}
+	}
+
+	return oauthAuthorization{
+		client:        client,
+		redirectURI:   redirectURI,
+		scopes:        scopes,
+		state:         req.State,
+		codeChallenge: req.CodeChallenge,
+	}, true
+}
+
+// issueAuthorizationCode stores a new code for an authorization and responds with the redirect that delivers it
+func (server *Server) issueAuthorizationCode(ctx *gin.Context, userID int64, authorization oauthAuthorization) {
+	code, codeHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	_, err = server.store.CreateOAuthAuthorizationCode(ctx, db.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      codeHash,
+		ClientID:      authorization.client.ID,
+		UserID:        userID,
+		RedirectUri:   authorization.redirectURI,
+		Scopes:        authorization.scopes,
+		CodeChallenge: authorization.codeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, oauthAuthorizeResponse{
+		RedirectTo: oauthRedirect(authorization.redirectURI, authorization.state, url.Values{"code": {code}}),
+	})
+}
+
+// oauthRedirect adds parameters and the client's state to a redirect URI
+func oauthRedirect(redirectURI string, state string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type oauthTokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthToken is the token endpoint. It exchanges authorization codes and the credentials of machine clients
+// for access tokens made by the server's token maker.
+func (server *Server) oauthToken(ctx *gin.Context) {
+	var req oauthTokenRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, err.Error()))
+		return
+	}
+
+	switch req.GrantType {
+	case oauthGrantAuthorizationCode:
+		server.exchangeAuthorizationCode(ctx, req)
+	case oauthGrantClientCredentials:
+		server.exchangeClientCredentials(ctx, req)
+	default:
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorUnsupportedGrantType, "unsupported grant_type"))
+	}
+}
+
+// exchangeAuthorizationCode issues a token for the user who approved a code. The code is used up by the first
+// attempt, whether or not it succeeds.
+func (server *Server) exchangeAuthorizationCode(ctx *gin.Context, req oauthTokenRequest) {
+	client, ok := server.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if !ok {
+		return
+	}
+
+	if !containsString(client.GrantTypes, oauthGrantAuthorizationCode) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorUnauthorizedClient, "the client may not use the authorization code grant"))
+		return
+	}
+	// every code is bound to a redirect URI, so the client must always send it back (RFC 6749 section 4.1.3)
+	if req.Code == "" || req.CodeVerifier == "" || req.RedirectURI == "" {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidRequest, "code, code_verifier and redirect_uri are required"))
+		return
+	}
+
+	code, err := server.store.UseOAuthAuthorizationCode(ctx, util.HashVerificationToken(req.Code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidGrant, "code is invalid, expired or already used"))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if code.ClientID != client.ID || time.Now().After(code.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidGrant, "code is invalid, expired or already used"))
+		return
+	}
+	if req.RedirectURI != code.RedirectUri {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidGrant, "redirect_uri does not match the authorization request"))
+		return
+	}
+	if !util.VerifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidGrant, "code_verifier does not match the code challenge"))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, code.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidGrant, "the user no longer exists"))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.issueOAuthToken(ctx, user, client, code.Scopes)
+}
+
+// exchangeClientCredentials issues a token to a machine client. It acts for the user who registered it.
+func (server *Server) exchangeClientCredentials(ctx *gin.Context, req oauthTokenRequest) {
+	client, ok := server.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if !ok {
+		return
+	}
+
+	if !client.SecretHash.Valid || !containsString(client.GrantTypes, oauthGrantClientCredentials) {
+		ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorUnauthorizedClient, "the client may not use the client credentials grant"))
+		return
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = uniqueStrings(strings.Fields(req.Scope))
+		if !containsAllStrings(client.Scopes, scopes) {
+			ctx.JSON(http.StatusBadRequest, oauthErrorResponse(oauthErrorInvalidScope, "the client may not ask for some of the scopes"))
+			return
+		}
+	}
+
+	owner, err := server.store.GetUserById(ctx, client.UserID)
+	if err != nil {
+		// a client can't act for an owner who no longer exists
+		if err == sql.ErrNoRows {
+			rejectOAuthClient(ctx)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.issueOAuthToken(ctx, owner, client, scopes)
+}
+
+// authenticateOAuthClient finds the client making a request, from HTTP basic authentication or else from the
+// client_id and client_secret form fields. Confidential clients must prove their secret, public clients must not
+// send one. It responds with an error if the client can't be authenticated.
+func (server *Server) authenticateOAuthClient(ctx *gin.Context, formClientID string, formClientSecret string) (db.OauthClients, bool) {
+	clientID, clientSecret, basicAuth := ctx.Request.BasicAuth()
+	if basicAuth {
+		// basic credentials are form encoded first, see RFC 6749 section 2.3.1
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = formClientID, formClientSecret
+	}
+
+	reject := func() (db.OauthClients, bool) {
+		rejectOAuthClient(ctx)
+		return db.OauthClients{}, false
+	}
+
+	if clientID == "" {
+		return reject()
+	}
+
+	client, err := server.store.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return reject()
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.OauthClients{}, false
+	}
+
+	if client.SecretHash.Valid {
+		secretHash := util.HashVerificationToken(clientSecret)
+		if clientSecret == "" || subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash.String)) != 1 {
+			return reject()
+		}
+	} else if clientSecret != "" {
+		return reject()
+	}
+	return client, true
+}
+
+// rejectOAuthClient responds that the client making a request couldn't be authenticated
+func rejectOAuthClient(ctx *gin.Context) {
+	if _, _, basicAuth := ctx.Request.BasicAuth(); basicAuth {
+		ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	ctx.JSON(http.StatusUnauthorized, oauthErrorResponse(oauthErrorInvalidClient, "client authentication failed"))
+}
+
+// issueOAuthToken responds with an access token that lets a client act for a user. It only grants the scopes
+// that the user's role grants.
+func (server *Server) issueOAuthToken(ctx *gin.Context, user db.Users, client db.OauthClients, scopes []string) {
+	permissions := scopedPermissions(scopes, user.Role)
+
+	accessToken, _, err := server.tokenMaker.CreateToken(
+		user.ID,
+		server.config.AccessTokenDuration,
+		token.WithRole(user.Role, permissions),
+		token.WithClientID(client.ID),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+	ctx.JSON(http.StatusOK, oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(server.config.AccessTokenDuration / time.Second),
+		Scope:       strings.Join(permissions, " "),
+	})
+}
+
+// containsString checks if a list holds a string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAllStrings checks if a list holds every string of another
+func containsAllStrings(list []string, subset []string) bool {
+	for _, s := range subset {
+		if !containsString(list, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueStrings drops repeated strings from a list, keeping the order
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	unique := make([]string, 0, len(list))
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
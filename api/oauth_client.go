@@ -0,0 +1,312 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"dive,required"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,required"`
+	// GrantTypes defaults to the authorization code grant
+	GrantTypes []string `json:"grant_types" binding:"dive,oneof=authorization_code client_credentials"`
+	// Confidential clients get a secret. Apps that can't keep one, such as mobile apps, rely on PKCE alone.
+	Confidential bool `json:"confidential"`
+}
+
+type oauthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grant_types"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// newOAuthClientResponse returns the fields of a client that are safe to show to its owner
+func newOAuthClientResponse(client db.OauthClients) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		GrantTypes:   client.GrantTypes,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+type createOAuthClientResponse struct {
+	// ClientSecret is only ever shown in this response
+	ClientSecret string              `json:"client_secret,omitempty"`
+	Client       oauthClientResponse `json:"client"`
+}
+
+// createOAuthClient registers a third-party app for the user making the request
+func (server *Server) createOAuthClient(ctx *gin.Context) {
+	var req createOAuthClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	grantTypes := uniqueStrings(req.GrantTypes)
+	if len(grantTypes) == 0 {
+		grantTypes = []string{oauthGrantAuthorizationCode}
+	}
+	scopes := uniqueStrings(req.Scopes)
+
+	for _, scope := range scopes {
+		if !oauthScopes[scope] {
+			ctx.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("unsupported scope %s", scope)))
+			return
+		}
+	}
+
+	for _, redirectURI := range req.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+	if containsString(grantTypes, oauthGrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		err := errors.New("the authorization code grant needs at least one redirect URI")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// a machine client acts for the user who registered it, so it can't be granted more than they have
+	if containsString(grantTypes, oauthGrantClientCredentials) {
+		if !req.Confidential {
+			err := errors.New("the client credentials grant is only open to confidential clients")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		for _, scope := range scopes {
+			if !authPayload.HasPermission(scope) {
+				err := fmt.Errorf("scope %s is not granted to the %s role", scope, authPayload.Role)
+				ctx.JSON(http.StatusBadRequest, errorResponse(err))
+				return
+			}
+		}
+	}
+
+	arg := db.CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		UserID:       authPayload.UserId,
+		Name:         req.Name,
+		RedirectUris: uniqueStrings(req.RedirectURIs),
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+	}
+
+	var clientSecret string
+	if req.Confidential {
+		secret, secretHash, err := util.GenerateVerificationToken()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		clientSecret = secret
+		arg.SecretHash = sql.NullString{String: secretHash, Valid: true}
+	}
+
+	client, err := server.store.CreateOAuthClient(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionOAuthClientCreate
+	event.TargetType = db.AuditTargetOAuthClient
+	event.TargetID = client.ID
+	event.After = client
+	server.recordAuditEvent(ctx, event)
+
+	ctx.JSON(http.StatusOK, createOAuthClientResponse{
+		ClientSecret: clientSecret,
+		Client:       newOAuthClientResponse(client),
+	})
+}
+
+// listOAuthClients lists the apps registered by the user making the request
+func (server *Server) listOAuthClients(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	clients, err := server.store.ListOAuthClients(ctx, authPayload.UserId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]oauthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		res = append(res, newOAuthClientResponse(client))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type oauthClientParam struct {
+	ClientID string `uri:"client_id" binding:"required"`
+}
+
+// deleteOAuthClient deletes an app registered by the user making the request, along with its codes and consents.
+// Access tokens already issued to it run until they expire.
+func (server *Server) deleteOAuthClient(ctx *gin.Context) {
+	var urlParam oauthClientParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	// clients of other users are not found
+	client, err := server.store.DeleteOAuthClient(ctx, db.DeleteOAuthClientParams{
+		ID:     urlParam.ClientID,
+		UserID: authPayload.UserId,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionOAuthClientDelete
+	event.TargetType = db.AuditTargetOAuthClient
+	event.TargetID = client.ID
+	event.Before = client
+	server.recordAuditEvent(ctx, event)
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type oauthConsentResponse struct {
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type userOAuthConsentsParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// listOAuthConsents lists the apps a user has let act for them
+func (server *Server) listOAuthConsents(ctx *gin.Context) {
+	var urlParam userOAuthConsentsParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersRead) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	consents, err := server.store.ListOAuthConsents(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]oauthConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		res = append(res, oauthConsentResponse{
+			ClientID:  consent.ClientID,
+			Scopes:    consent.Scopes,
+			CreatedAt: consent.CreatedAt,
+			UpdatedAt: consent.UpdatedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type revokeOAuthConsentParam struct {
+	ID       int64  `uri:"id" binding:"required,min=1"`
+	ClientID string `uri:"client_id" binding:"required"`
+}
+
+// revokeOAuthConsent withdraws the consent a user gave an app. The app has to ask again before it gets another code.
+func (server *Server) revokeOAuthConsent(ctx *gin.Context) {
+	var urlParam revokeOAuthConsentParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersWrite) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	_, err := server.store.DeleteOAuthConsent(ctx, db.DeleteOAuthConsentParams{
+		UserID:   urlParam.ID,
+		ClientID: urlParam.ClientID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// validateRedirectURI checks that a redirect URI can be registered. Codes are only sent over HTTPS, to a loopback
+// address for apps running on the user's machine, or to a private-use scheme such as com.example.app:/callback
+// for mobile apps, see RFC 8252.
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("redirect URI %s must be absolute", redirectURI)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %s must not have a fragment", redirectURI)
+	}
+
+	switch {
+	case u.Scheme == "https" && u.Host != "":
+		return nil
+	case u.Scheme == "http" && isLoopbackHost(u.Hostname()):
+		return nil
+	case strings.Contains(u.Scheme, ".") && u.Host == "":
+		return nil
+	}
+	return fmt.Errorf("redirect URI %s must use https, a loopback address or a private-use scheme", redirectURI)
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,1013 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://partner.example.com/callback"
+
+// randomOAuthClient returns a client of a user. A confidential client also gets its secret.
+func randomOAuthClient(t *testing.T, user db.Users, confidential bool, grantTypes ...string) (string, db.OauthClients) {
+	client := db.OauthClients{
+		ID:           util.RandomString(16),
+		UserID:       user.ID,
+		Name:         util.RandomString(8),
+		RedirectUris: []string{testRedirectURI},
+		Scopes:       []string{util.PermissionBookingsRead, util.PermissionUsersRead},
+		GrantTypes:   grantTypes,
+		CreatedAt:    time.Now(),
+	}
+
+	if !confidential {
+		return "", client
+	}
+
+	secret, secretHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+	client.SecretHash = sql.NullString{String: secretHash, Valid: true}
+	return secret, client
+}
+
+func TestCreateOAuthClientAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.AgentRole
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	expectVerifiedEmail := func(store *mockdb.MockStore) {
+		store.EXPECT().
+			GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+			Times(1).
+			Return(user, nil)
+	}
+
+	expectClientAuditEvent := func(store *mockdb.MockStore) {
+		store.EXPECT().
+			CreateAuditEventTx(gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+				require.Equal(t, db.AuditActionOAuthClientCreate, arg.Action)
+				require.Equal(t, db.AuditTargetOAuthClient, arg.TargetType)
+				require.Equal(t, arg.After.(db.OauthClients).ID, arg.TargetID)
+				return db.AuditEvents{}, nil
+			})
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Public Client",
+			body: gin.H{
+				"name":          "partner app",
+				"redirect_uris": []string{testRedirectURI, "com.example.app:/callback"},
+				"scopes":        []string{util.PermissionBookingsRead},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOAuthClientParams) (db.OauthClients, error) {
+						require.NotEmpty(t, arg.ID)
+						require.Equal(t, user.ID, arg.UserID)
+						require.False(t, arg.SecretHash.Valid)
+						require.Equal(t, []string{oauthGrantAuthorizationCode}, arg.GrantTypes)
+
+						return db.OauthClients{
+							ID:           arg.ID,
+							UserID:       arg.UserID,
+							Name:         arg.Name,
+							RedirectUris: arg.RedirectUris,
+							Scopes:       arg.Scopes,
+							GrantTypes:   arg.GrantTypes,
+						}, nil
+					})
+				expectClientAuditEvent(store)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res createOAuthClientResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Empty(t, res.ClientSecret)
+				require.False(t, res.Client.Confidential)
+			},
+		},
+		{
+			name: "Confidential Client",
+			body: gin.H{
+				"name":         "partner backend",
+				"scopes":       []string{util.PermissionBookingsRead},
+				"grant_types":  []string{oauthGrantClientCredentials},
+				"confidential": true,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOAuthClientParams) (db.OauthClients, error) {
+						require.True(t, arg.SecretHash.Valid)
+
+						return db.OauthClients{
+							ID:         arg.ID,
+							SecretHash: arg.SecretHash,
+							GrantTypes: arg.GrantTypes,
+						}, nil
+					})
+				expectClientAuditEvent(store)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res createOAuthClientResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.ClientSecret)
+				require.True(t, res.Client.Confidential)
+				require.NotContains(t, recorder.Body.String(), "secret_hash")
+			},
+		},
+		{
+			name: "Insecure Redirect URI",
+			body: gin.H{
+				"name":          "partner app",
+				"redirect_uris": []string{"http://partner.example.com/callback"},
+				"scopes":        []string{util.PermissionBookingsRead},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "No Redirect URI",
+			body: gin.H{
+				"name":   "partner app",
+				"scopes": []string{util.PermissionBookingsRead},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Unsupported Scope",
+			body: gin.H{
+				"name":          "partner app",
+				"redirect_uris": []string{testRedirectURI},
+				"scopes":        []string{util.PermissionAPIKeysManage},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Client Credentials For Public Client",
+			body: gin.H{
+				"name":        "partner backend",
+				"scopes":      []string{util.PermissionBookingsRead},
+				"grant_types": []string{oauthGrantClientCredentials},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expectVerifiedEmail(store)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Unverified Email",
+			body: gin.H{
+				"name":          "partner app",
+				"redirect_uris": []string{testRedirectURI},
+				"scopes":        []string{util.PermissionBookingsRead},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				unverifiedUser := user
+				unverifiedUser.EmailVerifiedAt = sql.NullTime{}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(unverifiedUser, nil)
+				store.EXPECT().
+					CreateOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/oauth/clients", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDeleteOAuthClientAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, client := randomOAuthClient(t, user, false, oauthGrantAuthorizationCode)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteOAuthClient(gomock.Any(), gomock.Eq(db.DeleteOAuthClientParams{
+						ID:     client.ID,
+						UserID: user.ID,
+					})).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionOAuthClientDelete, arg.Action)
+						require.Equal(t, client.ID, arg.TargetID)
+						require.Equal(t, client, arg.Before)
+						require.Nil(t, arg.After)
+						return db.AuditEvents{}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "Not Found",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthClients{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodDelete, "/api/v1/oauth/clients/"+client.ID, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestOAuthAuthorizeAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, client := randomOAuthClient(t, user, false, oauthGrantAuthorizationCode)
+	challenge := util.PKCEChallenge(util.RandomString(43))
+
+	authorizeQuery := func(modify func(query url.Values)) url.Values {
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {client.ID},
+			"redirect_uri":          {testRedirectURI},
+			"scope":                 {util.PermissionBookingsRead},
+			"state":                 {"xyz"},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {util.PKCEMethodS256},
+		}
+		if modify != nil {
+			modify(query)
+		}
+		return query
+	}
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "Consent Required",
+			query: authorizeQuery(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(client.ID)).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					GetOAuthConsent(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthConsents{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res oauthAuthorizeResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.ConsentRequired)
+				require.Empty(t, res.RedirectTo)
+				require.Equal(t, client.Name, res.Client.Name)
+				require.Equal(t, []string{util.PermissionBookingsRead}, res.Scopes)
+			},
+		},
+		{
+			name:  "Existing Consent",
+			query: authorizeQuery(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(client.ID)).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					GetOAuthConsent(gomock.Any(), gomock.Eq(db.GetOAuthConsentParams{UserID: user.ID, ClientID: client.ID})).
+					Times(1).
+					Return(db.OauthConsents{UserID: user.ID, ClientID: client.ID, Scopes: client.Scopes}, nil)
+				store.EXPECT().
+					CreateOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOAuthAuthorizationCodeParams) (db.OauthAuthorizationCodes, error) {
+						require.Equal(t, client.ID, arg.ClientID)
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, testRedirectURI, arg.RedirectUri)
+						require.Equal(t, []string{util.PermissionBookingsRead}, arg.Scopes)
+						require.Equal(t, challenge, arg.CodeChallenge)
+						return db.OauthAuthorizationCodes{CodeHash: arg.CodeHash}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				redirect := requireOAuthRedirect(t, recorder)
+				require.NotEmpty(t, redirect.Query().Get("code"))
+				require.Equal(t, "xyz", redirect.Query().Get("state"))
+			},
+		},
+		{
+			name: "Missing PKCE",
+			query: authorizeQuery(func(query url.Values) {
+				query.Del("code_challenge")
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					GetOAuthConsent(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+				redirect := requireOAuthRedirect(t, recorder)
+				require.Equal(t, oauthErrorInvalidRequest, redirect.Query().Get("error"))
+			},
+		},
+		{
+			name: "Scope Not Registered",
+			query: authorizeQuery(func(query url.Values) {
+				query.Set("scope", util.PermissionBookingsWrite)
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(client, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+				redirect := requireOAuthRedirect(t, recorder)
+				require.Equal(t, oauthErrorInvalidScope, redirect.Query().Get("error"))
+			},
+		},
+		{
+			name: "Unregistered Redirect URI",
+			query: authorizeQuery(func(query url.Values) {
+				query.Set("redirect_uri", "https://attacker.example.com/callback")
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(client, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "redirect_to")
+			},
+		},
+		{
+			name:  "Unknown Client",
+			query: authorizeQuery(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthClients{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "redirect_to")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/oauth/authorize?"+tc.query.Encode(), nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestOAuthConsentAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	_, client := randomOAuthClient(t, user, false, oauthGrantAuthorizationCode)
+
+	body := func(approve bool) gin.H {
+		return gin.H{
+			"response_type":         "code",
+			"client_id":             client.ID,
+			"scope":                 util.PermissionUsersRead,
+			"code_challenge":        util.PKCEChallenge(util.RandomString(43)),
+			"code_challenge_method": util.PKCEMethodS256,
+			"approve":               approve,
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Approve",
+			body: body(true),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					GetOAuthConsent(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthConsents{Scopes: []string{util.PermissionBookingsRead}}, nil)
+
+				// the scopes consented to earlier are kept
+				arg := db.UpsertOAuthConsentParams{
+					UserID:   user.ID,
+					ClientID: client.ID,
+					Scopes:   []string{util.PermissionBookingsRead, util.PermissionUsersRead},
+				}
+				store.EXPECT().
+					UpsertOAuthConsent(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.OauthConsents{}, nil)
+				store.EXPECT().
+					CreateOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthAuthorizationCodes{}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				redirect := requireOAuthRedirect(t, recorder)
+				require.NotEmpty(t, redirect.Query().Get("code"))
+			},
+		},
+		{
+			name: "Deny",
+			body: body(false),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(client, nil)
+				store.EXPECT().
+					UpsertOAuthConsent(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				redirect := requireOAuthRedirect(t, recorder)
+				require.Equal(t, oauthErrorAccessDenied, redirect.Query().Get("error"))
+				require.Empty(t, redirect.Query().Get("code"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/oauth/authorize", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestOAuthTokenAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.Role = util.AgentRole
+
+	_, publicClient := randomOAuthClient(t, user, false, oauthGrantAuthorizationCode)
+	secret, machineClient := randomOAuthClient(t, user, true, oauthGrantClientCredentials)
+
+	verifier := util.RandomString(43)
+	code, codeHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	authorizationCode := db.OauthAuthorizationCodes{
+		CodeHash:      codeHash,
+		ClientID:      publicClient.ID,
+		UserID:        user.ID,
+		RedirectUri:   testRedirectURI,
+		Scopes:        []string{util.PermissionBookingsRead},
+		CodeChallenge: util.PKCEChallenge(verifier),
+		ExpiresAt:     time.Now().Add(oauthCodeDuration),
+	}
+
+	codeForm := func(modify func(form url.Values)) url.Values {
+		form := url.Values{
+			"grant_type":    {oauthGrantAuthorizationCode},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+			"client_id":     {publicClient.ID},
+		}
+		if modify != nil {
+			modify(form)
+		}
+		return form
+	}
+
+	testCases := []struct {
+		name          string
+		form          url.Values
+		setupAuth     func(request *http.Request)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker)
+	}{
+		{
+			name: "Authorization Code",
+			form: codeForm(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(publicClient.ID)).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Eq(codeHash)).
+					Times(1).
+					Return(authorizationCode, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+				payload := requireOAuthTokenPayload(t, recorder, tokenMaker)
+				require.Equal(t, user.ID, payload.UserId)
+				require.Equal(t, publicClient.ID, payload.ClientID)
+				require.Equal(t, []string{util.PermissionBookingsRead}, payload.Permissions)
+			},
+		},
+		{
+			name: "Wrong Code Verifier",
+			form: codeForm(func(form url.Values) {
+				form.Set("code_verifier", util.RandomString(43))
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(authorizationCode, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidGrant)
+			},
+		},
+		{
+			name: "Missing Redirect URI",
+			form: codeForm(func(form url.Values) {
+				form.Del("redirect_uri")
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidRequest)
+			},
+		},
+		{
+			name: "Wrong Redirect URI",
+			form: codeForm(func(form url.Values) {
+				form.Set("redirect_uri", testRedirectURI+"/")
+			}),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(authorizationCode, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidGrant)
+			},
+		},
+		{
+			name: "Used Code",
+			form: codeForm(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OauthAuthorizationCodes{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidGrant)
+			},
+		},
+		{
+			name: "Expired Code",
+			form: codeForm(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				expiredCode := authorizationCode
+				expiredCode.ExpiresAt = time.Now().Add(-time.Second)
+
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(expiredCode, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidGrant)
+			},
+		},
+		{
+			name: "Code Of Another Client",
+			form: codeForm(nil),
+			buildStubs: func(store *mockdb.MockStore) {
+				otherCode := authorizationCode
+				otherCode.ClientID = util.RandomString(16)
+
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					UseOAuthAuthorizationCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(otherCode, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorInvalidGrant)
+			},
+		},
+		{
+			name: "Client Credentials",
+			form: url.Values{
+				"grant_type": {oauthGrantClientCredentials},
+				"scope":      {util.PermissionBookingsRead},
+			},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(machineClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(machineClient.ID)).
+					Times(1).
+					Return(machineClient, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				payload := requireOAuthTokenPayload(t, recorder, tokenMaker)
+				require.Equal(t, user.ID, payload.UserId)
+				require.Equal(t, machineClient.ID, payload.ClientID)
+				require.Equal(t, []string{util.PermissionBookingsRead}, payload.Permissions)
+			},
+		},
+		{
+			name: "Client Credentials Wrong Secret",
+			form: url.Values{"grant_type": {oauthGrantClientCredentials}},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(machineClient.ID, util.RandomString(32))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(machineClient, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusUnauthorized, oauthErrorInvalidClient)
+				require.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			},
+		},
+		{
+			name: "Client Credentials Owner Deleted",
+			form: url.Values{"grant_type": {oauthGrantClientCredentials}},
+			setupAuth: func(request *http.Request) {
+				request.SetBasicAuth(machineClient.ID, secret)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Eq(machineClient.ID)).
+					Times(1).
+					Return(machineClient, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusUnauthorized, oauthErrorInvalidClient)
+				require.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			},
+		},
+		{
+			name: "Client Credentials Public Client",
+			form: url.Values{
+				"grant_type": {oauthGrantClientCredentials},
+				"client_id":  {publicClient.ID},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(publicClient, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorUnauthorizedClient)
+			},
+		},
+		{
+			name: "Unsupported Grant Type",
+			form: url.Values{"grant_type": {"password"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOAuthClient(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) {
+				requireOAuthError(t, recorder, http.StatusBadRequest, oauthErrorUnsupportedGrantType)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/oauth/token", strings.NewReader(tc.form.Encode()))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if tc.setupAuth != nil {
+				tc.setupAuth(request)
+			}
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server.tokenMaker)
+		})
+	}
+}
+
+func TestOAuthTokenCannotActAsOwner(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	requests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPut, fmt.Sprintf("/api/v1/users/%d", user.ID), http.StatusUnauthorized},
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d/sessions", user.ID), http.StatusForbidden},
+		{http.MethodPost, fmt.Sprintf("/api/v1/users/%d/api-keys", user.ID), http.StatusForbidden},
+		{http.MethodGet, fmt.Sprintf("/api/v1/users/%d/oauth/consents", user.ID), http.StatusForbidden},
+		{http.MethodPost, "/api/v1/oauth/clients", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/oauth/authorize", http.StatusForbidden},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(req.method, req.path, bytes.NewReader([]byte("{}")))
+		require.NoError(t, err)
+
+		addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute,
+			token.WithRole(user.Role, []string{util.PermissionUsersRead}), token.WithClientID(util.RandomString(16)))
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, req.status, recorder.Code, "%s %s", req.method, req.path)
+	}
+}
+
+// requireOAuthRedirect reads the redirect an authorization response sends the user's browser to
+func requireOAuthRedirect(t *testing.T, recorder *httptest.ResponseRecorder) *url.URL {
+	var res oauthAuthorizeResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+
+	redirect, err := url.Parse(res.RedirectTo)
+	require.NoError(t, err)
+	require.Equal(t, "partner.example.com", redirect.Host)
+	return redirect
+}
+
+func requireOAuthError(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) {
+	require.Equal(t, status, recorder.Code)
+
+	var res gin.H
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, code, res["error"])
+}
+
+func requireOAuthTokenPayload(t *testing.T, recorder *httptest.ResponseRecorder, tokenMaker token.Maker) *token.Payload {
+	var res oauthTokenResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, "Bearer", res.TokenType)
+
+	payload, err := tokenMaker.VerifyToken(res.AccessToken)
+	require.NoError(t, err)
+	return payload
+}
@@ -0,0 +1,485 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/oidc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	// oidcStateDuration is how long a user has to sign in at the provider once the flow has started
+	oidcStateDuration = 10 * time.Minute
+	// oidcStateCookie holds the hash of the state of a sign in, in the browser that started it
+	oidcStateCookie     = "oidc_state_binding"
+	oidcStateCookiePath = "/api/v1/users/login/oidc"
+)
+
+var (
+	errOIDCNotConfigured = errors.New("OIDC login is not configured")
+	errInvalidOIDCState  = errors.New("the sign in request is invalid or has expired, please start again")
+	errOIDCNoEmail       = errors.New("the provider did not share an email address")
+	errOIDCAccountExists = errors.New("an account with this email already exists, sign in with your password to link the provider")
+	errIdentityLinked    = errors.New("this identity is linked to another account")
+)
+
+// newOIDCProvider creates the OpenID Connect provider users can sign in with. It returns nil when none is configured.
+func newOIDCProvider(config util.Config) (*oidc.Provider, error) {
+	if config.OIDCIssuer == "" {
+		return nil, nil
+	}
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       config.OIDCIssuer,
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  config.OIDCRedirectURL,
+		Scopes:       config.OIDCScopes,
+	}, nil)
+}
+
+type oidcStartResponse struct {
+	// AuthorizationURL is where the user signs in at the provider
+	AuthorizationURL string `json:"authorization_url"`
+	// State comes back with the code. The client should check it matches before finishing the flow.
+	State     string    `json:"state"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// startOIDCLogin starts signing a user in with the OpenID Connect provider
+func (server *Server) startOIDCLogin(ctx *gin.Context) {
+	server.startOIDCFlow(ctx, sql.NullInt64{})
+}
+
+// startOIDCFlow stores what is needed to finish the flow under a random state, and responds with the URL the
+// user signs in at. userID is set when a signed in user links an identity.
+func (server *Server) startOIDCFlow(ctx *gin.Context, userID sql.NullInt64) {
+	if server.oidcProvider == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errOIDCNotConfigured))
+		return
+	}
+
+	state, stateHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	codeVerifier, _, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	nonce, _, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	authURL, err := server.oidcProvider.AuthCodeURL(ctx, state, nonce, util.PKCEChallenge(codeVerifier))
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, errorResponse(err))
+		return
+	}
+
+	loginState, err := server.store.CreateOIDCLoginState(ctx, db.CreateOIDCLoginStateParams{
+		StateHash:    stateHash,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(oidcStateDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// a signed in user is already bound to the flow by its ID, a sign in is bound to the browser that started it
+	if !userID.Valid {
+		server.setOIDCStateCookie(ctx, stateHash, int(oidcStateDuration.Seconds()))
+	}
+
+	ctx.JSON(http.StatusOK, oidcStartResponse{
+		AuthorizationURL: authURL,
+		State:            state,
+		ExpiresAt:        loginState.ExpiresAt,
+	})
+}
+
+// setOIDCStateCookie sets the cookie a sign in is bound to, for maxAge seconds. A negative maxAge removes it.
+func (server *Server) setOIDCStateCookie(ctx *gin.Context, value string, maxAge int) {
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcStateCookiePath,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// loginOIDC finishes signing a user in with the OpenID Connect provider. A known identity signs its user in.
+// Otherwise an account with the same email is linked if both we and the provider have verified the email,
+// and a new account is created if there is none.
+func (server *Server) loginOIDC(ctx *gin.Context) {
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// without the cookie, an attacker could have the victim's browser finish a sign in the attacker started,
+	// signing the victim in to the attacker's account
+	stateHash := util.HashVerificationToken(req.State)
+	binding, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(binding), []byte(stateHash)) != 1 {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidOIDCState))
+		return
+	}
+	server.setOIDCStateCookie(ctx, "", -1)
+
+	claims, ok := server.exchangeOIDCCode(ctx, req, sql.NullInt64{})
+	if !ok {
+		return
+	}
+
+	user, ok := server.findOrCreateOIDCUser(ctx, claims)
+	if !ok {
+		return
+	}
+
+	server.loginFederatedUser(ctx, user)
+}
+
+// exchangeOIDCCode uses up the state of a flow and exchanges the code for the user's verified claims. The
+// state must have been started for userID. It responds with an error if the flow can't be finished.
+func (server *Server) exchangeOIDCCode(ctx *gin.Context, req oidcCallbackRequest, userID sql.NullInt64) (*oidc.Claims, bool) {
+	if server.oidcProvider == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errOIDCNotConfigured))
+		return nil, false
+	}
+
+	loginState, err := server.store.UseOIDCLoginState(ctx, util.HashVerificationToken(req.State))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidOIDCState))
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+
+	if loginState.UserID != userID || time.Now().After(loginState.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidOIDCState))
+		return nil, false
+	}
+
+	claims, err := server.oidcProvider.Exchange(ctx, req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		var providerErr *oidc.Error
+		if errors.As(err, &providerErr) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return nil, false
+		}
+		ctx.JSON(http.StatusBadGateway, errorResponse(err))
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// findOrCreateOIDCUser returns the user an identity belongs to, linking or creating an account the first
+// time the identity signs in
+func (server *Server) findOrCreateOIDCUser(ctx *gin.Context, claims *oidc.Claims) (db.Users, bool) {
+	identity, err := server.store.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Issuer:  server.oidcProvider.Issuer(),
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		user, err := server.store.GetUserById(ctx, identity.UserID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return db.Users{}, false
+		}
+
+		err = server.store.RecordUserIdentityLogin(ctx, db.RecordUserIdentityLoginParams{
+			ID:    identity.ID,
+			Email: claims.Email,
+		})
+		if err != nil {
+			log.Error().Err(err).Int64("identity_id", identity.ID).Msg("unable to record identity login")
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Users{}, false
+	}
+
+	if claims.Email == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errOIDCNoEmail))
+		return db.Users{}, false
+	}
+
+	user, err := server.store.GetUser(ctx, claims.Email)
+	if err == nil {
+		// whoever controls the provider account could otherwise take over an account they don't own
+		if !claims.EmailVerified || !user.EmailVerifiedAt.Valid {
+			ctx.JSON(http.StatusConflict, errorResponse(errOIDCAccountExists))
+			return db.Users{}, false
+		}
+
+		_, err = server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+			UserID:  user.ID,
+			Issuer:  server.oidcProvider.Issuer(),
+			Subject: claims.Subject,
+			Email:   claims.Email,
+		})
+		if err != nil {
+			respondIdentityError(ctx, err)
+			return db.Users{}, false
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Users{}, false
+	}
+
+	return server.createOIDCUser(ctx, claims)
+}
+
+// createOIDCUser signs up a user from the claims of their identity
+func (server *Server) createOIDCUser(ctx *gin.Context, claims *oidc.Claims) (db.Users, bool) {
+	hashedPassword, ok := server.hashRandomPassword(ctx)
+	if !ok {
+		return db.Users{}, false
+	}
+
+	firstName, lastName := oidcUserNames(claims)
+	result, err := server.store.CreateOIDCUserTx(ctx, db.CreateOIDCUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			FirstName: firstName,
+			LastName:  lastName,
+			Email:     claims.Email,
+			Password:  hashedPassword,
+		},
+		EmailVerified: claims.EmailVerified,
+		Issuer:        server.oidcProvider.Issuer(),
+		Subject:       claims.Subject,
+	})
+	if err != nil {
+		respondIdentityError(ctx, err)
+		return db.Users{}, false
+	}
+
+	if !claims.EmailVerified {
+		// the account exists at this point, so a failed email is only logged and can be resent
+		err = server.sendVerificationEmail(ctx, result.User)
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", result.User.ID).Msg("unable to send verification email")
+		}
+	}
+	return result.User, true
+}
+
+// oidcUserNames picks the names of a new user from the claims, falling back to the email when the provider
+// shares no name
+func oidcUserNames(claims *oidc.Claims) (firstName string, lastName string) {
+	if claims.GivenName != "" || claims.FamilyName != "" {
+		return claims.GivenName, claims.FamilyName
+	}
+	if name := strings.TrimSpace(claims.Name); name != "" {
+		firstName, lastName, _ = strings.Cut(name, " ")
+		return firstName, strings.TrimSpace(lastName)
+	}
+	firstName, _, _ = strings.Cut(claims.Email, "@")
+	return firstName, ""
+}
+
+// respondIdentityError responds to an error creating a user or an identity. A unique violation means a
+// concurrent sign in got there first.
+func respondIdentityError(ctx *gin.Context, err error) {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		ctx.JSON(http.StatusConflict, errorResponse(errIdentityLinked))
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+}
+
+type userIdentitiesParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type identityResponse struct {
+	ID          int64      `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+func newIdentityResponse(identity db.UserIdentities) identityResponse {
+	res := identityResponse{
+		ID:        identity.ID,
+		Issuer:    identity.Issuer,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+	if identity.LastLoginAt.Valid {
+		res.LastLoginAt = &identity.LastLoginAt.Time
+	}
+	return res
+}
+
+// startIdentityLink starts linking an identity at the OpenID Connect provider to the signed in user
+func (server *Server) startIdentityLink(ctx *gin.Context) {
+	var urlParam userIdentitiesParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// only the user can link an identity, since it lets whoever holds it sign in as them
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	server.startOIDCFlow(ctx, sql.NullInt64{Int64: urlParam.ID, Valid: true})
+}
+
+// linkIdentity finishes linking an identity to the signed in user. The flow must have been started by the
+// same user, so a link started by someone else can't attach their identity to this account.
+func (server *Server) linkIdentity(ctx *gin.Context) {
+	var urlParam userIdentitiesParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	claims, ok := server.exchangeOIDCCode(ctx, req, sql.NullInt64{Int64: urlParam.ID, Valid: true})
+	if !ok {
+		return
+	}
+
+	identity, err := server.store.GetUserIdentity(ctx, db.GetUserIdentityParams{
+		Issuer:  server.oidcProvider.Issuer(),
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		if identity.UserID != urlParam.ID {
+			ctx.JSON(http.StatusConflict, errorResponse(errIdentityLinked))
+			return
+		}
+		ctx.JSON(http.StatusOK, newIdentityResponse(identity))
+		return
+	}
+	if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	identity, err = server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		UserID:  urlParam.ID,
+		Issuer:  server.oidcProvider.Issuer(),
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		respondIdentityError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newIdentityResponse(identity))
+}
+
+// listIdentities lists the provider identities linked to a user
+func (server *Server) listIdentities(ctx *gin.Context) {
+	var urlParam userIdentitiesParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersRead) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	identities, err := server.store.ListUserIdentities(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]identityResponse, 0, len(identities))
+	for _, identity := range identities {
+		res = append(res, newIdentityResponse(identity))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type unlinkIdentityParam struct {
+	ID         int64 `uri:"id" binding:"required,min=1"`
+	IdentityID int64 `uri:"identity_id" binding:"required,min=1"`
+}
+
+// unlinkIdentity stops an identity from signing its user in. The user can still sign in with their password.
+func (server *Server) unlinkIdentity(ctx *gin.Context) {
+	var urlParam unlinkIdentityParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersWrite) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	_, err := server.store.DeleteUserIdentity(ctx, db.DeleteUserIdentityParams{
+		ID:     urlParam.IdentityID,
+		UserID: urlParam.ID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
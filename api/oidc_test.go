@@ -0,0 +1,695 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/oidc"
+	"github.com/sajitron/travel-agency/oidc/oidctest"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// newOIDCTestServer creates a test server that signs users in with a stand-in provider
+func newOIDCTestServer(t *testing.T, store db.Store) (*Server, *oidctest.Provider) {
+	stub, err := oidctest.NewProvider(util.RandomString(12), util.RandomString(32))
+	require.NoError(t, err)
+	t.Cleanup(stub.Close)
+
+	server := newTestServer(t, store)
+	server.oidcProvider, err = oidc.NewProvider(oidc.Config{
+		Issuer:       stub.URL,
+		ClientID:     stub.ClientID,
+		ClientSecret: stub.ClientSecret,
+		RedirectURL:  "https://travel.agency/oidc/callback",
+	}, stub.Client())
+	require.NoError(t, err)
+
+	return server, stub
+}
+
+func randomOIDCIdentity(user db.Users) oidctest.Identity {
+	return oidctest.Identity{
+		Subject:       util.RandomString(16),
+		Email:         user.Email,
+		EmailVerified: true,
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+	}
+}
+
+// startOIDCTestFlow starts a flow at path and signs the identity in at the provider. It returns the code and
+// state the provider sends the user back with, the stored state of the flow, and the state cookie if one was set.
+func startOIDCTestFlow(
+	t *testing.T,
+	server *Server,
+	store *mockdb.MockStore,
+	stub *oidctest.Provider,
+	path string,
+	setupAuth func(request *http.Request),
+	identity oidctest.Identity,
+) (string, string, db.OidcLoginStates, *http.Cookie) {
+	var loginState db.OidcLoginStates
+	store.EXPECT().
+		CreateOIDCLoginState(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateOIDCLoginStateParams) (db.OidcLoginStates, error) {
+			loginState = db.OidcLoginStates{
+				StateHash:    arg.StateHash,
+				CodeVerifier: arg.CodeVerifier,
+				Nonce:        arg.Nonce,
+				UserID:       arg.UserID,
+				ExpiresAt:    arg.ExpiresAt,
+				CreatedAt:    time.Now(),
+			}
+			return loginState, nil
+		})
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, path, nil)
+	require.NoError(t, err)
+	if setupAuth != nil {
+		setupAuth(request)
+	}
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res oidcStartResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, util.HashVerificationToken(res.State), loginState.StateHash)
+
+	code, state, err := stub.Authorize(res.AuthorizationURL, identity)
+	require.NoError(t, err)
+	require.Equal(t, res.State, state)
+
+	var stateCookie *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			stateCookie = cookie
+		}
+	}
+
+	return code, state, loginState, stateCookie
+}
+
+func TestLoginOIDCAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name          string
+		identity      func(identity *oidctest.Identity)
+		modifyRequest func(code *string, state *db.OidcLoginStates)
+		setupCookie   func(request *http.Request, cookie *http.Cookie)
+		buildStubs    func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Known Identity",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				userIdentity := db.UserIdentities{ID: 1, UserID: user.ID, Issuer: issuer, Subject: identity.Subject}
+
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Eq(state.StateHash)).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Eq(db.GetUserIdentityParams{Issuer: issuer, Subject: identity.Subject})).
+					Times(1).
+					Return(userIdentity, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					RecordUserIdentityLogin(gomock.Any(), gomock.Eq(db.RecordUserIdentityLoginParams{ID: userIdentity.ID, Email: identity.Email})).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res loginUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.Equal(t, user.Email, res.User.Email)
+			},
+		},
+		{
+			name: "New User",
+			identity: func(identity *oidctest.Identity) {
+				identity.Email = util.RandomEmail()
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(identity.Email)).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateOIDCUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOIDCUserTxParams) (db.CreateOIDCUserTxResult, error) {
+						require.Equal(t, identity.Email, arg.Email)
+						require.Equal(t, identity.GivenName, arg.FirstName)
+						require.Equal(t, identity.FamilyName, arg.LastName)
+						require.NotEmpty(t, arg.Password)
+						require.True(t, arg.EmailVerified)
+						require.Equal(t, issuer, arg.Issuer)
+						require.Equal(t, identity.Subject, arg.Subject)
+
+						return db.CreateOIDCUserTxResult{
+							User: db.Users{ID: user.ID + 1, Email: arg.Email, EmailVerifiedAt: user.EmailVerifiedAt},
+						}, nil
+					})
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "New User Unverified Email",
+			identity: func(identity *oidctest.Identity) {
+				identity.Email = util.RandomEmail()
+				identity.EmailVerified = false
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateOIDCUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOIDCUserTxParams) (db.CreateOIDCUserTxResult, error) {
+						require.False(t, arg.EmailVerified)
+						return db.CreateOIDCUserTxResult{User: db.Users{ID: user.ID + 1, Email: arg.Email}}, nil
+					})
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Link Verified Account",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+
+				arg := db.CreateUserIdentityParams{
+					UserID:  user.ID,
+					Issuer:  issuer,
+					Subject: identity.Subject,
+					Email:   identity.Email,
+				}
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Eq(arg)).
+					Times(1)
+				store.EXPECT().
+					CreateOIDCUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Existing Account Unverified By Provider",
+			identity: func(identity *oidctest.Identity) {
+				identity.EmailVerified = false
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Existing Account Unverified By Us",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				unverifiedUser := user
+				unverifiedUser.EmailVerifiedAt = sql.NullTime{}
+
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(unverifiedUser, nil)
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Two Factor Enabled",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				twoFactorUser := user
+				twoFactorUser.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{ID: 1, UserID: user.ID}, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(twoFactorUser, nil)
+				store.EXPECT().
+					RecordUserIdentityLogin(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res twoFactorChallengeResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.TwoFactorRequired)
+				require.NotEmpty(t, res.ChallengeToken)
+			},
+		},
+		{
+			name: "Locked Account",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				lockedUser := user
+				lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{ID: 1, UserID: user.ID}, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(lockedUser, nil)
+				store.EXPECT().
+					RecordUserIdentityLogin(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+		{
+			name: "Unknown State",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.OidcLoginStates{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired State",
+			modifyRequest: func(code *string, state *db.OidcLoginStates) {
+				state.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Link State",
+			modifyRequest: func(code *string, state *db.OidcLoginStates) {
+				state.UserID = sql.NullInt64{Int64: user.ID, Valid: true}
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:        "Missing State Cookie",
+			setupCookie: func(request *http.Request, cookie *http.Cookie) {},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			// the attacker's browser started the flow, and the victim's browser has a cookie from another one
+			name: "State Cookie Of Another Flow",
+			setupCookie: func(request *http.Request, cookie *http.Cookie) {
+				request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: util.HashVerificationToken(util.RandomString(32))})
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Code Rejected By Provider",
+			modifyRequest: func(code *string, state *db.OidcLoginStates) {
+				*code = util.RandomString(32)
+			},
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server, stub := newOIDCTestServer(t, store)
+
+			identity := randomOIDCIdentity(user)
+			if tc.identity != nil {
+				tc.identity(&identity)
+			}
+
+			code, state, loginState, stateCookie := startOIDCTestFlow(t, server, store, stub, "/api/v1/users/login/oidc", nil, identity)
+			require.NotNil(t, stateCookie)
+			require.Equal(t, loginState.StateHash, stateCookie.Value)
+			require.True(t, stateCookie.HttpOnly)
+			require.True(t, stateCookie.Secure)
+			require.Equal(t, http.SameSiteLaxMode, stateCookie.SameSite)
+			if tc.modifyRequest != nil {
+				tc.modifyRequest(&code, &loginState)
+			}
+			tc.buildStubs(store, stub.URL, identity, loginState)
+
+			data, err := json.Marshal(gin.H{"code": code, "state": state})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login/oidc/callback", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			if tc.setupCookie != nil {
+				tc.setupCookie(request, stateCookie)
+			} else {
+				request.AddCookie(stateCookie)
+			}
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginOIDCNotConfigured(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateOIDCLoginState(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login/oidc", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestLinkIdentityAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{}, sql.ErrNoRows)
+
+				arg := db.CreateUserIdentityParams{
+					UserID:  user.ID,
+					Issuer:  issuer,
+					Subject: identity.Subject,
+					Email:   identity.Email,
+				}
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.UserIdentities{ID: 1, UserID: user.ID, Issuer: issuer, Email: identity.Email}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res identityResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), res.ID)
+				require.Equal(t, user.Email, res.Email)
+			},
+		},
+		{
+			name: "Linked To Another User",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.UserIdentities{ID: 1, UserID: user.ID + 1}, nil)
+				store.EXPECT().
+					CreateUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Login State",
+			buildStubs: func(store *mockdb.MockStore, issuer string, identity oidctest.Identity, state db.OidcLoginStates) {
+				state.UserID = sql.NullInt64{}
+
+				store.EXPECT().
+					UseOIDCLoginState(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(state, nil)
+				store.EXPECT().
+					GetUserIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server, stub := newOIDCTestServer(t, store)
+
+			setupAuth := func(request *http.Request) {
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			}
+			path := fmt.Sprintf("/api/v1/users/%d/identities", user.ID)
+
+			identity := randomOIDCIdentity(user)
+			code, state, loginState, _ := startOIDCTestFlow(t, server, store, stub, path+"/start", setupAuth, identity)
+			require.Equal(t, sql.NullInt64{Int64: user.ID, Valid: true}, loginState.UserID)
+			tc.buildStubs(store, stub.URL, identity, loginState)
+
+			data, err := json.Marshal(gin.H{"code": code, "state": state})
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			setupAuth(request)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestStartIdentityLinkForeignUser(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		CreateOIDCLoginState(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server, _ := newOIDCTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/users/%d/identities/start", user.ID), nil)
+	require.NoError(t, err)
+
+	// not even an admin can link an identity to someone else
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AdminRole))
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
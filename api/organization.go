@@ -0,0 +1,245 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/saml"
+)
+
+// organizationSlugPattern keeps slugs safe to put in URLs
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// organizationRequest holds the settings of an organization's identity provider
+type organizationRequest struct {
+	Name           string   `json:"name" binding:"required,max=100"`
+	EmailDomains   []string `json:"email_domains" binding:"required,min=1,dive,fqdn"`
+	IdPEntityID    string   `json:"idp_entity_id" binding:"required"`
+	IdPSSOURL      string   `json:"idp_sso_url" binding:"required,url"`
+	IdPCertificate string   `json:"idp_certificate" binding:"required"`
+	// the attributes users are mapped from. When left out, the names common identity providers use are tried.
+	EmailAttribute     string `json:"email_attribute"`
+	FirstNameAttribute string `json:"first_name_attribute"`
+	LastNameAttribute  string `json:"last_name_attribute"`
+}
+
+// validate checks the settings that can't be checked by binding
+func (req *organizationRequest) validate() error {
+	if _, err := saml.ParseCertificates(req.IdPCertificate); err != nil {
+		return err
+	}
+	ssoURL, err := url.Parse(req.IdPSSOURL)
+	if err != nil || ssoURL.Scheme != "https" {
+		return errors.New("the identity provider's SSO URL must use https")
+	}
+	return nil
+}
+
+// emailDomains lowercases and dedupes the domains, as emails are matched against them
+func (req *organizationRequest) emailDomains() []string {
+	domains := make([]string, 0, len(req.EmailDomains))
+	for _, domain := range req.EmailDomains {
+		domains = append(domains, strings.ToLower(strings.TrimSuffix(domain, ".")))
+	}
+	return uniqueStrings(domains)
+}
+
+type createOrganizationRequest struct {
+	Slug string `json:"slug" binding:"required,max=50"`
+	organizationRequest
+}
+
+type organizationResponse struct {
+	Slug               string    `json:"slug"`
+	Name               string    `json:"name"`
+	EmailDomains       []string  `json:"email_domains"`
+	IdPEntityID        string    `json:"idp_entity_id"`
+	IdPSSOURL          string    `json:"idp_sso_url"`
+	IdPCertificate     string    `json:"idp_certificate"`
+	EmailAttribute     string    `json:"email_attribute"`
+	FirstNameAttribute string    `json:"first_name_attribute"`
+	LastNameAttribute  string    `json:"last_name_attribute"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	// what the identity provider is set up with, once SAML is configured
+	SPEntityID  string `json:"sp_entity_id,omitempty"`
+	ACSURL      string `json:"acs_url,omitempty"`
+	MetadataURL string `json:"metadata_url,omitempty"`
+}
+
+func (server *Server) newOrganizationResponse(org db.Organizations) organizationResponse {
+	res := organizationResponse{
+		Slug:               org.Slug,
+		Name:               org.Name,
+		EmailDomains:       org.EmailDomains,
+		IdPEntityID:        org.IdpEntityID,
+		IdPSSOURL:          org.IdpSsoUrl,
+		IdPCertificate:     org.IdpCertificate,
+		EmailAttribute:     org.EmailAttribute,
+		FirstNameAttribute: org.FirstNameAttribute,
+		LastNameAttribute:  org.LastNameAttribute,
+		CreatedAt:          org.CreatedAt,
+		UpdatedAt:          org.UpdatedAt,
+	}
+	if server.config.SAMLBaseURL != "" {
+		res.SPEntityID = server.samlEntityID(org)
+		res.ACSURL = server.samlACSURL(org)
+		res.MetadataURL = server.samlEntityID(org)
+	}
+	return res
+}
+
+// createOrganization sets up an organization whose employees sign in through its own identity provider
+func (server *Server) createOrganization(ctx *gin.Context) {
+	var req createOrganizationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !organizationSlugPattern.MatchString(req.Slug) {
+		err := errors.New("the slug may only hold lowercase letters, digits and dashes")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	org, err := server.store.CreateOrganization(ctx, db.CreateOrganizationParams{
+		Name:               req.Name,
+		Slug:               req.Slug,
+		EmailDomains:       req.emailDomains(),
+		IdpEntityID:        req.IdPEntityID,
+		IdpSsoUrl:          req.IdPSSOURL,
+		IdpCertificate:     req.IdPCertificate,
+		EmailAttribute:     req.EmailAttribute,
+		FirstNameAttribute: req.FirstNameAttribute,
+		LastNameAttribute:  req.LastNameAttribute,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionOrganizationCreate
+	event.TargetType = db.AuditTargetOrganization
+	event.TargetID = strconv.FormatInt(org.ID, 10)
+	event.After = org
+	server.recordAuditEvent(ctx, event)
+
+	ctx.JSON(http.StatusOK, server.newOrganizationResponse(org))
+}
+
+// listOrganizations lists the organizations by name
+func (server *Server) listOrganizations(ctx *gin.Context) {
+	orgs, err := server.store.ListOrganizations(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]organizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		res = append(res, server.newOrganizationResponse(org))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type organizationParam struct {
+	Slug string `uri:"slug" binding:"required"`
+}
+
+func (server *Server) getOrganization(ctx *gin.Context) {
+	var urlParam organizationParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	org, err := server.store.GetOrganizationBySlug(ctx, urlParam.Slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, server.newOrganizationResponse(org))
+}
+
+// updateOrganization replaces the settings of an organization, such as when its identity provider rotates its key
+func (server *Server) updateOrganization(ctx *gin.Context) {
+	var urlParam organizationParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req organizationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	before, err := server.store.GetOrganizationBySlug(ctx, urlParam.Slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	org, err := server.store.UpdateOrganization(ctx, db.UpdateOrganizationParams{
+		Slug:               urlParam.Slug,
+		Name:               req.Name,
+		EmailDomains:       req.emailDomains(),
+		IdpEntityID:        req.IdPEntityID,
+		IdpSsoUrl:          req.IdPSSOURL,
+		IdpCertificate:     req.IdPCertificate,
+		EmailAttribute:     req.EmailAttribute,
+		FirstNameAttribute: req.FirstNameAttribute,
+		LastNameAttribute:  req.LastNameAttribute,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// a replaced identity provider certificate shows up among the changes
+	event := newAuditEvent(ctx)
+	event.Action = db.AuditActionOrganizationUpdate
+	event.TargetType = db.AuditTargetOrganization
+	event.TargetID = strconv.FormatInt(org.ID, 10)
+	event.Before = before
+	event.After = org
+	server.recordAuditEvent(ctx, event)
+
+	ctx.JSON(http.StatusOK, server.newOrganizationResponse(org))
+}
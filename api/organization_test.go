@@ -0,0 +1,381 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/saml/samltest"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func organizationBody(t *testing.T) gin.H {
+	idp, err := samltest.NewIdP("https://idp.example.com/acme")
+	require.NoError(t, err)
+
+	return gin.H{
+		"name":            "Acme",
+		"email_domains":   []string{"Acme.com", "acme.co.uk", "acme.com"},
+		"idp_entity_id":   idp.EntityID,
+		"idp_sso_url":     idp.SSOURL,
+		"idp_certificate": idp.CertificatePEM(),
+		"email_attribute": "mail",
+	}
+}
+
+func TestCreateOrganizationAPI(t *testing.T) {
+	admin, _ := randomUser(t)
+	admin.Role = util.AdminRole
+
+	withSlug := func(body gin.H, slug string) gin.H {
+		body["slug"] = slug
+		return body
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: withSlug(organizationBody(t), "acme"),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateOrganizationParams) (db.Organizations, error) {
+						require.Equal(t, "acme", arg.Slug)
+						require.Equal(t, []string{"acme.com", "acme.co.uk"}, arg.EmailDomains)
+						require.Equal(t, "mail", arg.EmailAttribute)
+
+						return db.Organizations{
+							ID:             1,
+							Name:           arg.Name,
+							Slug:           arg.Slug,
+							EmailDomains:   arg.EmailDomains,
+							IdpEntityID:    arg.IdpEntityID,
+							IdpSsoUrl:      arg.IdpSsoUrl,
+							IdpCertificate: arg.IdpCertificate,
+							EmailAttribute: arg.EmailAttribute,
+						}, nil
+					})
+				expectAuditEvent(t, store, db.AuditActionOrganizationCreate, db.AuditTargetOrganization, "1")
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res organizationResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Equal(t, "acme", res.Slug)
+				require.Equal(t, "https://travel.agency/api/v1/saml/acme/acs", res.ACSURL)
+				require.Equal(t, "https://travel.agency/api/v1/saml/acme/metadata", res.SPEntityID)
+			},
+		},
+		{
+			name: "Slug Taken",
+			body: withSlug(organizationBody(t), "acme"),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Organizations{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid Slug",
+			body: withSlug(organizationBody(t), "Acme Inc"),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid Certificate",
+			body: func() gin.H {
+				body := withSlug(organizationBody(t), "acme")
+				body["idp_certificate"] = "-----BEGIN CERTIFICATE-----\nnot a certificate\n-----END CERTIFICATE-----"
+				return body
+			}(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Insecure SSO URL",
+			body: func() gin.H {
+				body := withSlug(organizationBody(t), "acme")
+				body["idp_sso_url"] = "http://idp.example.com/acme/sso"
+				return body
+			}(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid Email Domain",
+			body: func() gin.H {
+				body := withSlug(organizationBody(t), "acme")
+				body["email_domains"] = []string{"not a domain"}
+				return body
+			}(),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Forbidden",
+			body: withSlug(organizationBody(t), "acme"),
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(util.AgentRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.SAMLBaseURL = "https://travel.agency/api/v1/"
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/organizations", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestUpdateOrganizationAPI(t *testing.T) {
+	admin, _ := randomUser(t)
+	admin.Role = util.AdminRole
+
+	org := db.Organizations{
+		ID:             1,
+		Slug:           "acme",
+		Name:           "Acme",
+		IdpCertificate: "old certificate",
+	}
+
+	testCases := []struct {
+		name          string
+		slug          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			slug: "acme",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Eq("acme")).
+					Times(1).
+					Return(org, nil)
+				store.EXPECT().
+					UpdateOrganization(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.UpdateOrganizationParams) (db.Organizations, error) {
+						require.Equal(t, "acme", arg.Slug)
+						require.Equal(t, "Acme", arg.Name)
+						return db.Organizations{ID: 1, Slug: arg.Slug, Name: arg.Name, IdpCertificate: arg.IdpCertificate}, nil
+					})
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionOrganizationUpdate, arg.Action)
+						require.Equal(t, db.AuditTargetOrganization, arg.TargetType)
+						require.Equal(t, "1", arg.TargetID)
+						require.Equal(t, org, arg.Before)
+						require.NotEqual(t, org.IdpCertificate, arg.After.(db.Organizations).IdpCertificate)
+						return db.AuditEvents{}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Not Found",
+			slug: "unknown",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Eq("unknown")).
+					Times(1).
+					Return(db.Organizations{}, sql.ErrNoRows)
+				store.EXPECT().
+					UpdateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(organizationBody(t))
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPut, "/api/v1/organizations/"+tc.slug, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetOrganizationAPI(t *testing.T) {
+	admin, _ := randomUser(t)
+	admin.Role = util.AdminRole
+	org := db.Organizations{ID: 1, Name: "Acme", Slug: "acme", EmailDomains: []string{"acme.com"}}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Eq(org.Slug)).
+					Times(1).
+					Return(org, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res organizationResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Equal(t, org.Name, res.Name)
+				require.Empty(t, res.ACSURL)
+			},
+		},
+		{
+			name: "Not Found",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Organizations{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/organizations/"+org.Slug, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, admin.ID, time.Minute, withTestRole(admin.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sajitron/travel-agency/passwordpolicy"
+)
+
+var errWeakPassword = errors.New("password does not meet the password policy")
+
+// fieldError is a rule broken by one field of a request
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// passwordViolationsResponse lists every rule a password breaks, so a client can show them all at once
+func passwordViolationsResponse(violations []passwordpolicy.Violation) gin.H {
+	fields := make([]fieldError, 0, len(violations))
+	for _, violation := range violations {
+		fields = append(fields, fieldError{
+			Field:   "password",
+			Code:    violation.Code,
+			Message: violation.Message,
+		})
+	}
+	return gin.H{"error": errWeakPassword.Error(), "fields": fields}
+}
+
+// checkPassword checks a password against the password policy. It responds with the broken rules and
+// returns false if the password isn't accepted.
+func (server *Server) checkPassword(ctx *gin.Context, password string, user passwordpolicy.UserInfo) bool {
+	violations := server.passwordPolicy.Check(password, user)
+	if len(violations) > 0 {
+		ctx.JSON(http.StatusBadRequest, passwordViolationsResponse(violations))
+		return false
+	}
+	return true
+}
+
+// newPasswordUserInfo returns what a password is checked against for personal info
+func newPasswordUserInfo(firstName, lastName, email string) passwordpolicy.UserInfo {
+	return passwordpolicy.UserInfo{
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sajitron/travel-agency/passwordpolicy"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPasswordPolicy(t *testing.T) {
+	policy, err := newPasswordPolicy(util.Config{})
+	require.NoError(t, err)
+	require.Equal(t, defaultPasswordMinLength, policy.MinLength)
+	require.Equal(t, defaultPasswordMaxLength, policy.MaxLength)
+	require.Zero(t, policy.MinCharacterClasses)
+	require.False(t, policy.AllowPersonalInfo)
+	require.Nil(t, policy.Breached)
+
+	breachedPassword := "correct horse battery staple"
+	sum := sha1.Sum([]byte(breachedPassword))
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	err = os.WriteFile(breachedFile, []byte(hex.EncodeToString(sum[:])[:16]+"\n"), 0o600)
+	require.NoError(t, err)
+
+	policy, err = newPasswordPolicy(util.Config{
+		PasswordMinLength:     12,
+		PasswordMaxLength:     64,
+		PasswordMinClasses:    3,
+		PasswordAllowPersonal: true,
+		BreachedPasswordsFile: breachedFile,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 12, policy.MinLength)
+	require.Equal(t, 64, policy.MaxLength)
+	require.Equal(t, 3, policy.MinCharacterClasses)
+	require.True(t, policy.AllowPersonalInfo)
+	require.True(t, policy.Breached.Contains(breachedPassword))
+
+	_, err = newPasswordPolicy(util.Config{PasswordMinLength: 200})
+	require.Error(t, err)
+
+	_, err = newPasswordPolicy(util.Config{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	require.Error(t, err)
+}
+
+func TestBreachedPasswordRejected(t *testing.T) {
+	breachedPassword := "correct horse battery staple"
+	filter, err := passwordpolicy.NewBloomFilter(10, 0.001)
+	require.NoError(t, err)
+	filter.Add(breachedPassword)
+
+	server := newTestServer(t, nil)
+	server.passwordPolicy.Breached = filter
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	require.False(t, server.checkPassword(ctx, breachedPassword, passwordpolicy.UserInfo{}))
+	requirePasswordViolations(t, recorder, passwordpolicy.CodeBreached)
+
+	recorder = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(recorder)
+	require.True(t, server.checkPassword(ctx, "correct horse battery stable", passwordpolicy.UserInfo{}))
+}
+
+func requirePasswordViolations(t *testing.T, recorder *httptest.ResponseRecorder, codes ...string) {
+	var res struct {
+		Error  string       `json:"error"`
+		Fields []fieldError `json:"fields"`
+	}
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, errWeakPassword.Error(), res.Error)
+
+	gotCodes := make([]string, 0, len(res.Fields))
+	for _, field := range res.Fields {
+		require.Equal(t, "password", field.Field)
+		require.NotEmpty(t, field.Message)
+		gotCodes = append(gotCodes, field.Code)
+	}
+	require.Equal(t, codes, gotCodes)
+}
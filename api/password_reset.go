@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/passwordpolicy"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	passwordResetPurpose         = "password_reset"
+	defaultPasswordResetDuration = time.Hour
+)
+
+var errInvalidResetToken = errors.New("reset token is invalid or has expired")
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type forgotPasswordResponse struct {
+	Message string `json:"message"`
+}
+
+// forgotPassword emails a password reset link. It responds the same way whether or not the email belongs
+// to a user, so that it can't be used to find out who has an account.
+func (server *Server) forgotPassword(ctx *gin.Context) {
+	var req forgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	res := forgotPasswordResponse{
+		Message: "if an account exists for this email, a password reset link has been sent to it",
+	}
+
+	// limited requests get the same response so the limit doesn't reveal anything either
+	rateLimitIdentity := strings.ToLower(strings.TrimSpace(req.Email))
+	result, err := server.rateLimiter.Allow(ctx, forgotPasswordRateLimit, rateLimitIdentity)
+	if applyRateLimit(ctx, forgotPasswordRateLimit, result, err) != nil {
+		ctx.JSON(http.StatusOK, res)
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, req.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusOK, res)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the email is sent after responding, so that the response time doesn't reveal that the account exists
+	ctx.JSON(http.StatusOK, res)
+	server.runInBackground(func(ctx context.Context) {
+		err := server.sendPasswordResetEmail(ctx, user)
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to send password reset email")
+		}
+	})
+}
+
+// sendPasswordResetEmail emails a user a link to reset their password
+func (server *Server) sendPasswordResetEmail(ctx context.Context, user db.Users) error {
+	duration := server.config.PasswordResetDuration
+	if duration == 0 {
+		duration = defaultPasswordResetDuration
+	}
+
+	rawToken, err := server.createEmailToken(ctx, user, passwordResetPurpose, duration)
+	if err != nil {
+		return err
+	}
+
+	return server.mailer.Send(ctx, mailer.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYou can choose a new password by opening the link below. "+
+				"If you didn't ask for this, you can ignore this email.\n\n%s\n",
+			user.FirstName,
+			server.appLink("/reset-password", rawToken),
+		),
+	})
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// resetPassword sets a new password using a reset token and signs the user out everywhere
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// the rules that don't depend on the user are checked before the token is looked up
+	if !server.checkPassword(ctx, req.Password, passwordpolicy.UserInfo{}) {
+		return
+	}
+
+	resetToken, err := server.store.GetVerificationToken(ctx, db.GetVerificationTokenParams{
+		TokenHash: util.HashVerificationToken(req.Token),
+		Purpose:   passwordResetPurpose,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if resetToken.UsedAt.Valid || time.Now().After(resetToken.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidResetToken))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, resetToken.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	violations := server.passwordPolicy.CheckPersonalInfo(req.Password, newPasswordUserInfo(user.FirstName, user.LastName, user.Email))
+	if len(violations) > 0 {
+		ctx.JSON(http.StatusBadRequest, passwordViolationsResponse(violations))
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(ctx, req.Password)
+	if err != nil {
+		respondPasswordHashError(ctx, err)
+		return
+	}
+
+	before := user
+	user, err = server.store.ResetPasswordTx(ctx, db.ResetPasswordTxParams{
+		TokenID:        resetToken.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		// the token was used by a concurrent request
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidResetToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// there's no access token, the user is identified by the reset token
+	event := newAuditEvent(ctx)
+	event.ActorID = sql.NullInt64{Int64: user.ID, Valid: true}
+	event.Action = db.AuditActionUserResetPassword
+	event.TargetType = db.AuditTargetUser
+	event.TargetID = strconv.FormatInt(user.ID, 10)
+	event.Before = before
+	event.After = user
+	server.recordAuditEvent(ctx, event)
+
+	err = server.revokeUserTokensAfterPasswordChange(ctx, user, uuid.Nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/passwordpolicy"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForgotPasswordAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"email": user.Email,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Eq(db.InvalidateVerificationTokensParams{
+						UserID:  user.ID,
+						Purpose: passwordResetPurpose,
+					})).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.CreateVerificationTokenParams) (db.VerificationTokens, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Equal(t, passwordResetPurpose, arg.Purpose)
+						require.WithinDuration(t, time.Now().Add(defaultPasswordResetDuration), arg.ExpiresAt, time.Minute)
+						return db.VerificationTokens{UserID: arg.UserID, TokenHash: arg.TokenHash}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireForgotPasswordResponse(t, recorder)
+
+				files, err := os.ReadDir(mailDir)
+				require.NoError(t, err)
+				require.Len(t, files, 1)
+			},
+		},
+		{
+			name: "Unknown Email",
+			body: gin.H{
+				"email": "randomuser@email.com",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireForgotPasswordResponse(t, recorder)
+
+				files, err := os.ReadDir(mailDir)
+				require.NoError(t, err)
+				require.Empty(t, files)
+			},
+		},
+		{
+			name: "Invalid Email",
+			body: gin.H{
+				"email": "invalidmail",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, mailDir string) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+
+			mailDir := t.TempDir()
+			fileMailer, err := mailer.NewFileMailer(mailDir, "no-reply@travel.agency")
+			require.NoError(t, err)
+			server.mailer = fileMailer
+
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/api/v1/users/password/forgot"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			server.background.Wait()
+			tc.checkResponse(t, recorder, mailDir)
+		})
+	}
+}
+
+func TestResetPasswordAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	newPassword := util.RandomString(8)
+	rawToken, tokenHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	resetToken := db.VerificationTokens{
+		ID:        util.RandomInt(1, 1000),
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		Purpose:   passwordResetPurpose,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"token":    rawToken,
+				"password": newPassword,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.GetVerificationTokenParams{
+					TokenHash: tokenHash,
+					Purpose:   passwordResetPurpose,
+				}
+				updatedUser := user
+				updatedUser.PasswordChangedAt = time.Now()
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(resetToken, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.ResetPasswordTxParams) (db.Users, error) {
+						require.Equal(t, resetToken.ID, arg.TokenID)
+						require.NoError(t, util.ValidatePassword(newPassword, arg.HashedPassword))
+						return updatedUser, nil
+					})
+				store.EXPECT().
+					CreateAuditEventTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.AuditEventParams) (db.AuditEvents, error) {
+						require.Equal(t, db.AuditActionUserResetPassword, arg.Action)
+						require.Equal(t, sql.NullInt64{Int64: user.ID, Valid: true}, arg.ActorID)
+						require.Equal(t, user, arg.Before)
+						require.Equal(t, updatedUser, arg.After)
+						return db.AuditEvents{}, nil
+					})
+				// every session is blocked, none is kept
+				store.EXPECT().
+					BlockOtherSessions(gomock.Any(), gomock.Eq(db.BlockOtherSessionsParams{
+						UserID:   user.ID,
+						FamilyID: uuid.Nil,
+					})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+
+				revokedBefore, err := server.revocations.UserTokensRevokedBefore(context.Background(), user.ID)
+				require.NoError(t, err)
+				require.WithinDuration(t, time.Now(), revokedBefore, time.Minute)
+			},
+		},
+		{
+			name: "Unknown Token",
+			body: gin.H{
+				"token":    "unknown",
+				"password": newPassword,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.VerificationTokens{}, sql.ErrNoRows)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Used Token",
+			body: gin.H{
+				"token":    rawToken,
+				"password": newPassword,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				usedToken := resetToken
+				usedToken.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(usedToken, nil)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Token",
+			body: gin.H{
+				"token":    rawToken,
+				"password": newPassword,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				expiredToken := resetToken
+				expiredToken.ExpiresAt = time.Now().Add(-time.Minute)
+
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(expiredToken, nil)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Concurrent Use",
+			body: gin.H{
+				"token":    rawToken,
+				"password": newPassword,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(resetToken, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					BlockOtherSessions(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Short Password",
+			body: gin.H{
+				"token":    rawToken,
+				"password": "short",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeTooShort)
+			},
+		},
+		{
+			name: "Password Contains Email",
+			body: gin.H{
+				"token":    rawToken,
+				"password": user.Email + "!",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(resetToken, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					ResetPasswordTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeContainsPersonal)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/api/v1/users/password/reset"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server)
+		})
+	}
+}
+
+func requireForgotPasswordResponse(t *testing.T, recorder *httptest.ResponseRecorder) {
+	var res forgotPasswordResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, "if an account exists for this email, a password reset link has been sent to it", res.Message)
+}
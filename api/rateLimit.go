@@ -1,99 +1,111 @@
 package api
 
 import (
-	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/sajitron/travel-agency/ratelimit"
 )
 
-const (
-	defaultExpiryTime = 3600 // in seconds i.e. each token has a lifetime of 1 hour
-	maximumTries      = 5    // bucket limit
-)
-
-var ctx = context.Background()
-
-type FailedAccess struct {
-	Identity   string
-	AccessTime time.Time
-	ExpiryTime time.Time
-}
-
-// rateLimit checks if the identity has failed to login more than a specific number of times in the last hour
-func rateLimit(identity string, redisClient *redis.Client) error {
-	loginIdentity := fmt.Sprintf("%s-login", identity)
-	// check if store exists
-	existingIdentity, err := redisClient.LRange(ctx, loginIdentity, 0, -1).Result()
-	if err != nil {
-		fmt.Println("Error getting list:", err)
-		return nil
+// Rate limit policies of the API. Guards against guessing fail closed, while limits that only
+// protect the mailer or the server fail open so an outage of the backend doesn't lock everyone out.
+var (
+	// failed logins per email
+	loginRateLimit = ratelimit.Policy{
+		Name:   "login",
+		Limit:  5,
+		Window: time.Hour,
 	}
-
-	// check length
-	listLength, err := redisClient.LLen(ctx, loginIdentity).Result()
-	if listLength >= maximumTries {
-		return fmt.Errorf("maximum tries attained, try again later")
+	// failed two-factor codes per user
+	twoFactorRateLimit = ratelimit.Policy{
+		Name:   "2fa",
+		Limit:  5,
+		Window: time.Hour,
 	}
-
-	if err != nil {
-		fmt.Println("Error checking the length of list:", err)
-		return nil
+	// verification emails per user
+	verifyEmailRateLimit = ratelimit.Policy{
+		Name:        "verify-email",
+		Limit:       5,
+		Window:      time.Hour,
+		FailureMode: ratelimit.FailOpen,
 	}
-
-	// loop over existing list and remove expired failed access
-	for i := 0; i < int(listLength); i++ {
-		failedAccess, _ := redisClient.LIndex(ctx, loginIdentity, int64(i)).Result()
-
-		var structInList FailedAccess
-		err = json.Unmarshal([]byte(failedAccess), &structInList)
-		if err != nil {
-			fmt.Println("Error unmarshalling failed access:", err)
-			continue
-		}
-
-		if structInList.ExpiryTime.Before(time.Now()) {
-			_, err := redisClient.LRem(ctx, loginIdentity, 0, failedAccess).Result()
-			if err != nil {
-				fmt.Println("Error removing expired failed access", err)
-			} else {
-				fmt.Printf("Expired failed access - %s - removed successfully", loginIdentity)
-			}
-		}
+	// password reset emails per email
+	forgotPasswordRateLimit = ratelimit.Policy{
+		Name:        "forgot-password",
+		Limit:       5,
+		Window:      time.Hour,
+		FailureMode: ratelimit.FailOpen,
+	}
+	// magic link emails per email
+	magicLinkRateLimit = ratelimit.Policy{
+		Name:        "magic-link",
+		Limit:       5,
+		Window:      time.Hour,
+		FailureMode: ratelimit.FailOpen,
+	}
+	// sign ups per client IP
+	signupRateLimit = ratelimit.Policy{
+		Name:        "signup",
+		Limit:       10,
+		Window:      time.Hour,
+		FailureMode: ratelimit.FailOpen,
+	}
+	// requests to the other public endpoints per client IP
+	publicRateLimit = ratelimit.Policy{
+		Name:        "public",
+		Limit:       60,
+		Window:      time.Minute,
+		FailureMode: ratelimit.FailOpen,
 	}
+)
 
-	if existingIdentity == nil || listLength < maximumTries {
-		expiryTime := defaultExpiryTime * time.Second
-		currentTime := time.Now()
-		failedAccess := FailedAccess{
-			Identity:   identity,
-			AccessTime: currentTime,
-			ExpiryTime: currentTime.Add(time.Second * defaultExpiryTime),
-		}
+var (
+	errRateLimited            = errors.New("too many requests, try again later")
+	errRateLimiterUnavailable = errors.New("rate limiter is unavailable, try again later")
+)
 
-		jsonBytes, err := json.Marshal(failedAccess)
-		if err != nil {
-			fmt.Println("Error marshalling struct to JSON:", err)
+// applyRateLimit sets the rate limit headers of a response from the result of a rate limiter call.
+// It returns errRateLimited when the limit has been reached. Errors of the backend are logged and
+// settled by the failure mode of the policy.
+func applyRateLimit(ctx *gin.Context, policy ratelimit.Policy, result ratelimit.Result, err error) error {
+	if err != nil {
+		log.Error().Err(err).Str("policy", policy.Name).Msg("unable to check rate limit")
+		if policy.FailureMode == ratelimit.FailOpen {
 			return nil
 		}
+		return errRateLimiterUnavailable
+	}
 
-		err = redisClient.RPush(ctx, loginIdentity, string(jsonBytes)).Err()
-		if err != nil {
-			fmt.Println("Error adding slice to new redis list:", err)
-			return nil
-		}
+	ctx.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	ctx.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.Header("X-RateLimit-Reset", formatSeconds(result.ResetAfter))
 
-		err = redisClient.Expire(ctx, loginIdentity, expiryTime).Err()
-		if err != nil {
-			fmt.Println("Error setting expiry time on redis list:", err)
-			return nil
-		}
+	if !result.Allowed {
+		ctx.Header("Retry-After", formatSeconds(result.RetryAfter))
+		return errRateLimited
 	}
-
-	fmt.Printf("Failed access logged for %s", identity)
 	return nil
 }
 
-// TODO: add tests
+// rateLimitStatus picks the status code of an error returned by applyRateLimit
+func rateLimitStatus(err error) int {
+	if err == errRateLimiterUnavailable {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusTooManyRequests
+}
+
+// formatSeconds rounds a duration up to whole seconds, as the rate limit headers expect
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(duration.Seconds())), 10)
+}
+
+// clientIPKey rate limits requests by the IP address of the client
+func clientIPKey(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
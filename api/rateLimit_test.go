@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/ratelimit"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// unavailableRateLimiter fails every call, as if its backend were down
+type unavailableRateLimiter struct{}
+
+var errUnavailableBackend = errors.New("backend unavailable")
+
+func (unavailableRateLimiter) Allow(ctx context.Context, policy ratelimit.Policy, key string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errUnavailableBackend
+}
+
+func (unavailableRateLimiter) Peek(ctx context.Context, policy ratelimit.Policy, key string) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errUnavailableBackend
+}
+
+func (unavailableRateLimiter) Reset(ctx context.Context, policy ratelimit.Policy, key string) error {
+	return errUnavailableBackend
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	policy := ratelimit.Policy{
+		Name:   "test",
+		Limit:  2,
+		Window: time.Minute,
+	}
+
+	testCases := []struct {
+		name          string
+		limiter       ratelimit.RateLimiter
+		failureMode   ratelimit.FailureMode
+		requests      int
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			limiter:  ratelimit.NewMemoryRateLimiter(),
+			requests: 2,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "2", recorder.Header().Get("X-RateLimit-Limit"))
+				require.Equal(t, "0", recorder.Header().Get("X-RateLimit-Remaining"))
+				require.Equal(t, "60", recorder.Header().Get("X-RateLimit-Reset"))
+				require.Empty(t, recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name:     "Limit Reached",
+			limiter:  ratelimit.NewMemoryRateLimiter(),
+			requests: 3,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+				require.Equal(t, "0", recorder.Header().Get("X-RateLimit-Remaining"))
+				require.Equal(t, "60", recorder.Header().Get("Retry-After"))
+			},
+		},
+		{
+			name:        "Unavailable Fail Closed",
+			limiter:     unavailableRateLimiter{},
+			failureMode: ratelimit.FailClosed,
+			requests:    1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			},
+		},
+		{
+			name:        "Unavailable Fail Open",
+			limiter:     unavailableRateLimiter{},
+			failureMode: ratelimit.FailOpen,
+			requests:    1,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Empty(t, recorder.Header().Get("X-RateLimit-Limit"))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, nil)
+
+			testPolicy := policy
+			testPolicy.FailureMode = tc.failureMode
+
+			limitPath := "/limit"
+			server.router.GET(
+				limitPath,
+				rateLimitMiddleware(tc.limiter, testPolicy, clientIPKey),
+				func(ctx *gin.Context) {
+					ctx.JSON(http.StatusOK, gin.H{})
+				},
+			)
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < tc.requests; i++ {
+				recorder = httptest.NewRecorder()
+				request, err := http.NewRequest(http.MethodGet, limitPath, nil)
+				require.NoError(t, err)
+
+				server.router.ServeHTTP(recorder, request)
+			}
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginUserRateLimit(t *testing.T) {
+	user, password := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUser(gomock.Any(), gomock.Eq(user.Email)).
+		Times(loginRateLimit.Limit).
+		Return(user, nil)
+	store.EXPECT().
+		RecordFailedLogin(gomock.Any(), gomock.Eq(user.ID)).
+		Times(loginRateLimit.Limit).
+		Return(user, nil)
+
+	server := newTestServer(t, store)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(gin.H{
+			"email":    user.Email,
+			"password": password,
+		})
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(data))
+		require.NoError(t, err)
+
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < loginRateLimit.Limit; i++ {
+		recorder := login("wrong-password")
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		requireInvalidCredentials(t, recorder.Body)
+	}
+
+	// the right password is refused too, without looking the user up
+	recorder := login(password)
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+
+	retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, loginRateLimit.Window.Seconds(), retryAfter, 1)
+}
+
+func TestLoginUserRateLimitReset(t *testing.T) {
+	user, password := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetUser(gomock.Any(), gomock.Eq(user.Email)).
+		Times(1).
+		Return(user, nil)
+	store.EXPECT().
+		CreateSession(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(db.Sessions{}, nil)
+
+	server := newTestServer(t, store)
+	identity := strings.ToLower(user.Email)
+
+	for i := 0; i < loginRateLimit.Limit-1; i++ {
+		_, err := server.rateLimiter.Allow(context.Background(), loginRateLimit, identity)
+		require.NoError(t, err)
+	}
+
+	data, err := json.Marshal(gin.H{
+		"email":    user.Email,
+		"password": password,
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(data))
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// a successful login forgets the earlier failures
+	result, err := server.rateLimiter.Peek(context.Background(), loginRateLimit, identity)
+	require.NoError(t, err)
+	require.Equal(t, loginRateLimit.Limit, result.Remaining)
+}
+
+func TestClientIPRateLimitTrustedProxies(t *testing.T) {
+	const proxyAddr = "10.0.0.2:4321"
+
+	signup := func(server *Server, forwardedFor string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewReader([]byte("{}")))
+		require.NoError(t, err)
+
+		request.RemoteAddr = proxyAddr
+		request.Header.Set("X-Forwarded-For", forwardedFor)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("Spoofed X-Forwarded-For", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		server := newTestServer(t, mockdb.NewMockStore(ctrl))
+
+		// every request claims another IP, but they all come from the same address
+		for i := 0; i < signupRateLimit.Limit; i++ {
+			recorder := signup(server, fmt.Sprintf("198.51.100.%d", i+1))
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+		}
+
+		recorder := signup(server, "198.51.100.200")
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	})
+
+	t.Run("Trusted Proxy", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		config := util.Config{
+			TokenSymmetricKey:    util.RandomString(32),
+			AccessTokenDuration:  time.Minute,
+			RefreshTokenDuration: time.Hour,
+			TOTPEncryptionKey:    util.RandomString(32),
+			MailerType:           mailerTypeLog,
+			TrustedProxies:       []string{"10.0.0.0/8"},
+		}
+		server, err := NewServer(config, mockdb.NewMockStore(ctrl), nil)
+		require.NoError(t, err)
+
+		for i := 0; i < signupRateLimit.Limit; i++ {
+			recorder := signup(server, "198.51.100.1")
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+		}
+
+		// the proxy tells clients apart
+		recorder := signup(server, "198.51.100.1")
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		recorder = signup(server, "198.51.100.2")
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
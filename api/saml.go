@@ -0,0 +1,344 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/saml"
+	"github.com/sajitron/travel-agency/util"
+)
+
+// samlRequestDuration is how long a user has to sign in at the identity provider once the flow has started
+const samlRequestDuration = 10 * time.Minute
+
+var (
+	errSAMLNotConfigured  = errors.New("SAML login is not configured")
+	errInvalidSAMLRequest = errors.New("the sign in request is invalid or has expired, please start again")
+	errSAMLNoEmail        = errors.New("the identity provider did not share an email address")
+	errSAMLEmailDomain    = errors.New("the email address is not in one of the organization's domains")
+	errSAMLAccountExists  = errors.New("an account with this email already exists, verify its email before signing in with your organization")
+)
+
+// The attributes users are mapped from when an organization doesn't name them. They cover the names used by
+// common identity providers, the claim types of Active Directory and the LDAP attribute OIDs.
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlFirstNameAttributes = []string{
+		"first_name", "firstName", "givenName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+		"urn:oid:2.5.4.42",
+	}
+	samlLastNameAttributes = []string{
+		"last_name", "lastName", "surname", "sn",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+		"urn:oid:2.5.4.4",
+	}
+)
+
+// samlEntityID is the entity ID of the service provider an organization's identity provider knows. It doubles
+// as the URL of the metadata.
+func (server *Server) samlEntityID(org db.Organizations) string {
+	return strings.TrimSuffix(server.config.SAMLBaseURL, "/") + "/saml/" + org.Slug + "/metadata"
+}
+
+// samlACSURL is the assertion consumer service an organization's identity provider posts responses to
+func (server *Server) samlACSURL(org db.Organizations) string {
+	return strings.TrimSuffix(server.config.SAMLBaseURL, "/") + "/saml/" + org.Slug + "/acs"
+}
+
+// samlServiceProvider returns the service provider known to an organization's identity provider
+func (server *Server) samlServiceProvider(org db.Organizations) (*saml.ServiceProvider, error) {
+	certs, err := saml.ParseCertificates(org.IdpCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saml.ServiceProvider{
+		EntityID: server.samlEntityID(org),
+		ACSURL:   server.samlACSURL(org),
+		IdP: saml.IdentityProvider{
+			EntityID:     org.IdpEntityID,
+			SSOURL:       org.IdpSsoUrl,
+			Certificates: certs,
+		},
+	}, nil
+}
+
+// getSAMLOrganization returns the organization named in the URL and its service provider. It responds with
+// an error if there is none.
+func (server *Server) getSAMLOrganization(ctx *gin.Context) (db.Organizations, *saml.ServiceProvider, bool) {
+	if server.config.SAMLBaseURL == "" {
+		ctx.JSON(http.StatusNotFound, errorResponse(errSAMLNotConfigured))
+		return db.Organizations{}, nil, false
+	}
+
+	var urlParam organizationParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return db.Organizations{}, nil, false
+	}
+
+	org, err := server.store.GetOrganizationBySlug(ctx, urlParam.Slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return db.Organizations{}, nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Organizations{}, nil, false
+	}
+
+	sp, err := server.samlServiceProvider(org)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Organizations{}, nil, false
+	}
+	return org, sp, true
+}
+
+// getSAMLMetadata serves the metadata an organization's identity provider is set up with
+func (server *Server) getSAMLMetadata(ctx *gin.Context) {
+	_, sp, ok := server.getSAMLOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	metadata, err := sp.Metadata()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+type samlStartResponse struct {
+	// RedirectURL sends the user to the identity provider with the authentication request
+	RedirectURL string `json:"redirect_url"`
+	// RelayState comes back with the response. The client should check it matches before finishing the flow.
+	RelayState string    `json:"relay_state"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// startSAMLLogin starts signing a user in with their organization's identity provider. The ID of the
+// authentication request is stored under a random relay state, which the response must come back with.
+func (server *Server) startSAMLLogin(ctx *gin.Context) {
+	org, sp, ok := server.getSAMLOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	requestID, err := saml.NewRequestID()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	relayState, relayStateHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	redirectURL, err := sp.AuthnRequestURL(requestID, relayState)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	samlRequest, err := server.store.CreateSAMLRequest(ctx, db.CreateSAMLRequestParams{
+		RelayStateHash: relayStateHash,
+		RequestID:      requestID,
+		OrganizationID: org.ID,
+		ExpiresAt:      time.Now().Add(samlRequestDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, samlStartResponse{
+		RedirectURL: redirectURL,
+		RelayState:  relayState,
+		ExpiresAt:   samlRequest.ExpiresAt,
+	})
+}
+
+type samlACSRequest struct {
+	SAMLResponse string `form:"SAMLResponse" binding:"required"`
+	RelayState   string `form:"RelayState" binding:"required"`
+}
+
+// loginSAML is the assertion consumer service, where the identity provider posts its response. The response
+// must answer a request started for the same organization, which is used up by the first attempt. Users are
+// created the first time they sign in, and the login ends like a password login.
+func (server *Server) loginSAML(ctx *gin.Context) {
+	org, sp, ok := server.getSAMLOrganization(ctx)
+	if !ok {
+		return
+	}
+
+	var req samlACSRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	samlRequest, err := server.store.UseSAMLRequest(ctx, util.HashVerificationToken(req.RelayState))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidSAMLRequest))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if samlRequest.OrganizationID != org.ID || time.Now().After(samlRequest.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidSAMLRequest))
+		return
+	}
+
+	assertion, err := sp.ParseResponse(req.SAMLResponse)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	if assertion.InResponseTo != samlRequest.RequestID {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidSAMLRequest))
+		return
+	}
+
+	user, ok := server.findOrCreateSAMLUser(ctx, org, assertion)
+	if !ok {
+		return
+	}
+
+	server.loginFederatedUser(ctx, user)
+}
+
+// findOrCreateSAMLUser returns the user an assertion is about. The first time a user signs in, they're linked
+// to the account with their email, or a new account is created.
+func (server *Server) findOrCreateSAMLUser(ctx *gin.Context, org db.Organizations, assertion *saml.Assertion) (db.Users, bool) {
+	email := samlUserEmail(org, assertion)
+
+	identity, err := server.store.GetSAMLIdentity(ctx, db.GetSAMLIdentityParams{
+		OrganizationID: org.ID,
+		NameID:         assertion.NameID,
+	})
+	if err == nil {
+		user, err := server.store.GetUserById(ctx, identity.UserID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return db.Users{}, false
+		}
+
+		if email == "" {
+			email = identity.Email
+		}
+		err = server.store.RecordSAMLIdentityLogin(ctx, db.RecordSAMLIdentityLoginParams{
+			ID:    identity.ID,
+			Email: email,
+		})
+		if err != nil {
+			log.Error().Err(err).Int64("identity_id", identity.ID).Msg("unable to record SAML identity login")
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Users{}, false
+	}
+
+	if email == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errSAMLNoEmail))
+		return db.Users{}, false
+	}
+	// an organization's identity provider only vouches for the addresses of its own domains
+	_, domain, _ := strings.Cut(email, "@")
+	if !containsString(org.EmailDomains, strings.ToLower(domain)) {
+		ctx.JSON(http.StatusForbidden, errorResponse(errSAMLEmailDomain))
+		return db.Users{}, false
+	}
+
+	user, err := server.store.GetUser(ctx, email)
+	if err == nil {
+		// whoever signed up with the address without proving they own it must not share the account
+		if !user.EmailVerifiedAt.Valid {
+			ctx.JSON(http.StatusConflict, errorResponse(errSAMLAccountExists))
+			return db.Users{}, false
+		}
+
+		_, err = server.store.CreateSAMLIdentity(ctx, db.CreateSAMLIdentityParams{
+			OrganizationID: org.ID,
+			UserID:         user.ID,
+			NameID:         assertion.NameID,
+			Email:          email,
+		})
+		if err != nil {
+			respondIdentityError(ctx, err)
+			return db.Users{}, false
+		}
+		return user, true
+	}
+	if err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Users{}, false
+	}
+
+	hashedPassword, ok := server.hashRandomPassword(ctx)
+	if !ok {
+		return db.Users{}, false
+	}
+
+	firstName, lastName := samlUserNames(org, assertion, email)
+	result, err := server.store.CreateSAMLUserTx(ctx, db.CreateSAMLUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			FirstName: firstName,
+			LastName:  lastName,
+			Email:     email,
+			Password:  hashedPassword,
+		},
+		OrganizationID: org.ID,
+		NameID:         assertion.NameID,
+	})
+	if err != nil {
+		respondIdentityError(ctx, err)
+		return db.Users{}, false
+	}
+	return result.User, true
+}
+
+// samlAttribute returns the attribute an organization names, or the first of the default attributes found
+func samlAttribute(assertion *saml.Assertion, name string, defaults []string) string {
+	if name != "" {
+		return assertion.Attribute(name)
+	}
+	return assertion.Attribute(defaults...)
+}
+
+// samlUserEmail maps the email of a user, falling back to the name ID when it's an email
+func samlUserEmail(org db.Organizations, assertion *saml.Assertion) string {
+	email := samlAttribute(assertion, org.EmailAttribute, samlEmailAttributes)
+	if email == "" && assertion.NameIDFormat == saml.NameIDFormatEmail {
+		email = assertion.NameID
+	}
+	return strings.TrimSpace(email)
+}
+
+// samlUserNames maps the names of a new user, falling back to the email when the provider shares no name
+func samlUserNames(org db.Organizations, assertion *saml.Assertion, email string) (firstName string, lastName string) {
+	firstName = samlAttribute(assertion, org.FirstNameAttribute, samlFirstNameAttributes)
+	lastName = samlAttribute(assertion, org.LastNameAttribute, samlLastNameAttributes)
+	if firstName == "" && lastName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+	return firstName, lastName
+}
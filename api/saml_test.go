@@ -0,0 +1,586 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/saml/samltest"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+// newSAMLTestServer creates a test server with SAML login, and an organization that signs in at a stand-in provider
+func newSAMLTestServer(t *testing.T, store db.Store) (*Server, *samltest.IdP, db.Organizations) {
+	idp, err := samltest.NewIdP("https://idp.example.com/" + util.RandomString(8))
+	require.NoError(t, err)
+
+	server := newTestServer(t, store)
+	server.config.SAMLBaseURL = "https://travel.agency/api/v1"
+
+	org := db.Organizations{
+		ID:             util.RandomInt(1, 100),
+		Name:           util.RandomName(),
+		Slug:           strings.ToLower(util.RandomString(8)),
+		EmailDomains:   []string{"email.com"},
+		IdpEntityID:    idp.EntityID,
+		IdpSsoUrl:      idp.SSOURL,
+		IdpCertificate: idp.CertificatePEM(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	return server, idp, org
+}
+
+// startSAMLTestFlow starts a login for the organization and reads the authentication request at the provider.
+// It returns the request, the relay state and the stored request.
+func startSAMLTestFlow(
+	t *testing.T,
+	server *Server,
+	store *mockdb.MockStore,
+	idp *samltest.IdP,
+	org db.Organizations,
+) (*samltest.AuthnRequest, string, db.SamlRequests) {
+	var samlRequest db.SamlRequests
+	store.EXPECT().
+		GetOrganizationBySlug(gomock.Any(), gomock.Eq(org.Slug)).
+		AnyTimes().
+		Return(org, nil)
+	store.EXPECT().
+		CreateSAMLRequest(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(_ context.Context, arg db.CreateSAMLRequestParams) (db.SamlRequests, error) {
+			samlRequest = db.SamlRequests{
+				RelayStateHash: arg.RelayStateHash,
+				RequestID:      arg.RequestID,
+				OrganizationID: arg.OrganizationID,
+				ExpiresAt:      arg.ExpiresAt,
+				CreatedAt:      time.Now(),
+			}
+			return samlRequest, nil
+		})
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/saml/"+org.Slug+"/login", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var res samlStartResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &res)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.RelayState)
+	require.Equal(t, org.ID, samlRequest.OrganizationID)
+	require.Equal(t, util.HashVerificationToken(res.RelayState), samlRequest.RelayStateHash)
+
+	authnRequest, relayState, err := idp.ParseAuthnRequest(res.RedirectURL)
+	require.NoError(t, err)
+	require.Equal(t, res.RelayState, relayState)
+	require.Equal(t, samlRequest.RequestID, authnRequest.ID)
+	require.Equal(t, server.samlACSURL(org), authnRequest.ACSURL)
+	require.Equal(t, server.samlEntityID(org), authnRequest.Issuer)
+
+	return authnRequest, relayState, samlRequest
+}
+
+func randomSAMLUser(user db.Users) samltest.User {
+	return samltest.User{
+		NameID: util.RandomString(16),
+		Attributes: map[string]string{
+			"email":     user.Email,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+		},
+	}
+}
+
+func TestLoginSAMLAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	testCases := []struct {
+		name           string
+		samlUser       func(samlUser *samltest.User)
+		modifyResponse func(res *samltest.Response)
+		modifyRequest  func(samlRequest *db.SamlRequests)
+		buildStubs     func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests)
+		checkResponse  func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Known Identity",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Eq(samlRequest.RelayStateHash)).
+					Times(1).
+					Return(samlRequest, nil)
+
+				arg := db.GetSAMLIdentityParams{
+					OrganizationID: org.ID,
+					NameID:         samlUser.NameID,
+				}
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.SamlIdentities{ID: 1, OrganizationID: org.ID, UserID: user.ID, NameID: samlUser.NameID}, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					RecordSAMLIdentityLogin(gomock.Any(), gomock.Eq(db.RecordSAMLIdentityLoginParams{ID: 1, Email: user.Email})).
+					Times(1)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res loginUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.Equal(t, user.Email, res.User.Email)
+			},
+		},
+		{
+			name: "New User",
+			samlUser: func(samlUser *samltest.User) {
+				samlUser.Attributes["email"] = util.RandomEmail()
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(samlUser.Attributes["email"])).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSAMLUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSAMLUserTxParams) (db.CreateSAMLUserTxResult, error) {
+						require.Equal(t, samlUser.Attributes["email"], arg.Email)
+						require.Equal(t, samlUser.Attributes["firstName"], arg.FirstName)
+						require.Equal(t, samlUser.Attributes["lastName"], arg.LastName)
+						require.NotEmpty(t, arg.Password)
+						require.Equal(t, org.ID, arg.OrganizationID)
+						require.Equal(t, samlUser.NameID, arg.NameID)
+
+						return db.CreateSAMLUserTxResult{
+							User: db.Users{ID: user.ID + 1, Email: arg.Email, EmailVerifiedAt: user.EmailVerifiedAt},
+						}, nil
+					})
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "New User Without Names",
+			samlUser: func(samlUser *samltest.User) {
+				samlUser.Attributes = map[string]string{"mail": "jane.doe@email.com"}
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq("jane.doe@email.com")).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSAMLUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSAMLUserTxParams) (db.CreateSAMLUserTxResult, error) {
+						require.Equal(t, "jane.doe", arg.FirstName)
+						require.Empty(t, arg.LastName)
+						return db.CreateSAMLUserTxResult{User: db.Users{ID: user.ID + 1, Email: arg.Email}}, nil
+					})
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Link Verified Account",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+
+				arg := db.CreateSAMLIdentityParams{
+					OrganizationID: org.ID,
+					UserID:         user.ID,
+					NameID:         samlUser.NameID,
+					Email:          user.Email,
+				}
+				store.EXPECT().
+					CreateSAMLIdentity(gomock.Any(), gomock.Eq(arg)).
+					Times(1)
+				store.EXPECT().
+					CreateSAMLUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Existing Account Unverified",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				unverifiedUser := user
+				unverifiedUser.EmailVerifiedAt = sql.NullTime{}
+
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(unverifiedUser, nil)
+				store.EXPECT().
+					CreateSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Email Outside Domains",
+			samlUser: func(samlUser *samltest.User) {
+				samlUser.Attributes["email"] = util.RandomString(6) + "@elsewhere.com"
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSAMLUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "No Email",
+			samlUser: func(samlUser *samltest.User) {
+				delete(samlUser.Attributes, "email")
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Two Factor Enabled",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				twoFactorUser := user
+				twoFactorUser.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlIdentities{ID: 1, UserID: user.ID}, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(twoFactorUser, nil)
+				store.EXPECT().
+					RecordSAMLIdentityLogin(gomock.Any(), gomock.Any()).
+					Times(1)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res twoFactorChallengeResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.TwoFactorRequired)
+				require.NotEmpty(t, res.ChallengeToken)
+			},
+		},
+		{
+			name: "Unsigned Response",
+			modifyResponse: func(res *samltest.Response) {
+				res.SignAssertion = false
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Other Request",
+			modifyResponse: func(res *samltest.Response) {
+				res.InResponseTo = "_" + util.RandomString(40)
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Unknown Relay State",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.SamlRequests{}, sql.ErrNoRows)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Request",
+			modifyRequest: func(samlRequest *db.SamlRequests) {
+				samlRequest.ExpiresAt = time.Now().Add(-time.Second)
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Request Of Other Organization",
+			modifyRequest: func(samlRequest *db.SamlRequests) {
+				samlRequest.OrganizationID++
+			},
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations, samlUser samltest.User, samlRequest db.SamlRequests) {
+				store.EXPECT().
+					UseSAMLRequest(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(samlRequest, nil)
+				store.EXPECT().
+					GetSAMLIdentity(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server, idp, org := newSAMLTestServer(t, store)
+
+			samlUser := randomSAMLUser(user)
+			if tc.samlUser != nil {
+				tc.samlUser(&samlUser)
+			}
+
+			authnRequest, relayState, samlRequest := startSAMLTestFlow(t, server, store, idp, org)
+			if tc.modifyRequest != nil {
+				tc.modifyRequest(&samlRequest)
+			}
+			tc.buildStubs(store, org, samlUser, samlRequest)
+
+			samlResponse := idp.NewResponse(authnRequest, samlUser)
+			if tc.modifyResponse != nil {
+				tc.modifyResponse(samlResponse)
+			}
+			encoded, err := idp.Encode(samlResponse)
+			require.NoError(t, err)
+
+			form := url.Values{}
+			form.Set("SAMLResponse", encoded)
+			form.Set("RelayState", relayState)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/saml/"+org.Slug+"/acs", strings.NewReader(form.Encode()))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginSAMLNotConfigured(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		GetOrganizationBySlug(gomock.Any(), gomock.Any()).
+		Times(0)
+	store.EXPECT().
+		CreateSAMLRequest(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/saml/acme/login", nil)
+	require.NoError(t, err)
+
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestGetSAMLMetadataAPI(t *testing.T) {
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore, org db.Organizations)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server, org db.Organizations)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Eq(org.Slug)).
+					Times(1).
+					Return(org, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server, org db.Organizations) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/samlmetadata+xml", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Body.String(), server.samlEntityID(org))
+				require.Contains(t, recorder.Body.String(), server.samlACSURL(org))
+			},
+		},
+		{
+			name: "Not Found",
+			buildStubs: func(store *mockdb.MockStore, org db.Organizations) {
+				store.EXPECT().
+					GetOrganizationBySlug(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Organizations{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder, server *Server, org db.Organizations) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server, _, org := newSAMLTestServer(t, store)
+			tc.buildStubs(store, org)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/api/v1/saml/"+org.Slug+"/metadata", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder, server, org)
+		})
+	}
+}
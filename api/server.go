@@ -1,72 +1,406 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/mailer"
+	"github.com/sajitron/travel-agency/oidc"
+	"github.com/sajitron/travel-agency/passwordpolicy"
+	"github.com/sajitron/travel-agency/ratelimit"
 	"github.com/sajitron/travel-agency/token"
 	"github.com/sajitron/travel-agency/util"
+	"github.com/sajitron/travel-agency/webauthn"
 )
 
 type Server struct {
-	config     util.Config
-	router     *gin.Engine
-	tokenMaker token.Maker
-	store      db.Store
+	config         util.Config
+	router         *gin.Engine
+	passwordHasher *util.PasswordHasher
+	passwordPolicy passwordpolicy.Policy
+	httpServer     *http.Server
+	redis          *redis.Client
+	tokenMaker     token.Maker
+	revocations    token.RevocationStore
+	rateLimiter    ratelimit.RateLimiter
+	mailer         mailer.Mailer
+	oidcProvider   *oidc.Provider
+	relyingParty   *webauthn.RelyingParty
+	store          db.Store
+	// background tracks the tasks still running after their response was sent
+	background sync.WaitGroup
 }
 
-// NewServer creates a new server and sets up routing
-func NewServer(config util.Config, store db.Store) (*Server, error) {
-	tokenMaker, err := token.NewJWTMaker(config.TokenSymmetricKey)
+// backgroundTaskTimeout bounds a task run after its response, such as sending an email
+const backgroundTaskTimeout = 30 * time.Second
+
+// NewServer creates a new server and sets up routing. redisClient may be nil, in which case
+// revocations and rate limits are kept in memory. The server closes it on shutdown.
+func NewServer(config util.Config, store db.Store, redisClient *redis.Client) (*Server, error) {
+	tokenMaker, err := newTokenMaker(config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialise token maker: %w", err)
 	}
+	mailSender, err := newMailer(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise mailer: %w", err)
+	}
+	passwordHasher, err := util.NewPasswordHasher(newPasswordHashParams(config), config.HashConcurrency, config.HashQueueTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise password hasher: %w", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise password policy: %w", err)
+	}
+	oidcProvider, err := newOIDCProvider(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise OIDC provider: %w", err)
+	}
+	relyingParty, err := newRelyingParty(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialise WebAuthn relying party: %w", err)
+	}
+	if config.ImpersonationDuration > maxImpersonationDuration {
+		return nil, fmt.Errorf("impersonation duration %s is above the max of %s", config.ImpersonationDuration, maxImpersonationDuration)
+	}
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:         config,
+		store:          store,
+		tokenMaker:     tokenMaker,
+		passwordHasher: passwordHasher,
+		passwordPolicy: passwordPolicy,
+		mailer:         mailSender,
+		oidcProvider:   oidcProvider,
+		relyingParty:   relyingParty,
+		redis:          redisClient,
 	}
 
-	server.setupRouter()
+	if redisClient != nil {
+		server.revocations = token.NewRedisRevocationStore(redisClient)
+		server.rateLimiter = ratelimit.NewRedisRateLimiter(redisClient)
+	} else {
+		server.revocations = token.NewMemoryRevocationStore()
+		server.rateLimiter = ratelimit.NewMemoryRateLimiter()
+	}
+
+	if err := server.setupRouter(); err != nil {
+		return nil, fmt.Errorf("unable to set trusted proxies: %w", err)
+	}
 
 	return server, nil
 }
 
-func GetRedisConnection(server *Server) *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:     server.config.RedisAddress,
-		Password: "",
-		DB:       0,
-	})
+// Supported values of the TOKEN_TYPE config
+const (
+	tokenTypeJWT    = "jwt"
+	tokenTypePaseto = "paseto"
+)
+
+// newTokenMaker creates the token maker picked by the config. Tokens are signed with the private key
+// when one is configured, so that other services can verify them with the published public key.
+// Otherwise they are signed with the symmetric key ring.
+func newTokenMaker(config util.Config) (token.Maker, error) {
+	if config.TokenPrivateKey != "" {
+		privateKey, err := token.ParseEd25519PrivateKey(config.TokenPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		switch config.TokenType {
+		case "", tokenTypeJWT:
+			return token.NewAsymmetricJWTMaker(config.TokenKeyID, privateKey)
+		case tokenTypePaseto:
+			return token.NewAsymmetricPasetoMaker(config.TokenKeyID, privateKey)
+		}
+		return nil, fmt.Errorf("unsupported token type %s", config.TokenType)
+	}
+
+	keyRing, err := newKeyRing(config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.TokenType {
+	case "", tokenTypeJWT:
+		return token.NewJWTMakerWithKeyRing(keyRing)
+	case tokenTypePaseto:
+		return token.NewPasetoMakerWithKeyRing(keyRing)
+	}
+	return nil, fmt.Errorf("unsupported token type %s", config.TokenType)
+}
+
+// newKeyRing builds the symmetric key ring from the active key and the verify-only keys in the config.
+// A verify-only key retires once its retirement time passes or once it's removed from the config.
+func newKeyRing(config util.Config) (*token.KeyRing, error) {
+	activeKeyID := config.TokenSymmetricKeyID
+	if activeKeyID == "" {
+		activeKeyID = token.DefaultKeyID
+	}
+
+	verifyKeys := make([]token.SymmetricKey, 0, len(config.TokenVerifyKeys))
+	for _, spec := range config.TokenVerifyKeys {
+		key, err := token.ParseSymmetricKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		verifyKeys = append(verifyKeys, key)
+	}
+
+	return token.NewKeyRing(token.SymmetricKey{
+		ID:     activeKeyID,
+		Secret: []byte(config.TokenSymmetricKey),
+	}, verifyKeys...)
 }
 
-func (server *Server) setupRouter() {
+// newPasswordHashParams picks how new passwords are hashed. Anything left out of the config falls back
+// to util.DefaultPasswordHashParams.
+func newPasswordHashParams(config util.Config) util.PasswordHashParams {
+	params := util.DefaultPasswordHashParams
+	if config.PasswordHashAlgorithm != "" {
+		params.Algorithm = config.PasswordHashAlgorithm
+	}
+	if config.BcryptCost != 0 {
+		params.BcryptCost = config.BcryptCost
+	}
+	if config.Argon2Memory != 0 {
+		params.Argon2id.Memory = config.Argon2Memory
+	}
+	if config.Argon2Iterations != 0 {
+		params.Argon2id.Iterations = config.Argon2Iterations
+	}
+	if config.Argon2Parallelism != 0 {
+		params.Argon2id.Parallelism = config.Argon2Parallelism
+	}
+	return params
+}
+
+// Defaults of the password policy. Character classes aren't required by default, as length and the
+// breached password list do more against guessing.
+const (
+	defaultPasswordMinLength = 8
+	defaultPasswordMaxLength = 128
+)
+
+// newPasswordPolicy builds the password policy from the config, loading the breached password list
+// if a file is configured
+func newPasswordPolicy(config util.Config) (passwordpolicy.Policy, error) {
+	policy := passwordpolicy.Policy{
+		MinLength:           defaultPasswordMinLength,
+		MaxLength:           defaultPasswordMaxLength,
+		MinCharacterClasses: config.PasswordMinClasses,
+		AllowPersonalInfo:   config.PasswordAllowPersonal,
+	}
+	if config.PasswordMinLength != 0 {
+		policy.MinLength = config.PasswordMinLength
+	}
+	if config.PasswordMaxLength != 0 {
+		policy.MaxLength = config.PasswordMaxLength
+	}
+	if policy.MaxLength < policy.MinLength {
+		return passwordpolicy.Policy{}, fmt.Errorf("password max length %d is below the min length %d", policy.MaxLength, policy.MinLength)
+	}
+
+	if config.BreachedPasswordsFile != "" {
+		breached, err := passwordpolicy.LoadBreachedList(config.BreachedPasswordsFile)
+		if err != nil {
+			return passwordpolicy.Policy{}, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// Supported values of the MAILER_TYPE config
+const (
+	mailerTypeLog  = "log"
+	mailerTypeFile = "file"
+	mailerTypeSMTP = "smtp"
+)
+
+// newMailer creates the mailer picked by the config. The type must be set, so that a deployment missing it fails
+// to start rather than silently dropping every email.
+func newMailer(config util.Config) (mailer.Mailer, error) {
+	switch config.MailerType {
+	case "":
+		return nil, fmt.Errorf("MAILER_TYPE must be set to %s, %s or %s", mailerTypeSMTP, mailerTypeFile, mailerTypeLog)
+	case mailerTypeLog:
+		return mailer.NewLogMailer(), nil
+	case mailerTypeFile:
+		return mailer.NewFileMailer(config.MailerFileDir, config.MailerFrom)
+	case mailerTypeSMTP:
+		return mailer.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailerFrom)
+	}
+	return nil, fmt.Errorf("unsupported mailer type %s", config.MailerType)
+}
+
+func (server *Server) setupRouter() error {
 
 	router := gin.Default()
+	// the client IP keys rate limits and is recorded in sessions and audit events, so X-Forwarded-For is only
+	// believed when it's set by one of our own proxies
+	if err := router.SetTrustedProxies(server.config.TrustedProxies); err != nil {
+		return err
+	}
+	router.Use(requestIDMiddleware())
+
+	router.GET("/.well-known/jwks.json", server.getJWKS)
 
 	baseRoute := router.Group("/api/v1/")
 
-	baseRoute.GET("/health", func(ctx *gin.Context) {
-		ctx.JSON(http.StatusOK, "up and running")
-	})
+	baseRoute.GET("/health", server.health)
+
+	signupLimit := rateLimitMiddleware(server.rateLimiter, signupRateLimit, clientIPKey)
+	publicLimit := rateLimitMiddleware(server.rateLimiter, publicRateLimit, clientIPKey)
 
-	baseRoute.POST("/users", server.createUser)
-	baseRoute.POST("/users/login", server.loginUser)
-	baseRoute.POST("/users/renew-token", server.renewAccessToken)
+	baseRoute.POST("/users", signupLimit, server.createUser)
+	baseRoute.POST("/users/login", publicLimit, server.loginUser)
+	baseRoute.POST("/users/login/2fa", publicLimit, server.loginTwoFactor)
+	baseRoute.POST("/users/login/oidc", publicLimit, server.startOIDCLogin)
+	baseRoute.POST("/users/login/oidc/callback", publicLimit, server.loginOIDC)
+	baseRoute.POST("/users/login/passkey/start", publicLimit, server.startPasskeyLogin)
+	baseRoute.POST("/users/login/passkey", publicLimit, server.loginPasskey)
+	baseRoute.POST("/users/login/magic-link/send", publicLimit, server.sendMagicLink)
+	baseRoute.POST("/users/login/magic-link", publicLimit, server.loginMagicLink)
+	baseRoute.POST("/users/renew-token", publicLimit, server.renewAccessToken)
+	baseRoute.POST("/users/logout", server.logoutUser)
+	baseRoute.POST("/users/verify-email", publicLimit, server.verifyEmail)
+	baseRoute.POST("/users/password/forgot", publicLimit, server.forgotPassword)
+	baseRoute.POST("/users/password/reset", publicLimit, server.resetPassword)
+	baseRoute.POST("/oauth/token", publicLimit, server.oauthToken)
+	// introspection is called on every request other services get, so it's left out of the per IP limit.
+	// Only known clients can call it.
+	baseRoute.POST("/oauth/introspect", server.introspectToken)
+	baseRoute.GET("/saml/:slug/metadata", server.getSAMLMetadata)
+	baseRoute.POST("/saml/:slug/login", publicLimit, server.startSAMLLogin)
+	baseRoute.POST("/saml/:slug/acs", publicLimit, server.loginSAML)
 
-	authRoutes := baseRoute.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes := baseRoute.Group("/").Use(
+		authMiddleware(server.tokenMaker, server.revocations, server.store),
+		auditImpersonation(server.store),
+	)
 
+	authRoutes.GET("/userinfo", server.getUserInfo)
 	authRoutes.GET("/users/:id", server.getUserById)
 	authRoutes.PUT("/users/:id", server.updateUser)
+	authRoutes.PUT("/users/:id/role", requireFirstParty(), requirePermission(util.PermissionUsersManageRole), server.updateUserRole)
+	authRoutes.GET("/users/:id/lockout", requirePermission(util.PermissionUsersRead), server.getUserLockout)
+	authRoutes.POST("/users/:id/unlock", requirePermission(util.PermissionUsersWrite), server.unlockUser)
+	authRoutes.POST("/users/:id/impersonate", requireFirstParty(), requirePermission(util.PermissionUsersImpersonate), server.impersonateUser)
+	// account security is managed by the user themselves, a leaked API key or OAuth token or an admin acting as
+	// the user can't take over the account
+	authRoutes.POST("/users/:id/2fa/totp", requireFirstParty(), server.enrollTOTP)
+	authRoutes.POST("/users/:id/2fa/totp/confirm", requireFirstParty(), server.confirmTOTP)
+	authRoutes.DELETE("/users/:id/2fa/totp", requireFirstParty(), server.disableTOTP)
+	authRoutes.POST("/users/:id/verify-email/resend", requireFirstParty(), server.resendVerificationEmail)
+	authRoutes.GET("/users/:id/sessions", requireFirstParty(), server.listSessions)
+	authRoutes.DELETE("/users/:id/sessions", requireFirstParty(), server.revokeOtherSessions)
+	authRoutes.DELETE("/users/:id/sessions/:session_id", requireFirstParty(), server.revokeSession)
+	authRoutes.POST("/users/:id/api-keys", requireFirstParty(), server.createAPIKey)
+	authRoutes.GET("/users/:id/api-keys", requireFirstParty(), server.listAPIKeys)
+	authRoutes.DELETE("/users/:id/api-keys/:key_id", requireFirstParty(), server.revokeAPIKey)
+	authRoutes.POST("/users/:id/identities/start", requireFirstParty(), server.startIdentityLink)
+	authRoutes.POST("/users/:id/identities", requireFirstParty(), server.linkIdentity)
+	authRoutes.GET("/users/:id/identities", requireFirstParty(), server.listIdentities)
+	authRoutes.DELETE("/users/:id/identities/:identity_id", requireFirstParty(), server.unlinkIdentity)
+	authRoutes.POST("/users/:id/passkeys/start", requireFirstParty(), server.startPasskeyRegistration)
+	authRoutes.POST("/users/:id/passkeys", requireFirstParty(), server.registerPasskey)
+	authRoutes.GET("/users/:id/passkeys", requireFirstParty(), server.listPasskeys)
+	authRoutes.DELETE("/users/:id/passkeys/:passkey_id", requireFirstParty(), server.deletePasskey)
+	authRoutes.GET("/users/:id/oauth/consents", requireFirstParty(), server.listOAuthConsents)
+	authRoutes.DELETE("/users/:id/oauth/consents/:client_id", requireFirstParty(), server.revokeOAuthConsent)
+	// an app acts for the users who consent to it, so only users who have verified their email may register one
+	authRoutes.POST("/oauth/clients", requireFirstParty(), requireVerifiedEmail(server.store), server.createOAuthClient)
+	authRoutes.GET("/oauth/clients", requireFirstParty(), server.listOAuthClients)
+	authRoutes.DELETE("/oauth/clients/:client_id", requireFirstParty(), server.deleteOAuthClient)
+	authRoutes.GET("/oauth/authorize", requireFirstParty(), server.oauthAuthorize)
+	authRoutes.POST("/oauth/authorize", requireFirstParty(), server.oauthConsent)
+	authRoutes.POST("/organizations", requirePermission(util.PermissionOrgsManage), server.createOrganization)
+	authRoutes.GET("/organizations", requirePermission(util.PermissionOrgsManage), server.listOrganizations)
+	authRoutes.GET("/organizations/:slug", requirePermission(util.PermissionOrgsManage), server.getOrganization)
+	authRoutes.PUT("/organizations/:slug", requirePermission(util.PermissionOrgsManage), server.updateOrganization)
+	authRoutes.GET("/audit-events", requirePermission(util.PermissionAuditRead), server.listAuditEvents)
 
 	server.router = router
+	return nil
+}
+
+// Run serves HTTP requests until ctx is done, then shuts the server down. It only returns once the shutdown is
+// over, so that the process doesn't exit while ongoing requests or background tasks are still running.
+func (server *Server) Run(ctx context.Context, address string, shutdownTimeout time.Duration) error {
+	server.httpServer = &http.Server{
+		Addr:    address,
+		Handler: server.router,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// Shutdown stops accepting requests, waits for the ongoing ones and their background tasks to finish and closes
+// the Redis client
+func (server *Server) Shutdown(ctx context.Context) error {
+	if server.httpServer != nil {
+		if err := server.httpServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if server.redis != nil {
+		return server.redis.Close()
+	}
+	return nil
+}
+
+// runInBackground runs a task without holding up the response, such as sending an email whose delay would
+// reveal something. The task gets a context of its own, as the request's is cancelled once the handler returns.
+func (server *Server) runInBackground(task func(ctx context.Context)) {
+	server.background.Add(1)
+	go func() {
+		defer server.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		defer cancel()
+		task(ctx)
+	}()
 }
 
-func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+// revokeSessionTokens rejects the tokens of a session until the longest of them, its refresh token, has expired
+func (server *Server) revokeSessionTokens(ctx context.Context, sessionID uuid.UUID) error {
+	return server.revocations.RevokeToken(ctx, sessionID, time.Now().Add(server.config.RefreshTokenDuration))
 }
 
 func errorResponse(err error) gin.H {
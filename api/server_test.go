@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTokenMakerKeyRotation(t *testing.T) {
+	for _, tokenType := range []string{tokenTypeJWT, tokenTypePaseto} {
+		tokenType := tokenType
+
+		t.Run(tokenType, func(t *testing.T) {
+			oldKey := util.RandomString(32)
+			newKey := util.RandomString(32)
+
+			oldMaker, err := newTokenMaker(util.Config{
+				TokenType:           tokenType,
+				TokenSymmetricKey:   oldKey,
+				TokenSymmetricKeyID: "old",
+			})
+			require.NoError(t, err)
+
+			oldToken, _, err := oldMaker.CreateToken(1, time.Minute)
+			require.NoError(t, err)
+
+			rotatedMaker, err := newTokenMaker(util.Config{
+				TokenType:           tokenType,
+				TokenSymmetricKey:   newKey,
+				TokenSymmetricKeyID: "new",
+				TokenVerifyKeys:     []string{"old:" + oldKey},
+			})
+			require.NoError(t, err)
+
+			_, err = rotatedMaker.VerifyToken(oldToken)
+			require.NoError(t, err)
+
+			retiredMaker, err := newTokenMaker(util.Config{
+				TokenType:           tokenType,
+				TokenSymmetricKey:   newKey,
+				TokenSymmetricKeyID: "new",
+				TokenVerifyKeys:     []string{"old:" + oldKey + "@" + time.Now().Add(-time.Minute).Format(time.RFC3339)},
+			})
+			require.NoError(t, err)
+
+			_, err = retiredMaker.VerifyToken(oldToken)
+			require.ErrorIs(t, err, token.ErrInvalidToken)
+		})
+	}
+}
+
+func TestNewTokenMakerUnsupportedType(t *testing.T) {
+	_, err := newTokenMaker(util.Config{
+		TokenType:         "saml",
+		TokenSymmetricKey: util.RandomString(32),
+	})
+	require.Error(t, err)
+}
+
+func TestNewMailer(t *testing.T) {
+	_, err := newMailer(util.Config{})
+	require.Error(t, err)
+
+	_, err = newMailer(util.Config{MailerType: "carrier-pigeon"})
+	require.Error(t, err)
+
+	_, err = newMailer(util.Config{MailerType: mailerTypeLog})
+	require.NoError(t, err)
+}
+
+func TestNewServerInvalidTrustedProxies(t *testing.T) {
+	config := util.Config{
+		TokenSymmetricKey: util.RandomString(32),
+		TOTPEncryptionKey: util.RandomString(32),
+		MailerType:        mailerTypeLog,
+		TrustedProxies:    []string{"not-an-ip"},
+	}
+	_, err := NewServer(config, nil, nil)
+	require.Error(t, err)
+}
+
+func TestRunWaitsForBackgroundTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newTestServer(t, mockdb.NewMockStore(ctrl))
+
+	var finished int32
+	server.runInBackground(func(ctx context.Context) {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := server.Run(ctx, "127.0.0.1:0", time.Second)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newTestServer(t, mockdb.NewMockStore(ctrl))
+
+	release := make(chan struct{})
+	defer close(release)
+	server.runInBackground(func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := server.Run(ctx, "127.0.0.1:0", 10*time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
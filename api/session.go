@@ -0,0 +1,219 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+type sessionResponse struct {
+	ID        uuid.UUID `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	ClientIp  string    `json:"client_ip"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newSessionResponse returns the fields of a session that are safe to show to its owner
+func newSessionResponse(session db.Sessions, currentSessionID uuid.UUID) sessionResponse {
+	return sessionResponse{
+		ID:        session.ID,
+		UserAgent: session.UserAgent,
+		ClientIp:  session.ClientIp,
+		Current:   session.FamilyID == currentSessionID,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+type userSessionsParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// listSessions lists the active sessions of a user
+func (server *Server) listSessions(ctx *gin.Context) {
+	var urlParam userSessionsParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionSessionsManage) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	sessions, err := server.store.ListActiveSessions(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, newSessionResponse(session, authPayload.SessionID))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type revokeSessionParam struct {
+	ID        int64  `uri:"id" binding:"required,min=1"`
+	SessionID string `uri:"session_id" binding:"required,uuid"`
+}
+
+// revokeSession blocks a single session of a user, along with every session it was rotated into
+func (server *Server) revokeSession(ctx *gin.Context) {
+	var urlParam revokeSessionParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionSessionsManage) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	session, err := server.store.GetSession(ctx, uuid.MustParse(urlParam.SessionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// don't reveal that a session belonging to someone else exists
+	if session.UserID != urlParam.ID {
+		ctx.JSON(http.StatusNotFound, errorResponse(sql.ErrNoRows))
+		return
+	}
+
+	err = server.store.BlockSessionFamily(ctx, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.revokeSessionTokens(ctx, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// revokeOtherSessions blocks every session of a user except the one making the request
+func (server *Server) revokeOtherSessions(ctx *gin.Context) {
+	var urlParam userSessionsParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionSessionsManage) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	// an admin revoking another user's sessions has no session of theirs to keep
+	currentSessionID := authPayload.SessionID
+	if authPayload.UserId != urlParam.ID {
+		currentSessionID = uuid.Nil
+	} else if currentSessionID == uuid.Nil {
+		err := errors.New("access token is not tied to a session")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	sessions, err := server.store.ListActiveSessions(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.store.BlockOtherSessions(ctx, db.BlockOtherSessionsParams{
+		UserID:   urlParam.ID,
+		FamilyID: currentSessionID,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	for _, session := range sessions {
+		if session.FamilyID == currentSessionID {
+			continue
+		}
+
+		err = server.revokeSessionTokens(ctx, session.FamilyID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type logoutUserRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// logoutUser blocks the session that a refresh token belongs to
+func (server *Server) logoutUser(ctx *gin.Context) {
+	var req logoutUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	refreshPayload, err := server.tokenMaker.VerifyToken(req.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	session, err := server.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if session.RefreshToken != req.RefreshToken {
+		err := errors.New("mismatched session token")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	err = server.store.BlockSessionFamily(ctx, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.revokeSessionTokens(ctx, session.FamilyID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
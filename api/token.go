@@ -2,11 +2,16 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
 )
 
 type renewAccessTokenRequest struct {
@@ -14,10 +19,15 @@ type renewAccessTokenRequest struct {
 }
 
 type renewAccessTokenResponse struct {
-	AccessToken          string    `json:"access_token"`
-	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 }
 
+// renewAccessToken exchanges a refresh token for a new access token and a new refresh token.
+// The presented refresh token is rotated out and can't be used again.
 func (server *Server) renewAccessToken(ctx *gin.Context) {
 	var req renewAccessTokenRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -31,6 +41,20 @@ func (server *Server) renewAccessToken(ctx *gin.Context) {
 		return
 	}
 
+	// refresh tokens issued before they were given a purpose have none
+	if refreshPayload.Purpose != token.PurposeRefresh && refreshPayload.Purpose != "" {
+		err := errors.New("token is not a refresh token")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	// impersonations end when their token expires
+	if refreshPayload.IsImpersonated() {
+		err := errors.New("impersonation tokens cannot be renewed")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
 	session, err := server.store.GetSession(ctx, refreshPayload.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -65,9 +89,28 @@ func (server *Server) renewAccessToken(ctx *gin.Context) {
 		return
 	}
 
+	// reload the user so that role changes apply from the next renewal
+	user, err := server.store.GetUserById(ctx, session.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	refreshToken, newRefreshPayload, err := server.tokenMaker.CreateToken(
+		refreshPayload.UserId,
+		server.config.RefreshTokenDuration,
+		refreshTokenOptions(session.FamilyID)...,
+	)
+
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
 	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
 		refreshPayload.UserId,
 		server.config.AccessTokenDuration,
+		userTokenOptions(user, session.FamilyID)...,
 	)
 
 	if err != nil {
@@ -75,9 +118,50 @@ func (server *Server) renewAccessToken(ctx *gin.Context) {
 		return
 	}
 
+	result, err := server.store.RotateSessionTx(ctx, db.RotateSessionTxParams{
+		SessionID: session.ID,
+		NewSession: db.CreateSessionParams{
+			ID:           newRefreshPayload.ID,
+			UserID:       refreshPayload.UserId,
+			RefreshToken: refreshToken,
+			UserAgent:    ctx.Request.UserAgent(),
+			ClientIp:     ctx.ClientIP(),
+			IsBlocked:    false,
+			ExpiresAt:    newRefreshPayload.ExpiredAt,
+		},
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenReused) {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
 	rsp := renewAccessTokenResponse{
-		AccessToken:          accessToken,
-		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		SessionID:             result.Session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: newRefreshPayload.ExpiredAt,
 	}
 	ctx.JSON(http.StatusOK, rsp)
 }
+
+// userTokenOptions returns the payload options describing a user's session and rights
+func userTokenOptions(user db.Users, sessionID uuid.UUID) []token.PayloadOption {
+	return []token.PayloadOption{
+		token.WithSessionID(sessionID),
+		token.WithRole(user.Role, util.PermissionsForRole(user.Role)),
+	}
+}
+
+// refreshTokenOptions returns the payload options of a session's refresh token. Its purpose keeps it from being
+// used as an access token.
+func refreshTokenOptions(sessionID uuid.UUID) []token.PayloadOption {
+	return []token.PayloadOption{
+		token.WithPurpose(token.PurposeRefresh),
+		token.WithSessionID(sessionID),
+	}
+}
@@ -0,0 +1,456 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+const (
+	defaultTOTPIssuer        = "Travel Agency"
+	defaultTwoFactorDuration = 5 * time.Minute
+	recoveryCodeCount        = 10
+)
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired  bool      `json:"two_factor_required"`
+	ChallengeToken     string    `json:"challenge_token"`
+	ChallengeExpiresAt time.Time `json:"challenge_expires_at"`
+}
+
+// createTwoFactorChallenge responds to a login of a user with 2FA enabled with a short-lived challenge token
+// instead of a session
+func (server *Server) createTwoFactorChallenge(ctx *gin.Context, user db.Users) {
+	duration := server.config.TwoFactorDuration
+	if duration == 0 {
+		duration = defaultTwoFactorDuration
+	}
+
+	challengeToken, challengePayload, err := server.tokenMaker.CreateToken(
+		user.ID,
+		duration,
+		token.WithPurpose(token.PurposeTwoFactorChallenge),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := twoFactorChallengeResponse{
+		TwoFactorRequired:  true,
+		ChallengeToken:     challengeToken,
+		ChallengeExpiresAt: challengePayload.ExpiredAt,
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+// loginTwoFactor exchanges a challenge token and a TOTP or recovery code for a new session
+func (server *Server) loginTwoFactor(ctx *gin.Context) {
+	var req loginTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	challengePayload, err := server.tokenMaker.VerifyToken(req.ChallengeToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	if challengePayload.Purpose != token.PurposeTwoFactorChallenge {
+		err := errors.New("token is not a two-factor challenge")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	revoked, err := token.IsPayloadRevoked(ctx, server.revocations, challengePayload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if revoked {
+		err := errors.New("challenge has already been used")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	rateLimitIdentity := strconv.FormatInt(challengePayload.UserId, 10)
+	result, err := server.rateLimiter.Peek(ctx, twoFactorRateLimit, rateLimitIdentity)
+	if err := applyRateLimit(ctx, twoFactorRateLimit, result, err); err != nil {
+		ctx.JSON(rateLimitStatus(err), errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, challengePayload.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		err := errors.New("two-factor authentication is not enabled")
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	err = server.checkSecondFactor(ctx, user, req.Code, req.RecoveryCode)
+	if err != nil {
+		if err == errInvalidTwoFactorCode {
+			result, limitErr := server.rateLimiter.Allow(ctx, twoFactorRateLimit, rateLimitIdentity)
+			_ = applyRateLimit(ctx, twoFactorRateLimit, result, limitErr)
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// a challenge can only be completed once
+	err = server.revocations.RevokeToken(ctx, challengePayload.ID, challengePayload.ExpiredAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.rateLimiter.Reset(ctx, twoFactorRateLimit, rateLimitIdentity)
+	if err != nil {
+		log.Error().Err(err).Str("policy", twoFactorRateLimit.Name).Msg("unable to reset rate limit")
+	}
+
+	res, err := server.createUserSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// checkSecondFactor consumes a TOTP code, or a recovery code when no TOTP code is given.
+// It returns errInvalidTwoFactorCode if the code is wrong or has already been used.
+func (server *Server) checkSecondFactor(ctx *gin.Context, user db.Users, code string, recoveryCode string) error {
+	if code != "" {
+		secret, err := util.DecryptSecret(server.config.TOTPEncryptionKey, user.TotpSecret.String)
+		if err != nil {
+			return err
+		}
+
+		step, ok := util.ValidateTOTPCode(secret, code, time.Now())
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+
+		// the update only goes through for a step later than the last one used, so a code can't be replayed,
+		// even by concurrent requests
+		_, err = server.store.UseTOTPStep(ctx, db.UseTOTPStepParams{
+			Step: step,
+			ID:   user.ID,
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errInvalidTwoFactorCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	_, err := server.store.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: util.HashRecoveryCode(recoveryCode),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+type twoFactorParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type enrollTOTPResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// enrollTOTP generates a new TOTP secret for a user. 2FA stays off until the secret is confirmed with a code.
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	var urlParam twoFactorParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// replacing the secret would turn 2FA off without a code
+	if user.TotpEnabledAt.Valid {
+		err := errors.New("two-factor authentication is already enabled")
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	encryptedSecret, err := util.EncryptSecret(server.config.TOTPEncryptionKey, secret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	updatedUser, err := server.store.SetUserTOTPSecret(ctx, db.SetUserTOTPSecretParams{
+		TotpSecret: sql.NullString{
+			String: encryptedSecret,
+			Valid:  true,
+		},
+		ID: user.ID,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.recordUserAuditEvent(ctx, db.AuditActionUserEnrollTOTP, user, updatedUser)
+
+	issuer := server.config.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	res := enrollTOTPResponse{
+		Secret:     secret,
+		OtpauthURI: util.TOTPURI(issuer, user.Email, secret),
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type confirmTOTPResponse struct {
+	RecoveryCodes []string     `json:"recovery_codes"`
+	User          userResponse `json:"user"`
+}
+
+// confirmTOTP turns 2FA on once the user proves their authenticator produces valid codes.
+// The recovery codes are only ever shown in this response.
+func (server *Server) confirmTOTP(ctx *gin.Context) {
+	var req confirmTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var urlParam twoFactorParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		err := errors.New("two-factor authentication is already enabled")
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
+	if !user.TotpSecret.Valid {
+		err := errors.New("two-factor enrolment has not been started")
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// codes are limited as on login, so a stolen access token can't be used to guess them
+	rateLimitIdentity := strconv.FormatInt(user.ID, 10)
+	limitResult, err := server.rateLimiter.Peek(ctx, twoFactorRateLimit, rateLimitIdentity)
+	if err := applyRateLimit(ctx, twoFactorRateLimit, limitResult, err); err != nil {
+		ctx.JSON(rateLimitStatus(err), errorResponse(err))
+		return
+	}
+
+	err = server.checkSecondFactor(ctx, user, req.Code, "")
+	if err != nil {
+		if err == errInvalidTwoFactorCode {
+			limitResult, limitErr := server.rateLimiter.Allow(ctx, twoFactorRateLimit, rateLimitIdentity)
+			_ = applyRateLimit(ctx, twoFactorRateLimit, limitResult, limitErr)
+			ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	err = server.rateLimiter.Reset(ctx, twoFactorRateLimit, rateLimitIdentity)
+	if err != nil {
+		log.Error().Err(err).Str("policy", twoFactorRateLimit.Name).Msg("unable to reset rate limit")
+	}
+
+	recoveryCodes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	codeHashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		codeHashes[i] = util.HashRecoveryCode(code)
+	}
+
+	result, err := server.store.EnableTOTPTx(ctx, db.EnableTOTPTxParams{
+		UserID:             user.ID,
+		RecoveryCodeHashes: codeHashes,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.recordUserAuditEvent(ctx, db.AuditActionUserEnableTOTP, user, result.User)
+
+	res := confirmTOTPResponse{
+		RecoveryCodes: recoveryCodes,
+		User:          newUserResponse(result.User),
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type disableTOTPRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// disableTOTP turns 2FA off. Users must present a code, while admins can reset it for users who lost their device.
+func (server *Server) disableTOTP(ctx *gin.Context) {
+	// admins resetting 2FA don't have to send a body
+	var req disableTOTPRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+
+	var urlParam twoFactorParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersWrite) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if authPayload.UserId == user.ID && user.TotpEnabledAt.Valid {
+		if req.Code == "" && req.RecoveryCode == "" {
+			err := errors.New("a two-factor code is required")
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		rateLimitIdentity := strconv.FormatInt(user.ID, 10)
+		result, err := server.rateLimiter.Peek(ctx, twoFactorRateLimit, rateLimitIdentity)
+		if err := applyRateLimit(ctx, twoFactorRateLimit, result, err); err != nil {
+			ctx.JSON(rateLimitStatus(err), errorResponse(err))
+			return
+		}
+
+		err = server.checkSecondFactor(ctx, user, req.Code, req.RecoveryCode)
+		if err != nil {
+			if err == errInvalidTwoFactorCode {
+				result, limitErr := server.rateLimiter.Allow(ctx, twoFactorRateLimit, rateLimitIdentity)
+				_ = applyRateLimit(ctx, twoFactorRateLimit, result, limitErr)
+				ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		err = server.rateLimiter.Reset(ctx, twoFactorRateLimit, rateLimitIdentity)
+		if err != nil {
+			log.Error().Err(err).Str("policy", twoFactorRateLimit.Name).Msg("unable to reset rate limit")
+		}
+	}
+
+	updatedUser, err := server.store.DisableTOTPTx(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	server.recordUserAuditEvent(ctx, db.AuditActionUserDisableTOTP, user, updatedUser)
+
+	res := newUserResponse(updatedUser)
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,850 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginTwoFactorAPI(t *testing.T) {
+	encryptionKey := util.RandomString(32)
+	user, secret := randomTwoFactorUser(t, encryptionKey)
+	recoveryCode := "abcde-fghij"
+
+	testCases := []struct {
+		name           string
+		setupChallenge func(t *testing.T, server *Server) string
+		body           func(challengeToken string) gin.H
+		buildStubs     func(store *mockdb.MockStore)
+		checkResponse  func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				expectUseTOTPStep(t, store, user)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res loginUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.NotEmpty(t, res.RefreshToken)
+			},
+		},
+		{
+			name: "Recovery Code",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"recovery_code":   recoveryCode,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.UseRecoveryCodeParams{
+					UserID:   user.ID,
+					CodeHash: util.HashRecoveryCode(recoveryCode),
+				}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.RecoveryCodes{UserID: user.ID, CodeHash: arg.CodeHash}, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Invalid Code",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            "abcdef",
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Replayed Code",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				// the step of the code, or a later one, has already been used
+				store.EXPECT().
+					UseTOTPStep(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Used Recovery Code",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"recovery_code":   recoveryCode,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UseRecoveryCode(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.RecoveryCodes{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Access Token",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				accessToken, _, err := server.tokenMaker.CreateToken(user.ID, time.Minute)
+				require.NoError(t, err)
+				return accessToken
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Used Challenge",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				challengeToken := createTestChallenge(t, server, user.ID, time.Minute)
+				payload, err := server.tokenMaker.VerifyToken(challengeToken)
+				require.NoError(t, err)
+
+				err = server.revocations.RevokeToken(context.Background(), payload.ID, payload.ExpiredAt)
+				require.NoError(t, err)
+				return challengeToken
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Challenge",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, -time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Two Factor Disabled",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+					"code":            currentTOTPCode(t, secret),
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				disabledUser := user
+				disabledUser.TotpSecret = sql.NullString{}
+				disabledUser.TotpEnabledAt = sql.NullTime{}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(disabledUser, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Missing Code",
+			setupChallenge: func(t *testing.T, server *Server) string {
+				return createTestChallenge(t, server, user.ID, time.Minute)
+			},
+			body: func(challengeToken string) gin.H {
+				return gin.H{
+					"challenge_token": challengeToken,
+				}
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.TOTPEncryptionKey = encryptionKey
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body(tc.setupChallenge(t, server)))
+			require.NoError(t, err)
+
+			url := "/api/v1/users/login/2fa"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestEnrollTOTPAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		userID        int64
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			userID: user.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.SetUserTOTPSecretParams) (db.Users, error) {
+						require.Equal(t, user.ID, arg.ID)
+						require.True(t, arg.TotpSecret.Valid)
+						return user, nil
+					})
+				expectAuditEvent(t, store, db.AuditActionUserEnrollTOTP, db.AuditTargetUser, strconv.FormatInt(user.ID, 10))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res enrollTOTPResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.Secret)
+				require.True(t, strings.HasPrefix(res.OtpauthURI, "otpauth://totp/"))
+				require.Contains(t, res.OtpauthURI, res.Secret)
+			},
+		},
+		{
+			name:   "Already Enabled",
+			userID: user.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				enabledUser := user
+				enabledUser.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(enabledUser, nil)
+				store.EXPECT().
+					SetUserTOTPSecret(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "Foreign User",
+			userID: user.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:      "No Authorization",
+			userID:    user.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/2fa/totp", tc.userID)
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestConfirmTOTPAPI(t *testing.T) {
+	encryptionKey := util.RandomString(32)
+	enabledUser, secret := randomTwoFactorUser(t, encryptionKey)
+
+	// enrolled but not confirmed yet
+	user := enabledUser
+	user.TotpEnabledAt = sql.NullTime{}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"code": currentTOTPCode(t, secret),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				expectUseTOTPStep(t, store, user)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.EnableTOTPTxParams) (db.EnableTOTPTxResult, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.Len(t, arg.RecoveryCodeHashes, recoveryCodeCount)
+						return db.EnableTOTPTxResult{User: enabledUser}, nil
+					})
+				expectAuditEvent(t, store, db.AuditActionUserEnableTOTP, db.AuditTargetUser, strconv.FormatInt(user.ID, 10))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res confirmTOTPResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Len(t, res.RecoveryCodes, recoveryCodeCount)
+				require.True(t, res.User.TwoFactorEnabled)
+			},
+		},
+		{
+			name: "Invalid Code",
+			body: gin.H{
+				"code": "abcdef",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Not Enrolled",
+			body: gin.H{
+				"code": currentTOTPCode(t, secret),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				notEnrolledUser := user
+				notEnrolledUser.TotpSecret = sql.NullString{}
+
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(notEnrolledUser, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Already Enabled",
+			body: gin.H{
+				"code": currentTOTPCode(t, secret),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(enabledUser, nil)
+				store.EXPECT().
+					EnableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "Missing Code",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.TOTPEncryptionKey = encryptionKey
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/api/v1/users/%d/2fa/totp/confirm", user.ID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestDisableTOTPAPI(t *testing.T) {
+	encryptionKey := util.RandomString(32)
+	user, secret := randomTwoFactorUser(t, encryptionKey)
+
+	disabledUser := user
+	disabledUser.TotpSecret = sql.NullString{}
+	disabledUser.TotpEnabledAt = sql.NullTime{}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"code": currentTOTPCode(t, secret),
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				expectUseTOTPStep(t, store, user)
+				store.EXPECT().
+					DisableTOTPTx(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(disabledUser, nil)
+				expectAuditEvent(t, store, db.AuditActionUserDisableTOTP, db.AuditTargetUser, strconv.FormatInt(user.ID, 10))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res userResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.False(t, res.TwoFactorEnabled)
+			},
+		},
+		{
+			name: "Invalid Code",
+			body: gin.H{
+				"code": "abcdef",
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					DisableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Missing Code",
+			body: nil,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					DisableTOTPTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Admin Reset",
+			body: nil,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					DisableTOTPTx(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(disabledUser, nil)
+				expectAuditEvent(t, store, db.AuditActionUserDisableTOTP, db.AuditTargetUser, strconv.FormatInt(user.ID, 10))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Foreign User",
+			body: nil,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.TravelerRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			server.config.TOTPEncryptionKey = encryptionKey
+			recorder := httptest.NewRecorder()
+
+			var data []byte
+			if tc.body != nil {
+				var err error
+				data, err = json.Marshal(tc.body)
+				require.NoError(t, err)
+			}
+
+			url := fmt.Sprintf("/api/v1/users/%d/2fa/totp", user.ID)
+			request, err := http.NewRequest(http.MethodDelete, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+// randomTwoFactorUser returns a user with TOTP enabled, along with its plain secret
+func randomTwoFactorUser(t *testing.T, encryptionKey string) (db.Users, string) {
+	user, _ := randomUser(t)
+
+	secret, err := util.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	encryptedSecret, err := util.EncryptSecret(encryptionKey, secret)
+	require.NoError(t, err)
+
+	user.TotpSecret = sql.NullString{String: encryptedSecret, Valid: true}
+	user.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	return user, secret
+}
+
+func currentTOTPCode(t *testing.T, secret string) string {
+	code, err := util.GenerateTOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	return code
+}
+
+// expectUseTOTPStep expects the step of a code generated just now to be recorded as used
+func expectUseTOTPStep(t *testing.T, store *mockdb.MockStore, user db.Users) {
+	store.EXPECT().
+		UseTOTPStep(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, arg db.UseTOTPStepParams) (db.Users, error) {
+			require.Equal(t, user.ID, arg.ID)
+			require.InDelta(t, util.TOTPStep(time.Now()), arg.Step, 1)
+			return user, nil
+		})
+}
+
+func createTestChallenge(t *testing.T, server *Server, userId int64, duration time.Duration) string {
+	challengeToken, _, err := server.tokenMaker.CreateToken(userId, duration, token.WithPurpose(token.PurposeTwoFactorChallenge))
+	require.NoError(t, err)
+	return challengeToken
+}
+
+func TestTOTPCodeRateLimit(t *testing.T) {
+	encryptionKey := util.RandomString(32)
+	enabledUser, secret := randomTwoFactorUser(t, encryptionKey)
+
+	enrolledUser := enabledUser
+	enrolledUser.TotpEnabledAt = sql.NullTime{}
+
+	testCases := []struct {
+		name   string
+		user   db.Users
+		method string
+		path   string
+	}{
+		{
+			name:   "Confirm",
+			user:   enrolledUser,
+			method: http.MethodPost,
+			path:   "/api/v1/users/%d/2fa/totp/confirm",
+		},
+		{
+			name:   "Disable",
+			user:   enabledUser,
+			method: http.MethodDelete,
+			path:   "/api/v1/users/%d/2fa/totp",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			store.EXPECT().
+				GetUserById(gomock.Any(), gomock.Eq(tc.user.ID)).
+				AnyTimes().
+				Return(tc.user, nil)
+			store.EXPECT().
+				UseTOTPStep(gomock.Any(), gomock.Any()).
+				Times(0)
+
+			server := newTestServer(t, store)
+			server.config.TOTPEncryptionKey = encryptionKey
+
+			send := func(code string) *httptest.ResponseRecorder {
+				data, err := json.Marshal(gin.H{"code": code})
+				require.NoError(t, err)
+
+				recorder := httptest.NewRecorder()
+				request, err := http.NewRequest(tc.method, fmt.Sprintf(tc.path, tc.user.ID), bytes.NewReader(data))
+				require.NoError(t, err)
+
+				addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.user.ID, time.Minute)
+				server.router.ServeHTTP(recorder, request)
+				return recorder
+			}
+
+			for i := 0; i < twoFactorRateLimit.Limit; i++ {
+				recorder := send("abcdef")
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			}
+
+			// even the right code is refused once the limit is reached
+			recorder := send(currentTOTPCode(t, secret))
+			require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		})
+	}
+}
@@ -3,13 +3,16 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
 	db "github.com/sajitron/travel-agency/db/sqlc"
 	"github.com/sajitron/travel-agency/token"
 	"github.com/sajitron/travel-agency/util"
@@ -19,13 +22,16 @@ type createUserRequest struct {
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=8"`
+	Password  string `json:"password" binding:"required"`
 }
 
 type userResponse struct {
 	FirstName         string    `json:"first_name"`
 	LastName          string    `json:"last_name"`
 	Email             string    `json:"email"`
+	Role              string    `json:"role"`
+	EmailVerified     bool      `json:"email_verified"`
+	TwoFactorEnabled  bool      `json:"two_factor_enabled"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
@@ -37,6 +43,9 @@ func newUserResponse(user db.Users) userResponse {
 		FirstName:         user.FirstName,
 		LastName:          user.LastName,
 		Email:             user.Email,
+		Role:              user.Role,
+		EmailVerified:     user.EmailVerifiedAt.Valid,
+		TwoFactorEnabled:  user.TotpEnabledAt.Valid,
 		PasswordChangedAt: user.PasswordChangedAt,
 		CreatedAt:         user.CreatedAt,
 		UpdatedAt:         user.UpdatedAt,
@@ -51,9 +60,13 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := util.HashPassword(req.Password)
+	if !server.checkPassword(ctx, req.Password, newPasswordUserInfo(req.FirstName, req.LastName, req.Email)) {
+		return
+	}
+
+	hashedPassword, err := server.passwordHasher.Hash(ctx, req.Password)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondPasswordHashError(ctx, err)
 		return
 	}
 
@@ -78,10 +91,18 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
+	// the account exists at this point, so a failed email is only logged and can be resent
+	err = server.sendVerificationEmail(ctx, user)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to send verification email")
+	}
+
 	res := newUserResponse(user)
 	ctx.JSON(http.StatusOK, res)
 }
 
+var errInvalidCredentials = errors.New("invalid credentials")
+
 type loginUserRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
@@ -98,53 +119,174 @@ type loginUserResponse struct {
 
 // loginUser handles a user's login request
 func (server *Server) loginUser(ctx *gin.Context) {
-	redisClient := GetRedisConnection(server)
-
 	var req loginUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
 
+	// unknown emails and wrong passwords are counted and reported alike, so neither reveals who has an account
+	rateLimitIdentity := strings.ToLower(strings.TrimSpace(req.Email))
+
+	// only failures are counted, so a user who has used up their tries is refused before any check
+	result, err := server.rateLimiter.Peek(ctx, loginRateLimit, rateLimitIdentity)
+	if err := applyRateLimit(ctx, loginRateLimit, result, err); err != nil {
+		ctx.JSON(rateLimitStatus(err), errorResponse(err))
+		return
+	}
+
 	user, err := server.store.GetUser(ctx, req.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			clientIP := ctx.ClientIP()
-			redisErr := rateLimit(clientIP, redisClient)
-			if redisErr != nil {
-				ctx.JSON(http.StatusUnauthorized, errorResponse(redisErr))
+			if err := server.passwordHasher.CompareDummy(ctx, req.Password); err != nil {
+				respondPasswordHashError(ctx, err)
 				return
 			}
-
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			server.rejectLogin(ctx, rateLimitIdentity)
 			return
 		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
-	err = util.ValidatePassword(req.Password, user.Password)
+	// a locked account is refused before its password is checked, so guesses can't go on meanwhile. It is
+	// refused like an unknown email, so that the lockout doesn't reveal that the account exists.
+	if isLockedOut(user) {
+		if err := server.passwordHasher.CompareDummy(ctx, req.Password); err != nil {
+			respondPasswordHashError(ctx, err)
+			return
+		}
+		server.rejectLogin(ctx, rateLimitIdentity)
+		return
+	}
+
+	err = server.passwordHasher.Validate(ctx, req.Password, user.Password)
 	if err != nil {
-		redisErr := rateLimit(req.Email, redisClient)
-		if redisErr != nil {
-			ctx.JSON(http.StatusUnauthorized, errorResponse(redisErr))
+		// a password that couldn't be checked isn't a wrong one
+		if err == util.ErrHasherBusy || ctx.Err() != nil {
+			respondPasswordHashError(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		if err := server.recordFailedLogin(ctx, user); err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to record failed login")
+		}
+		server.rejectLogin(ctx, rateLimitIdentity)
 		return
 	}
 
-	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.ID, server.config.AccessTokenDuration)
+	if user.FailedLoginCount > 0 || user.LockedUntil.Valid {
+		user, err = server.store.ResetFailedLoginsTx(ctx, user.ID)
+		if err != nil {
+			// a concurrent failed login may have locked the account since it was read
+			if err == db.ErrAccountLocked {
+				server.rejectLogin(ctx, rateLimitIdentity)
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	// outdated hashes are upgraded while the password is known, so nobody has to reset theirs
+	if server.passwordHasher.NeedsRehash(user.Password) {
+		user = server.rehashPassword(ctx, user, req.Password)
+	}
+
+	// a successful login forgets earlier failures
+	err = server.rateLimiter.Reset(ctx, loginRateLimit, rateLimitIdentity)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		log.Error().Err(err).Str("policy", loginRateLimit.Name).Msg("unable to reset rate limit")
+	}
+
+	if user.TotpEnabledAt.Valid {
+		server.createTwoFactorChallenge(ctx, user)
 		return
 	}
 
-	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(user.ID, server.config.RefreshTokenDuration)
+	res, err := server.createUserSession(ctx, user)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+// rejectLogin records a failed login and responds with the same error whatever the reason
+func (server *Server) rejectLogin(ctx *gin.Context, rateLimitIdentity string) {
+	result, err := server.rateLimiter.Allow(ctx, loginRateLimit, rateLimitIdentity)
+	// the failure is reported either way, the limit only applies to the next attempt
+	_ = applyRateLimit(ctx, loginRateLimit, result, err)
+
+	ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidCredentials))
+}
+
+// rehashPassword hashes the password of a user again with the current algorithm and parameters, and stores it
+// in place of the old hash. The hash is only replaced if it hasn't changed meanwhile, so that a password
+// changed by a concurrent request is never reverted. Failures are only logged, as the old hash still works
+// and the upgrade is tried again at the next login.
+func (server *Server) rehashPassword(ctx *gin.Context, user db.Users, password string) db.Users {
+	hashedPassword, err := server.passwordHasher.Hash(ctx, password)
+	if err != nil {
+		log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to rehash password")
+		return user
+	}
+
+	updatedUser, err := server.store.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+		NewPassword: hashedPassword,
+		ID:          user.ID,
+		OldPassword: user.Password,
+	})
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to store rehashed password")
+		}
+		return user
+	}
+	return updatedUser
+}
+
+// respondPasswordHashError responds to an error of the password hasher. A busy hasher means the server is
+// overloaded rather than broken, so the client is asked to retry. A password too long for bcrypt is the
+// client's to fix.
+func respondPasswordHashError(ctx *gin.Context, err error) {
+	if err == util.ErrHasherBusy {
+		ctx.Header("Retry-After", "1")
+		ctx.JSON(http.StatusServiceUnavailable, errorResponse(err))
+		return
+	}
+	if err == util.ErrPasswordTooLong {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+}
+
+// createUserSession starts a new session for a user whose credentials have been checked
+func (server *Server) createUserSession(ctx *gin.Context, user db.Users) (loginUserResponse, error) {
+	// the session keeps its family ID across rotations, and its tokens carry it so that they can be revoked together
+	familyID, err := uuid.NewRandom()
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	// the refresh token ID doubles as the session ID
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(
+		user.ID,
+		server.config.RefreshTokenDuration,
+		refreshTokenOptions(familyID)...,
+	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.ID,
+		server.config.AccessTokenDuration,
+		userTokenOptions(user, familyID)...,
+	)
+	if err != nil {
+		return loginUserResponse{}, err
+	}
 
 	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
 		ID:           refreshPayload.ID,
@@ -154,16 +296,12 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		ClientIp:     ctx.ClientIP(),
 		IsBlocked:    false,
 		ExpiresAt:    refreshPayload.ExpiredAt,
+		FamilyID:     familyID,
 	})
-
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return
+		return loginUserResponse{}, err
 	}
 
-	// delete failed access cache on successful login
-	redisClient.Del(context.Background(), fmt.Sprintf("%s-login", req.Email))
-
 	res := loginUserResponse{
 		SessionID:             session.ID,
 		AccessToken:           accessToken,
@@ -172,6 +310,43 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
 		User:                  newUserResponse(user),
 	}
+	return res, nil
+}
+
+// hashRandomPassword hashes a random password nobody knows, for users who sign up through an identity provider.
+// They can replace it through a password reset. It responds with an error if the password can't be hashed.
+func (server *Server) hashRandomPassword(ctx *gin.Context) (string, bool) {
+	password, _, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return "", false
+	}
+	hashedPassword, err := server.passwordHasher.Hash(ctx, password)
+	if err != nil {
+		respondPasswordHashError(ctx, err)
+		return "", false
+	}
+	return hashedPassword, true
+}
+
+// loginFederatedUser signs in a user who was authenticated by an identity provider or an emailed link. These
+// only stand in for the password, so a locked account stays locked and the second factor is still asked for.
+func (server *Server) loginFederatedUser(ctx *gin.Context, user db.Users) {
+	if isLockedOut(user) {
+		rejectLockedLogin(ctx, user.LockedUntil.Time)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		server.createTwoFactorChallenge(ctx, user)
+		return
+	}
+
+	res, err := server.createUserSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
 	ctx.JSON(http.StatusOK, res)
 }
 
@@ -186,7 +361,7 @@ type updateUserParam struct {
 	ID int64 `uri:"id" binding:"required,min=1"`
 }
 
-// updateUser handles the update of a user's info and its storage in the DB
+// updateUser handles the update of a user's info and its storage in the DB, along with an audit event of the change
 func (server *Server) updateUser(ctx *gin.Context) {
 	var req updateUserRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -201,11 +376,17 @@ func (server *Server) updateUser(ctx *gin.Context) {
 	}
 
 	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
-	if urlParam.ID != authPayload.UserId {
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersWrite) {
 		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
 		return
 	}
 
+	// the sign in details stay the user's own, support can only fix the profile
+	if authPayload.IsImpersonated() && (req.Email != "" || req.Password != "") {
+		ctx.JSON(http.StatusForbidden, errorResponse(errImpersonationDenied))
+		return
+	}
+
 	arg := db.UpdateUserParams{
 		FirstName: sql.NullString{
 			String: req.FirstName,
@@ -223,12 +404,37 @@ func (server *Server) updateUser(ctx *gin.Context) {
 	}
 
 	if req.Password != "" {
-		password, err := util.HashPassword(req.Password)
+		// the password is checked against the name and email the user will have after the update
+		currentUser, err := server.store.GetUserById(ctx, urlParam.ID)
 		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.JSON(http.StatusNotFound, errorResponse(err))
+				return
+			}
 			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 			return
 		}
 
+		userInfo := newPasswordUserInfo(currentUser.FirstName, currentUser.LastName, currentUser.Email)
+		if arg.FirstName.Valid {
+			userInfo.FirstName = arg.FirstName.String
+		}
+		if arg.LastName.Valid {
+			userInfo.LastName = arg.LastName.String
+		}
+		if arg.Email.Valid {
+			userInfo.Email = arg.Email.String
+		}
+		if !server.checkPassword(ctx, req.Password, userInfo) {
+			return
+		}
+
+		password, err := server.passwordHasher.Hash(ctx, req.Password)
+		if err != nil {
+			respondPasswordHashError(ctx, err)
+			return
+		}
+
 		arg.Password = sql.NullString{
 			String: password,
 			Valid:  true,
@@ -240,7 +446,10 @@ func (server *Server) updateUser(ctx *gin.Context) {
 		}
 	}
 
-	user, err := server.store.UpdateUser(ctx, arg)
+	user, err := server.store.UpdateUserTx(ctx, db.UpdateUserTxParams{
+		UpdateUserParams: arg,
+		Audit:            newAuditEvent(ctx),
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorResponse(err))
@@ -250,10 +459,47 @@ func (server *Server) updateUser(ctx *gin.Context) {
 		return
 	}
 
+	// a changed email address has to be verified again
+	if arg.Email.Valid && !user.EmailVerifiedAt.Valid {
+		err = server.sendVerificationEmail(ctx, user)
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", user.ID).Msg("unable to send verification email")
+		}
+	}
+
+	if arg.Password.Valid {
+		// a user changing their own password keeps their session but has to renew its access token
+		currentSessionID := uuid.Nil
+		if authPayload.UserId == user.ID {
+			currentSessionID = authPayload.SessionID
+		}
+
+		err = server.revokeUserTokensAfterPasswordChange(ctx, user, currentSessionID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
 	res := newUserResponse(user)
 	ctx.JSON(http.StatusOK, res)
 }
 
+// revokeUserTokensAfterPasswordChange rejects every token issued before the password change and blocks every
+// session apart from currentSessionID. Pass uuid.Nil to block every session.
+func (server *Server) revokeUserTokensAfterPasswordChange(ctx context.Context, user db.Users, currentSessionID uuid.UUID) error {
+	err := server.store.BlockOtherSessions(ctx, db.BlockOtherSessionsParams{
+		UserID:   user.ID,
+		FamilyID: currentSessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(server.config.RefreshTokenDuration)
+	return server.revocations.RevokeUserTokens(ctx, user.ID, user.PasswordChangedAt, expiresAt)
+}
+
 type getUserRequest struct {
 	ID int64 `uri:"id" binding:"required,min=1"`
 }
@@ -266,6 +512,14 @@ func (server *Server) getUserById(ctx *gin.Context) {
 		return
 	}
 
+	// users can read their own record, reading anyone else's needs users:read
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, req.ID, util.PermissionUsersRead) {
+		err := fmt.Errorf("missing permission %s", util.PermissionUsersRead)
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
 	user, err := server.store.GetUserById(ctx, req.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -279,3 +533,50 @@ func (server *Server) getUserById(ctx *gin.Context) {
 	res := newUserResponse(user)
 	ctx.JSON(http.StatusOK, res)
 }
+
+type updateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=traveler agent admin"`
+}
+
+// updateUserRole changes the role of a user
+func (server *Server) updateUserRole(ctx *gin.Context) {
+	var req updateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var urlParam updateUserParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.UpdateUserRoleTx(ctx, db.UpdateUserRoleTxParams{
+		UpdateUserRoleParams: db.UpdateUserRoleParams{
+			Role: req.Role,
+			ID:   urlParam.ID,
+		},
+		Audit: newAuditEvent(ctx),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// tokens carry the role they were issued with, so the user's current ones are rejected and renewing them
+	// picks up the new role
+	now := time.Now()
+	err = server.revocations.RevokeUserTokens(ctx, user.ID, now, now.Add(server.config.RefreshTokenDuration))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := newUserResponse(user)
+	ctx.JSON(http.StatusOK, res)
+}
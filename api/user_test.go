@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,17 +10,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 	mockdb "github.com/sajitron/travel-agency/db/mock"
 	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/passwordpolicy"
 	"github.com/sajitron/travel-agency/token"
 	"github.com/sajitron/travel-agency/util"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type eqCreateUserParamsMatcher struct {
@@ -79,6 +84,16 @@ func TestCreateUserAPI(t *testing.T) {
 					CreateUser(gomock.Any(), EqCreateUserParams(arg, password)).
 					Times(1).
 					Return(user, nil)
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Eq(db.InvalidateVerificationTokensParams{
+						UserID:  user.ID,
+						Purpose: emailVerificationPurpose,
+					})).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -153,6 +168,25 @@ func TestCreateUserAPI(t *testing.T) {
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeTooShort)
+			},
+		},
+		{
+			name: "Password Contains Name",
+			body: gin.H{
+				"email":      user.Email,
+				"first_name": user.FirstName,
+				"last_name":  user.LastName,
+				"password":   strings.ToUpper(user.LastName) + "-1234",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeContainsPersonal)
 			},
 		},
 	}
@@ -186,6 +220,11 @@ func TestCreateUserAPI(t *testing.T) {
 
 func TestLoginUserAPI(t *testing.T) {
 	user, password := randomUser(t)
+	bcryptHash, err := util.HashPasswordWithParams(password, util.PasswordHashParams{
+		Algorithm:  util.PasswordAlgorithmBcrypt,
+		BcryptCost: bcrypt.MinCost,
+	})
+	require.NoError(t, err)
 
 	testCases := []struct {
 		name          string
@@ -212,6 +251,96 @@ func TestLoginUserAPI(t *testing.T) {
 				require.Equal(t, http.StatusOK, recorder.Code)
 			},
 		},
+		{
+			name: "Rehash Outdated Hash",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				outdatedUser := user
+				outdatedUser.Password = bcryptHash
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(outdatedUser, nil)
+				store.EXPECT().
+					RehashUserPassword(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.RehashUserPasswordParams) (db.Users, error) {
+						require.Equal(t, user.ID, arg.ID)
+						require.Equal(t, bcryptHash, arg.OldPassword)
+						require.True(t, strings.HasPrefix(arg.NewPassword, "$argon2id$"))
+						require.NoError(t, util.ValidatePassword(password, arg.NewPassword))
+
+						rehashedUser := user
+						rehashedUser.Password = arg.NewPassword
+						return rehashedUser, nil
+					})
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Rehash Conflict",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				outdatedUser := user
+				outdatedUser.Password = bcryptHash
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(outdatedUser, nil)
+				// the password was changed since it was read, so the hash is left alone
+				store.EXPECT().
+					RehashUserPassword(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Two Factor Required",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				twoFactorUser := user
+				twoFactorUser.TotpEnabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(twoFactorUser, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res twoFactorChallengeResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.True(t, res.TwoFactorRequired)
+				require.NotEmpty(t, res.ChallengeToken)
+			},
+		},
 		{
 			name: "User Not Found",
 			body: gin.H{
@@ -225,7 +354,9 @@ func TestLoginUserAPI(t *testing.T) {
 					Return(db.Users{}, sql.ErrNoRows)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusNotFound, recorder.Code)
+				// unknown emails are indistinguishable from wrong passwords
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireInvalidCredentials(t, recorder.Body)
 			},
 		},
 		{
@@ -235,13 +366,143 @@ func TestLoginUserAPI(t *testing.T) {
 				"password": "incorrect",
 			},
 			buildStubs: func(store *mockdb.MockStore) {
+				failedUser := user
+				failedUser.FailedLoginCount = 1
+
 				store.EXPECT().
 					GetUser(gomock.Any(), gomock.Eq(user.Email)).
 					Times(1).
 					Return(user, nil)
+				store.EXPECT().
+					RecordFailedLogin(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(failedUser, nil)
+				store.EXPECT().
+					LockUser(gomock.Any(), gomock.Any()).
+					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireInvalidCredentials(t, recorder.Body)
+			},
+		},
+		{
+			name: "Lockout Reached",
+			body: gin.H{
+				"email":    user.Email,
+				"password": "incorrect",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failedUser := user
+				failedUser.FailedLoginCount = lockoutThreshold
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					RecordFailedLogin(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(failedUser, nil)
+				store.EXPECT().
+					LockUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg db.LockUserParams) (db.Users, error) {
+						require.Equal(t, user.ID, arg.ID)
+						require.WithinDuration(t, time.Now().Add(lockoutBaseDuration), arg.LockedUntil, time.Second)
+						return failedUser, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireInvalidCredentials(t, recorder.Body)
+			},
+		},
+		{
+			name: "Account Locked",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				lockedUser := user
+				lockedUser.FailedLoginCount = lockoutThreshold
+				lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(lockedUser, nil)
+				store.EXPECT().
+					RecordFailedLogin(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				// a locked account is indistinguishable from an unknown email
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				require.Empty(t, recorder.Header().Get("Retry-After"))
+				requireInvalidCredentials(t, recorder.Body)
+			},
+		},
+		{
+			name: "Clears Failed Logins",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failedUser := user
+				failedUser.FailedLoginCount = lockoutThreshold
+				failedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(failedUser, nil)
+				store.EXPECT().
+					ResetFailedLoginsTx(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Locked Concurrently",
+			body: gin.H{
+				"email":    user.Email,
+				"password": password,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				failedUser := user
+				failedUser.FailedLoginCount = lockoutThreshold - 1
+
+				lockedUser := user
+				lockedUser.FailedLoginCount = lockoutThreshold
+				lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}
+
+				store.EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.Email)).
+					Times(1).
+					Return(failedUser, nil)
+				store.EXPECT().
+					ResetFailedLoginsTx(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(lockedUser, db.ErrAccountLocked)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireInvalidCredentials(t, recorder.Body)
 			},
 		},
 		{
@@ -309,7 +570,9 @@ func TestUpdateUserAPI(t *testing.T) {
 	newFirstName := util.RandomName()
 	newLastName := util.RandomName()
 	newEmail := util.RandomEmail()
+	newPassword := util.RandomString(8)
 	invalidEmail := "r@m.co"
+	sessionID := uuid.New()
 
 	testCases := []struct {
 		name          string
@@ -356,9 +619,23 @@ func TestUpdateUserAPI(t *testing.T) {
 					UpdatedAt:         user.UpdatedAt,
 				}
 				store.EXPECT().
-					UpdateUser(gomock.Any(), gomock.Eq(arg)).
+					UpdateUserTx(gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(updatedUser, nil)
+					DoAndReturn(func(_ interface{}, txArg db.UpdateUserTxParams) (db.Users, error) {
+						require.Equal(t, arg, txArg.UpdateUserParams)
+						// the change is audited under the user making it
+						require.Equal(t, sql.NullInt64{Int64: user.ID, Valid: true}, txArg.Audit.ActorID)
+						require.NotEmpty(t, txArg.Audit.RequestID)
+						return updatedUser, nil
+					})
+				// the new email address has to be verified
+				store.EXPECT().
+					InvalidateVerificationTokens(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+				store.EXPECT().
+					CreateVerificationToken(gomock.Any(), gomock.Any()).
+					Times(1)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -370,6 +647,88 @@ func TestUpdateUserAPI(t *testing.T) {
 				require.Equal(t, newLastName, gotUser.LastName)
 			},
 		},
+		{
+			name: "Password Change",
+			body: gin.H{
+				"password": newPassword,
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, token.WithSessionID(sessionID))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				updatedUser := user
+				updatedUser.PasswordChangedAt = time.Now()
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.UpdateUserTxParams) (db.Users, error) {
+						require.True(t, arg.Password.Valid)
+						require.NoError(t, util.ValidatePassword(newPassword, arg.Password.String))
+						require.True(t, arg.PasswordChangedAt.Valid)
+						return updatedUser, nil
+					})
+				arg := db.BlockOtherSessionsParams{
+					UserID:   user.ID,
+					FamilyID: sessionID,
+				}
+				store.EXPECT().
+					BlockOtherSessions(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Password Contains New Name",
+			body: gin.H{
+				"first_name": &newFirstName,
+				"password":   newFirstName + "-1234",
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeContainsPersonal)
+			},
+		},
+		{
+			name: "Short Password",
+			body: gin.H{
+				"password": "short",
+			},
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					UpdateUserTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requirePasswordViolations(t, recorder, passwordpolicy.CodeTooShort)
+			},
+		},
 		{
 			name: "User Not Found",
 			body: gin.H{
@@ -382,7 +741,7 @@ func TestUpdateUserAPI(t *testing.T) {
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					UpdateUser(gomock.Any(), gomock.Any()).
+					UpdateUserTx(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(db.Users{}, sql.ErrNoRows)
 			},
@@ -402,7 +761,7 @@ func TestUpdateUserAPI(t *testing.T) {
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					UpdateUser(gomock.Any(), gomock.Any()).
+					UpdateUserTx(gomock.Any(), gomock.Any()).
 					Times(0).
 					Return(db.Users{}, sql.ErrNoRows)
 			},
@@ -421,7 +780,7 @@ func TestUpdateUserAPI(t *testing.T) {
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					UpdateUser(gomock.Any(), gomock.Any()).
+					UpdateUserTx(gomock.Any(), gomock.Any()).
 					Times(0).
 					Return(db.Users{}, sql.ErrNoRows)
 			},
@@ -438,7 +797,7 @@ func TestUpdateUserAPI(t *testing.T) {
 			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					UpdateUser(gomock.Any(), gomock.Any()).
+					UpdateUserTx(gomock.Any(), gomock.Any()).
 					Times(0).
 					Return(db.Users{}, sql.ErrNoRows)
 			},
@@ -476,6 +835,262 @@ func TestUpdateUserAPI(t *testing.T) {
 	}
 }
 
+func TestGetUserAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchUser(t, recorder.Body, user)
+			},
+		},
+		{
+			name: "Agent",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(util.AgentRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Traveler Own Record",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(util.TravelerRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchUser(t, recorder.Body, user)
+			},
+		},
+		{
+			name: "Traveler Other User",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.TravelerRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "OAuth Token Without Scope",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute,
+					token.WithClientID(util.RandomString(16)), token.WithRole(util.TravelerRole, []string{util.PermissionBookingsRead}))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "User Not Found",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Users{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d", user.ID)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUpdateUserRoleAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"role": util.AgentRole},
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.UpdateUserRoleParams{
+					Role: util.AgentRole,
+					ID:   user.ID,
+				}
+				updatedUser := user
+				updatedUser.Role = util.AgentRole
+				store.EXPECT().
+					UpdateUserRoleTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, txArg db.UpdateUserRoleTxParams) (db.Users, error) {
+						require.Equal(t, arg, txArg.UpdateUserRoleParams)
+						require.Equal(t, sql.NullInt64{Int64: 1, Valid: true}, txArg.Audit.ActorID)
+						return updatedUser, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var gotUser userResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &gotUser)
+				require.NoError(t, err)
+				require.Equal(t, util.AgentRole, gotUser.Role)
+			},
+		},
+		{
+			name: "Unknown Role",
+			body: gin.H{"role": "pilot"},
+			role: util.AdminRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserRoleTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Agent",
+			body: gin.H{"role": util.AdminRole},
+			role: util.AgentRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateUserRoleTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/api/v1/users/%d/role", user.ID)
+			request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, 1, time.Minute, withTestRole(tc.role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUpdateUserRoleRevokesTokens(t *testing.T) {
+	user, _ := randomUser(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	server := newTestServer(t, store)
+
+	_, payload, err := server.tokenMaker.CreateToken(user.ID, time.Minute, withTestRole(user.Role))
+	require.NoError(t, err)
+
+	updatedUser := user
+	updatedUser.Role = util.AgentRole
+	store.EXPECT().
+		UpdateUserRoleTx(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(updatedUser, nil)
+
+	data, err := json.Marshal(gin.H{"role": util.AgentRole})
+	require.NoError(t, err)
+
+	url := fmt.Sprintf("/api/v1/users/%d/role", user.ID)
+	request, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID+100, time.Minute, withTestRole(util.AdminRole))
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// the user's token still carries the old role
+	revoked, err := token.IsPayloadRevoked(context.Background(), server.revocations, payload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+}
+
 func randomUser(t *testing.T) (user db.Users, password string) {
 	password = util.RandomString(8)
 	hashedPassword, err := util.HashPassword(password)
@@ -487,6 +1102,7 @@ func randomUser(t *testing.T) (user db.Users, password string) {
 		Password:  hashedPassword,
 		FirstName: util.RandomName(),
 		LastName:  util.RandomName(),
+		Role:      util.TravelerRole,
 	}
 	return
 }
@@ -504,3 +1120,10 @@ func requireBodyMatchUser(t *testing.T, body *bytes.Buffer, user db.Users) {
 	require.Equal(t, user.LastName, gotUser.LastName)
 	require.Empty(t, gotUser.Password) // testing that the password isn't returned.
 }
+
+func requireInvalidCredentials(t *testing.T, body *bytes.Buffer) {
+	var res gin.H
+	err := json.Unmarshal(body.Bytes(), &res)
+	require.NoError(t, err)
+	require.Equal(t, errInvalidCredentials.Error(), res["error"])
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+)
+
+// userInfoResponse uses the claim names of the OpenID Connect userinfo endpoint, so that clients can use it as they
+// would any other
+type userInfoResponse struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+// getUserInfo returns the profile of the user who owns the token. API keys and OAuth tokens need the users:read
+// scope, as acting on the user's bookings doesn't need their profile.
+func (server *Server) getUserInfo(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, authPayload.UserId, util.PermissionUsersRead) {
+		err := fmt.Errorf("missing permission %s", util.PermissionUsersRead)
+		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, authPayload.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, userInfoResponse{
+		Sub:           strconv.FormatInt(user.ID, 10),
+		Name:          user.FirstName + " " + user.LastName,
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Role:          user.Role,
+		UpdatedAt:     user.UpdatedAt.Unix(),
+	})
+}
@@ -0,0 +1,430 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/sajitron/travel-agency/webauthn"
+)
+
+// defaultPasskeyName names passkeys registered without a name
+const defaultPasskeyName = "Passkey"
+
+var (
+	errWebAuthnNotConfigured     = errors.New("passkey login is not configured")
+	errInvalidWebAuthnChallenge  = errors.New("the passkey request is invalid or has expired, please start again")
+	errPasskeyRegistered         = errors.New("this passkey is already registered")
+	errInvalidPasskeyCredentials = errors.New("the passkey could not be verified")
+)
+
+// newRelyingParty creates the WebAuthn relying party users register passkeys with. It returns nil when none is configured.
+func newRelyingParty(config util.Config) (*webauthn.RelyingParty, error) {
+	if config.WebAuthnRPID == "" {
+		return nil, nil
+	}
+
+	return webauthn.NewRelyingParty(webauthn.Config{
+		RPID:    config.WebAuthnRPID,
+		RPName:  config.WebAuthnRPName,
+		Origins: config.WebAuthnOrigins,
+	})
+}
+
+// webauthnUserHandle is the handle a user's passkeys are stored with by authenticators. It's the user's ID,
+// which is neither personal nor secret.
+func webauthnUserHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+type webauthnOptionsResponse struct {
+	// PublicKey is passed as is to navigator.credentials.create() or navigator.credentials.get()
+	PublicKey interface{} `json:"publicKey"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// createWebAuthnChallenge stores a new challenge, for a user registering a passkey or for anyone signing in.
+// It responds with an error if the challenge can't be stored.
+func (server *Server) createWebAuthnChallenge(ctx *gin.Context, userID sql.NullInt64) (string, time.Time, bool) {
+	challenge, challengeHash, err := util.GenerateVerificationToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return "", time.Time{}, false
+	}
+
+	stored, err := server.store.CreateWebAuthnChallenge(ctx, db.CreateWebAuthnChallengeParams{
+		ChallengeHash: challengeHash,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webauthn.DefaultTimeout),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return "", time.Time{}, false
+	}
+	return challenge, stored.ExpiresAt, true
+}
+
+// useWebAuthnChallenge uses up the challenge a response answers. The challenge must have been created for
+// userID. It responds with an error if there is no such challenge.
+func (server *Server) useWebAuthnChallenge(ctx *gin.Context, challenge string, userID sql.NullInt64) bool {
+	stored, err := server.store.UseWebAuthnChallenge(ctx, util.HashVerificationToken(challenge))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidWebAuthnChallenge))
+			return false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+
+	if stored.UserID != userID || time.Now().After(stored.ExpiresAt) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidWebAuthnChallenge))
+		return false
+	}
+	return true
+}
+
+// startPasskeyLogin starts signing in with a passkey. Any passkey of the site can answer, so the user doesn't
+// have to type their email.
+func (server *Server) startPasskeyLogin(ctx *gin.Context) {
+	if server.relyingParty == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errWebAuthnNotConfigured))
+		return
+	}
+
+	challenge, expiresAt, ok := server.createWebAuthnChallenge(ctx, sql.NullInt64{})
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webauthnOptionsResponse{
+		PublicKey: server.relyingParty.RequestOptions(challenge),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// loginPasskey signs a user in with the assertion of one of their passkeys. Passkeys verify the user with a
+// biometric or PIN on top of holding the key, so no second factor is asked for. The login ends like a
+// password login.
+func (server *Server) loginPasskey(ctx *gin.Context) {
+	if server.relyingParty == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errWebAuthnNotConfigured))
+		return
+	}
+
+	var req webauthn.AuthenticationResponse
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	challenge, err := req.Challenge()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !server.useWebAuthnChallenge(ctx, challenge, sql.NullInt64{}) {
+		return
+	}
+
+	credentialID, err := req.CredentialID()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	credential, err := server.store.GetWebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidPasskeyCredentials))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// the authenticator names the account the passkey was made for, which must be the one it's stored with
+	userHandle, err := req.UserHandle()
+	if err != nil || !bytes.Equal(userHandle, webauthnUserHandle(credential.UserID)) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidPasskeyCredentials))
+		return
+	}
+
+	assertion, err := server.relyingParty.VerifyAssertion(&req, challenge, webauthn.Credential{
+		ID:        credential.CredentialID,
+		PublicKey: credential.PublicKey,
+		SignCount: uint32(credential.SignCount),
+	})
+	if err != nil {
+		if err == webauthn.ErrClonedAuthenticator {
+			log.Warn().Int64("user_id", credential.UserID).Int64("credential_id", credential.ID).Msg("passkey signature counter went backwards")
+		}
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	// the counter only moves forward, so of two logins made with the same count only the first gets through
+	_, err = server.store.UpdateWebAuthnCredentialUse(ctx, db.UpdateWebAuthnCredentialUseParams{
+		ID:        credential.ID,
+		SignCount: int64(assertion.SignCount),
+		BackedUp:  assertion.BackedUp,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn().Int64("user_id", credential.UserID).Int64("credential_id", credential.ID).Msg("passkey signature counter went backwards")
+			ctx.JSON(http.StatusUnauthorized, errorResponse(webauthn.ErrClonedAuthenticator))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, credential.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if isLockedOut(user) {
+		rejectLockedLogin(ctx, user.LockedUntil.Time)
+		return
+	}
+
+	res, err := server.createUserSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type userPasskeysParam struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+type passkeyResponse struct {
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Transports     []string   `json:"transports"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackedUp       bool       `json:"backed_up"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newPasskeyResponse(credential db.WebauthnCredentials) passkeyResponse {
+	res := passkeyResponse{
+		ID:             credential.ID,
+		Name:           credential.Name,
+		Transports:     credential.Transports,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+		CreatedAt:      credential.CreatedAt,
+	}
+	if credential.LastUsedAt.Valid {
+		res.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return res
+}
+
+// startPasskeyRegistration starts registering a passkey for the signed in user
+func (server *Server) startPasskeyRegistration(ctx *gin.Context) {
+	var urlParam userPasskeysParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// only the user can add a passkey, since it lets whoever holds it sign in as them
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	if server.relyingParty == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errWebAuthnNotConfigured))
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, urlParam.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	credentials, err := server.store.ListWebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		exclude = append(exclude, webauthn.NewCredentialDescriptor(credential.CredentialID, credential.Transports))
+	}
+
+	challenge, expiresAt, ok := server.createWebAuthnChallenge(ctx, sql.NullInt64{Int64: user.ID, Valid: true})
+	if !ok {
+		return
+	}
+
+	options := server.relyingParty.CreationOptions(challenge, webauthn.User{
+		Handle:      webauthnUserHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}, exclude)
+
+	ctx.JSON(http.StatusOK, webauthnOptionsResponse{
+		PublicKey: options,
+		ExpiresAt: expiresAt,
+	})
+}
+
+type registerPasskeyRequest struct {
+	Name       string                        `json:"name" binding:"max=100"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// registerPasskey finishes registering a passkey for the signed in user. The registration must have been
+// started by the same user.
+func (server *Server) registerPasskey(ctx *gin.Context) {
+	var urlParam userPasskeysParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var req registerPasskeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if authPayload.UserId != urlParam.ID {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	if server.relyingParty == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errWebAuthnNotConfigured))
+		return
+	}
+
+	challenge, err := req.Credential.Challenge()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !server.useWebAuthnChallenge(ctx, challenge, sql.NullInt64{Int64: urlParam.ID, Valid: true}) {
+		return
+	}
+
+	credential, err := server.relyingParty.VerifyRegistration(&req.Credential, challenge)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+
+	stored, err := server.store.CreateWebAuthnCredential(ctx, db.CreateWebAuthnCredentialParams{
+		UserID:         urlParam.ID,
+		CredentialID:   credential.ID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      int64(credential.SignCount),
+		Transports:     credential.Transports,
+		Aaguid:         credential.AAGUID,
+		Name:           name,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+	})
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusConflict, errorResponse(errPasskeyRegistered))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newPasskeyResponse(stored))
+}
+
+// listPasskeys lists the passkeys of a user
+func (server *Server) listPasskeys(ctx *gin.Context) {
+	var urlParam userPasskeysParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersRead) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to access foreign resource")
+		return
+	}
+
+	credentials, err := server.store.ListWebAuthnCredentials(ctx, urlParam.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	res := make([]passkeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		res = append(res, newPasskeyResponse(credential))
+	}
+	ctx.JSON(http.StatusOK, res)
+}
+
+type deletePasskeyParam struct {
+	ID        int64 `uri:"id" binding:"required,min=1"`
+	PasskeyID int64 `uri:"passkey_id" binding:"required,min=1"`
+}
+
+// deletePasskey stops a passkey from signing its user in, such as when the device it's on is lost
+func (server *Server) deletePasskey(ctx *gin.Context) {
+	var urlParam deletePasskeyParam
+	if err := ctx.ShouldBindUri(&urlParam); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !canAccessUser(authPayload, urlParam.ID, util.PermissionUsersWrite) {
+		ctx.JSON(http.StatusUnauthorized, "Unable to modify foreign resource")
+		return
+	}
+
+	_, err := server.store.DeleteWebAuthnCredential(ctx, db.DeleteWebAuthnCredentialParams{
+		ID:     urlParam.PasskeyID,
+		UserID: urlParam.ID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
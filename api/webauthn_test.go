@@ -0,0 +1,735 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	mockdb "github.com/sajitron/travel-agency/db/mock"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/token"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/sajitron/travel-agency/webauthn"
+	"github.com/sajitron/travel-agency/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "travel.agency"
+	testOrigin = "https://travel.agency"
+)
+
+// newWebAuthnTestServer creates a test server that users can register passkeys with
+func newWebAuthnTestServer(t *testing.T, store db.Store) *Server {
+	server := newTestServer(t, store)
+
+	var err error
+	server.relyingParty, err = webauthn.NewRelyingParty(webauthn.Config{
+		RPID:    testRPID,
+		RPName:  "Travel Agency",
+		Origins: []string{testOrigin},
+	})
+	require.NoError(t, err)
+
+	return server
+}
+
+func randomWebAuthnChallenge(t *testing.T, userID sql.NullInt64) (string, db.WebauthnChallenges) {
+	challenge, challengeHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	return challenge, db.WebauthnChallenges{
+		ChallengeHash: challengeHash,
+		UserID:        userID,
+		ExpiresAt:     time.Now().Add(webauthn.DefaultTimeout),
+		CreatedAt:     time.Now(),
+	}
+}
+
+// registerTestPasskey registers a passkey of the authenticator for the user, as it would be stored
+func registerTestPasskey(t *testing.T, server *Server, authenticator *webauthntest.Authenticator, user db.Users) db.WebauthnCredentials {
+	challenge, _ := randomWebAuthnChallenge(t, sql.NullInt64{Int64: user.ID, Valid: true})
+	registration, err := authenticator.Register(testRPID, testOrigin, challenge, webauthnUserHandle(user.ID))
+	require.NoError(t, err)
+
+	var res webauthn.RegistrationResponse
+	data, err := json.Marshal(registration)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &res))
+
+	credential, err := server.relyingParty.VerifyRegistration(&res, challenge)
+	require.NoError(t, err)
+
+	return db.WebauthnCredentials{
+		ID:           util.RandomInt(1, 1000),
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Transports:   credential.Transports,
+		Aaguid:       credential.AAGUID,
+		Name:         defaultPasskeyName,
+		CreatedAt:    time.Now(),
+	}
+}
+
+func TestStartPasskeyRegistrationAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	registered := db.WebauthnCredentials{ID: 1, UserID: user.ID, CredentialID: []byte("registered"), Transports: []string{"usb"}}
+
+	testCases := []struct {
+		name          string
+		userID        int64
+		configured    bool
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "OK",
+			userID:     user.ID,
+			configured: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					ListWebAuthnCredentials(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.WebauthnCredentials{registered}, nil)
+				store.EXPECT().
+					CreateWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateWebAuthnChallengeParams) (db.WebauthnChallenges, error) {
+						require.Equal(t, sql.NullInt64{Int64: user.ID, Valid: true}, arg.UserID)
+						require.WithinDuration(t, time.Now().Add(webauthn.DefaultTimeout), arg.ExpiresAt, time.Second)
+						return db.WebauthnChallenges{ChallengeHash: arg.ChallengeHash, UserID: arg.UserID, ExpiresAt: arg.ExpiresAt}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res struct {
+					PublicKey webauthn.CreationOptions `json:"publicKey"`
+				}
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.PublicKey.Challenge)
+				require.Equal(t, testRPID, res.PublicKey.RP.ID)
+				require.Equal(t, user.Email, res.PublicKey.User.Name)
+				require.Len(t, res.PublicKey.ExcludeCredentials, 1)
+				require.Equal(t, "required", res.PublicKey.AuthenticatorSelection.UserVerification)
+			},
+		},
+		{
+			name:       "Foreign User",
+			userID:     user.ID + 1,
+			configured: true,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Configured",
+			userID: user.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			if tc.configured {
+				server = newWebAuthnTestServer(t, store)
+			}
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/passkeys/start", tc.userID)
+			request, err := http.NewRequest(http.MethodPost, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestRegisterPasskeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	userID := sql.NullInt64{Int64: user.ID, Valid: true}
+
+	testCases := []struct {
+		name          string
+		authenticator func(authenticator *webauthntest.Authenticator)
+		clientData    func(clientData *webauthntest.ClientData)
+		buildStubs    func(store *mockdb.MockStore, challenge db.WebauthnChallenges)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			authenticator: func(authenticator *webauthntest.Authenticator) {
+				authenticator.SyncedCredentials = true
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Eq(challenge.ChallengeHash)).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateWebAuthnCredentialParams) (db.WebauthnCredentials, error) {
+						require.Equal(t, user.ID, arg.UserID)
+						require.NotEmpty(t, arg.CredentialID)
+						require.NotEmpty(t, arg.PublicKey)
+						require.Equal(t, "Laptop", arg.Name)
+						require.Equal(t, []string{"internal", "hybrid"}, arg.Transports)
+						require.True(t, arg.BackupEligible)
+						require.True(t, arg.BackedUp)
+
+						return db.WebauthnCredentials{
+							ID:             1,
+							UserID:         arg.UserID,
+							CredentialID:   arg.CredentialID,
+							PublicKey:      arg.PublicKey,
+							Transports:     arg.Transports,
+							Name:           arg.Name,
+							BackupEligible: arg.BackupEligible,
+							BackedUp:       arg.BackedUp,
+							CreatedAt:      time.Now(),
+						}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res passkeyResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), res.ID)
+				require.Equal(t, "Laptop", res.Name)
+				require.True(t, res.BackedUp)
+				require.Nil(t, res.LastUsedAt)
+			},
+		},
+		{
+			name: "Challenge Not Found",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnChallenges{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Expired Challenge",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				challenge.ExpiresAt = time.Now().Add(-time.Second)
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Login Challenge",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				challenge.UserID = sql.NullInt64{}
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Another User's Challenge",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				challenge.UserID = sql.NullInt64{Int64: user.ID + 1, Valid: true}
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "User Not Verified",
+			authenticator: func(authenticator *webauthntest.Authenticator) {
+				authenticator.UserVerified = false
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Origin",
+			clientData: func(clientData *webauthntest.ClientData) {
+				clientData.Origin = "https://evil.example"
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Already Registered",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					CreateWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredentials{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			challenge, storedChallenge := randomWebAuthnChallenge(t, userID)
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store, storedChallenge)
+
+			server := newWebAuthnTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			authenticator := webauthntest.NewAuthenticator()
+			if tc.authenticator != nil {
+				tc.authenticator(authenticator)
+			}
+			clientData := webauthntest.ClientData{Type: "webauthn.create", Challenge: challenge, Origin: testOrigin}
+			if tc.clientData != nil {
+				tc.clientData(&clientData)
+			}
+			registration, err := authenticator.RegisterWith(testRPID, clientData, webauthnUserHandle(user.ID))
+			require.NoError(t, err)
+
+			data, err := json.Marshal(gin.H{"name": " Laptop ", "credential": registration})
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/api/v1/users/%d/passkeys", user.ID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginPasskeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		credential    func(credential *db.WebauthnCredentials)
+		buildStubs    func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Eq(challenge.ChallengeHash)).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Eq(credential.CredentialID)).
+					Times(1).
+					Return(credential, nil)
+
+				arg := db.UpdateWebAuthnCredentialUseParams{ID: credential.ID, SignCount: credential.SignCount + 1}
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(user, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(1)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var res loginUserResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &res)
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+				require.Equal(t, user.Email, res.User.Email)
+			},
+		},
+		{
+			name: "Registration Challenge",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				challenge.UserID = sql.NullInt64{Int64: user.ID, Valid: true}
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Unknown Passkey",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredentials{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Stored For Another User",
+			credential: func(credential *db.WebauthnCredentials) {
+				credential.UserID = user.ID + 1
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Public Key",
+			credential: func(credential *db.WebauthnCredentials) {
+				other := registerTestPasskey(t, newWebAuthnTestServer(t, nil), webauthntest.NewAuthenticator(), user)
+				credential.PublicKey = other.PublicKey
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Cloned Authenticator",
+			credential: func(credential *db.WebauthnCredentials) {
+				credential.SignCount = 10
+			},
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Counter Already Used",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredentials{}, sql.ErrNoRows)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Locked Out",
+			buildStubs: func(store *mockdb.MockStore, challenge db.WebauthnChallenges, credential db.WebauthnCredentials) {
+				lockedUser := user
+				lockedUser.LockedUntil = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+
+				store.EXPECT().
+					UseWebAuthnChallenge(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(challenge, nil)
+				store.EXPECT().
+					GetWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					UpdateWebAuthnCredentialUse(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(credential, nil)
+				store.EXPECT().
+					GetUserById(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(lockedUser, nil)
+				store.EXPECT().
+					CreateSession(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newWebAuthnTestServer(t, store)
+
+			authenticator := webauthntest.NewAuthenticator()
+			credential := registerTestPasskey(t, server, authenticator, user)
+			if tc.credential != nil {
+				tc.credential(&credential)
+			}
+
+			challenge, storedChallenge := randomWebAuthnChallenge(t, sql.NullInt64{})
+			tc.buildStubs(store, storedChallenge, credential)
+
+			assertion, err := authenticator.Login(testRPID, testOrigin, challenge)
+			require.NoError(t, err)
+
+			data, err := json.Marshal(assertion)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/api/v1/users/login/passkey", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestDeletePasskeyAPI(t *testing.T) {
+	user, _ := randomUser(t)
+	passkeyID := util.RandomInt(1, 1000)
+
+	testCases := []struct {
+		name          string
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.DeleteWebAuthnCredentialParams{ID: passkeyID, UserID: user.ID}
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.WebauthnCredentials{ID: passkeyID, UserID: user.ID}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "Admin",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.AdminRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredentials{ID: passkeyID, UserID: user.ID}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "Foreign User",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID+1, time.Minute, withTestRole(util.TravelerRole))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "Not Found",
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, user.ID, time.Minute, withTestRole(user.Role))
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DeleteWebAuthnCredential(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.WebauthnCredentials{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newWebAuthnTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/api/v1/users/%d/passkeys/%d", user.ID, passkeyID)
+			request, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			tc.setupAuth(t, request, server.tokenMaker)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
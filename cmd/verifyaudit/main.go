@@ -0,0 +1,64 @@
+// Command verifyaudit checks that the audit events haven't been changed or removed since they were recorded.
+// It exits with status 1 if the hash chain is broken. Pass the last hash printed by an earlier run with
+// -last-hash to also catch the removal of the latest events.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	db "github.com/sajitron/travel-agency/db/sqlc"
+	"github.com/sajitron/travel-agency/util"
+)
+
+func main() {
+	configPath := flag.String("config", ".", "directory of the app.env config file")
+	lastHash := flag.String("last-hash", "", "hash printed by an earlier run, which the chain must still contain")
+	flag.Parse()
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	config, err := util.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load config")
+	}
+
+	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to connect to the database")
+	}
+	defer conn.Close()
+
+	store := db.NewStore(conn)
+
+	ctx := context.Background()
+	result, err := store.VerifyAuditChain(ctx)
+	if errors.Is(err, db.ErrAuditChainBroken) {
+		log.Error().Err(err).Int64("verified_events", result.Events).Msg("audit events have been tampered with")
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to verify audit events")
+	}
+
+	if *lastHash != "" {
+		_, err = store.GetAuditEventByHash(ctx, *lastHash)
+		if err == sql.ErrNoRows {
+			log.Error().Str("last_hash", *lastHash).Msg("audit events have been removed since the earlier run")
+			os.Exit(1)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to look up the earlier hash")
+		}
+	}
+
+	log.Info().Int64("events", result.Events).Msg("audit events are intact")
+	fmt.Println(result.LastHash)
+}
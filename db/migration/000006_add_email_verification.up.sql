@@ -0,0 +1,15 @@
+ALTER TABLE "users" ADD COLUMN "email_verified_at" timestamptz;
+
+CREATE TABLE "verification_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "purpose" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "verification_tokens" ("user_id", "purpose");
+
+ALTER TABLE "verification_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
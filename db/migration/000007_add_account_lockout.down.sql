@@ -0,0 +1,5 @@
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "last_failed_login_at";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "locked_until";
+
+ALTER TABLE IF EXISTS "users" DROP COLUMN IF EXISTS "failed_login_count";
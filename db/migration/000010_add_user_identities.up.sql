@@ -0,0 +1,26 @@
+CREATE TABLE "user_identities" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "issuer" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_login_at" timestamptz
+);
+
+CREATE TABLE "oidc_login_states" (
+  "state_hash" varchar PRIMARY KEY,
+  "code_verifier" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "user_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "user_identities" ("issuer", "subject");
+
+CREATE INDEX ON "user_identities" ("user_id");
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "oidc_login_states" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
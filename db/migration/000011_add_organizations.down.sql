@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "saml_requests";
+
+DROP TABLE IF EXISTS "saml_identities";
+
+DROP TABLE IF EXISTS "organizations";
@@ -0,0 +1,42 @@
+CREATE TABLE "organizations" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "slug" varchar UNIQUE NOT NULL,
+  "email_domains" varchar[] NOT NULL,
+  "idp_entity_id" varchar NOT NULL,
+  "idp_sso_url" varchar NOT NULL,
+  "idp_certificate" text NOT NULL,
+  "email_attribute" varchar NOT NULL DEFAULT '',
+  "first_name_attribute" varchar NOT NULL DEFAULT '',
+  "last_name_attribute" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "saml_identities" (
+  "id" bigserial PRIMARY KEY,
+  "organization_id" bigint NOT NULL,
+  "user_id" bigint NOT NULL,
+  "name_id" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_login_at" timestamptz
+);
+
+CREATE TABLE "saml_requests" (
+  "relay_state_hash" varchar PRIMARY KEY,
+  "request_id" varchar NOT NULL,
+  "organization_id" bigint NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "saml_identities" ("organization_id", "name_id");
+
+CREATE INDEX ON "saml_identities" ("user_id");
+
+ALTER TABLE "saml_identities" ADD FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "saml_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "saml_requests" ADD FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id") ON DELETE CASCADE;
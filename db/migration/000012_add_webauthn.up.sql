@@ -0,0 +1,27 @@
+CREATE TABLE "webauthn_credentials" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "credential_id" bytea UNIQUE NOT NULL,
+  "public_key" bytea NOT NULL,
+  "sign_count" bigint NOT NULL DEFAULT 0,
+  "transports" varchar[] NOT NULL DEFAULT '{}',
+  "aaguid" bytea NOT NULL,
+  "name" varchar NOT NULL,
+  "backup_eligible" boolean NOT NULL DEFAULT false,
+  "backed_up" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_used_at" timestamptz
+);
+
+CREATE TABLE "webauthn_challenges" (
+  "challenge_hash" varchar PRIMARY KEY,
+  "user_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "webauthn_credentials" ("user_id");
+
+ALTER TABLE "webauthn_credentials" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "webauthn_challenges" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS "verification_tokens" DROP COLUMN IF EXISTS "binding_hash";
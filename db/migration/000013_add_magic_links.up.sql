@@ -0,0 +1 @@
+ALTER TABLE "verification_tokens" ADD COLUMN "binding_hash" varchar;
@@ -0,0 +1,26 @@
+CREATE TABLE "impersonations" (
+  "id" uuid PRIMARY KEY,
+  "impersonator_id" bigint NOT NULL,
+  "user_id" bigint NOT NULL,
+  "reason" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "impersonation_requests" (
+  "id" bigserial PRIMARY KEY,
+  "impersonation_id" uuid NOT NULL,
+  "method" varchar NOT NULL,
+  "path" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "impersonations" ("impersonator_id");
+
+CREATE INDEX ON "impersonations" ("user_id");
+
+CREATE INDEX ON "impersonation_requests" ("impersonation_id");
+
+ALTER TABLE "impersonation_requests" ADD FOREIGN KEY ("impersonation_id") REFERENCES "impersonations" ("id");
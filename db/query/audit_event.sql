@@ -0,0 +1,47 @@
+-- name: LockAuditChain :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLastAuditEvent :one
+SELECT * FROM audit_events
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: GetAuditEventByHash :one
+SELECT * FROM audit_events
+WHERE hash = $1 LIMIT 1;
+
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+    actor_id,
+    impersonator_id,
+    action,
+    target_type,
+    target_id,
+    changes,
+    client_ip,
+    request_id,
+    created_at,
+    prev_hash,
+    hash
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+) RETURNING *;
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE
+  (sqlc.narg(actor_id)::bigint IS NULL OR actor_id = sqlc.narg(actor_id)) AND
+  (sqlc.narg(action)::varchar IS NULL OR action = sqlc.narg(action)) AND
+  (sqlc.narg(target_type)::varchar IS NULL OR target_type = sqlc.narg(target_type)) AND
+  (sqlc.narg(target_id)::varchar IS NULL OR target_id = sqlc.narg(target_id)) AND
+  (sqlc.narg(created_after)::timestamptz IS NULL OR created_at >= sqlc.narg(created_after)) AND
+  (sqlc.narg(created_before)::timestamptz IS NULL OR created_at < sqlc.narg(created_before))
+ORDER BY id DESC
+LIMIT sqlc.arg(limit_count)
+OFFSET sqlc.arg(offset_count);
+
+-- name: ListAuditEventsAfter :many
+SELECT * FROM audit_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
@@ -0,0 +1,26 @@
+-- name: CreateImpersonation :one
+INSERT INTO impersonations (
+    id,
+    impersonator_id,
+    user_id,
+    reason,
+    client_ip,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: CreateImpersonationRequest :one
+INSERT INTO impersonation_requests (
+    impersonation_id,
+    method,
+    path,
+    client_ip
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: ListImpersonationRequests :many
+SELECT * FROM impersonation_requests
+WHERE impersonation_id = $1
+ORDER BY id;
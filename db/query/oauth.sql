@@ -0,0 +1,75 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+    id,
+    user_id,
+    name,
+    secret_hash,
+    redirect_uris,
+    scopes,
+    grant_types
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1 LIMIT 1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :one
+DELETE FROM oauth_clients
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: CreateOAuthAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (
+    code_hash,
+    client_id,
+    user_id,
+    redirect_uri,
+    scopes,
+    code_challenge,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: UseOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET
+  used_at = now()
+WHERE
+  code_hash = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: GetOAuthConsent :one
+SELECT * FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2 LIMIT 1;
+
+-- name: ListOAuthConsents :many
+SELECT * FROM oauth_consents
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: UpsertOAuthConsent :one
+INSERT INTO oauth_consents (
+    user_id,
+    client_id,
+    scopes
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET
+  scopes = EXCLUDED.scopes,
+  updated_at = now()
+RETURNING *;
+
+-- name: DeleteOAuthConsent :one
+DELETE FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2
+RETURNING *;
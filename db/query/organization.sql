@@ -0,0 +1,75 @@
+-- name: CreateOrganization :one
+INSERT INTO organizations (
+    name,
+    slug,
+    email_domains,
+    idp_entity_id,
+    idp_sso_url,
+    idp_certificate,
+    email_attribute,
+    first_name_attribute,
+    last_name_attribute
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING *;
+
+-- name: GetOrganizationBySlug :one
+SELECT * FROM organizations
+WHERE slug = $1 LIMIT 1;
+
+-- name: ListOrganizations :many
+SELECT * FROM organizations
+ORDER BY name;
+
+-- name: UpdateOrganization :one
+UPDATE organizations
+SET
+  name = $2,
+  email_domains = $3,
+  idp_entity_id = $4,
+  idp_sso_url = $5,
+  idp_certificate = $6,
+  email_attribute = $7,
+  first_name_attribute = $8,
+  last_name_attribute = $9,
+  updated_at = now()
+WHERE
+  slug = $1
+RETURNING *;
+
+-- name: CreateSAMLIdentity :one
+INSERT INTO saml_identities (
+    organization_id,
+    user_id,
+    name_id,
+    email
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetSAMLIdentity :one
+SELECT * FROM saml_identities
+WHERE organization_id = $1 AND name_id = $2 LIMIT 1;
+
+-- name: RecordSAMLIdentityLogin :exec
+UPDATE saml_identities
+SET
+  email = $2,
+  last_login_at = now()
+WHERE
+  id = $1;
+
+-- name: CreateSAMLRequest :one
+INSERT INTO saml_requests (
+    relay_state_hash,
+    request_id,
+    organization_id,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: UseSAMLRequest :one
+DELETE FROM saml_requests
+WHERE relay_state_hash = $1
+RETURNING *;
@@ -24,7 +24,108 @@ SET
   updated_at = now(),
   first_name = COALESCE(sqlc.narg(first_name), first_name),
   last_name = COALESCE(sqlc.narg(last_name), last_name),
-  email = COALESCE(sqlc.narg(email), email)
+  email = COALESCE(sqlc.narg(email), email),
+  email_verified_at = CASE WHEN email = COALESCE(sqlc.narg(email), email) THEN email_verified_at ELSE NULL END
 WHERE
   id = sqlc.arg(id)
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET
+  role = $1,
+  updated_at = now()
+WHERE
+  id = $2
+RETURNING *;
+
+-- name: SetUserTOTPSecret :one
+UPDATE users
+SET
+  totp_secret = $1,
+  totp_enabled_at = NULL,
+  updated_at = now()
+WHERE
+  id = $2
+RETURNING *;
+
+-- name: EnableUserTOTP :one
+UPDATE users
+SET
+  totp_enabled_at = now(),
+  updated_at = now()
+WHERE
+  id = $1 AND totp_secret IS NOT NULL
+RETURNING *;
+
+-- name: DisableUserTOTP :one
+UPDATE users
+SET
+  totp_secret = NULL,
+  totp_enabled_at = NULL,
+  updated_at = now()
+WHERE
+  id = $1
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET
+  email_verified_at = now(),
+  updated_at = now()
+WHERE
+  id = $1
+RETURNING *;
+
+-- name: GetUserByIdForUpdate :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: GetUserPasswordChangedAt :one
+SELECT password_changed_at FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: RecordFailedLogin :one
+UPDATE users
+SET
+  failed_login_count = failed_login_count + 1,
+  last_failed_login_at = now()
+WHERE
+  id = $1
+RETURNING *;
+
+-- name: LockUser :one
+UPDATE users
+SET
+  locked_until = GREATEST(locked_until, sqlc.arg(locked_until)::timestamptz)
+WHERE
+  id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ResetFailedLogins :one
+UPDATE users
+SET
+  failed_login_count = 0,
+  locked_until = NULL,
+  last_failed_login_at = NULL
+WHERE
+  id = $1
+RETURNING *;
+
+-- name: RehashUserPassword :one
+UPDATE users
+SET
+  password = sqlc.arg(new_password),
+  updated_at = now()
+WHERE
+  id = sqlc.arg(id) AND password = sqlc.arg(old_password)
+RETURNING *;
+
+-- name: UseTOTPStep :one
+UPDATE users
+SET
+  totp_last_used_step = sqlc.arg(step)
+WHERE
+  id = sqlc.arg(id) AND totp_last_used_step < sqlc.arg(step)
+RETURNING *;
@@ -0,0 +1,47 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (
+    user_id,
+    issuer,
+    subject,
+    email
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities
+WHERE issuer = $1 AND subject = $2 LIMIT 1;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: RecordUserIdentityLogin :exec
+UPDATE user_identities
+SET
+  email = $2,
+  last_login_at = now()
+WHERE
+  id = $1;
+
+-- name: DeleteUserIdentity :one
+DELETE FROM user_identities
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: CreateOIDCLoginState :one
+INSERT INTO oidc_login_states (
+    state_hash,
+    code_verifier,
+    nonce,
+    user_id,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: UseOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+RETURNING *;
@@ -0,0 +1,29 @@
+-- name: CreateVerificationToken :one
+INSERT INTO verification_tokens (
+    user_id,
+    token_hash,
+    purpose,
+    expires_at,
+    binding_hash
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetVerificationToken :one
+SELECT * FROM verification_tokens
+WHERE token_hash = $1 AND purpose = $2 LIMIT 1;
+
+-- name: UseVerificationToken :one
+UPDATE verification_tokens
+SET
+  used_at = now()
+WHERE
+  id = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: InvalidateVerificationTokens :exec
+UPDATE verification_tokens
+SET
+  used_at = now()
+WHERE
+  user_id = $1 AND purpose = $2 AND used_at IS NULL;
@@ -0,0 +1,52 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id,
+    credential_id,
+    public_key,
+    sign_count,
+    transports,
+    aaguid,
+    name,
+    backup_eligible,
+    backed_up
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING *;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1 LIMIT 1;
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: UpdateWebAuthnCredentialUse :one
+UPDATE webauthn_credentials
+SET
+  sign_count = $2,
+  backed_up = $3,
+  last_used_at = now()
+WHERE
+  id = $1 AND (sign_count < $2 OR $2 = 0)
+RETURNING *;
+
+-- name: DeleteWebAuthnCredential :one
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (
+    challenge_hash,
+    user_id,
+    expires_at
+) VALUES (
+    $1, $2, $3
+) RETURNING *;
+
+-- name: UseWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE challenge_hash = $1
+RETURNING *;
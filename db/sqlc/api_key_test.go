@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAPIKey(t *testing.T, user Users) ApiKeys {
+	_, prefix, keyHash, err := util.GenerateAPIKey()
+	require.NoError(t, err)
+
+	arg := CreateAPIKeyParams{
+		UserID:    user.ID,
+		Name:      util.RandomString(8),
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    []string{util.PermissionBookingsRead, util.PermissionBookingsWrite},
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	apiKey, err := testQueries.CreateAPIKey(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.UserID, apiKey.UserID)
+	require.Equal(t, arg.Name, apiKey.Name)
+	require.Equal(t, arg.Prefix, apiKey.Prefix)
+	require.Equal(t, arg.KeyHash, apiKey.KeyHash)
+	require.Equal(t, arg.Scopes, apiKey.Scopes)
+	require.WithinDuration(t, arg.ExpiresAt, apiKey.ExpiresAt, time.Second)
+	require.False(t, apiKey.LastUsedAt.Valid)
+	require.False(t, apiKey.RevokedAt.Valid)
+
+	return apiKey
+}
+
+func TestGetAPIKeyByPrefix(t *testing.T) {
+	apiKey := createRandomAPIKey(t, createRandomUser(t))
+
+	gotKey, err := testQueries.GetAPIKeyByPrefix(context.Background(), apiKey.Prefix)
+	require.NoError(t, err)
+	require.Equal(t, apiKey.ID, gotKey.ID)
+	require.Equal(t, apiKey.Scopes, gotKey.Scopes)
+}
+
+func TestListAPIKeys(t *testing.T) {
+	user := createRandomUser(t)
+	first := createRandomAPIKey(t, user)
+	second := createRandomAPIKey(t, user)
+	createRandomAPIKey(t, createRandomUser(t))
+
+	apiKeys, err := testQueries.ListAPIKeys(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, apiKeys, 2)
+	require.Equal(t, second.ID, apiKeys[0].ID)
+	require.Equal(t, first.ID, apiKeys[1].ID)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	user := createRandomUser(t)
+	apiKey := createRandomAPIKey(t, user)
+
+	// a key can only be revoked by its owner
+	_, err := testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{
+		ID:     apiKey.ID,
+		UserID: createRandomUser(t).ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	revokedKey, err := testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{
+		ID:     apiKey.ID,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+	require.True(t, revokedKey.RevokedAt.Valid)
+
+	_, err = testQueries.RevokeAPIKey(context.Background(), RevokeAPIKeyParams{
+		ID:     apiKey.ID,
+		UserID: user.ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestTouchAPIKey(t *testing.T) {
+	apiKey := createRandomAPIKey(t, createRandomUser(t))
+
+	err := testQueries.TouchAPIKey(context.Background(), apiKey.ID)
+	require.NoError(t, err)
+
+	touchedKey, err := testQueries.GetAPIKeyByPrefix(context.Background(), apiKey.Prefix)
+	require.NoError(t, err)
+	require.True(t, touchedKey.LastUsedAt.Valid)
+
+	// uses within a minute of the last recorded one aren't written
+	err = testQueries.TouchAPIKey(context.Background(), apiKey.ID)
+	require.NoError(t, err)
+
+	gotKey, err := testQueries.GetAPIKeyByPrefix(context.Background(), apiKey.Prefix)
+	require.NoError(t, err)
+	require.Equal(t, touchedKey.LastUsedAt, gotKey.LastUsedAt)
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAuditEvent(t *testing.T, store Store) AuditEvents {
+	user := createRandomUser(t)
+
+	arg := AuditEventParams{
+		ActorID:    sql.NullInt64{Int64: user.ID, Valid: true},
+		ClientIp:   "127.0.0.1",
+		RequestID:  util.RandomString(16),
+		Action:     AuditActionUserUnlock,
+		TargetType: AuditTargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+	}
+
+	event, err := store.CreateAuditEventTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.ActorID, event.ActorID)
+	require.False(t, event.ImpersonatorID.Valid)
+	require.Equal(t, arg.Action, event.Action)
+	require.Equal(t, arg.TargetID, event.TargetID)
+	require.Equal(t, "{}", event.Changes)
+	require.Equal(t, arg.RequestID, event.RequestID)
+	require.Equal(t, auditEventHash(event), event.Hash)
+
+	return event
+}
+
+func TestCreateAuditEventTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	event1 := createRandomAuditEvent(t, store)
+	event2 := createRandomAuditEvent(t, store)
+	require.Equal(t, event1.Hash, event2.PrevHash)
+
+	// events can't be changed or removed once recorded
+	_, err := testDB.Exec("UPDATE audit_events SET action = 'user.delete' WHERE id = $1", event1.ID)
+	require.Error(t, err)
+	_, err = testDB.Exec("DELETE FROM audit_events WHERE id = $1", event1.ID)
+	require.Error(t, err)
+}
+
+func TestUpdateUserTxAudit(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	newFirstName := util.RandomName()
+
+	updatedUser, err := store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			ID:        user.ID,
+			FirstName: sql.NullString{String: newFirstName, Valid: true},
+			Password:  sql.NullString{String: util.RandomString(32), Valid: true},
+		},
+		Audit: AuditEventParams{
+			ActorID:   sql.NullInt64{Int64: user.ID, Valid: true},
+			ClientIp:  "127.0.0.1",
+			RequestID: util.RandomString(16),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newFirstName, updatedUser.FirstName)
+
+	events, err := store.ListAuditEvents(context.Background(), ListAuditEventsParams{
+		TargetType:  sql.NullString{String: AuditTargetUser, Valid: true},
+		TargetID:    sql.NullString{String: strconv.FormatInt(user.ID, 10), Valid: true},
+		LimitCount:  5,
+		OffsetCount: 0,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, AuditActionUserUpdate, events[0].Action)
+
+	var changes map[string]auditChange
+	err = json.Unmarshal([]byte(events[0].Changes), &changes)
+	require.NoError(t, err)
+	require.JSONEq(t, strconv.Quote(user.FirstName), string(changes["first_name"].Before))
+	require.JSONEq(t, strconv.Quote(newFirstName), string(changes["first_name"].After))
+	require.JSONEq(t, `"[redacted]"`, string(changes["password"].After))
+	require.NotContains(t, changes, "last_name")
+
+	// a user that doesn't exist isn't audited
+	_, err = store.UpdateUserTx(context.Background(), UpdateUserTxParams{
+		UpdateUserParams: UpdateUserParams{
+			ID:        user.ID + 1000000,
+			FirstName: sql.NullString{String: newFirstName, Valid: true},
+		},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	store := NewStore(testDB)
+	event := createRandomAuditEvent(t, store)
+	createRandomAuditEvent(t, store)
+
+	result, err := store.VerifyAuditChain(context.Background())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, result.Events, int64(2))
+
+	// tamper with an event the way someone with direct access to the database could
+	_, err = testDB.Exec("ALTER TABLE audit_events DISABLE TRIGGER audit_events_append_only")
+	require.NoError(t, err)
+	defer func() {
+		_, err = testDB.Exec("UPDATE audit_events SET target_id = $1 WHERE id = $2", event.TargetID, event.ID)
+		require.NoError(t, err)
+		_, err = testDB.Exec("ALTER TABLE audit_events ENABLE TRIGGER audit_events_append_only")
+		require.NoError(t, err)
+	}()
+
+	_, err = testDB.Exec("UPDATE audit_events SET target_id = '1' WHERE id = $1", event.ID)
+	require.NoError(t, err)
+
+	_, err = store.VerifyAuditChain(context.Background())
+	require.ErrorIs(t, err, ErrAuditChainBroken)
+	require.Contains(t, err.Error(), strconv.FormatInt(event.ID, 10))
+}
+
+func TestAuditChanges(t *testing.T) {
+	before := Users{
+		ID:         1,
+		FirstName:  "Jane",
+		Password:   "old hash",
+		TotpSecret: sql.NullString{String: "secret", Valid: true},
+	}
+	after := before
+	after.FirstName = "Janet"
+	after.Password = "new hash"
+	after.TotpSecret = sql.NullString{}
+	after.LockedUntil = sql.NullTime{Time: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+
+	changes, err := auditChanges(before, after)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"first_name": {"before": "Jane", "after": "Janet"},
+		"password": {"before": "[redacted]", "after": "[redacted]"},
+		"totp_secret": {"before": "[redacted]", "after": null},
+		"locked_until": {"before": null, "after": "2030-01-01T00:00:00Z"}
+	}`, changes)
+
+	changes, err = auditChanges(nil, OauthClients{ID: "client", SecretHash: sql.NullString{String: "hash", Valid: true}})
+	require.NoError(t, err)
+	require.Contains(t, changes, `"secret_hash":{"before":null,"after":"[redacted]"}`)
+
+	changes, err = auditChanges(nil, map[string]string{"reason": "ticket 4521"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"reason": {"before": null, "after": "ticket 4521"}}`, changes)
+
+	changes, err = auditChanges(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "{}", changes)
+
+	_, err = auditChanges(nil, "not an object")
+	require.Error(t, err)
+}
+
+func TestAuditEventHash(t *testing.T) {
+	event := AuditEvents{
+		ID:         1,
+		ActorID:    sql.NullInt64{Int64: 7, Valid: true},
+		Action:     AuditActionUserUpdate,
+		TargetType: AuditTargetUser,
+		TargetID:   "12",
+		Changes:    "{}",
+		ClientIp:   "127.0.0.1",
+		RequestID:  "abc",
+		CreatedAt:  time.Now().Truncate(time.Microsecond),
+		PrevHash:   "0f",
+	}
+	hash := auditEventHash(event)
+	require.Len(t, hash, 64)
+
+	// the ID and the time zone aren't covered, as the database sets the first and may change the second
+	unchanged := event
+	unchanged.ID = 2
+	unchanged.CreatedAt = event.CreatedAt.In(time.FixedZone("WAT", 3600))
+	require.Equal(t, hash, auditEventHash(unchanged))
+
+	changed := []func(e *AuditEvents){
+		func(e *AuditEvents) { e.PrevHash = "" },
+		func(e *AuditEvents) { e.ActorID = sql.NullInt64{} },
+		func(e *AuditEvents) { e.ActorID = sql.NullInt64{Int64: 0, Valid: true} },
+		func(e *AuditEvents) { e.TargetID = "1" },
+		func(e *AuditEvents) { e.Changes = `{"role":{"before":"agent","after":"admin"}}` },
+		func(e *AuditEvents) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		// text moved from one field to the next
+		func(e *AuditEvents) { e.TargetType, e.TargetID = AuditTargetUser+"1", "2" },
+	}
+	for _, change := range changed {
+		tampered := event
+		change(&tampered)
+		require.NotEqual(t, hash, auditEventHash(tampered))
+	}
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomImpersonation(t *testing.T) Impersonations {
+	arg := CreateImpersonationParams{
+		ID:             uuid.New(),
+		ImpersonatorID: createRandomUser(t).ID,
+		UserID:         createRandomUser(t).ID,
+		Reason:         "ticket 4521, booking stuck",
+		ClientIp:       "127.0.0.1",
+		ExpiresAt:      time.Now().Add(15 * time.Minute),
+	}
+
+	impersonation, err := testQueries.CreateImpersonation(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.ID, impersonation.ID)
+	require.Equal(t, arg.ImpersonatorID, impersonation.ImpersonatorID)
+	require.Equal(t, arg.UserID, impersonation.UserID)
+	require.Equal(t, arg.Reason, impersonation.Reason)
+	require.Equal(t, arg.ClientIp, impersonation.ClientIp)
+	require.WithinDuration(t, arg.ExpiresAt, impersonation.ExpiresAt, time.Second)
+	require.NotZero(t, impersonation.CreatedAt)
+
+	return impersonation
+}
+
+func TestListImpersonationRequests(t *testing.T) {
+	impersonation := createRandomImpersonation(t)
+	createRandomImpersonation(t)
+
+	paths := []string{"/api/v1/users/1", "/api/v1/bookings"}
+	for _, path := range paths {
+		request, err := testQueries.CreateImpersonationRequest(context.Background(), CreateImpersonationRequestParams{
+			ImpersonationID: impersonation.ID,
+			Method:          "GET",
+			Path:            path,
+			ClientIp:        "127.0.0.1",
+		})
+		require.NoError(t, err)
+		require.Equal(t, impersonation.ID, request.ImpersonationID)
+		require.Equal(t, path, request.Path)
+	}
+
+	requests, err := testQueries.ListImpersonationRequests(context.Background(), impersonation.ID)
+	require.NoError(t, err)
+	require.Len(t, requests, len(paths))
+	for i, request := range requests {
+		require.Equal(t, paths[i], request.Path)
+	}
+
+	// requests can only be recorded for an impersonation
+	_, err = testQueries.CreateImpersonationRequest(context.Background(), CreateImpersonationRequestParams{
+		ImpersonationID: uuid.New(),
+		Method:          "GET",
+		Path:            "/api/v1/users/1",
+		ClientIp:        "127.0.0.1",
+	})
+	require.Error(t, err)
+}
@@ -5,29 +5,212 @@
 package db
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKeys struct {
+	ID         int64        `json:"id"`
+	UserID     int64        `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type AuditEvents struct {
+	ID             int64         `json:"id"`
+	ActorID        sql.NullInt64 `json:"actor_id"`
+	ImpersonatorID sql.NullInt64 `json:"impersonator_id"`
+	Action         string        `json:"action"`
+	TargetType     string        `json:"target_type"`
+	TargetID       string        `json:"target_id"`
+	Changes        string        `json:"changes"`
+	ClientIp       string        `json:"client_ip"`
+	RequestID      string        `json:"request_id"`
+	CreatedAt      time.Time     `json:"created_at"`
+	PrevHash       string        `json:"prev_hash"`
+	Hash           string        `json:"hash"`
+}
+
+type ImpersonationRequests struct {
+	ID              int64     `json:"id"`
+	ImpersonationID uuid.UUID `json:"impersonation_id"`
+	Method          string    `json:"method"`
+	Path            string    `json:"path"`
+	ClientIp        string    `json:"client_ip"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type Impersonations struct {
+	ID             uuid.UUID `json:"id"`
+	ImpersonatorID int64     `json:"impersonator_id"`
+	UserID         int64     `json:"user_id"`
+	Reason         string    `json:"reason"`
+	ClientIp       string    `json:"client_ip"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type OauthAuthorizationCodes struct {
+	CodeHash      string       `json:"code_hash"`
+	ClientID      string       `json:"client_id"`
+	UserID        int64        `json:"user_id"`
+	RedirectUri   string       `json:"redirect_uri"`
+	Scopes        []string     `json:"scopes"`
+	CodeChallenge string       `json:"code_challenge"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	UsedAt        sql.NullTime `json:"used_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+type OauthClients struct {
+	ID           string         `json:"id"`
+	UserID       int64          `json:"user_id"`
+	Name         string         `json:"name"`
+	SecretHash   sql.NullString `json:"secret_hash"`
+	RedirectUris []string       `json:"redirect_uris"`
+	Scopes       []string       `json:"scopes"`
+	GrantTypes   []string       `json:"grant_types"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type OauthConsents struct {
+	UserID    int64     `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OidcLoginStates struct {
+	StateHash    string        `json:"state_hash"`
+	CodeVerifier string        `json:"code_verifier"`
+	Nonce        string        `json:"nonce"`
+	UserID       sql.NullInt64 `json:"user_id"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+type Organizations struct {
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	Slug               string    `json:"slug"`
+	EmailDomains       []string  `json:"email_domains"`
+	IdpEntityID        string    `json:"idp_entity_id"`
+	IdpSsoUrl          string    `json:"idp_sso_url"`
+	IdpCertificate     string    `json:"idp_certificate"`
+	EmailAttribute     string    `json:"email_attribute"`
+	FirstNameAttribute string    `json:"first_name_attribute"`
+	LastNameAttribute  string    `json:"last_name_attribute"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type RecoveryCodes struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type SamlIdentities struct {
+	ID             int64        `json:"id"`
+	OrganizationID int64        `json:"organization_id"`
+	UserID         int64        `json:"user_id"`
+	NameID         string       `json:"name_id"`
+	Email          string       `json:"email"`
+	CreatedAt      time.Time    `json:"created_at"`
+	LastLoginAt    sql.NullTime `json:"last_login_at"`
+}
+
+type SamlRequests struct {
+	RelayStateHash string    `json:"relay_state_hash"`
+	RequestID      string    `json:"request_id"`
+	OrganizationID int64     `json:"organization_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 type Sessions struct {
-	ID           uuid.UUID `json:"id"`
-	UserID       int64     `json:"user_id"`
-	RefreshToken string    `json:"refresh_token"`
-	UserAgent    string    `json:"user_agent"`
-	ClientIp     string    `json:"client_ip"`
-	IsBlocked    bool      `json:"is_blocked"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           uuid.UUID     `json:"id"`
+	UserID       int64         `json:"user_id"`
+	RefreshToken string        `json:"refresh_token"`
+	UserAgent    string        `json:"user_agent"`
+	ClientIp     string        `json:"client_ip"`
+	IsBlocked    bool          `json:"is_blocked"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	CreatedAt    time.Time     `json:"created_at"`
+	FamilyID     uuid.UUID     `json:"family_id"`
+	ParentID     uuid.NullUUID `json:"parent_id"`
+	RotatedAt    sql.NullTime  `json:"rotated_at"`
+}
+
+type UserIdentities struct {
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"user_id"`
+	Issuer      string       `json:"issuer"`
+	Subject     string       `json:"subject"`
+	Email       string       `json:"email"`
+	CreatedAt   time.Time    `json:"created_at"`
+	LastLoginAt sql.NullTime `json:"last_login_at"`
 }
 
 type Users struct {
-	ID                int64     `json:"id"`
-	FirstName         string    `json:"first_name"`
-	LastName          string    `json:"last_name"`
-	Email             string    `json:"email"`
-	Password          string    `json:"password"`
-	PasswordChangedAt time.Time `json:"password_changed_at"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                int64          `json:"id"`
+	FirstName         string         `json:"first_name"`
+	LastName          string         `json:"last_name"`
+	Email             string         `json:"email"`
+	Password          string         `json:"password"`
+	PasswordChangedAt time.Time      `json:"password_changed_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	Role              string         `json:"role"`
+	TotpSecret        sql.NullString `json:"totp_secret"`
+	TotpEnabledAt     sql.NullTime   `json:"totp_enabled_at"`
+	EmailVerifiedAt   sql.NullTime   `json:"email_verified_at"`
+	FailedLoginCount  int32          `json:"failed_login_count"`
+	LockedUntil       sql.NullTime   `json:"locked_until"`
+	LastFailedLoginAt sql.NullTime   `json:"last_failed_login_at"`
+	TotpLastUsedStep  int64          `json:"totp_last_used_step"`
+}
+
+type VerificationTokens struct {
+	ID          int64          `json:"id"`
+	UserID      int64          `json:"user_id"`
+	TokenHash   string         `json:"token_hash"`
+	Purpose     string         `json:"purpose"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+	UsedAt      sql.NullTime   `json:"used_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	BindingHash sql.NullString `json:"binding_hash"`
+}
+
+type WebauthnChallenges struct {
+	ChallengeHash string        `json:"challenge_hash"`
+	UserID        sql.NullInt64 `json:"user_id"`
+	ExpiresAt     time.Time     `json:"expires_at"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+type WebauthnCredentials struct {
+	ID             int64        `json:"id"`
+	UserID         int64        `json:"user_id"`
+	CredentialID   []byte       `json:"credential_id"`
+	PublicKey      []byte       `json:"public_key"`
+	SignCount      int64        `json:"sign_count"`
+	Transports     []string     `json:"transports"`
+	Aaguid         []byte       `json:"aaguid"`
+	Name           string       `json:"name"`
+	BackupEligible bool         `json:"backup_eligible"`
+	BackedUp       bool         `json:"backed_up"`
+	CreatedAt      time.Time    `json:"created_at"`
+	LastUsedAt     sql.NullTime `json:"last_used_at"`
 }
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomOAuthClient(t *testing.T, user Users) OauthClients {
+	arg := CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		UserID:       user.ID,
+		Name:         util.RandomString(8),
+		RedirectUris: []string{"https://partner.example.com/callback"},
+		Scopes:       []string{util.PermissionBookingsRead},
+		GrantTypes:   []string{"authorization_code"},
+	}
+
+	client, err := testQueries.CreateOAuthClient(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.ID, client.ID)
+	require.Equal(t, arg.UserID, client.UserID)
+	require.Equal(t, arg.RedirectUris, client.RedirectUris)
+	require.Equal(t, arg.Scopes, client.Scopes)
+	require.Equal(t, arg.GrantTypes, client.GrantTypes)
+	require.False(t, client.SecretHash.Valid)
+
+	return client
+}
+
+func TestGetOAuthClient(t *testing.T) {
+	client := createRandomOAuthClient(t, createRandomUser(t))
+
+	gotClient, err := testQueries.GetOAuthClient(context.Background(), client.ID)
+	require.NoError(t, err)
+	require.Equal(t, client.Name, gotClient.Name)
+	require.Equal(t, client.Scopes, gotClient.Scopes)
+}
+
+func TestDeleteOAuthClient(t *testing.T) {
+	user := createRandomUser(t)
+	client := createRandomOAuthClient(t, user)
+
+	// clients of other users can't be deleted
+	_, err := testQueries.DeleteOAuthClient(context.Background(), DeleteOAuthClientParams{
+		ID:     client.ID,
+		UserID: createRandomUser(t).ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.DeleteOAuthClient(context.Background(), DeleteOAuthClientParams{
+		ID:     client.ID,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.GetOAuthClient(context.Background(), client.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseOAuthAuthorizationCode(t *testing.T) {
+	user := createRandomUser(t)
+	client := createRandomOAuthClient(t, user)
+
+	_, codeHash, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	_, err = testQueries.CreateOAuthAuthorizationCode(context.Background(), CreateOAuthAuthorizationCodeParams{
+		CodeHash:      codeHash,
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectUri:   client.RedirectUris[0],
+		Scopes:        client.Scopes,
+		CodeChallenge: util.PKCEChallenge(util.RandomString(43)),
+		ExpiresAt:     time.Now().Add(5 * time.Minute),
+	})
+	require.NoError(t, err)
+
+	code, err := testQueries.UseOAuthAuthorizationCode(context.Background(), codeHash)
+	require.NoError(t, err)
+	require.True(t, code.UsedAt.Valid)
+	require.Equal(t, user.ID, code.UserID)
+
+	// a code can only be used once
+	_, err = testQueries.UseOAuthAuthorizationCode(context.Background(), codeHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUpsertOAuthConsent(t *testing.T) {
+	user := createRandomUser(t)
+	client := createRandomOAuthClient(t, user)
+
+	consent, err := testQueries.UpsertOAuthConsent(context.Background(), UpsertOAuthConsentParams{
+		UserID:   user.ID,
+		ClientID: client.ID,
+		Scopes:   []string{util.PermissionBookingsRead},
+	})
+	require.NoError(t, err)
+
+	scopes := []string{util.PermissionBookingsRead, util.PermissionUsersRead}
+	updatedConsent, err := testQueries.UpsertOAuthConsent(context.Background(), UpsertOAuthConsentParams{
+		UserID:   user.ID,
+		ClientID: client.ID,
+		Scopes:   scopes,
+	})
+	require.NoError(t, err)
+	require.Equal(t, scopes, updatedConsent.Scopes)
+	require.Equal(t, consent.CreatedAt, updatedConsent.CreatedAt)
+
+	consents, err := testQueries.ListOAuthConsents(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, consents, 1)
+
+	_, err = testQueries.DeleteOAuthConsent(context.Background(), DeleteOAuthConsentParams{
+		UserID:   user.ID,
+		ClientID: client.ID,
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.GetOAuthConsent(context.Background(), GetOAuthConsentParams{
+		UserID:   user.ID,
+		ClientID: client.ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomOrganization(t *testing.T) Organizations {
+	arg := CreateOrganizationParams{
+		Name:           util.RandomName(),
+		Slug:           strings.ToLower(util.RandomString(12)),
+		EmailDomains:   []string{"email.com"},
+		IdpEntityID:    "https://idp.example.com/" + util.RandomString(8),
+		IdpSsoUrl:      "https://idp.example.com/sso",
+		IdpCertificate: util.RandomString(64),
+		EmailAttribute: "mail",
+	}
+
+	org, err := testQueries.CreateOrganization(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.Slug, org.Slug)
+	require.Equal(t, arg.EmailDomains, org.EmailDomains)
+	require.Equal(t, arg.IdpEntityID, org.IdpEntityID)
+	require.Equal(t, arg.EmailAttribute, org.EmailAttribute)
+	require.Empty(t, org.FirstNameAttribute)
+	require.NotZero(t, org.CreatedAt)
+
+	return org
+}
+
+func TestGetOrganizationBySlug(t *testing.T) {
+	org := createRandomOrganization(t)
+
+	gotOrg, err := testQueries.GetOrganizationBySlug(context.Background(), org.Slug)
+	require.NoError(t, err)
+	require.Equal(t, org.ID, gotOrg.ID)
+	require.Equal(t, org.EmailDomains, gotOrg.EmailDomains)
+
+	_, err = testQueries.CreateOrganization(context.Background(), CreateOrganizationParams{
+		Name:         util.RandomName(),
+		Slug:         org.Slug,
+		EmailDomains: org.EmailDomains,
+	})
+	require.Error(t, err)
+}
+
+func TestUpdateOrganization(t *testing.T) {
+	org := createRandomOrganization(t)
+
+	arg := UpdateOrganizationParams{
+		Slug:           org.Slug,
+		Name:           util.RandomName(),
+		EmailDomains:   []string{"email.com", "travel.agency"},
+		IdpEntityID:    org.IdpEntityID,
+		IdpSsoUrl:      org.IdpSsoUrl,
+		IdpCertificate: util.RandomString(64),
+	}
+
+	updated, err := testQueries.UpdateOrganization(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, org.ID, updated.ID)
+	require.Equal(t, arg.EmailDomains, updated.EmailDomains)
+	require.Equal(t, arg.IdpCertificate, updated.IdpCertificate)
+	require.Empty(t, updated.EmailAttribute)
+
+	arg.Slug = "unknown-" + org.Slug
+	_, err = testQueries.UpdateOrganization(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSAMLIdentity(t *testing.T) {
+	org := createRandomOrganization(t)
+	user := createRandomUser(t)
+
+	arg := CreateSAMLIdentityParams{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		NameID:         util.RandomString(16),
+		Email:          user.Email,
+	}
+	identity, err := testQueries.CreateSAMLIdentity(context.Background(), arg)
+	require.NoError(t, err)
+
+	// the same name ID at another organization is someone else
+	_, err = testQueries.GetSAMLIdentity(context.Background(), GetSAMLIdentityParams{
+		OrganizationID: createRandomOrganization(t).ID,
+		NameID:         arg.NameID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	email := util.RandomEmail()
+	err = testQueries.RecordSAMLIdentityLogin(context.Background(), RecordSAMLIdentityLoginParams{
+		ID:    identity.ID,
+		Email: email,
+	})
+	require.NoError(t, err)
+
+	gotIdentity, err := testQueries.GetSAMLIdentity(context.Background(), GetSAMLIdentityParams{
+		OrganizationID: org.ID,
+		NameID:         arg.NameID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.ID, gotIdentity.UserID)
+	require.Equal(t, email, gotIdentity.Email)
+	require.True(t, gotIdentity.LastLoginAt.Valid)
+}
+
+func TestUseSAMLRequest(t *testing.T) {
+	org := createRandomOrganization(t)
+
+	arg := CreateSAMLRequestParams{
+		RelayStateHash: util.RandomString(32),
+		RequestID:      "_" + util.RandomString(40),
+		OrganizationID: org.ID,
+		ExpiresAt:      time.Now().Add(10 * time.Minute),
+	}
+	_, err := testQueries.CreateSAMLRequest(context.Background(), arg)
+	require.NoError(t, err)
+
+	samlRequest, err := testQueries.UseSAMLRequest(context.Background(), arg.RelayStateHash)
+	require.NoError(t, err)
+	require.Equal(t, arg.RequestID, samlRequest.RequestID)
+	require.Equal(t, org.ID, samlRequest.OrganizationID)
+
+	// a request can only be used once
+	_, err = testQueries.UseSAMLRequest(context.Background(), arg.RelayStateHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestCreateSAMLUserTx(t *testing.T) {
+	store := NewStore(testDB)
+	org := createRandomOrganization(t)
+
+	arg := CreateSAMLUserTxParams{
+		CreateUserParams: CreateUserParams{
+			Email:     util.RandomEmail(),
+			FirstName: util.RandomName(),
+			LastName:  util.RandomName(),
+			Password:  util.RandomString(32),
+		},
+		OrganizationID: org.ID,
+		NameID:         util.RandomString(16),
+	}
+
+	result, err := store.CreateSAMLUserTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Email, result.User.Email)
+	require.True(t, result.User.EmailVerifiedAt.Valid)
+	require.Equal(t, result.User.ID, result.Identity.UserID)
+	require.Equal(t, arg.NameID, result.Identity.NameID)
+
+	// a taken name ID rolls the new user back
+	arg.Email = util.RandomEmail()
+	_, err = store.CreateSAMLUserTx(context.Background(), arg)
+	require.Error(t, err)
+
+	_, err = testQueries.GetUser(context.Background(), arg.Email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -6,17 +6,90 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Querier interface {
+	BlockOtherSessions(ctx context.Context, arg BlockOtherSessionsParams) error
+	BlockSessionFamily(ctx context.Context, familyID uuid.UUID) error
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKeys, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvents, error)
+	CreateImpersonation(ctx context.Context, arg CreateImpersonationParams) (Impersonations, error)
+	CreateImpersonationRequest(ctx context.Context, arg CreateImpersonationRequestParams) (ImpersonationRequests, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg CreateOAuthAuthorizationCodeParams) (OauthAuthorizationCodes, error)
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClients, error)
+	CreateOIDCLoginState(ctx context.Context, arg CreateOIDCLoginStateParams) (OidcLoginStates, error)
+	CreateOrganization(ctx context.Context, arg CreateOrganizationParams) (Organizations, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCodes, error)
+	CreateSAMLIdentity(ctx context.Context, arg CreateSAMLIdentityParams) (SamlIdentities, error)
+	CreateSAMLRequest(ctx context.Context, arg CreateSAMLRequestParams) (SamlRequests, error)
 	CreateSession(ctx context.Context, arg CreateSessionParams) (Sessions, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (Users, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentities, error)
+	CreateVerificationToken(ctx context.Context, arg CreateVerificationTokenParams) (VerificationTokens, error)
+	CreateWebAuthnChallenge(ctx context.Context, arg CreateWebAuthnChallengeParams) (WebauthnChallenges, error)
+	CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredentials, error)
+	DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (OauthClients, error)
+	DeleteOAuthConsent(ctx context.Context, arg DeleteOAuthConsentParams) (OauthConsents, error)
+	DeleteRecoveryCodes(ctx context.Context, userID int64) error
+	DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (UserIdentities, error)
+	DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (WebauthnCredentials, error)
+	DisableUserTOTP(ctx context.Context, id int64) (Users, error)
+	EnableUserTOTP(ctx context.Context, id int64) (Users, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (ApiKeys, error)
+	GetAuditEventByHash(ctx context.Context, hash string) (AuditEvents, error)
+	GetLastAuditEvent(ctx context.Context) (AuditEvents, error)
+	GetLatestFamilySession(ctx context.Context, familyID uuid.UUID) (Sessions, error)
+	GetOAuthClient(ctx context.Context, id string) (OauthClients, error)
+	GetOAuthConsent(ctx context.Context, arg GetOAuthConsentParams) (OauthConsents, error)
+	GetOrganizationBySlug(ctx context.Context, slug string) (Organizations, error)
+	GetSAMLIdentity(ctx context.Context, arg GetSAMLIdentityParams) (SamlIdentities, error)
 	GetSession(ctx context.Context, id uuid.UUID) (Sessions, error)
+	GetSessionForUpdate(ctx context.Context, id uuid.UUID) (Sessions, error)
 	GetUser(ctx context.Context, email string) (Users, error)
 	GetUserById(ctx context.Context, id int64) (Users, error)
+	GetUserByIdForUpdate(ctx context.Context, id int64) (Users, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentities, error)
+	GetUserPasswordChangedAt(ctx context.Context, id int64) (time.Time, error)
+	GetVerificationToken(ctx context.Context, arg GetVerificationTokenParams) (VerificationTokens, error)
+	GetWebAuthnCredential(ctx context.Context, credentialID []byte) (WebauthnCredentials, error)
+	InvalidateVerificationTokens(ctx context.Context, arg InvalidateVerificationTokensParams) error
+	ListAPIKeys(ctx context.Context, userID int64) ([]ApiKeys, error)
+	ListActiveSessions(ctx context.Context, userID int64) ([]Sessions, error)
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvents, error)
+	ListAuditEventsAfter(ctx context.Context, arg ListAuditEventsAfterParams) ([]AuditEvents, error)
+	ListImpersonationRequests(ctx context.Context, impersonationID uuid.UUID) ([]ImpersonationRequests, error)
+	ListOAuthClients(ctx context.Context, userID int64) ([]OauthClients, error)
+	ListOAuthConsents(ctx context.Context, userID int64) ([]OauthConsents, error)
+	ListOrganizations(ctx context.Context) ([]Organizations, error)
+	ListUserIdentities(ctx context.Context, userID int64) ([]UserIdentities, error)
+	ListWebAuthnCredentials(ctx context.Context, userID int64) ([]WebauthnCredentials, error)
+	LockAuditChain(ctx context.Context) error
+	LockUser(ctx context.Context, arg LockUserParams) (Users, error)
+	RecordFailedLogin(ctx context.Context, id int64) (Users, error)
+	RecordSAMLIdentityLogin(ctx context.Context, arg RecordSAMLIdentityLoginParams) error
+	RecordUserIdentityLogin(ctx context.Context, arg RecordUserIdentityLoginParams) error
+	RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (Users, error)
+	ResetFailedLogins(ctx context.Context, id int64) (Users, error)
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (ApiKeys, error)
+	RotateSession(ctx context.Context, id uuid.UUID) error
+	SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (Users, error)
+	TouchAPIKey(ctx context.Context, id int64) error
+	UpdateOrganization(ctx context.Context, arg UpdateOrganizationParams) (Organizations, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (Users, error)
+	UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (Users, error)
+	UpdateWebAuthnCredentialUse(ctx context.Context, arg UpdateWebAuthnCredentialUseParams) (WebauthnCredentials, error)
+	UpsertOAuthConsent(ctx context.Context, arg UpsertOAuthConsentParams) (OauthConsents, error)
+	UseOAuthAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCodes, error)
+	UseOIDCLoginState(ctx context.Context, stateHash string) (OidcLoginStates, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCodes, error)
+	UseSAMLRequest(ctx context.Context, relayStateHash string) (SamlRequests, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (Users, error)
+	UseVerificationToken(ctx context.Context, id int64) (VerificationTokens, error)
+	UseWebAuthnChallenge(ctx context.Context, challengeHash string) (WebauthnChallenges, error)
+	VerifyUserEmail(ctx context.Context, id int64) (Users, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomSession(t *testing.T, user Users) Sessions {
+	id := uuid.New()
+	arg := CreateSessionParams{
+		ID:           id,
+		UserID:       user.ID,
+		RefreshToken: util.RandomString(32),
+		UserAgent:    util.RandomString(10),
+		ClientIp:     "127.0.0.1",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		FamilyID:     id,
+	}
+
+	session, err := testQueries.CreateSession(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, session)
+
+	require.Equal(t, arg.ID, session.ID)
+	require.Equal(t, arg.UserID, session.UserID)
+	require.Equal(t, arg.FamilyID, session.FamilyID)
+	require.False(t, session.ParentID.Valid)
+	require.False(t, session.RotatedAt.Valid)
+	require.False(t, session.IsBlocked)
+
+	return session
+}
+
+func newChildSessionParams(user Users) CreateSessionParams {
+	return CreateSessionParams{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		RefreshToken: util.RandomString(32),
+		UserAgent:    util.RandomString(10),
+		ClientIp:     "127.0.0.1",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+}
+
+func TestRotateSessionTx(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	session := createRandomSession(t, user)
+
+	arg := RotateSessionTxParams{
+		SessionID:  session.ID,
+		NewSession: newChildSessionParams(user),
+	}
+
+	result, err := store.RotateSessionTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	child := result.Session
+	require.Equal(t, arg.NewSession.ID, child.ID)
+	require.Equal(t, session.FamilyID, child.FamilyID)
+	require.True(t, child.ParentID.Valid)
+	require.Equal(t, session.ID, child.ParentID.UUID)
+
+	parent, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.True(t, parent.RotatedAt.Valid)
+	require.False(t, parent.IsBlocked)
+}
+
+func TestRotateSessionTxReuse(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	session := createRandomSession(t, user)
+
+	result, err := store.RotateSessionTx(context.Background(), RotateSessionTxParams{
+		SessionID:  session.ID,
+		NewSession: newChildSessionParams(user),
+	})
+	require.NoError(t, err)
+
+	// presenting the parent again should block the whole family
+	_, err = store.RotateSessionTx(context.Background(), RotateSessionTxParams{
+		SessionID:  session.ID,
+		NewSession: newChildSessionParams(user),
+	})
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	for _, id := range []uuid.UUID{session.ID, result.Session.ID} {
+		blocked, err := testQueries.GetSession(context.Background(), id)
+		require.NoError(t, err)
+		require.True(t, blocked.IsBlocked)
+	}
+}
+
+func TestGetLatestFamilySession(t *testing.T) {
+	store := NewStore(testDB)
+	user := createRandomUser(t)
+	session := createRandomSession(t, user)
+
+	latest, err := testQueries.GetLatestFamilySession(context.Background(), session.FamilyID)
+	require.NoError(t, err)
+	require.Equal(t, session.ID, latest.ID)
+
+	result, err := store.RotateSessionTx(context.Background(), RotateSessionTxParams{
+		SessionID:  session.ID,
+		NewSession: newChildSessionParams(user),
+	})
+	require.NoError(t, err)
+
+	latest, err = testQueries.GetLatestFamilySession(context.Background(), session.FamilyID)
+	require.NoError(t, err)
+	require.Equal(t, result.Session.ID, latest.ID)
+}
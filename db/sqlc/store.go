@@ -10,6 +10,18 @@ import (
 
 type Store interface {
 	Querier
+	RotateSessionTx(ctx context.Context, arg RotateSessionTxParams) (RotateSessionTxResult, error)
+	EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error)
+	DisableTOTPTx(ctx context.Context, userID int64) (Users, error)
+	VerifyEmailTx(ctx context.Context, tokenID int64) (Users, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (Users, error)
+	ResetFailedLoginsTx(ctx context.Context, userID int64) (Users, error)
+	CreateOIDCUserTx(ctx context.Context, arg CreateOIDCUserTxParams) (CreateOIDCUserTxResult, error)
+	CreateSAMLUserTx(ctx context.Context, arg CreateSAMLUserTxParams) (CreateSAMLUserTxResult, error)
+	UpdateUserTx(ctx context.Context, arg UpdateUserTxParams) (Users, error)
+	UpdateUserRoleTx(ctx context.Context, arg UpdateUserRoleTxParams) (Users, error)
+	CreateAuditEventTx(ctx context.Context, arg AuditEventParams) (AuditEvents, error)
+	VerifyAuditChain(ctx context.Context) (VerifyAuditChainResult, error)
 }
 
 type SQLStore struct {
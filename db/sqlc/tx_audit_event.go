@@ -0,0 +1,291 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in audit events
+const (
+	AuditActionUserUpdate         = "user.update"
+	AuditActionUserUpdateRole     = "user.update_role"
+	AuditActionUserUnlock         = "user.unlock"
+	AuditActionUserImpersonate    = "user.impersonate"
+	AuditActionUserResetPassword  = "user.reset_password"
+	AuditActionUserEnrollTOTP     = "user.enroll_totp"
+	AuditActionUserEnableTOTP     = "user.enable_totp"
+	AuditActionUserDisableTOTP    = "user.disable_totp"
+	AuditActionOrganizationCreate = "organization.create"
+	AuditActionOrganizationUpdate = "organization.update"
+	AuditActionAPIKeyCreate       = "api_key.create"
+	AuditActionAPIKeyRevoke       = "api_key.revoke"
+	AuditActionOAuthClientCreate  = "oauth_client.create"
+	AuditActionOAuthClientDelete  = "oauth_client.delete"
+)
+
+// Types of the targets of audit events
+const (
+	AuditTargetUser         = "user"
+	AuditTargetOrganization = "organization"
+	AuditTargetAPIKey       = "api_key"
+	AuditTargetOAuthClient  = "oauth_client"
+)
+
+// ErrAuditChainBroken is returned when an audit event doesn't match its hash or the event before it
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+// auditRedactedFields are recorded as changed without their values
+var auditRedactedFields = map[string]bool{
+	"password":    true,
+	"totp_secret": true,
+	"key_hash":    true,
+	"secret_hash": true,
+}
+
+// AuditEventParams contains the input parameters of an audit event
+type AuditEventParams struct {
+	// ActorID is the user who took the action, unset for requests without an access token
+	ActorID sql.NullInt64
+	// ImpersonatorID is the admin who took the action as ActorID
+	ImpersonatorID sql.NullInt64
+	ClientIp       string
+	RequestID      string
+	Action         string
+	TargetType     string
+	TargetID       string
+	// Before and After are the target before and after the action. Either may be nil, and only the
+	// fields that differ are recorded.
+	Before interface{}
+	After  interface{}
+}
+
+// CreateAuditEventTx appends an audit event to the hash chain within a single transaction
+func (store *SQLStore) CreateAuditEventTx(ctx context.Context, arg AuditEventParams) (AuditEvents, error) {
+	var event AuditEvents
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+		event, err = appendAuditEvent(ctx, q, arg)
+		return err
+	})
+
+	return event, err
+}
+
+// appendAuditEvent links an audit event to the last one. Appends are serialized by a lock held until the
+// transaction ends, so that no two events follow the same one.
+func appendAuditEvent(ctx context.Context, q *Queries, arg AuditEventParams) (AuditEvents, error) {
+	changes, err := auditChanges(arg.Before, arg.After)
+	if err != nil {
+		return AuditEvents{}, err
+	}
+
+	err = q.LockAuditChain(ctx)
+	if err != nil {
+		return AuditEvents{}, err
+	}
+
+	var prevHash string
+	last, err := q.GetLastAuditEvent(ctx)
+	switch {
+	case err == nil:
+		prevHash = last.Hash
+	case err != sql.ErrNoRows:
+		return AuditEvents{}, err
+	}
+
+	event := AuditEvents{
+		ActorID:        arg.ActorID,
+		ImpersonatorID: arg.ImpersonatorID,
+		Action:         arg.Action,
+		TargetType:     arg.TargetType,
+		TargetID:       arg.TargetID,
+		Changes:        changes,
+		ClientIp:       arg.ClientIp,
+		RequestID:      arg.RequestID,
+		// postgres keeps microseconds, the hash has to cover the time as it's stored
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		PrevHash:  prevHash,
+	}
+
+	return q.CreateAuditEvent(ctx, CreateAuditEventParams{
+		ActorID:        event.ActorID,
+		ImpersonatorID: event.ImpersonatorID,
+		Action:         event.Action,
+		TargetType:     event.TargetType,
+		TargetID:       event.TargetID,
+		Changes:        event.Changes,
+		ClientIp:       event.ClientIp,
+		RequestID:      event.RequestID,
+		CreatedAt:      event.CreatedAt,
+		PrevHash:       event.PrevHash,
+		Hash:           auditEventHash(event),
+	})
+}
+
+// auditEventHash hashes every field of an audit event apart from its ID and hash. As the hash covers the hash
+// of the event before, changing or removing an event breaks the hashes of all the events after it.
+func auditEventHash(event AuditEvents) string {
+	fields := []string{
+		event.PrevHash,
+		nullInt64String(event.ActorID),
+		nullInt64String(event.ImpersonatorID),
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Changes,
+		event.ClientIp,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	hash := sha256.New()
+	for _, field := range fields {
+		// fields are length prefixed, so that moving text from one to the next changes the hash
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func nullInt64String(value sql.NullInt64) string {
+	if !value.Valid {
+		return ""
+	}
+	return strconv.FormatInt(value.Int64, 10)
+}
+
+type auditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// auditChanges returns the JSON fields that differ between before and after, with their value on each side
+func auditChanges(before interface{}, after interface{}) (string, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return "", err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	changes := map[string]auditChange{}
+	for name, value := range afterFields {
+		if !bytes.Equal(beforeFields[name], value) {
+			changes[name] = newAuditChange(name, beforeFields[name], value)
+		}
+	}
+	for name, value := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			changes[name] = newAuditChange(name, value, nil)
+		}
+	}
+
+	data, err := json.Marshal(changes)
+	return string(data), err
+}
+
+func newAuditChange(name string, before json.RawMessage, after json.RawMessage) auditChange {
+	if auditRedactedFields[name] {
+		return auditChange{Before: redactAuditValue(before), After: redactAuditValue(after)}
+	}
+	return auditChange{Before: before, After: after}
+}
+
+func redactAuditValue(value json.RawMessage) json.RawMessage {
+	if value == nil || bytes.Equal(value, []byte("null")) {
+		return value
+	}
+	return json.RawMessage(`"[redacted]"`)
+}
+
+// auditFields returns the JSON fields of a value, with sql.Null* values flattened to their value or null
+func auditFields(value interface{}) (map[string]json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("audit target must be a JSON object: %w", err)
+	}
+
+	for name, field := range fields {
+		var nullable map[string]json.RawMessage
+		if json.Unmarshal(field, &nullable) != nil || len(nullable) != 2 || nullable["Valid"] == nil {
+			continue
+		}
+
+		for key, inner := range nullable {
+			if key == "Valid" {
+				continue
+			}
+			if bytes.Equal(nullable["Valid"], []byte("true")) {
+				fields[name] = inner
+			} else {
+				fields[name] = json.RawMessage("null")
+			}
+		}
+	}
+	return fields, nil
+}
+
+// auditVerifyBatchSize is how many audit events are read at a time while verifying the chain
+const auditVerifyBatchSize = 500
+
+// VerifyAuditChainResult is the result of verifying the audit chain
+type VerifyAuditChainResult struct {
+	Events   int64
+	LastHash string
+}
+
+// VerifyAuditChain recomputes the hash chain over every audit event, oldest first. It returns
+// ErrAuditChainBroken with the ID of the first event that was changed, or whose predecessor was removed.
+// Removing the latest events doesn't break the chain, which is why the result has the last hash, to compare
+// with one kept from an earlier run.
+func (store *SQLStore) VerifyAuditChain(ctx context.Context) (VerifyAuditChainResult, error) {
+	var result VerifyAuditChainResult
+	var lastID int64
+
+	for {
+		events, err := store.ListAuditEventsAfter(ctx, ListAuditEventsAfterParams{
+			ID:    lastID,
+			Limit: auditVerifyBatchSize,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		for _, event := range events {
+			if event.PrevHash != result.LastHash {
+				return result, fmt.Errorf("%w: event %d doesn't follow the event before it", ErrAuditChainBroken, event.ID)
+			}
+			if auditEventHash(event) != event.Hash {
+				return result, fmt.Errorf("%w: event %d doesn't match its hash", ErrAuditChainBroken, event.ID)
+			}
+
+			result.Events++
+			result.LastHash = event.Hash
+			lastID = event.ID
+		}
+
+		if len(events) < auditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
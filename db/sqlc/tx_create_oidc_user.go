@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+)
+
+// CreateOIDCUserTxParams contains the input parameters of the create OIDC user transaction
+type CreateOIDCUserTxParams struct {
+	CreateUserParams
+	// EmailVerified marks the email as verified, when the provider vouches for it
+	EmailVerified bool
+	Issuer        string
+	Subject       string
+}
+
+// CreateOIDCUserTxResult is the result of the create OIDC user transaction
+type CreateOIDCUserTxResult struct {
+	User     Users
+	Identity UserIdentities
+}
+
+// CreateOIDCUserTx creates a user who signed up through an OpenID Connect provider, along with the identity
+// they signed in with, within a single transaction
+func (store *SQLStore) CreateOIDCUserTx(ctx context.Context, arg CreateOIDCUserTxParams) (CreateOIDCUserTxResult, error) {
+	var result CreateOIDCUserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.CreateUser(ctx, arg.CreateUserParams)
+		if err != nil {
+			return err
+		}
+
+		if arg.EmailVerified {
+			result.User, err = q.VerifyUserEmail(ctx, result.User.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		result.Identity, err = q.CreateUserIdentity(ctx, CreateUserIdentityParams{
+			UserID:  result.User.ID,
+			Issuer:  arg.Issuer,
+			Subject: arg.Subject,
+			Email:   arg.Email,
+		})
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+)
+
+// CreateSAMLUserTxParams contains the input parameters of the create SAML user transaction
+type CreateSAMLUserTxParams struct {
+	CreateUserParams
+	OrganizationID int64
+	NameID         string
+}
+
+// CreateSAMLUserTxResult is the result of the create SAML user transaction
+type CreateSAMLUserTxResult struct {
+	User     Users
+	Identity SamlIdentities
+}
+
+// CreateSAMLUserTx creates a user who signed in through their organization's identity provider for the first
+// time, along with their identity, within a single transaction. The email is verified, as it belongs to one of
+// the organization's domains and the identity provider vouches for it.
+func (store *SQLStore) CreateSAMLUserTx(ctx context.Context, arg CreateSAMLUserTxParams) (CreateSAMLUserTxResult, error) {
+	var result CreateSAMLUserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.CreateUser(ctx, arg.CreateUserParams)
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.VerifyUserEmail(ctx, result.User.ID)
+		if err != nil {
+			return err
+		}
+
+		result.Identity, err = q.CreateSAMLIdentity(ctx, CreateSAMLIdentityParams{
+			OrganizationID: arg.OrganizationID,
+			UserID:         result.User.ID,
+			NameID:         arg.NameID,
+			Email:          arg.Email,
+		})
+		return err
+	})
+
+	return result, err
+}
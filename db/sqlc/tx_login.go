@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrAccountLocked is returned when an account has been locked out after too many failed logins
+var ErrAccountLocked = errors.New("account is locked")
+
+// ResetFailedLoginsTx clears the failed login counters of a user after a successful login within a single
+// transaction. The user row is locked first, so that an account locked by a concurrent failed login
+// stays locked and ErrAccountLocked is returned along with the locked user.
+func (store *SQLStore) ResetFailedLoginsTx(ctx context.Context, userID int64) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		user, err = q.GetUserByIdForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+			return ErrAccountLocked
+		}
+
+		if user.FailedLoginCount == 0 && !user.LockedUntil.Valid {
+			return nil
+		}
+
+		user, err = q.ResetFailedLogins(ctx, userID)
+		return err
+	})
+
+	return user, err
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ResetPasswordTxParams contains the input parameters of the reset password transaction
+type ResetPasswordTxParams struct {
+	TokenID        int64
+	HashedPassword string
+}
+
+// ResetPasswordTx uses up a password reset token, along with every other pending reset token of its user,
+// and sets the new password within a single transaction. It returns sql.ErrNoRows if the token has already been used.
+func (store *SQLStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		resetToken, err := q.UseVerificationToken(ctx, arg.TokenID)
+		if err != nil {
+			return err
+		}
+
+		err = q.InvalidateVerificationTokens(ctx, InvalidateVerificationTokensParams{
+			UserID:  resetToken.UserID,
+			Purpose: resetToken.Purpose,
+		})
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUser(ctx, UpdateUserParams{
+			ID: resetToken.UserID,
+			Password: sql.NullString{
+				String: arg.HashedPassword,
+				Valid:  true,
+			},
+			PasswordChangedAt: sql.NullTime{
+				Time:  time.Now(),
+				Valid: true,
+			},
+		})
+		return err
+	})
+
+	return user, err
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that has already been rotated is presented again
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// RotateSessionTxParams contains the input parameters of the rotate session transaction
+type RotateSessionTxParams struct {
+	SessionID  uuid.UUID
+	NewSession CreateSessionParams
+}
+
+// RotateSessionTxResult is the result of the rotate session transaction
+type RotateSessionTxResult struct {
+	Session Sessions
+}
+
+// RotateSessionTx marks a session as rotated and creates its child session within a single transaction.
+// If the session has already been rotated, its whole family is blocked and ErrRefreshTokenReused is returned.
+func (store *SQLStore) RotateSessionTx(ctx context.Context, arg RotateSessionTxParams) (RotateSessionTxResult, error) {
+	var result RotateSessionTxResult
+	var reused bool
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		parent, err := q.GetSessionForUpdate(ctx, arg.SessionID)
+		if err != nil {
+			return err
+		}
+
+		//* a rotated session presented again means the refresh token leaked
+		if parent.RotatedAt.Valid {
+			reused = true
+			return q.BlockSessionFamily(ctx, parent.FamilyID)
+		}
+
+		err = q.RotateSession(ctx, parent.ID)
+		if err != nil {
+			return err
+		}
+
+		newSession := arg.NewSession
+		newSession.FamilyID = parent.FamilyID
+		newSession.ParentID = uuid.NullUUID{
+			UUID:  parent.ID,
+			Valid: true,
+		}
+
+		result.Session, err = q.CreateSession(ctx, newSession)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if reused {
+		return result, ErrRefreshTokenReused
+	}
+
+	return result, nil
+}
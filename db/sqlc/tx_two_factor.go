@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+)
+
+// EnableTOTPTxParams contains the input parameters of the enable TOTP transaction
+type EnableTOTPTxParams struct {
+	UserID             int64
+	RecoveryCodeHashes []string
+}
+
+// EnableTOTPTxResult is the result of the enable TOTP transaction
+type EnableTOTPTxResult struct {
+	User Users
+}
+
+// EnableTOTPTx turns on TOTP for a user and replaces their recovery codes within a single transaction
+func (store *SQLStore) EnableTOTPTx(ctx context.Context, arg EnableTOTPTxParams) (EnableTOTPTxResult, error) {
+	var result EnableTOTPTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.EnableUserTOTP(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = q.DeleteRecoveryCodes(ctx, arg.UserID)
+		if err != nil {
+			return err
+		}
+
+		for _, codeHash := range arg.RecoveryCodeHashes {
+			_, err = q.CreateRecoveryCode(ctx, CreateRecoveryCodeParams{
+				UserID:   arg.UserID,
+				CodeHash: codeHash,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// DisableTOTPTx turns off TOTP for a user and drops their recovery codes within a single transaction
+func (store *SQLStore) DisableTOTPTx(ctx context.Context, userID int64) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		user, err = q.DisableUserTOTP(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		return q.DeleteRecoveryCodes(ctx, userID)
+	})
+
+	return user, err
+}
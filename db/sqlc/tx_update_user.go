@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"strconv"
+)
+
+// UpdateUserTxParams contains the input parameters of the update user transaction
+type UpdateUserTxParams struct {
+	UpdateUserParams
+	// Audit describes who is making the change. Its action, target and changes are filled in by the transaction.
+	Audit AuditEventParams
+}
+
+// UpdateUserTx updates a user and records the change in the audit log within a single transaction, so that
+// no change goes unrecorded. It returns sql.ErrNoRows if the user doesn't exist.
+func (store *SQLStore) UpdateUserTx(ctx context.Context, arg UpdateUserTxParams) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		before, err := q.GetUserByIdForUpdate(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUser(ctx, arg.UpdateUserParams)
+		if err != nil {
+			return err
+		}
+
+		_, err = appendAuditEvent(ctx, q, userAuditEvent(arg.Audit, AuditActionUserUpdate, before, user))
+		return err
+	})
+
+	return user, err
+}
+
+// UpdateUserRoleTxParams contains the input parameters of the update user role transaction
+type UpdateUserRoleTxParams struct {
+	UpdateUserRoleParams
+	// Audit describes who is making the change. Its action, target and changes are filled in by the transaction.
+	Audit AuditEventParams
+}
+
+// UpdateUserRoleTx changes the role of a user and records the change in the audit log within a single
+// transaction. It returns sql.ErrNoRows if the user doesn't exist.
+func (store *SQLStore) UpdateUserRoleTx(ctx context.Context, arg UpdateUserRoleTxParams) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		before, err := q.GetUserByIdForUpdate(ctx, arg.ID)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.UpdateUserRole(ctx, arg.UpdateUserRoleParams)
+		if err != nil {
+			return err
+		}
+
+		_, err = appendAuditEvent(ctx, q, userAuditEvent(arg.Audit, AuditActionUserUpdateRole, before, user))
+		return err
+	})
+
+	return user, err
+}
+
+func userAuditEvent(audit AuditEventParams, action string, before Users, after Users) AuditEventParams {
+	audit.Action = action
+	audit.TargetType = AuditTargetUser
+	audit.TargetID = strconv.FormatInt(after.ID, 10)
+	audit.Before = before
+	audit.After = after
+	return audit
+}
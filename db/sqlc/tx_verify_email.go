@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+)
+
+// VerifyEmailTx uses up an email verification token and marks the email of its user as verified
+// within a single transaction. It returns sql.ErrNoRows if the token has already been used.
+func (store *SQLStore) VerifyEmailTx(ctx context.Context, tokenID int64) (Users, error) {
+	var user Users
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		verificationToken, err := q.UseVerificationToken(ctx, tokenID)
+		if err != nil {
+			return err
+		}
+
+		user, err = q.VerifyUserEmail(ctx, verificationToken.UserID)
+		return err
+	})
+
+	return user, err
+}
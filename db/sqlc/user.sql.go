@@ -8,6 +8,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -18,7 +19,7 @@ INSERT INTO users (
     password
 ) VALUES (
     $1, $2, $3, $4
-) RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at
+) RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
 `
 
 type CreateUserParams struct {
@@ -45,12 +46,89 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (Users,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const disableUserTOTP = `-- name: DisableUserTOTP :one
+UPDATE users
+SET
+  totp_secret = NULL,
+  totp_enabled_at = NULL,
+  updated_at = now()
+WHERE
+  id = $1
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, disableUserTOTP, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :one
+UPDATE users
+SET
+  totp_enabled_at = now(),
+  updated_at = now()
+WHERE
+  id = $1 AND totp_secret IS NOT NULL
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, enableUserTOTP, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, first_name, last_name, email, password, password_changed_at, created_at, updated_at FROM users
+SELECT id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -66,12 +144,20 @@ func (q *Queries) GetUser(ctx context.Context, email string) (Users, error) {
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, first_name, last_name, email, password, password_changed_at, created_at, updated_at FROM users
+SELECT id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -87,6 +173,243 @@ func (q *Queries) GetUserById(ctx context.Context, id int64) (Users, error) {
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const getUserByIdForUpdate = `-- name: GetUserByIdForUpdate :one
+SELECT id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step FROM users
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE
+`
+
+func (q *Queries) GetUserByIdForUpdate(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIdForUpdate, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const getUserPasswordChangedAt = `-- name: GetUserPasswordChangedAt :one
+SELECT password_changed_at FROM users
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserPasswordChangedAt(ctx context.Context, id int64) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, getUserPasswordChangedAt, id)
+	var password_changed_at time.Time
+	err := row.Scan(&password_changed_at)
+	return password_changed_at, err
+}
+
+const lockUser = `-- name: LockUser :one
+UPDATE users
+SET
+  locked_until = GREATEST(locked_until, $1::timestamptz)
+WHERE
+  id = $2
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+type LockUserParams struct {
+	LockedUntil time.Time `json:"locked_until"`
+	ID          int64     `json:"id"`
+}
+
+func (q *Queries) LockUser(ctx context.Context, arg LockUserParams) (Users, error) {
+	row := q.db.QueryRowContext(ctx, lockUser, arg.LockedUntil, arg.ID)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+UPDATE users
+SET
+  failed_login_count = failed_login_count + 1,
+  last_failed_login_at = now()
+WHERE
+  id = $1
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+func (q *Queries) RecordFailedLogin(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :one
+UPDATE users
+SET
+  password = $1,
+  updated_at = now()
+WHERE
+  id = $2 AND password = $3
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+type RehashUserPasswordParams struct {
+	NewPassword string `json:"new_password"`
+	ID          int64  `json:"id"`
+	OldPassword string `json:"old_password"`
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (Users, error) {
+	row := q.db.QueryRowContext(ctx, rehashUserPassword, arg.NewPassword, arg.ID, arg.OldPassword)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :one
+UPDATE users
+SET
+  failed_login_count = 0,
+  locked_until = NULL,
+  last_failed_login_at = NULL
+WHERE
+  id = $1
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, resetFailedLogins, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :one
+UPDATE users
+SET
+  totp_secret = $1,
+  totp_enabled_at = NULL,
+  updated_at = now()
+WHERE
+  id = $2
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+type SetUserTOTPSecretParams struct {
+	TotpSecret sql.NullString `json:"totp_secret"`
+	ID         int64          `json:"id"`
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (Users, error) {
+	row := q.db.QueryRowContext(ctx, setUserTOTPSecret, arg.TotpSecret, arg.ID)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
@@ -99,10 +422,11 @@ SET
   updated_at = now(),
   first_name = COALESCE($3, first_name),
   last_name = COALESCE($4, last_name),
-  email = COALESCE($5, email)
+  email = COALESCE($5, email),
+  email_verified_at = CASE WHEN email = COALESCE($5, email) THEN email_verified_at ELSE NULL END
 WHERE
   id = $6
-RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
 `
 
 type UpdateUserParams struct {
@@ -133,6 +457,125 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (Users,
 		&i.PasswordChangedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET
+  role = $1,
+  updated_at = now()
+WHERE
+  id = $2
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+type UpdateUserRoleParams struct {
+	Role string `json:"role"`
+	ID   int64  `json:"id"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (Users, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Role, arg.ID)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :one
+UPDATE users
+SET
+  totp_last_used_step = $1
+WHERE
+  id = $2 AND totp_last_used_step < $1
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+type UseTOTPStepParams struct {
+	Step int64 `json:"step"`
+	ID   int64 `json:"id"`
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (Users, error) {
+	row := q.db.QueryRowContext(ctx, useTOTPStep, arg.Step, arg.ID)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET
+  email_verified_at = now(),
+  updated_at = now()
+WHERE
+  id = $1
+RETURNING id, first_name, last_name, email, password, password_changed_at, created_at, updated_at, role, totp_secret, totp_enabled_at, email_verified_at, failed_login_count, locked_until, last_failed_login_at, totp_last_used_step
+`
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, id int64) (Users, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, id)
+	var i Users
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Password,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLoginCount,
+		&i.LockedUntil,
+		&i.LastFailedLoginAt,
+		&i.TotpLastUsedStep,
 	)
 	return i, err
 }
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://accounts.travel.agency"
+
+func createRandomUserIdentity(t *testing.T, user Users) UserIdentities {
+	arg := CreateUserIdentityParams{
+		UserID:  user.ID,
+		Issuer:  testIssuer,
+		Subject: util.RandomString(16),
+		Email:   user.Email,
+	}
+
+	identity, err := testQueries.CreateUserIdentity(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.UserID, identity.UserID)
+	require.Equal(t, arg.Issuer, identity.Issuer)
+	require.Equal(t, arg.Subject, identity.Subject)
+	require.Equal(t, arg.Email, identity.Email)
+	require.NotZero(t, identity.CreatedAt)
+
+	return identity
+}
+
+func TestGetUserIdentity(t *testing.T) {
+	identity := createRandomUserIdentity(t, createRandomUser(t))
+
+	gotIdentity, err := testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	require.NoError(t, err)
+	require.Equal(t, identity.ID, gotIdentity.ID)
+	require.Equal(t, identity.UserID, gotIdentity.UserID)
+
+	// the same subject at another issuer is someone else
+	_, err = testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Issuer:  "https://another.issuer",
+		Subject: identity.Subject,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestCreateUserIdentityDuplicate(t *testing.T) {
+	identity := createRandomUserIdentity(t, createRandomUser(t))
+
+	_, err := testQueries.CreateUserIdentity(context.Background(), CreateUserIdentityParams{
+		UserID:  createRandomUser(t).ID,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   util.RandomEmail(),
+	})
+	require.Error(t, err)
+}
+
+func TestListUserIdentities(t *testing.T) {
+	user := createRandomUser(t)
+	first := createRandomUserIdentity(t, user)
+	second := createRandomUserIdentity(t, user)
+	createRandomUserIdentity(t, createRandomUser(t))
+
+	identities, err := testQueries.ListUserIdentities(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+	require.ElementsMatch(t, []int64{first.ID, second.ID}, []int64{identities[0].ID, identities[1].ID})
+}
+
+func TestRecordUserIdentityLogin(t *testing.T) {
+	identity := createRandomUserIdentity(t, createRandomUser(t))
+	email := util.RandomEmail()
+
+	err := testQueries.RecordUserIdentityLogin(context.Background(), RecordUserIdentityLoginParams{
+		ID:    identity.ID,
+		Email: email,
+	})
+	require.NoError(t, err)
+
+	gotIdentity, err := testQueries.GetUserIdentity(context.Background(), GetUserIdentityParams{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+	})
+	require.NoError(t, err)
+	require.Equal(t, email, gotIdentity.Email)
+	require.True(t, gotIdentity.LastLoginAt.Valid)
+}
+
+func TestDeleteUserIdentity(t *testing.T) {
+	user := createRandomUser(t)
+	identity := createRandomUserIdentity(t, user)
+
+	// only the owner can unlink an identity
+	_, err := testQueries.DeleteUserIdentity(context.Background(), DeleteUserIdentityParams{
+		ID:     identity.ID,
+		UserID: createRandomUser(t).ID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	deleted, err := testQueries.DeleteUserIdentity(context.Background(), DeleteUserIdentityParams{
+		ID:     identity.ID,
+		UserID: user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, identity.ID, deleted.ID)
+
+	identities, err := testQueries.ListUserIdentities(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, identities)
+}
+
+func TestUseOIDCLoginState(t *testing.T) {
+	user := createRandomUser(t)
+
+	arg := CreateOIDCLoginStateParams{
+		StateHash:    util.RandomString(32),
+		CodeVerifier: util.RandomString(43),
+		Nonce:        util.RandomString(16),
+		UserID:       sql.NullInt64{Int64: user.ID, Valid: true},
+		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	}
+
+	loginState, err := testQueries.CreateOIDCLoginState(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.StateHash, loginState.StateHash)
+	require.Equal(t, arg.UserID, loginState.UserID)
+
+	usedState, err := testQueries.UseOIDCLoginState(context.Background(), arg.StateHash)
+	require.NoError(t, err)
+	require.Equal(t, arg.CodeVerifier, usedState.CodeVerifier)
+	require.Equal(t, arg.Nonce, usedState.Nonce)
+	require.WithinDuration(t, arg.ExpiresAt, usedState.ExpiresAt, time.Second)
+
+	// a state can only be used once
+	_, err = testQueries.UseOIDCLoginState(context.Background(), arg.StateHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestCreateOIDCUserTx(t *testing.T) {
+	store := NewStore(testDB)
+
+	arg := CreateOIDCUserTxParams{
+		CreateUserParams: CreateUserParams{
+			Email:     util.RandomEmail(),
+			FirstName: util.RandomName(),
+			LastName:  util.RandomName(),
+			Password:  util.RandomString(32),
+		},
+		EmailVerified: true,
+		Issuer:        testIssuer,
+		Subject:       util.RandomString(16),
+	}
+
+	result, err := store.CreateOIDCUserTx(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Email, result.User.Email)
+	require.True(t, result.User.EmailVerifiedAt.Valid)
+	require.Equal(t, result.User.ID, result.Identity.UserID)
+	require.Equal(t, arg.Subject, result.Identity.Subject)
+
+	// a taken subject rolls the new user back
+	arg.Email = util.RandomEmail()
+	_, err = store.CreateOIDCUserTx(context.Background(), arg)
+	require.Error(t, err)
+
+	_, err = testQueries.GetUser(context.Background(), arg.Email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -73,6 +73,24 @@ func TestGetUserByID(t *testing.T) {
 	require.WithinDuration(t, newUser.UpdatedAt, retrievedUser.UpdatedAt, time.Second)
 }
 
+func TestGetUserPasswordChangedAt(t *testing.T) {
+	user := createRandomUser(t)
+
+	passwordChangedAt := time.Now().UTC().Truncate(time.Microsecond)
+	_, err := testQueries.UpdateUser(context.Background(), UpdateUserParams{
+		ID:                user.ID,
+		PasswordChangedAt: sql.NullTime{Time: passwordChangedAt, Valid: true},
+	})
+	require.NoError(t, err)
+
+	retrievedPasswordChangedAt, err := testQueries.GetUserPasswordChangedAt(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.True(t, passwordChangedAt.Equal(retrievedPasswordChangedAt))
+
+	_, err = testQueries.GetUserPasswordChangedAt(context.Background(), user.ID+1000000)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
 func TestUpdateUserFirstAndLastName(t *testing.T) {
 	user := createRandomUser(t)
 
@@ -185,3 +203,87 @@ func TestUpdateAllFields(t *testing.T) {
 	require.Equal(t, newHashedPassword, updatedUser.Password)
 	require.NotEqual(t, user.Password, updatedUser.Password)
 }
+
+func TestAccountLockout(t *testing.T) {
+	user := createRandomUser(t)
+	require.Zero(t, user.FailedLoginCount)
+	require.False(t, user.LockedUntil.Valid)
+
+	failedUser, err := testQueries.RecordFailedLogin(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), failedUser.FailedLoginCount)
+	require.True(t, failedUser.LastFailedLoginAt.Valid)
+	require.WithinDuration(t, time.Now(), failedUser.LastFailedLoginAt.Time, time.Second)
+
+	lockedUntil := time.Now().Add(time.Hour)
+	lockedUser, err := testQueries.LockUser(context.Background(), LockUserParams{
+		LockedUntil: lockedUntil,
+		ID:          user.ID,
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, lockedUntil, lockedUser.LockedUntil.Time, time.Second)
+
+	// a shorter lockout doesn't cut an existing one short
+	lockedUser, err = testQueries.LockUser(context.Background(), LockUserParams{
+		LockedUntil: time.Now().Add(time.Minute),
+		ID:          user.ID,
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, lockedUntil, lockedUser.LockedUntil.Time, time.Second)
+
+	store := NewStore(testDB)
+	_, err = store.ResetFailedLoginsTx(context.Background(), user.ID)
+	require.ErrorIs(t, err, ErrAccountLocked)
+
+	unlockedUser, err := testQueries.ResetFailedLogins(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Zero(t, unlockedUser.FailedLoginCount)
+	require.False(t, unlockedUser.LockedUntil.Valid)
+	require.False(t, unlockedUser.LastFailedLoginAt.Valid)
+}
+
+func TestRehashUserPassword(t *testing.T) {
+	user := createRandomUser(t)
+
+	newHash, err := util.HashPassword(util.RandomString(8))
+	require.NoError(t, err)
+
+	rehashedUser, err := testQueries.RehashUserPassword(context.Background(), RehashUserPasswordParams{
+		NewPassword: newHash,
+		ID:          user.ID,
+		OldPassword: user.Password,
+	})
+	require.NoError(t, err)
+	require.Equal(t, newHash, rehashedUser.Password)
+	require.Equal(t, user.PasswordChangedAt, rehashedUser.PasswordChangedAt)
+
+	// a hash that has changed since it was read is left alone
+	_, err = testQueries.RehashUserPassword(context.Background(), RehashUserPasswordParams{
+		NewPassword: user.Password,
+		ID:          user.ID,
+		OldPassword: user.Password,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	user := createRandomUser(t)
+	require.Zero(t, user.TotpLastUsedStep)
+
+	step := util.TOTPStep(time.Now())
+	updatedUser, err := testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{
+		Step: step,
+		ID:   user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, step, updatedUser.TotpLastUsedStep)
+
+	// the same step, or an earlier one, can't be used again
+	for _, usedStep := range []int64{step, step - 1} {
+		_, err = testQueries.UseTOTPStep(context.Background(), UseTOTPStepParams{
+			Step: usedStep,
+			ID:   user.ID,
+		})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	}
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomWebAuthnCredential(t *testing.T, user Users) WebauthnCredentials {
+	arg := CreateWebAuthnCredentialParams{
+		UserID:       user.ID,
+		CredentialID: []byte(util.RandomString(16)),
+		PublicKey:    []byte(util.RandomString(77)),
+		SignCount:    1,
+		Transports:   []string{"internal", "hybrid"},
+		Aaguid:       make([]byte, 16),
+		Name:         util.RandomString(8),
+	}
+
+	credential, err := testQueries.CreateWebAuthnCredential(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, arg.UserID, credential.UserID)
+	require.Equal(t, arg.CredentialID, credential.CredentialID)
+	require.Equal(t, arg.PublicKey, credential.PublicKey)
+	require.Equal(t, arg.SignCount, credential.SignCount)
+	require.Equal(t, arg.Transports, credential.Transports)
+	require.Equal(t, arg.Name, credential.Name)
+	require.False(t, credential.LastUsedAt.Valid)
+	require.NotZero(t, credential.CreatedAt)
+
+	return credential
+}
+
+func TestGetWebAuthnCredential(t *testing.T) {
+	credential := createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	gotCredential, err := testQueries.GetWebAuthnCredential(context.Background(), credential.CredentialID)
+	require.NoError(t, err)
+	require.Equal(t, credential.ID, gotCredential.ID)
+	require.Equal(t, credential.UserID, gotCredential.UserID)
+
+	_, err = testQueries.CreateWebAuthnCredential(context.Background(), CreateWebAuthnCredentialParams{
+		UserID:       createRandomUser(t).ID,
+		CredentialID: credential.CredentialID,
+		PublicKey:    credential.PublicKey,
+		Transports:   []string{},
+		Aaguid:       credential.Aaguid,
+		Name:         credential.Name,
+	})
+	require.Error(t, err)
+}
+
+func TestListWebAuthnCredentials(t *testing.T) {
+	user := createRandomUser(t)
+	for i := 0; i < 2; i++ {
+		createRandomWebAuthnCredential(t, user)
+	}
+	createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	credentials, err := testQueries.ListWebAuthnCredentials(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, credentials, 2)
+	for _, credential := range credentials {
+		require.Equal(t, user.ID, credential.UserID)
+	}
+}
+
+func TestUpdateWebAuthnCredentialUse(t *testing.T) {
+	credential := createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	updated, err := testQueries.UpdateWebAuthnCredentialUse(context.Background(), UpdateWebAuthnCredentialUseParams{
+		ID:        credential.ID,
+		SignCount: 5,
+		BackedUp:  true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), updated.SignCount)
+	require.True(t, updated.BackedUp)
+	require.True(t, updated.LastUsedAt.Valid)
+
+	// a counter that doesn't move forward is refused
+	_, err = testQueries.UpdateWebAuthnCredentialUse(context.Background(), UpdateWebAuthnCredentialUseParams{
+		ID:        credential.ID,
+		SignCount: 5,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	credential := createRandomWebAuthnCredential(t, createRandomUser(t))
+
+	// another user can't delete it
+	_, err := testQueries.DeleteWebAuthnCredential(context.Background(), DeleteWebAuthnCredentialParams{
+		ID:     credential.ID,
+		UserID: credential.UserID + 1,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = testQueries.DeleteWebAuthnCredential(context.Background(), DeleteWebAuthnCredentialParams{
+		ID:     credential.ID,
+		UserID: credential.UserID,
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.GetWebAuthnCredential(context.Background(), credential.CredentialID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestUseWebAuthnChallenge(t *testing.T) {
+	user := createRandomUser(t)
+	arg := CreateWebAuthnChallengeParams{
+		ChallengeHash: util.HashVerificationToken(util.RandomString(32)),
+		UserID:        sql.NullInt64{Int64: user.ID, Valid: true},
+		ExpiresAt:     time.Now().Add(5 * time.Minute),
+	}
+
+	challenge, err := testQueries.CreateWebAuthnChallenge(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.UserID, challenge.UserID)
+
+	usedChallenge, err := testQueries.UseWebAuthnChallenge(context.Background(), arg.ChallengeHash)
+	require.NoError(t, err)
+	require.Equal(t, arg.UserID, usedChallenge.UserID)
+
+	// a challenge can only be answered once
+	_, err = testQueries.UseWebAuthnChallenge(context.Background(), arg.ChallengeHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -1,6 +1,6 @@
 -- SQL dump generated using DBML (dbml-lang.org)
 -- Database: PostgreSQL
--- Generated at: 2023-03-11T22:31:05.524Z
+-- Generated at: 2026-10-17T09:12:44.318Z
 
 CREATE TABLE "users" (
   "id" bigserial PRIMARY KEY,
@@ -10,7 +10,15 @@ CREATE TABLE "users" (
   "password" varchar NOT NULL,
   "password_changed_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
   "created_at" timestamptz NOT NULL DEFAULT (now()),
-  "updated_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z'
+  "updated_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
+  "role" varchar NOT NULL DEFAULT 'traveler',
+  "totp_secret" varchar,
+  "totp_enabled_at" timestamptz,
+  "email_verified_at" timestamptz,
+  "failed_login_count" integer NOT NULL DEFAULT 0,
+  "locked_until" timestamptz,
+  "last_failed_login_at" timestamptz,
+  "totp_last_used_step" bigint NOT NULL DEFAULT 0
 );
 
 CREATE TABLE "sessions" (
@@ -21,7 +29,298 @@ CREATE TABLE "sessions" (
   "client_ip" varchar NOT NULL,
   "is_blocked" boolean NOT NULL DEFAULT false,
   "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "family_id" uuid NOT NULL,
+  "parent_id" uuid,
+  "rotated_at" timestamptz
+);
+
+CREATE TABLE "recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "code_hash" varchar NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "verification_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "purpose" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "binding_hash" varchar
+);
+
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "name" varchar NOT NULL,
+  "prefix" varchar UNIQUE NOT NULL,
+  "key_hash" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "last_used_at" timestamptz,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "oauth_clients" (
+  "id" varchar PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "name" varchar NOT NULL,
+  "secret_hash" varchar,
+  "redirect_uris" varchar[] NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "grant_types" varchar[] NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "oauth_authorization_codes" (
+  "code_hash" varchar PRIMARY KEY,
+  "client_id" varchar NOT NULL,
+  "user_id" bigint NOT NULL,
+  "redirect_uri" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "code_challenge" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "oauth_consents" (
+  "user_id" bigint NOT NULL,
+  "client_id" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("user_id", "client_id")
+);
+
+CREATE TABLE "user_identities" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "issuer" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_login_at" timestamptz
+);
+
+CREATE TABLE "oidc_login_states" (
+  "state_hash" varchar PRIMARY KEY,
+  "code_verifier" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "user_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "organizations" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "slug" varchar UNIQUE NOT NULL,
+  "email_domains" varchar[] NOT NULL,
+  "idp_entity_id" varchar NOT NULL,
+  "idp_sso_url" varchar NOT NULL,
+  "idp_certificate" text NOT NULL,
+  "email_attribute" varchar NOT NULL DEFAULT '',
+  "first_name_attribute" varchar NOT NULL DEFAULT '',
+  "last_name_attribute" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "saml_identities" (
+  "id" bigserial PRIMARY KEY,
+  "organization_id" bigint NOT NULL,
+  "user_id" bigint NOT NULL,
+  "name_id" varchar NOT NULL,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_login_at" timestamptz
+);
+
+CREATE TABLE "saml_requests" (
+  "relay_state_hash" varchar PRIMARY KEY,
+  "request_id" varchar NOT NULL,
+  "organization_id" bigint NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webauthn_credentials" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "credential_id" bytea UNIQUE NOT NULL,
+  "public_key" bytea NOT NULL,
+  "sign_count" bigint NOT NULL DEFAULT 0,
+  "transports" varchar[] NOT NULL DEFAULT '{}',
+  "aaguid" bytea NOT NULL,
+  "name" varchar NOT NULL,
+  "backup_eligible" boolean NOT NULL DEFAULT false,
+  "backed_up" boolean NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_used_at" timestamptz
+);
+
+CREATE TABLE "webauthn_challenges" (
+  "challenge_hash" varchar PRIMARY KEY,
+  "user_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "impersonations" (
+  "id" uuid PRIMARY KEY,
+  "impersonator_id" bigint NOT NULL,
+  "user_id" bigint NOT NULL,
+  "reason" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "impersonation_requests" (
+  "id" bigserial PRIMARY KEY,
+  "impersonation_id" uuid NOT NULL,
+  "method" varchar NOT NULL,
+  "path" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
   "created_at" timestamptz NOT NULL DEFAULT (now())
 );
 
+CREATE TABLE "audit_events" (
+  "id" bigserial PRIMARY KEY,
+  "actor_id" bigint,
+  "impersonator_id" bigint,
+  "action" varchar NOT NULL,
+  "target_type" varchar NOT NULL,
+  "target_id" varchar NOT NULL,
+  "changes" varchar NOT NULL,
+  "client_ip" varchar NOT NULL,
+  "request_id" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL,
+  "prev_hash" varchar NOT NULL,
+  "hash" varchar UNIQUE NOT NULL
+);
+
+CREATE INDEX ON "sessions" ("family_id");
+
+CREATE UNIQUE INDEX ON "recovery_codes" ("user_id", "code_hash");
+
+CREATE INDEX ON "verification_tokens" ("user_id", "purpose");
+
+CREATE INDEX ON "api_keys" ("user_id");
+
+CREATE INDEX ON "oauth_clients" ("user_id");
+
+CREATE UNIQUE INDEX ON "user_identities" ("issuer", "subject");
+
+CREATE INDEX ON "user_identities" ("user_id");
+
+CREATE UNIQUE INDEX ON "saml_identities" ("organization_id", "name_id");
+
+CREATE INDEX ON "saml_identities" ("user_id");
+
+CREATE INDEX ON "webauthn_credentials" ("user_id");
+
+CREATE INDEX ON "impersonations" ("impersonator_id");
+
+CREATE INDEX ON "impersonations" ("user_id");
+
+CREATE INDEX ON "impersonation_requests" ("impersonation_id");
+
+CREATE INDEX ON "audit_events" ("actor_id");
+
+CREATE INDEX ON "audit_events" ("target_type", "target_id");
+
+CREATE INDEX ON "audit_events" ("created_at");
+
+COMMENT ON COLUMN "users"."role" IS 'traveler, agent or admin';
+
+COMMENT ON COLUMN "users"."totp_secret" IS 'encrypted with TOTP_ENCRYPTION_KEY';
+
+COMMENT ON COLUMN "verification_tokens"."purpose" IS 'email_verification, password_reset or magic_link';
+
+COMMENT ON COLUMN "verification_tokens"."binding_hash" IS 'hash of the cookie of the browser a magic link was requested from';
+
+COMMENT ON COLUMN "api_keys"."prefix" IS 'identifies the key, shown in listings';
+
+COMMENT ON COLUMN "api_keys"."scopes" IS 'permissions granted to the key';
+
+COMMENT ON COLUMN "oauth_clients"."user_id" IS 'the user who registered the client';
+
+COMMENT ON COLUMN "oauth_clients"."secret_hash" IS 'null for public clients';
+
+COMMENT ON COLUMN "oauth_clients"."scopes" IS 'scopes the client may ask for';
+
+COMMENT ON COLUMN "oauth_clients"."grant_types" IS 'authorization_code, client_credentials';
+
+COMMENT ON COLUMN "oauth_authorization_codes"."code_challenge" IS 'PKCE S256 challenge';
+
+COMMENT ON COLUMN "user_identities"."issuer" IS 'issuer URL of the OpenID Connect provider';
+
+COMMENT ON COLUMN "user_identities"."subject" IS 'ID of the user at the provider';
+
+COMMENT ON COLUMN "oidc_login_states"."user_id" IS 'set when a signed in user links an identity';
+
+COMMENT ON COLUMN "organizations"."email_domains" IS 'domains the identity provider vouches for';
+
+COMMENT ON COLUMN "organizations"."idp_certificate" IS 'PEM certificates the identity provider signs with';
+
+COMMENT ON COLUMN "saml_identities"."name_id" IS 'ID of the user at the identity provider';
+
+COMMENT ON COLUMN "webauthn_credentials"."public_key" IS 'COSE encoded public key';
+
+COMMENT ON COLUMN "webauthn_challenges"."user_id" IS 'set when a signed in user registers a passkey';
+
+COMMENT ON COLUMN "impersonations"."id" IS 'ID of the access token issued to the impersonator';
+
+COMMENT ON TABLE "audit_events" IS 'append-only, updates and deletes are rejected by a trigger';
+
+COMMENT ON COLUMN "audit_events"."impersonator_id" IS 'admin who acted as the actor';
+
+COMMENT ON COLUMN "audit_events"."changes" IS 'JSON of the changed fields, kept as text so that the hashed bytes are stored as they are';
+
+COMMENT ON COLUMN "audit_events"."prev_hash" IS 'hash of the event before, empty for the first event';
+
+COMMENT ON COLUMN "audit_events"."hash" IS 'SHA-256 of prev_hash and every other field apart from id';
+
 ALTER TABLE "sessions" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "sessions" ADD FOREIGN KEY ("parent_id") REFERENCES "sessions" ("id");
+
+ALTER TABLE "recovery_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "verification_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "oauth_clients" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "oauth_authorization_codes" ADD FOREIGN KEY ("client_id") REFERENCES "oauth_clients" ("id");
+
+ALTER TABLE "oauth_authorization_codes" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "oauth_consents" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "oauth_consents" ADD FOREIGN KEY ("client_id") REFERENCES "oauth_clients" ("id");
+
+ALTER TABLE "user_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "oidc_login_states" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "saml_identities" ADD FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id");
+
+ALTER TABLE "saml_identities" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "saml_requests" ADD FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id");
+
+ALTER TABLE "webauthn_credentials" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "webauthn_challenges" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+
+ALTER TABLE "impersonation_requests" ADD FOREIGN KEY ("impersonation_id") REFERENCES "impersonations" ("id");
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// FileMailer drops every email as an .eml file into a directory instead of sending it.
+// It suits tests and local development.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a new FileMailer, creating its directory if needed
+func NewFileMailer(dir string, from string) (Mailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create mail directory %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes an email to a new file named after the time and its recipient
+func (mailer *FileMailer) Send(ctx context.Context, email Email) error {
+	now := time.Now()
+	msg, err := buildMessage(mailer.from, email, now)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), unsafeFileNameChars.ReplaceAllString(email.To, "_"))
+	return os.WriteFile(filepath.Join(mailer.dir, name), msg, 0o644)
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir, "no-reply@travel.agency")
+	require.NoError(t, err)
+
+	email := Email{
+		To:      "jane@email.com",
+		Subject: "Verify your email",
+		Body:    "first line\nsecond line",
+	}
+	err = mailer.Send(context.Background(), email)
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.True(t, strings.HasSuffix(files[0].Name(), "-jane@email.com.eml"))
+
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+
+	msg := string(data)
+	require.Contains(t, msg, "From: no-reply@travel.agency\r\n")
+	require.Contains(t, msg, "To: jane@email.com\r\n")
+	require.Contains(t, msg, "Subject: Verify your email\r\n")
+	require.True(t, strings.HasSuffix(msg, "\r\n\r\nfirst line\r\nsecond line"))
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer, err := NewFileMailer(t.TempDir(), "no-reply@travel.agency")
+	require.NoError(t, err)
+
+	err = mailer.Send(context.Background(), Email{
+		To:      "jane@email.com\r\nBcc: everyone@email.com",
+		Subject: "Verify your email",
+	})
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestLogMailer(t *testing.T) {
+	err := NewLogMailer().Send(context.Background(), Email{To: "jane@email.com"})
+	require.NoError(t, err)
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	_, err := NewSMTPMailer("", 587, "", "", "no-reply@travel.agency")
+	require.Error(t, err)
+
+	_, err = NewSMTPMailer("smtp.travel.agency", 587, "", "", "")
+	require.Error(t, err)
+
+	mailer, err := NewSMTPMailer("smtp.travel.agency", 587, "user", "secret", "no-reply@travel.agency")
+	require.NoError(t, err)
+	require.Equal(t, "smtp.travel.agency:587", mailer.(*SMTPMailer).address)
+}
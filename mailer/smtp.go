@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPMailer creates a new SMTPMailer. It only authenticates when a username is given.
+func NewSMTPMailer(host string, port int, username string, password string, from string) (Mailer, error) {
+	if host == "" {
+		return nil, fmt.Errorf("smtp host must not be empty")
+	}
+	if from == "" {
+		return nil, fmt.Errorf("sender address must not be empty")
+	}
+
+	mailer := &SMTPMailer{
+		address: net.JoinHostPort(host, fmt.Sprint(port)),
+		from:    from,
+	}
+	if username != "" {
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer, nil
+}
+
+// Send sends an email, upgrading the connection with STARTTLS when the server supports it
+func (mailer *SMTPMailer) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(mailer.from, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(mailer.address, mailer.auth, mailer.from, []string{email.To}, msg)
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres" // specifies the db driver
 	_ "github.com/golang-migrate/migrate/v4/source/file"       // specifies migration source is from a local file
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/sajitron/travel-agency/api"
@@ -14,6 +20,9 @@ import (
 	"github.com/sajitron/travel-agency/util"
 )
 
+// shutdownTimeout is how long ongoing requests get to finish once the server is asked to stop
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	config, err := util.LoadConfig(".")
 	if err != nil {
@@ -34,7 +43,26 @@ func main() {
 
 	store := db.NewStore(conn)
 
-	runGinServer(config, store)
+	runGinServer(config, store, newRedisClient(config))
+}
+
+// newRedisClient creates the Redis client shared by the whole server. It returns nil when Redis isn't configured.
+func newRedisClient(config util.Config) *redis.Client {
+	if config.RedisAddress == "" {
+		return nil
+	}
+
+	options := &redis.Options{
+		Addr:     config.RedisAddress,
+		Password: config.RedisPassword,
+		DB:       config.RedisDB,
+		PoolSize: config.RedisPoolSize,
+	}
+	if config.RedisTLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return redis.NewClient(options)
 }
 
 func runDBMigration(migrationURL string, dbSource string) {
@@ -49,14 +77,17 @@ func runDBMigration(migrationURL string, dbSource string) {
 	log.Info().Msg("Database was migrated successfully")
 }
 
-func runGinServer(config util.Config, store db.Store) {
-	server, err := api.NewServer(config, store)
+func runGinServer(config util.Config, store db.Store, redisClient *redis.Client) {
+	server, err := api.NewServer(config, store, redisClient)
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to create server")
 	}
 
-	err = server.Start(config.HTTPServerAddress)
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err = server.Run(stop, config.HTTPServerAddress, shutdownTimeout)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unable to initiate server")
+		log.Fatal().Err(err).Msg("unable to run server")
 	}
 }
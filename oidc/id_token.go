@@ -0,0 +1,126 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrInvalidIDToken is returned for ID tokens that fail any check
+var ErrInvalidIDToken = errors.New("oidc: invalid ID token")
+
+// clockSkew is how far the provider's clock may be off from ours
+const clockSkew = time.Minute
+
+// signingMethods are the algorithms ID tokens may be signed with. Symmetric algorithms and "none" are refused,
+// as they would let anyone who knows the client secret, or nobody at all, sign tokens.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// audience is the aud claim, which is either a single string or a list of them
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*aud = list
+	return nil
+}
+
+// Claims are the claims of an ID token that are used to sign a user in
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	EmailVerified   bool     `json:"email_verified,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	GivenName       string   `json:"given_name,omitempty"`
+	FamilyName      string   `json:"family_name,omitempty"`
+}
+
+// Valid checks the times of the token. It is called while the token is parsed.
+func (claims *Claims) Valid() error {
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("%w: token has expired", ErrInvalidIDToken)
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: token was issued in the future", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's keys, and that it was issued by
+// the provider to this app for the authorization request with the nonce. See OpenID Connect Core 1.0
+// section 3.1.3.7.
+func (provider *Provider) VerifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*Claims, error) {
+	parser := &jwt.Parser{ValidMethods: signingMethods}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return provider.keys.key(ctx, keyID)
+	}
+
+	token, err := parser.ParseWithClaims(rawIDToken, &Claims{}, keyFunc)
+	if err != nil {
+		var verr *jwt.ValidationError
+		if errors.As(err, &verr) && verr.Inner != nil {
+			if errors.Is(verr.Inner, ErrInvalidIDToken) {
+				return nil, verr.Inner
+			}
+			// the keys couldn't be fetched, which is no fault of the token
+			if verr.Errors&jwt.ValidationErrorUnverifiable != 0 {
+				return nil, verr.Inner
+			}
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	if claims.Issuer != provider.config.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidIDToken)
+	}
+	if !claims.hasAudience(provider.config.ClientID) {
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != provider.config.ClientID {
+		return nil, fmt.Errorf("%w: token was authorized for another client", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+func (claims *Claims) hasAudience(clientID string) bool {
+	for _, aud := range claims.Audience {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
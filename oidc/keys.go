@@ -0,0 +1,168 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval is the least time between two fetches of the provider's keys. A token signed with an
+// unknown key triggers a fetch, so the limit stops forged tokens from hammering the provider.
+const keyRefreshInterval = time.Minute
+
+// jsonWebKey is a public key of the provider as described in RFC 7517. Only RSA and EC keys are used.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// keySet caches the provider's signing keys by key ID. The keys are fetched again when a token names a key
+// that isn't known, which picks up keys the provider rotated in.
+type keySet struct {
+	client *http.Client
+	uri    func(ctx context.Context) (string, error)
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, uri func(ctx context.Context) (string, error)) *keySet {
+	return &keySet{
+		client: client,
+		uri:    uri,
+	}
+}
+
+// key returns the public key with an ID. An empty ID is only accepted when the provider has a single key.
+func (set *keySet) key(ctx context.Context, keyID string) (interface{}, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	if key, ok := set.lookup(keyID); ok {
+		return key, nil
+	}
+	if !set.fetchedAt.IsZero() && time.Since(set.fetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, keyID)
+	}
+
+	if err := set.fetch(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := set.lookup(keyID); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, keyID)
+}
+
+func (set *keySet) lookup(keyID string) (interface{}, bool) {
+	if keyID == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, true
+		}
+	}
+	key, ok := set.keys[keyID]
+	return key, ok
+}
+
+// fetch replaces the cached keys with the provider's current ones. Keys that can't be used are skipped.
+func (set *keySet) fetch(ctx context.Context) error {
+	uri, err := set.uri(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keySet jsonWebKeySet
+	if err := getJSON(ctx, set.client, uri, &keySet); err != nil {
+		return fmt.Errorf("oidc: unable to fetch the provider's keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	set.keys = keys
+	set.fetchedAt = time.Now()
+	return nil
+}
+
+// publicKey decodes an RSA or EC public key
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.KeyType)
+}
+
+func decodeBigInt(encoded string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
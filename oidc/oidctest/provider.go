@@ -0,0 +1,235 @@
+// Package oidctest runs a stand-in OpenID Connect provider on a local httptest server, so that sign in flows
+// can be tested end to end without a real provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// KeyID is the ID of the provider's signing key
+const KeyID = "oidctest"
+
+// Identity is the user who signs in at the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// authorization is a code the provider handed out, along with what it was issued for
+type authorization struct {
+	identity      Identity
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// Provider is a stand-in OpenID Connect provider. Its URL is the issuer.
+type Provider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// NewProvider starts a provider that knows a single client. Close it when done.
+func NewProvider(clientID string, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.serveDiscovery)
+	mux.HandleFunc("/jwks", provider.serveJWKS)
+	mux.HandleFunc("/token", provider.serveToken)
+	provider.Server = httptest.NewServer(mux)
+	return provider, nil
+}
+
+// Authorize stands in for a user signing in at the provider's authorization endpoint. It checks the
+// authorization URL the app sent the user to, and returns the code and state the user would be sent back with.
+func (provider *Provider) Authorize(authCodeURL string, identity Identity) (code string, state string, err error) {
+	u, err := url.Parse(authCodeURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+
+	switch {
+	case u.Scheme+"://"+u.Host+u.Path != provider.URL+"/authorize":
+		return "", "", errors.New("oidctest: not the provider's authorization endpoint")
+	case query.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: response_type must be code")
+	case query.Get("client_id") != provider.ClientID:
+		return "", "", errors.New("oidctest: unknown client")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		return "", "", errors.New("oidctest: PKCE with S256 is required")
+	}
+
+	code = randomString()
+	provider.mu.Lock()
+	provider.codes[code] = authorization{
+		identity:      identity,
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	provider.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+// SignIDToken signs claims with the provider's key, as an ID token
+func (provider *Provider) SignIDToken(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(provider.Key)
+}
+
+// IDTokenClaims returns the claims of an ID token issued to the provider's client for an identity
+func (provider *Provider) IDTokenClaims(identity Identity, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            provider.URL,
+		"sub":            identity.Subject,
+		"aud":            provider.ClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+		"given_name":     identity.GivenName,
+		"family_name":    identity.FamilyName,
+	}
+}
+
+func (provider *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                provider.URL,
+		"authorization_endpoint":                provider.URL + "/authorize",
+		"token_endpoint":                        provider.URL + "/token",
+		"jwks_uri":                              provider.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (provider *Provider) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	publicKey := provider.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// serveToken exchanges a code for an ID token, checking the client, the redirect URI and the PKCE verifier
+func (provider *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != provider.ClientID || clientSecret != provider.ClientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	// codes are used up by the first attempt
+	code := r.PostForm.Get("code")
+	provider.mu.Lock()
+	auth, ok := provider.codes[code]
+	delete(provider.codes, code)
+	provider.mu.Unlock()
+
+	if !ok || r.PostForm.Get("redirect_uri") != auth.redirectURI {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "code is invalid")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	idToken, err := provider.SignIDToken(provider.IDTokenClaims(auth.identity, auth.nonce))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("oidctest: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
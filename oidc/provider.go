@@ -0,0 +1,241 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScopes are asked for when the config doesn't list any. They cover the claims a user is created from.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// defaultHTTPTimeout bounds every request made to the provider
+const defaultHTTPTimeout = 10 * time.Second
+
+// Config describes the provider and how this app is registered with it
+type Config struct {
+	// Issuer is the provider's issuer URL, e.g. https://accounts.example.com. Its discovery document is
+	// served under /.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to with a code
+	RedirectURL string
+	Scopes      []string
+}
+
+// Error is an error response of the provider's token endpoint, see RFC 6749 section 5.2
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oidc: %s", e.Code)
+	}
+	return fmt.Sprintf("oidc: %s: %s", e.Code, e.Description)
+}
+
+// discoveryDocument holds the parts of the provider's metadata that are used, see OpenID Connect Discovery 1.0
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider signs users in with an OpenID Connect provider through the authorization code flow with PKCE.
+// The provider's metadata is fetched on first use, so the server can start while the provider is down.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+// NewProvider creates a provider from its config. client may be nil, in which case a client with a timeout is used.
+func NewProvider(config Config, client *http.Client) (*Provider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer, client ID and redirect URL are required")
+	}
+	if _, err := url.Parse(config.RedirectURL); err != nil {
+		return nil, fmt.Errorf("oidc: invalid redirect URL: %w", err)
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	provider := &Provider{
+		config: config,
+		client: client,
+	}
+	provider.keys = newKeySet(client, provider.jwksURI)
+	return provider, nil
+}
+
+// Issuer returns the issuer of the provider. Identities are stored under it.
+func (provider *Provider) Issuer() string {
+	return provider.config.Issuer
+}
+
+// AuthCodeURL returns the provider's URL a user signs in at. state comes back with the code, nonce is
+// embedded in the ID token and codeChallenge is the S256 challenge of the verifier sent with the code.
+func (provider *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.config.ClientID)
+	query.Set("redirect_uri", provider.config.RedirectURL)
+	query.Set("scope", strings.Join(provider.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Exchange swaps a code for the user's ID token and checks it. The nonce must be the one sent with the
+// authorization request.
+func (provider *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Claims, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if provider.config.ClientSecret == "" {
+		form.Set("client_id", provider.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if provider.config.ClientSecret != "" {
+		// basic credentials are form encoded first, see RFC 6749 section 2.3.1
+		req.SetBasicAuth(url.QueryEscape(provider.config.ClientID), url.QueryEscape(provider.config.ClientSecret))
+	}
+
+	res, err := provider.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: unable to read token response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		tokenErr := &Error{}
+		if err := json.Unmarshal(body, tokenErr); err != nil || tokenErr.Code == "" {
+			return nil, fmt.Errorf("oidc: token endpoint responded with %s", res.Status)
+		}
+		return nil, tokenErr
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oidc: invalid token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: the token response has no ID token", ErrInvalidIDToken)
+	}
+
+	return provider.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// maxResponseSize bounds the responses read from the provider
+const maxResponseSize = 1 << 20
+
+// discover fetches the provider's metadata once, and checks that it describes the configured issuer
+func (provider *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(provider.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var discovery discoveryDocument
+	if err := getJSON(ctx, provider.client, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("oidc: unable to fetch the discovery document: %w", err)
+	}
+
+	if discovery.Issuer != provider.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q instead of %q", discovery.Issuer, provider.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing an endpoint")
+	}
+
+	provider.discovery = &discovery
+	return provider.discovery, nil
+}
+
+// jwksURI returns the URL of the provider's signing keys
+func (provider *Provider) jwksURI(ctx context.Context) (string, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return discovery.JWKSURI, nil
+}
+
+// getJSON fetches a JSON document
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sajitron/travel-agency/oidc/oidctest"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURL = "https://travel.agency/oidc/callback"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	stub, err := oidctest.NewProvider(util.RandomString(12), util.RandomString(32))
+	require.NoError(t, err)
+	t.Cleanup(stub.Close)
+
+	provider, err := NewProvider(Config{
+		Issuer:       stub.URL,
+		ClientID:     stub.ClientID,
+		ClientSecret: stub.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, stub.Client())
+	require.NoError(t, err)
+
+	return provider, stub
+}
+
+func randomIdentity() oidctest.Identity {
+	return oidctest.Identity{
+		Subject:       util.RandomString(16),
+		Email:         util.RandomEmail(),
+		EmailVerified: true,
+		GivenName:     util.RandomName(),
+		FamilyName:    util.RandomName(),
+	}
+}
+
+func TestExchange(t *testing.T) {
+	provider, stub := newTestProvider(t)
+	identity := randomIdentity()
+
+	verifier, _, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", util.PKCEChallenge(verifier))
+	require.NoError(t, err)
+
+	code, state, err := stub.Authorize(authURL, identity)
+	require.NoError(t, err)
+	require.Equal(t, "state", state)
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+	require.NoError(t, err)
+	require.Equal(t, stub.URL, claims.Issuer)
+	require.Equal(t, identity.Subject, claims.Subject)
+	require.Equal(t, identity.Email, claims.Email)
+	require.True(t, claims.EmailVerified)
+	require.Equal(t, identity.GivenName, claims.GivenName)
+	require.Equal(t, identity.FamilyName, claims.FamilyName)
+
+	// the code was used up
+	_, err = provider.Exchange(context.Background(), code, verifier, "nonce")
+	var providerErr *Error
+	require.ErrorAs(t, err, &providerErr)
+	require.Equal(t, "invalid_grant", providerErr.Code)
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	verifier, _, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", util.PKCEChallenge(verifier))
+	require.NoError(t, err)
+
+	code, _, err := stub.Authorize(authURL, randomIdentity())
+	require.NoError(t, err)
+
+	otherVerifier, _, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(context.Background(), code, otherVerifier, "nonce")
+	var providerErr *Error
+	require.ErrorAs(t, err, &providerErr)
+	require.Equal(t, "invalid_grant", providerErr.Code)
+}
+
+func TestExchangeWrongNonce(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	verifier, _, err := util.GenerateVerificationToken()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", util.PKCEChallenge(verifier))
+	require.NoError(t, err)
+
+	code, _, err := stub.Authorize(authURL, randomIdentity())
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(context.Background(), code, verifier, "another nonce")
+	require.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, stub := newTestProvider(t)
+	identity := randomIdentity()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		signIDToken func(t *testing.T) string
+		checkResult func(t *testing.T, claims *Claims, err error)
+	}{
+		{
+			name: "OK",
+			signIDToken: func(t *testing.T) string {
+				idToken, err := stub.SignIDToken(stub.IDTokenClaims(identity, "nonce"))
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.NoError(t, err)
+				require.Equal(t, identity.Subject, claims.Subject)
+			},
+		},
+		{
+			name: "Audience List",
+			signIDToken: func(t *testing.T) string {
+				claims := stub.IDTokenClaims(identity, "nonce")
+				claims["aud"] = []string{"another-client", stub.ClientID}
+				claims["azp"] = stub.ClientID
+				idToken, err := stub.SignIDToken(claims)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Another Audience",
+			signIDToken: func(t *testing.T) string {
+				claims := stub.IDTokenClaims(identity, "nonce")
+				claims["aud"] = "another-client"
+				idToken, err := stub.SignIDToken(claims)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Another Issuer",
+			signIDToken: func(t *testing.T) string {
+				claims := stub.IDTokenClaims(identity, "nonce")
+				claims["iss"] = "https://attacker.example.com"
+				idToken, err := stub.SignIDToken(claims)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Expired",
+			signIDToken: func(t *testing.T) string {
+				claims := stub.IDTokenClaims(identity, "nonce")
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				idToken, err := stub.SignIDToken(claims)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Wrong Nonce",
+			signIDToken: func(t *testing.T) string {
+				idToken, err := stub.SignIDToken(stub.IDTokenClaims(identity, "another nonce"))
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Signed With Another Key",
+			signIDToken: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, stub.IDTokenClaims(identity, "nonce"))
+				token.Header["kid"] = oidctest.KeyID
+				idToken, err := token.SignedString(otherKey)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Unknown Key",
+			signIDToken: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, stub.IDTokenClaims(identity, "nonce"))
+				token.Header["kid"] = "another-key"
+				idToken, err := token.SignedString(otherKey)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "Symmetric Algorithm",
+			signIDToken: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, stub.IDTokenClaims(identity, "nonce"))
+				idToken, err := token.SignedString([]byte(stub.ClientSecret))
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+		{
+			name: "No Signature",
+			signIDToken: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, stub.IDTokenClaims(identity, "nonce"))
+				idToken, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				require.NoError(t, err)
+				return idToken
+			},
+			checkResult: func(t *testing.T, claims *Claims, err error) {
+				require.ErrorIs(t, err, ErrInvalidIDToken)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := provider.VerifyIDToken(context.Background(), tc.signIDToken(t), "nonce")
+			tc.checkResult(t, claims, err)
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	stub, err := oidctest.NewProvider(util.RandomString(12), "")
+	require.NoError(t, err)
+	defer stub.Close()
+
+	// the discovery document names the stub's URL, not the configured issuer
+	provider, err := NewProvider(Config{
+		Issuer:      stub.URL + "/tenant",
+		ClientID:    stub.ClientID,
+		RedirectURL: testRedirectURL,
+	}, stub.Client())
+	require.NoError(t, err)
+
+	_, err = provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrInvalidIDToken))
+}
+
+func TestProviderDown(t *testing.T) {
+	stub, err := oidctest.NewProvider(util.RandomString(12), "")
+	require.NoError(t, err)
+
+	provider, err := NewProvider(Config{
+		Issuer:      stub.URL,
+		ClientID:    stub.ClientID,
+		RedirectURL: testRedirectURL,
+	}, nil)
+	require.NoError(t, err)
+
+	idToken, err := stub.SignIDToken(stub.IDTokenClaims(randomIdentity(), "nonce"))
+	require.NoError(t, err)
+	stub.Close()
+
+	// a provider that can't be reached is no fault of the token
+	_, err = provider.VerifyIDToken(context.Background(), idToken, "nonce")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrInvalidIDToken))
+}
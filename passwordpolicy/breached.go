@@ -0,0 +1,225 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// BreachedList tells if a password has appeared in a data breach
+type BreachedList interface {
+	Contains(password string) bool
+}
+
+// minPrefixLength is the shortest SHA-1 prefix a PrefixList accepts, in hex characters.
+// Shorter prefixes would match too many passwords that were never breached.
+const minPrefixLength = 10
+
+// PrefixList holds the SHA-1 hashes of breached passwords, cut down to the same number of hex characters.
+// Shorter prefixes take less memory, at the cost of refusing a few passwords that were never breached.
+type PrefixList struct {
+	prefixLength int
+	prefixes     map[string]struct{}
+}
+
+// LoadPrefixList reads a list of SHA-1 hashes or hash prefixes, one per line, in hex. Anything after
+// a colon is ignored, so the "HASH:COUNT" files published by Have I Been Pwned can be used as they are.
+func LoadPrefixList(r io.Reader) (*PrefixList, error) {
+	list := &PrefixList{
+		prefixes: make(map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		prefix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if prefix == "" {
+			continue
+		}
+		prefix = strings.ToUpper(prefix)
+
+		if list.prefixLength == 0 {
+			if len(prefix) < minPrefixLength || len(prefix) > sha1.Size*2 {
+				return nil, fmt.Errorf("line %d: prefix must be between %d and %d hex characters", line, minPrefixLength, sha1.Size*2)
+			}
+			list.prefixLength = len(prefix)
+		}
+
+		if len(prefix) != list.prefixLength {
+			return nil, fmt.Errorf("line %d: every prefix must be %d hex characters long", line, list.prefixLength)
+		}
+		// prefixes may have an odd length, so they're checked character by character rather than decoded
+		if strings.Trim(prefix, "0123456789ABCDEF") != "" {
+			return nil, fmt.Errorf("line %d: prefix is not hex", line)
+		}
+
+		list.prefixes[prefix] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Contains checks if the SHA-1 hash of a password starts with one of the prefixes
+func (list *PrefixList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	prefix := strings.ToUpper(hex.EncodeToString(sum[:]))[:list.prefixLength]
+
+	_, ok := list.prefixes[prefix]
+	return ok
+}
+
+// bloomFilterMagic starts every bloom filter file
+var bloomFilterMagic = []byte("PWBLOOM1")
+
+// BloomFilter holds breached passwords in a fixed number of bits, whatever the size of the list.
+// It never misses a breached password, but refuses a small share of passwords that were never breached.
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint32
+}
+
+// NewBloomFilter creates an empty bloom filter sized for count passwords at a false positive rate
+func NewBloomFilter(count int, falsePositiveRate float64) (*BloomFilter, error) {
+	if count <= 0 || falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("count must be positive and the false positive rate between 0 and 1")
+	}
+
+	size := uint64(math.Ceil(-float64(count) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(size)/float64(count)*math.Ln2)))
+
+	return &BloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}, nil
+}
+
+// BuildBloomFilter adds every SHA-1 hash of a list in the format read by LoadPrefixList to a new bloom filter.
+// The hashes have to be complete.
+func BuildBloomFilter(r io.Reader, count int, falsePositiveRate float64) (*BloomFilter, error) {
+	filter, err := NewBloomFilter(count, falsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha1.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		filter.add(sum)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Add adds a password to the filter
+func (filter *BloomFilter) Add(password string) {
+	sum := sha1.Sum([]byte(password))
+	filter.add(sum[:])
+}
+
+// Contains checks if a password may have been added to the filter
+func (filter *BloomFilter) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	for _, bit := range filter.positions(sum[:]) {
+		if filter.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (filter *BloomFilter) add(sum []byte) {
+	for _, bit := range filter.positions(sum) {
+		filter.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// positions derives the bits of a SHA-1 hash by double hashing its first 16 bytes
+func (filter *BloomFilter) positions(sum []byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+
+	positions := make([]uint64, filter.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % filter.size
+	}
+	return positions
+}
+
+// WriteTo saves the filter in the format read by ReadBloomFilter
+func (filter *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	buf.Write(bloomFilterMagic)
+	binary.Write(buf, binary.LittleEndian, filter.hashes)
+	binary.Write(buf, binary.LittleEndian, filter.size)
+	binary.Write(buf, binary.LittleEndian, filter.bits)
+
+	if err := buf.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(len(bloomFilterMagic) + 4 + 8 + 8*len(filter.bits)), nil
+}
+
+// ReadBloomFilter reads a filter saved by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	magic := make([]byte, len(bloomFilterMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, bloomFilterMagic) {
+		return nil, errors.New("not a bloom filter file")
+	}
+
+	filter := &BloomFilter{}
+	if err := binary.Read(r, binary.LittleEndian, &filter.hashes); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &filter.size); err != nil {
+		return nil, err
+	}
+	if filter.hashes == 0 || filter.size == 0 {
+		return nil, errors.New("bloom filter is empty")
+	}
+
+	filter.bits = make([]uint64, (filter.size+63)/64)
+	if err := binary.Read(r, binary.LittleEndian, filter.bits); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// LoadBreachedList loads a breached password list from a file, either a bloom filter saved by
+// BloomFilter.WriteTo or a list of SHA-1 prefixes read by LoadPrefixList
+func LoadBreachedList(path string) (BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(bloomFilterMagic))
+	if bytes.Equal(magic, bloomFilterMagic) {
+		return ReadBloomFilter(reader)
+	}
+	return LoadPrefixList(reader)
+}
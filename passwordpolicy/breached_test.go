@@ -0,0 +1,122 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var breachedPasswords = []string{"password123", "qwertyuiop", "letmein!", "iloveyou2"}
+
+// hibpList formats passwords like the lists published by Have I Been Pwned
+func hibpList(passwords []string, prefixLength int) string {
+	var list strings.Builder
+	for i, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		fmt.Fprintf(&list, "%s:%d\n", strings.ToUpper(hex.EncodeToString(sum[:]))[:prefixLength], i+1)
+	}
+	return list.String()
+}
+
+func TestPrefixList(t *testing.T) {
+	for _, prefixLength := range []int{minPrefixLength, 13, 40} {
+		list, err := LoadPrefixList(strings.NewReader(hibpList(breachedPasswords, prefixLength)))
+		require.NoError(t, err)
+
+		for _, password := range breachedPasswords {
+			require.True(t, list.Contains(password), password)
+		}
+		require.False(t, list.Contains("correct horse battery staple"))
+	}
+}
+
+func TestLoadPrefixListInvalid(t *testing.T) {
+	lists := []string{
+		"ABCDE\n",
+		"CBFDAC6008F9CAB4083784CBD1874F76618D2A97\nCBFDAC6008\n",
+		"ZZZZZZZZZZZZ\n",
+	}
+
+	for _, list := range lists {
+		_, err := LoadPrefixList(strings.NewReader(list))
+		require.Error(t, err, list)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter, err := BuildBloomFilter(strings.NewReader(hibpList(breachedPasswords, 40)), 1000, 0.001)
+	require.NoError(t, err)
+
+	for _, password := range breachedPasswords {
+		require.True(t, filter.Contains(password), password)
+	}
+	require.False(t, filter.Contains("correct horse battery staple"))
+
+	filter.Add("correct horse battery staple")
+	require.True(t, filter.Contains("correct horse battery staple"))
+
+	var buf bytes.Buffer
+	n, err := filter.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+
+	readFilter, err := ReadBloomFilter(&buf)
+	require.NoError(t, err)
+	require.Equal(t, filter, readFilter)
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	filter, err := NewBloomFilter(10000, 0.01)
+	require.NoError(t, err)
+
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("breached-%d", i))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.Contains(fmt.Sprintf("safe-%d", i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 200)
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	dir := t.TempDir()
+
+	prefixPath := filepath.Join(dir, "breached.txt")
+	err := os.WriteFile(prefixPath, []byte(hibpList(breachedPasswords, 16)), 0o600)
+	require.NoError(t, err)
+
+	filter, err := BuildBloomFilter(strings.NewReader(hibpList(breachedPasswords, 40)), 100, 0.001)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = filter.WriteTo(&buf)
+	require.NoError(t, err)
+
+	bloomPath := filepath.Join(dir, "breached.bloom")
+	err = os.WriteFile(bloomPath, buf.Bytes(), 0o600)
+	require.NoError(t, err)
+
+	for _, path := range []string{prefixPath, bloomPath} {
+		list, err := LoadBreachedList(path)
+		require.NoError(t, err)
+
+		for _, password := range breachedPasswords {
+			require.True(t, list.Contains(password), password)
+		}
+		require.False(t, list.Contains("correct horse battery staple"))
+	}
+
+	_, err = LoadBreachedList(filepath.Join(dir, "missing.txt"))
+	require.Error(t, err)
+}
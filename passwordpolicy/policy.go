@@ -0,0 +1,151 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Codes of the rules a password can break
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeCharacterClasses = "character_classes"
+	CodeContainsPersonal = "contains_personal_info"
+	CodeBreached         = "breached"
+)
+
+// minPersonalInfoLength leaves out names too short to matter, as they'd turn up in passwords by chance
+const minPersonalInfoLength = 3
+
+// Violation is a rule a password breaks. Code is meant for clients, Message for people.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// UserInfo is what a user is known by. Passwords that contain any of it are easy to guess.
+type UserInfo struct {
+	FirstName string
+	LastName  string
+	Email     string
+}
+
+// Policy describes what a password needs to be accepted
+type Policy struct {
+	MinLength int
+	// MaxLength is ignored when zero
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase letters, uppercase letters, digits and symbols
+	// a password must mix. It is ignored when zero.
+	MinCharacterClasses int
+	// AllowPersonalInfo lets passwords contain the name or email of their user
+	AllowPersonalInfo bool
+	// Breached is checked when it is set
+	Breached BreachedList
+}
+
+// Check returns every rule a password breaks, or nothing if it's accepted. The personal info rule is
+// skipped when user is empty, so the other rules can be checked before the user is known.
+func (policy Policy) Check(password string, user UserInfo) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters long", policy.MinLength),
+		})
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("password must be at most %d characters long", policy.MaxLength),
+		})
+	}
+
+	if characterClasses(password) < policy.MinCharacterClasses {
+		violations = append(violations, Violation{
+			Code: CodeCharacterClasses,
+			Message: fmt.Sprintf(
+				"password must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+				policy.MinCharacterClasses,
+			),
+		})
+	}
+
+	violations = append(violations, policy.CheckPersonalInfo(password, user)...)
+
+	if policy.Breached != nil && policy.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "password has appeared in a data breach, choose another one",
+		})
+	}
+
+	return violations
+}
+
+// CheckPersonalInfo checks that a password doesn't contain the name or email of its user
+func (policy Policy) CheckPersonalInfo(password string, user UserInfo) []Violation {
+	if policy.AllowPersonalInfo {
+		return nil
+	}
+
+	lowerPassword := strings.ToLower(password)
+	for _, info := range personalInfo(user) {
+		if strings.Contains(lowerPassword, info) {
+			return []Violation{{
+				Code:    CodeContainsPersonal,
+				Message: "password must not contain your name or email",
+			}}
+		}
+	}
+	return nil
+}
+
+// personalInfo returns the lowercase parts of a user's name and email worth looking for
+func personalInfo(user UserInfo) []string {
+	candidates := []string{user.FirstName, user.LastName}
+	if email := strings.ToLower(strings.TrimSpace(user.Email)); email != "" {
+		candidates = append(candidates, email)
+		if at := strings.LastIndex(email, "@"); at > 0 {
+			candidates = append(candidates, email[:at])
+		}
+	}
+
+	var info []string
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if utf8.RuneCountInString(candidate) >= minPersonalInfoLength {
+			info = append(info, candidate)
+		}
+	}
+	return info
+}
+
+// characterClasses counts which of lowercase letters, uppercase letters, digits and symbols a password uses
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			count++
+		}
+	}
+	return count
+}
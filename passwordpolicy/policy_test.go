@@ -0,0 +1,130 @@
+package passwordpolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func violationCodes(violations []Violation) []string {
+	codes := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestPolicyCheck(t *testing.T) {
+	breached := &PrefixList{prefixLength: 40, prefixes: map[string]struct{}{}}
+	// SHA-1 of "password123"
+	breached.prefixes["CBFDAC6008F9CAB4083784CBD1874F76618D2A97"] = struct{}{}
+
+	policy := Policy{
+		MinLength:           8,
+		MaxLength:           64,
+		MinCharacterClasses: 2,
+		Breached:            breached,
+	}
+	user := UserInfo{
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+		Email:     "ada.king@example.com",
+	}
+
+	testCases := []struct {
+		name     string
+		password string
+		user     UserInfo
+		codes    []string
+	}{
+		{
+			name:     "OK",
+			password: "correct horse battery 9",
+			user:     user,
+			codes:    []string{},
+		},
+		{
+			name:     "Too Short",
+			password: "ab1",
+			user:     user,
+			codes:    []string{CodeTooShort},
+		},
+		{
+			name:     "Too Long",
+			password: "a1" + string(make([]byte, 63)),
+			user:     user,
+			codes:    []string{CodeTooLong},
+		},
+		{
+			name:     "Character Classes",
+			password: "onlylowercaseletters",
+			user:     user,
+			codes:    []string{CodeCharacterClasses},
+		},
+		{
+			name:     "Last Name",
+			password: "iLoveLOVELACE1",
+			user:     user,
+			codes:    []string{CodeContainsPersonal},
+		},
+		{
+			name:     "Email Local Part",
+			password: "Ada.King2024",
+			user:     user,
+			codes:    []string{CodeContainsPersonal},
+		},
+		{
+			name:     "Short Name",
+			password: "adabyron-1815",
+			user:     UserInfo{FirstName: "Al"},
+			codes:    []string{},
+		},
+		{
+			name:     "Unknown User",
+			password: "Lovelace1815",
+			user:     UserInfo{},
+			codes:    []string{},
+		},
+		{
+			name:     "Breached",
+			password: "password123",
+			user:     user,
+			codes:    []string{CodeBreached},
+		},
+		{
+			name:     "Several Rules",
+			password: "ada",
+			user:     user,
+			codes:    []string{CodeTooShort, CodeCharacterClasses, CodeContainsPersonal},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			violations := policy.Check(tc.password, tc.user)
+			require.Equal(t, tc.codes, violationCodes(violations))
+
+			for _, violation := range violations {
+				require.NotEmpty(t, violation.Message)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowPersonalInfo(t *testing.T) {
+	policy := Policy{MinLength: 8, AllowPersonalInfo: true}
+
+	violations := policy.Check("lovelace1815", UserInfo{LastName: "Lovelace"})
+	require.Empty(t, violations)
+}
+
+func TestCharacterClasses(t *testing.T) {
+	require.Equal(t, 0, characterClasses(""))
+	require.Equal(t, 1, characterClasses("abc"))
+	require.Equal(t, 2, characterClasses("abcDEF"))
+	require.Equal(t, 3, characterClasses("abcDEF123"))
+	require.Equal(t, 4, characterClasses("abcDEF123!"))
+	require.Equal(t, 2, characterClasses("ünïcödéÜNÏ"))
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often idle keys are looked for. Keys are only pruned when they're hit otherwise.
+const memorySweepInterval = time.Minute
+
+// memoryKey holds the hits of a key, oldest first, and the window of the policy they were counted against
+type memoryKey struct {
+	window time.Duration
+	hits   []time.Time
+}
+
+// MemoryRateLimiter keeps hits in process memory. It suits tests and single instance deployments.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	keys      map[string]*memoryKey
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimiter creates a new MemoryRateLimiter
+func NewMemoryRateLimiter() RateLimiter {
+	return &MemoryRateLimiter{
+		keys: make(map[string]*memoryKey),
+		now:  time.Now,
+	}
+}
+
+// Allow records a hit if it is within the limit of the policy
+func (limiter *MemoryRateLimiter) Allow(ctx context.Context, policy Policy, key string) (Result, error) {
+	return limiter.hit(policy, key, true), nil
+}
+
+// Peek reports whether a hit would be allowed, without recording one
+func (limiter *MemoryRateLimiter) Peek(ctx context.Context, policy Policy, key string) (Result, error) {
+	return limiter.hit(policy, key, false), nil
+}
+
+// Reset forgets every hit recorded for a key
+func (limiter *MemoryRateLimiter) Reset(ctx context.Context, policy Policy, key string) error {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	delete(limiter.keys, storageKey(policy, key))
+	return nil
+}
+
+func (limiter *MemoryRateLimiter) hit(policy Policy, key string, record bool) Result {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	id := storageKey(policy, key)
+	entry, ok := limiter.keys[id]
+	if !ok {
+		entry = &memoryKey{}
+	}
+	entry.window = policy.Window
+	entry.removeExpired(now)
+
+	allowed := len(entry.hits) < policy.Limit
+	if allowed && record {
+		entry.hits = append(entry.hits, now)
+	}
+
+	if len(entry.hits) > 0 {
+		limiter.keys[id] = entry
+	} else {
+		delete(limiter.keys, id)
+	}
+	return newResult(policy, allowed, len(entry.hits), entry.hits, now)
+}
+
+// sweep drops the keys whose hits have all left their window, at most once every memorySweepInterval,
+// so that keys which are never hit again don't hold on to memory
+func (limiter *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < memorySweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for id, entry := range limiter.keys {
+		entry.removeExpired(now)
+		if len(entry.hits) == 0 {
+			delete(limiter.keys, id)
+		}
+	}
+}
+
+// removeExpired drops the hits that have left the key's window
+func (entry *memoryKey) removeExpired(now time.Time) {
+	i := 0
+	for i < len(entry.hits) && !entry.hits[i].After(now.Add(-entry.window)) {
+		i++
+	}
+	entry.hits = entry.hits[i:]
+}
+
+func newResult(policy Policy, allowed bool, count int, hits []time.Time, now time.Time) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: policy.Limit - count,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if len(hits) > 0 {
+		result.ResetAfter = hits[len(hits)-1].Add(policy.Window).Sub(now)
+		if !allowed {
+			result.RetryAfter = hits[0].Add(policy.Window).Sub(now)
+		}
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// FailureMode decides what happens to requests when the rate limiter backend is unavailable
+type FailureMode int
+
+const (
+	// FailClosed refuses requests while the backend is unavailable. It is the default.
+	FailClosed FailureMode = iota
+	// FailOpen lets requests through while the backend is unavailable
+	FailOpen
+)
+
+// Policy allows Limit hits per key within a sliding window
+type Policy struct {
+	// Name keeps the counters of different policies apart
+	Name        string
+	Limit       int
+	Window      time.Duration
+	FailureMode FailureMode
+}
+
+// Result describes the state of a key after a rate limiter call
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a hit would be allowed again. It is zero when hits are allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until every recorded hit has left the window
+	ResetAfter time.Duration
+}
+
+// RateLimiter counts hits per key with a sliding window
+type RateLimiter interface {
+	// Allow records a hit if it is within the limit of the policy
+	Allow(ctx context.Context, policy Policy, key string) (Result, error)
+
+	// Peek reports whether a hit would be allowed, without recording one
+	Peek(ctx context.Context, policy Policy, key string) (Result, error)
+
+	// Reset forgets every hit recorded for a key
+	Reset(ctx context.Context, policy Policy, key string) error
+}
+
+func storageKey(policy Policy, key string) string {
+	return "ratelimit:" + policy.Name + ":" + key
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = Policy{
+	Name:   "test",
+	Limit:  3,
+	Window: time.Minute,
+}
+
+func newTestRedisRateLimiter(t *testing.T) (RateLimiter, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisRateLimiter(client), server
+}
+
+func testRateLimiter(t *testing.T, limiter RateLimiter) {
+	ctx := context.Background()
+
+	for i := 0; i < testPolicy.Limit; i++ {
+		result, err := limiter.Allow(ctx, testPolicy, "key")
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, testPolicy.Limit, result.Limit)
+		require.Equal(t, testPolicy.Limit-i-1, result.Remaining)
+		require.Zero(t, result.RetryAfter)
+	}
+
+	result, err := limiter.Peek(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+
+	result, err = limiter.Allow(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+	require.InDelta(t, testPolicy.Window, result.RetryAfter, float64(time.Second))
+	require.InDelta(t, testPolicy.Window, result.ResetAfter, float64(time.Second))
+
+	// keys and policies are counted separately
+	result, err = limiter.Allow(ctx, testPolicy, "other")
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	otherPolicy := testPolicy
+	otherPolicy.Name = "other"
+	result, err = limiter.Allow(ctx, otherPolicy, "key")
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	err = limiter.Reset(ctx, testPolicy, "key")
+	require.NoError(t, err)
+
+	result, err = limiter.Peek(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Equal(t, testPolicy.Limit, result.Remaining)
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	testRateLimiter(t, NewMemoryRateLimiter())
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	limiter, _ := newTestRedisRateLimiter(t)
+	testRateLimiter(t, limiter)
+}
+
+func TestMemoryRateLimiterSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	limiter := NewMemoryRateLimiter().(*MemoryRateLimiter)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < testPolicy.Limit; i++ {
+		_, err := limiter.Allow(ctx, testPolicy, "key")
+		require.NoError(t, err)
+		now = now.Add(10 * time.Second)
+	}
+
+	result, err := limiter.Allow(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 30*time.Second, result.RetryAfter)
+
+	// only the oldest hit leaves the window
+	now = now.Add(result.RetryAfter)
+	result, err = limiter.Allow(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+
+	result, err = limiter.Peek(ctx, testPolicy, "key")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+}
+
+func TestMemoryRateLimiterWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	limiter := NewMemoryRateLimiter().(*MemoryRateLimiter)
+	limiter.now = func() time.Time { return now }
+
+	longPolicy := Policy{Name: "long", Limit: 1, Window: time.Hour}
+	_, err := limiter.Allow(ctx, longPolicy, "key")
+	require.NoError(t, err)
+
+	// hits of a policy with a shorter window don't prune the hits of other policies
+	now = now.Add(2 * testPolicy.Window)
+	_, err = limiter.Allow(ctx, testPolicy, "key")
+	require.NoError(t, err)
+
+	result, err := limiter.Peek(ctx, longPolicy, "key")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Zero(t, result.Remaining)
+
+	// keys that are never hit again are swept once their hits have left the window
+	now = now.Add(longPolicy.Window)
+	_, err = limiter.Peek(ctx, testPolicy, "other")
+	require.NoError(t, err)
+	require.Empty(t, limiter.keys)
+}
+
+func TestRedisRateLimiterExpiresKeys(t *testing.T) {
+	ctx := context.Background()
+	limiter, server := newTestRedisRateLimiter(t)
+
+	_, err := limiter.Allow(ctx, testPolicy, "key")
+	require.NoError(t, err)
+
+	key := storageKey(testPolicy, "key")
+	require.True(t, server.Exists(key))
+	require.Equal(t, testPolicy.Window, server.TTL(key))
+
+	server.FastForward(testPolicy.Window)
+	require.False(t, server.Exists(key))
+}
+
+func TestRedisRateLimiterUnavailable(t *testing.T) {
+	limiter, server := newTestRedisRateLimiter(t)
+	server.Close()
+
+	result, err := limiter.Allow(context.Background(), testPolicy, "key")
+	require.Error(t, err)
+	require.False(t, result.Allowed)
+}
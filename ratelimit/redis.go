@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript keeps the hits of a key in a sorted set scored by time in milliseconds.
+// Pruning, counting and recording run as one script so concurrent requests cannot race past the limit.
+//
+// KEYS[1] is the sorted set, ARGV is now, window, limit, member and whether to record the hit.
+// It returns whether the hit is allowed, the hit count and the scores of the oldest and newest hits.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local record = ARGV[5] == "1"
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+local count = redis.call("ZCARD", key)
+
+local allowed = 0
+if count < limit then
+	allowed = 1
+	if record then
+		redis.call("ZADD", key, now, ARGV[4])
+		redis.call("PEXPIRE", key, window)
+		count = count + 1
+	end
+end
+
+local oldest = -1
+local newest = -1
+if count > 0 then
+	oldest = tonumber(redis.call("ZRANGE", key, 0, 0, "WITHSCORES")[2])
+	newest = tonumber(redis.call("ZRANGE", key, -1, -1, "WITHSCORES")[2])
+end
+
+return {allowed, count, oldest, newest}
+`)
+
+// RedisRateLimiter keeps hits in Redis so that every API instance shares the same limits
+type RedisRateLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimiter creates a new RedisRateLimiter
+func NewRedisRateLimiter(client *redis.Client) RateLimiter {
+	return &RedisRateLimiter{client}
+}
+
+// Allow records a hit if it is within the limit of the policy
+func (limiter *RedisRateLimiter) Allow(ctx context.Context, policy Policy, key string) (Result, error) {
+	return limiter.hit(ctx, policy, key, true)
+}
+
+// Peek reports whether a hit would be allowed, without recording one
+func (limiter *RedisRateLimiter) Peek(ctx context.Context, policy Policy, key string) (Result, error) {
+	return limiter.hit(ctx, policy, key, false)
+}
+
+// Reset forgets every hit recorded for a key
+func (limiter *RedisRateLimiter) Reset(ctx context.Context, policy Policy, key string) error {
+	return limiter.client.Del(ctx, storageKey(policy, key)).Err()
+}
+
+func (limiter *RedisRateLimiter) hit(ctx context.Context, policy Policy, key string, record bool) (Result, error) {
+	now := time.Now()
+	nowMs := now.UnixMilli()
+
+	recordArg := "0"
+	if record {
+		recordArg = "1"
+	}
+
+	values, err := slidingWindowScript.Run(
+		ctx,
+		limiter.client,
+		[]string{storageKey(policy, key)},
+		nowMs,
+		policy.Window.Milliseconds(),
+		policy.Limit,
+		strconv.FormatInt(nowMs, 10)+"-"+uuid.NewString(),
+		recordArg,
+	).Int64Slice()
+	if err != nil {
+		return Result{Limit: policy.Limit}, err
+	}
+
+	var hits []time.Time
+	if values[1] > 0 {
+		hits = []time.Time{time.UnixMilli(values[2]), time.UnixMilli(values[3])}
+	}
+
+	return newResult(policy, values[0] == 1, int(values[1]), hits, time.UnixMilli(nowMs)), nil
+}
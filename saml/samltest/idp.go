@@ -0,0 +1,245 @@
+// Package samltest is a stand-in SAML identity provider built from a static key, so that SAML sign in can be
+// tested end to end without a real provider. It reads authentication requests and writes signed responses.
+package samltest
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sajitron/travel-agency/saml/xmldsig"
+)
+
+// Namespaces and values of SAML 2.0 used in responses
+const (
+	namespaceAssertion     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	namespaceProtocol      = "urn:oasis:names:tc:SAML:2.0:protocol"
+	confirmationBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	// StatusSuccess is the status of a good response
+	StatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+)
+
+// IdP is a stand-in identity provider
+type IdP struct {
+	EntityID    string
+	SSOURL      string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// NewIdP creates an identity provider that signs with the static key
+func NewIdP(entityID string) (*IdP, error) {
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, errors.New("samltest: invalid key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("samltest: key is not an RSA key")
+	}
+
+	certBlock, _ := pem.Decode([]byte(certificatePEM))
+	if certBlock == nil {
+		return nil, errors.New("samltest: invalid certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdP{
+		EntityID:    entityID,
+		SSOURL:      entityID + "/sso",
+		Key:         rsaKey,
+		Certificate: cert,
+	}, nil
+}
+
+// CertificatePEM returns the certificate the service provider is set up with
+func (idp *IdP) CertificatePEM() string {
+	return strings.TrimSpace(certificatePEM)
+}
+
+// AuthnRequest is an authentication request sent by the service provider
+type AuthnRequest struct {
+	ID          string `xml:"ID,attr"`
+	Destination string `xml:"Destination,attr"`
+	ACSURL      string `xml:"AssertionConsumerServiceURL,attr"`
+	Issuer      string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+}
+
+// ParseAuthnRequest stands in for the user being sent to the provider. It reads the authentication request
+// and the relay state of a URL made with the HTTP-Redirect binding.
+func (idp *IdP) ParseAuthnRequest(authnRequestURL string) (*AuthnRequest, string, error) {
+	u, err := url.Parse(authnRequestURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme+"://"+u.Host+u.Path != idp.SSOURL {
+		return nil, "", errors.New("samltest: not the provider's SSO endpoint")
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var request AuthnRequest
+	if err := xml.Unmarshal(data, &request); err != nil {
+		return nil, "", err
+	}
+	if request.ID == "" || request.ACSURL == "" || request.Issuer == "" {
+		return nil, "", errors.New("samltest: incomplete authentication request")
+	}
+	return &request, u.Query().Get("RelayState"), nil
+}
+
+// User is the user who signs in at the provider
+type User struct {
+	NameID     string
+	Attributes map[string]string
+}
+
+// Response holds what goes into a response. Tests can change it before it's encoded, to make a bad one.
+type Response struct {
+	ID           string
+	Destination  string
+	Issuer       string
+	Status       string
+	AssertionID  string
+	NameID       string
+	NameIDFormat string
+	InResponseTo string
+	Recipient    string
+	Audience     string
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+	Attributes   map[string]string
+	// SignAssertion and SignResponse pick what is signed. Signing neither makes an unsigned response.
+	SignAssertion bool
+	SignResponse  bool
+}
+
+// NewResponse returns a good response to a request, valid for 5 minutes, with a signed assertion
+func (idp *IdP) NewResponse(request *AuthnRequest, user User) *Response {
+	now := time.Now()
+	return &Response{
+		ID:            "_response-" + request.ID,
+		Destination:   request.ACSURL,
+		Issuer:        idp.EntityID,
+		Status:        StatusSuccess,
+		AssertionID:   "_assertion-" + request.ID,
+		NameID:        user.NameID,
+		NameIDFormat:  nameIDFormatPersistent,
+		InResponseTo:  request.ID,
+		Recipient:     request.ACSURL,
+		Audience:      request.Issuer,
+		NotBefore:     now.Add(-time.Minute),
+		NotOnOrAfter:  now.Add(5 * time.Minute),
+		Attributes:    user.Attributes,
+		SignAssertion: true,
+	}
+}
+
+// Respond returns a good response to a request, encoded to be posted to the service provider
+func (idp *IdP) Respond(request *AuthnRequest, user User) (string, error) {
+	return idp.Encode(idp.NewResponse(request, user))
+}
+
+// Encode writes, signs and encodes a response, as it's posted to the service provider
+func (idp *IdP) Encode(res *Response) (string, error) {
+	root, err := xmldsig.Parse([]byte(res.document()))
+	if err != nil {
+		return "", err
+	}
+
+	// signatures go right after the issuer
+	if res.SignAssertion {
+		assertion, err := root.ChildElement(namespaceAssertion, "Assertion")
+		if err != nil {
+			return "", err
+		}
+		signature, err := xmldsig.Sign(assertion, idp.Key, idp.Certificate)
+		if err != nil {
+			return "", err
+		}
+		assertion.InsertChild(1, signature)
+	}
+	if res.SignResponse {
+		signature, err := xmldsig.Sign(root, idp.Key, idp.Certificate)
+		if err != nil {
+			return "", err
+		}
+		root.InsertChild(1, signature)
+	}
+
+	return base64.StdEncoding.EncodeToString(xmldsig.Canonicalize(root, nil)), nil
+}
+
+func (res *Response) document() string {
+	var sb strings.Builder
+	now := formatTime(time.Now())
+
+	fmt.Fprintf(&sb, `<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" InResponseTo="%s">`,
+		namespaceProtocol, namespaceAssertion, escape(res.ID), now, escape(res.Destination), escape(res.InResponseTo))
+	fmt.Fprintf(&sb, `<saml:Issuer>%s</saml:Issuer>`, escape(res.Issuer))
+	fmt.Fprintf(&sb, `<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>`, escape(res.Status))
+
+	fmt.Fprintf(&sb, `<saml:Assertion ID="%s" Version="2.0" IssueInstant="%s">`, escape(res.AssertionID), now)
+	fmt.Fprintf(&sb, `<saml:Issuer>%s</saml:Issuer>`, escape(res.Issuer))
+	fmt.Fprintf(&sb, `<saml:Subject><saml:NameID Format="%s">%s</saml:NameID>`, escape(res.NameIDFormat), escape(res.NameID))
+	fmt.Fprintf(&sb, `<saml:SubjectConfirmation Method="%s"><saml:SubjectConfirmationData InResponseTo="%s" Recipient="%s" NotOnOrAfter="%s"/></saml:SubjectConfirmation>`,
+		confirmationBearer, escape(res.InResponseTo), escape(res.Recipient), formatTime(res.NotOnOrAfter))
+	sb.WriteString(`</saml:Subject>`)
+	fmt.Fprintf(&sb, `<saml:Conditions NotBefore="%s" NotOnOrAfter="%s"><saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`,
+		formatTime(res.NotBefore), formatTime(res.NotOnOrAfter), escape(res.Audience))
+	fmt.Fprintf(&sb, `<saml:AuthnStatement AuthnInstant="%s" SessionIndex="%s"><saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext></saml:AuthnStatement>`,
+		now, escape(res.AssertionID))
+
+	names := make([]string, 0, len(res.Attributes))
+	for name := range res.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb.WriteString(`<saml:AttributeStatement>`)
+	for _, name := range names {
+		fmt.Fprintf(&sb, `<saml:Attribute Name="%s" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:basic">`, escape(name))
+		fmt.Fprintf(&sb, `<saml:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">%s</saml:AttributeValue>`,
+			escape(res.Attributes[name]))
+		sb.WriteString(`</saml:Attribute>`)
+	}
+	sb.WriteString(`</saml:AttributeStatement>`)
+
+	sb.WriteString(`</saml:Assertion></samlp:Response>`)
+	return sb.String()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
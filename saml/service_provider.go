@@ -0,0 +1,444 @@
+// Package saml is a SAML 2.0 service provider for the web browser SSO profile. Users are sent to the identity
+// provider with the HTTP-Redirect binding, and come back with a signed response through the HTTP-POST binding.
+// Encrypted assertions aren't supported.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sajitron/travel-agency/saml/xmldsig"
+)
+
+// Namespaces, bindings and formats of SAML 2.0
+const (
+	NamespaceAssertion     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceProtocol      = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceMetadata      = "urn:oasis:names:tc:SAML:2.0:metadata"
+	BindingHTTPPost        = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	BindingHTTPRedirect    = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	StatusSuccess          = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	ConfirmationBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	NameIDFormatEmail      = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+)
+
+// ErrInvalidResponse is returned for responses that fail any check
+var ErrInvalidResponse = errors.New("saml: invalid response")
+
+// clockSkew is how far the identity provider's clock may be off from ours
+const clockSkew = time.Minute
+
+// maxResponseSize caps the size of a decoded response
+const maxResponseSize = 256 << 10
+
+// IdentityProvider is the identity provider users sign in at
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL is the endpoint of the HTTP-Redirect binding
+	SSOURL string
+	// Certificates are the certificates the provider signs with. There may be more than one while a key is rotated.
+	Certificates []*x509.Certificate
+}
+
+// ServiceProvider is this app, as known to one identity provider
+type ServiceProvider struct {
+	EntityID string
+	// ACSURL is the assertion consumer service the identity provider posts responses to
+	ACSURL string
+	IdP    IdentityProvider
+}
+
+// Attribute is an attribute of the user, asserted by the identity provider
+type Attribute struct {
+	Name         string
+	FriendlyName string
+	Values       []string
+}
+
+// Assertion is the verified assertion of a response
+type Assertion struct {
+	ID           string
+	NameID       string
+	NameIDFormat string
+	// InResponseTo is the ID of the authentication request the assertion answers
+	InResponseTo string
+	Attributes   []Attribute
+}
+
+// Attribute returns the first value of the first attribute with one of the names. Names are compared to
+// both the name and the friendly name of attributes, ignoring case.
+func (assertion *Assertion) Attribute(names ...string) string {
+	for _, name := range names {
+		for _, attr := range assertion.Attributes {
+			if (strings.EqualFold(attr.Name, name) || strings.EqualFold(attr.FriendlyName, name)) && len(attr.Values) != 0 {
+				return strings.TrimSpace(attr.Values[0])
+			}
+		}
+	}
+	return ""
+}
+
+// ParseCertificates parses the PEM encoded certificates of an identity provider
+func ParseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("saml: unexpected PEM block %s", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("saml: no certificate found")
+	}
+	return certs, nil
+}
+
+// NewRequestID creates a random ID for an authentication request
+func NewRequestID() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	// IDs must not start with a digit
+	return "_" + hex.EncodeToString(buf), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	Issuer                      string       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	AllowCreate bool `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequestURL returns the URL that sends the user to the identity provider with an authentication request.
+// The relay state comes back with the response.
+func (sp *ServiceProvider) AuthnRequestURL(requestID string, relayState string) (string, error) {
+	request, err := xml.Marshal(authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 sp.IdP.SSOURL,
+		AssertionConsumerServiceURL: sp.ACSURL,
+		ProtocolBinding:             BindingHTTPPost,
+		Issuer:                      sp.EntityID,
+		NameIDPolicy:                nameIDPolicy{AllowCreate: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// the redirect binding deflates the request before encoding it
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(request); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	ssoURL, err := url.Parse(sp.IdP.SSOURL)
+	if err != nil {
+		return "", err
+	}
+	query := ssoURL.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	query.Set("RelayState", relayState)
+	ssoURL.RawQuery = query.Encode()
+	return ssoURL.String(), nil
+}
+
+type entityDescriptor struct {
+	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                       `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                       `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                     `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormats              []string                   `xml:"NameIDFormat"`
+	AssertionConsumerServices  []assertionConsumerService `xml:"AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata returns the metadata the identity provider is set up with
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(entityDescriptor{
+		EntityID: sp.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: NamespaceProtocol,
+			NameIDFormats:              []string{NameIDFormatPersistent, NameIDFormatEmail},
+			AssertionConsumerServices: []assertionConsumerService{{
+				Binding:   BindingHTTPPost,
+				Location:  sp.ACSURL,
+				IsDefault: true,
+			}},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// ParseResponse decodes a response posted to the assertion consumer service and returns its assertion, once
+// the signature, issuer, audience, recipient and validity period have been checked. Either the assertion or
+// the whole response must be signed. The caller must check that InResponseTo is a request it sent.
+func (sp *ServiceProvider) ParseResponse(encoded string) (*Assertion, error) {
+	encoded = strings.Join(strings.Fields(encoded), "")
+	if len(encoded) > base64.StdEncoding.EncodedLen(maxResponseSize) {
+		return nil, fmt.Errorf("%w: response is too large", ErrInvalidResponse)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	response, err := xmldsig.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if err := sp.checkResponse(response); err != nil {
+		return nil, err
+	}
+
+	signed, err := sp.verifiedAssertion(response)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the signed bytes are read, whatever else the response holds
+	var assertion xmlAssertion
+	if err := xml.Unmarshal(signed, &assertion); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return sp.checkAssertion(&assertion)
+}
+
+// checkResponse checks the unsigned envelope of a response
+func (sp *ServiceProvider) checkResponse(response *xmldsig.Element) error {
+	if !response.Is(NamespaceProtocol, "Response") {
+		return fmt.Errorf("%w: not a response", ErrInvalidResponse)
+	}
+	if response.Attr("Version") != "2.0" {
+		return fmt.Errorf("%w: unsupported version %q", ErrInvalidResponse, response.Attr("Version"))
+	}
+	if destination := response.Attr("Destination"); destination != "" && destination != sp.ACSURL {
+		return fmt.Errorf("%w: response was sent to %s", ErrInvalidResponse, destination)
+	}
+
+	status, err := response.ChildElement(NamespaceProtocol, "Status")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	statusCode, err := status.ChildElement(NamespaceProtocol, "StatusCode")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if statusCode.Attr("Value") != StatusSuccess {
+		return fmt.Errorf("%w: identity provider responded with %s", ErrInvalidResponse, statusCode.Attr("Value"))
+	}
+
+	for _, issuer := range response.ChildElements(NamespaceAssertion, "Issuer") {
+		if strings.TrimSpace(issuer.Text()) != sp.IdP.EntityID {
+			return fmt.Errorf("%w: issued by %q", ErrInvalidResponse, issuer.Text())
+		}
+	}
+	return nil
+}
+
+// verifiedAssertion returns the canonical form of the response's only assertion, once its signature or the
+// response's signature has been verified
+func (sp *ServiceProvider) verifiedAssertion(response *xmldsig.Element) ([]byte, error) {
+	if len(response.ChildElements(NamespaceAssertion, "EncryptedAssertion")) != 0 {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	assertion, err := response.ChildElement(NamespaceAssertion, "Assertion")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	signed, err := xmldsig.Verify(assertion, sp.IdP.Certificates)
+	if err == nil {
+		return signed, nil
+	}
+	if !errors.Is(err, xmldsig.ErrMissingSignature) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	// the assertion isn't signed, so the whole response must be
+	signed, err = xmldsig.Verify(response, sp.IdP.Certificates)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	signedResponse, err := xmldsig.Parse(signed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	assertion, err = signedResponse.ChildElement(NamespaceAssertion, "Assertion")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return xmldsig.Canonicalize(assertion, nil), nil
+}
+
+type xmlAssertion struct {
+	XMLName    xml.Name       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID         string         `xml:"ID,attr"`
+	Version    string         `xml:"Version,attr"`
+	Issuer     string         `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject    xmlSubject     `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *xmlConditions `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	Statements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+type xmlSubject struct {
+	NameID struct {
+		Format string `xml:"Format,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	Confirmations []struct {
+		Method string `xml:"Method,attr"`
+		Data   *struct {
+			Recipient    string    `xml:"Recipient,attr"`
+			InResponseTo string    `xml:"InResponseTo,attr"`
+			NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+}
+
+type xmlConditions struct {
+	NotBefore            time.Time `xml:"NotBefore,attr"`
+	NotOnOrAfter         time.Time `xml:"NotOnOrAfter,attr"`
+	AudienceRestrictions []struct {
+		Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+}
+
+// checkAssertion checks a verified assertion against the profile. See SAML 2.0 Profiles section 4.1.4.3.
+func (sp *ServiceProvider) checkAssertion(assertion *xmlAssertion) (*Assertion, error) {
+	now := time.Now()
+
+	if assertion.Version != "2.0" {
+		return nil, fmt.Errorf("%w: unsupported assertion version %q", ErrInvalidResponse, assertion.Version)
+	}
+	if strings.TrimSpace(assertion.Issuer) != sp.IdP.EntityID {
+		return nil, fmt.Errorf("%w: assertion issued by %q", ErrInvalidResponse, assertion.Issuer)
+	}
+	nameID := strings.TrimSpace(assertion.Subject.NameID.Value)
+	if nameID == "" {
+		return nil, fmt.Errorf("%w: assertion has no subject", ErrInvalidResponse)
+	}
+
+	conditions := assertion.Conditions
+	if conditions == nil {
+		return nil, fmt.Errorf("%w: assertion has no conditions", ErrInvalidResponse)
+	}
+	if !conditions.NotBefore.IsZero() && now.Add(clockSkew).Before(conditions.NotBefore) {
+		return nil, fmt.Errorf("%w: assertion is not valid yet", ErrInvalidResponse)
+	}
+	if !conditions.NotOnOrAfter.IsZero() && !now.Add(-clockSkew).Before(conditions.NotOnOrAfter) {
+		return nil, fmt.Errorf("%w: assertion has expired", ErrInvalidResponse)
+	}
+	if len(conditions.AudienceRestrictions) == 0 {
+		return nil, fmt.Errorf("%w: assertion has no audience", ErrInvalidResponse)
+	}
+	for _, restriction := range conditions.AudienceRestrictions {
+		if !containsString(restriction.Audiences, sp.EntityID) {
+			return nil, fmt.Errorf("%w: assertion was issued to another service provider", ErrInvalidResponse)
+		}
+	}
+
+	// the assertion must be confirmed as a bearer assertion for a request to this service provider
+	var inResponseTo string
+	for _, confirmation := range assertion.Subject.Confirmations {
+		data := confirmation.Data
+		if confirmation.Method != ConfirmationBearer || data == nil || data.Recipient != sp.ACSURL || data.InResponseTo == "" {
+			continue
+		}
+		if data.NotOnOrAfter.IsZero() || !now.Add(-clockSkew).Before(data.NotOnOrAfter) {
+			continue
+		}
+		inResponseTo = data.InResponseTo
+		break
+	}
+	if inResponseTo == "" {
+		return nil, fmt.Errorf("%w: assertion has no valid bearer confirmation", ErrInvalidResponse)
+	}
+
+	result := &Assertion{
+		ID:           assertion.ID,
+		NameID:       nameID,
+		NameIDFormat: assertion.Subject.NameID.Format,
+		InResponseTo: inResponseTo,
+	}
+	for _, statement := range assertion.Statements {
+		for _, attr := range statement.Attributes {
+			result.Attributes = append(result.Attributes, Attribute{
+				Name:         attr.Name,
+				FriendlyName: attr.FriendlyName,
+				Values:       attr.Values,
+			})
+		}
+	}
+	return result, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
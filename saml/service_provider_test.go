@@ -0,0 +1,481 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/saml/samltest"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com"
+	testEntityID    = "https://travel.agency/api/v1/saml/example/metadata"
+	testACSURL      = "https://travel.agency/api/v1/saml/example/acs"
+)
+
+func newTestServiceProvider(t *testing.T) (*ServiceProvider, *samltest.IdP) {
+	idp, err := samltest.NewIdP(testIdPEntityID)
+	require.NoError(t, err)
+
+	certs, err := ParseCertificates(idp.CertificatePEM())
+	require.NoError(t, err)
+
+	sp := &ServiceProvider{
+		EntityID: testEntityID,
+		ACSURL:   testACSURL,
+		IdP: IdentityProvider{
+			EntityID:     idp.EntityID,
+			SSOURL:       idp.SSOURL,
+			Certificates: certs,
+		},
+	}
+	return sp, idp
+}
+
+func startTestLogin(t *testing.T, sp *ServiceProvider, idp *samltest.IdP) *samltest.AuthnRequest {
+	requestID, err := NewRequestID()
+	require.NoError(t, err)
+
+	authnURL, err := sp.AuthnRequestURL(requestID, "relay-state")
+	require.NoError(t, err)
+
+	request, relayState, err := idp.ParseAuthnRequest(authnURL)
+	require.NoError(t, err)
+	require.Equal(t, requestID, request.ID)
+	require.Equal(t, "relay-state", relayState)
+	require.Equal(t, testACSURL, request.ACSURL)
+	require.Equal(t, testEntityID, request.Issuer)
+	require.Equal(t, idp.SSOURL, request.Destination)
+
+	return request
+}
+
+func randomUser() samltest.User {
+	return samltest.User{
+		NameID: util.RandomString(16),
+		Attributes: map[string]string{
+			"email":     util.RandomEmail(),
+			"firstName": util.RandomName(),
+			"lastName":  util.RandomName(),
+		},
+	}
+}
+
+// otherCertificate returns a certificate that has nothing to do with the identity provider
+func otherCertificate(t *testing.T) *x509.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "another IdP"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// signedAssertion returns the signed assertion of a decoded response
+func signedAssertion(t *testing.T, document string) string {
+	start := strings.Index(document, "<saml:Assertion")
+	end := strings.Index(document, "</saml:Assertion>") + len("</saml:Assertion>")
+	require.True(t, start >= 0 && end > start)
+	return document[start:end]
+}
+
+// editResponse changes an encoded response after it has been signed
+func editResponse(t *testing.T, encoded string, old string, new string) string {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	require.Contains(t, string(data), old)
+	return base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(data), old, new, 1)))
+}
+
+func TestParseResponse(t *testing.T) {
+	sp, idp := newTestServiceProvider(t)
+	user := randomUser()
+
+	testCases := []struct {
+		name           string
+		buildResponse  func(t *testing.T, res *samltest.Response) string
+		checkAssertion func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error)
+	}{
+		{
+			name: "Signed Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.NameID, assertion.NameID)
+				require.Equal(t, NameIDFormatPersistent, assertion.NameIDFormat)
+				require.Equal(t, request.ID, assertion.InResponseTo)
+				require.Equal(t, user.Attributes["email"], assertion.Attribute("mail", "Email"))
+				require.Equal(t, user.Attributes["firstName"], assertion.Attribute("firstName"))
+				require.Empty(t, assertion.Attribute("title"))
+			},
+		},
+		{
+			name: "Signed Response",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.SignAssertion = false
+				res.SignResponse = true
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.NameID, assertion.NameID)
+			},
+		},
+		{
+			name: "Signed Response And Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.SignResponse = true
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "Not Signed",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.SignAssertion = false
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Subject Changed",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return editResponse(t, encoded, user.NameID, "admin")
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			// the signed assertion is hidden in the status, and a forged one takes its place
+			name: "Wrapped Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				require.NoError(t, err)
+				document := string(data)
+				start := strings.Index(document, "<saml:Assertion")
+				end := strings.Index(document, "</saml:Assertion>") + len("</saml:Assertion>")
+				signed := document[start:end]
+
+				forged := strings.Replace(signed, user.NameID, "admin", 1)
+				document = strings.Replace(document, signed, forged, 1)
+				document = strings.Replace(document, "</samlp:Status>", "<samlp:StatusDetail>"+signed+"</samlp:StatusDetail></samlp:Status>", 1)
+				return base64.StdEncoding.EncodeToString([]byte(document))
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Second Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.SignAssertion = false
+				res.SignResponse = true
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return editResponse(t, encoded, "<saml:Assertion ", `<saml:Assertion xmlns:saml="`+NamespaceAssertion+`" ID="forged" Version="2.0"></saml:Assertion><saml:Assertion `)
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			// comments aren't signed, so one can be added, but it mustn't cut the name ID short
+			name: "Comment In Name ID",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.NameID = "alice@example.com.attacker.example"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return editResponse(t, encoded, "alice@example.com.attacker", "alice@example.com<!---->.attacker")
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "alice@example.com.attacker.example", assertion.NameID)
+			},
+		},
+		{
+			// the forged assertion holds the signed one, so a lookup by ID would still find a valid signature
+			name: "Assertion Wrapped In Forged Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				require.NoError(t, err)
+				document := string(data)
+				signed := signedAssertion(t, document)
+
+				forged := strings.Replace(signed, user.NameID, "admin", 1)
+				forged = strings.Replace(forged, `ID="`+res.AssertionID+`"`, `ID="forged"`, 1)
+				forged = strings.Replace(forged, "</saml:Subject>", "</saml:Subject>"+signed, 1)
+				document = strings.Replace(document, signed, forged, 1)
+				return base64.StdEncoding.EncodeToString([]byte(document))
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Unsigned Assertion Next To Signed Assertion",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				require.NoError(t, err)
+				document := string(data)
+				signed := signedAssertion(t, document)
+
+				forged := strings.Replace(signed, user.NameID, "admin", 1)
+				forged = strings.Replace(forged, `ID="`+res.AssertionID+`"`, `ID="forged"`, 1)
+				start := strings.Index(forged, "<ds:Signature")
+				end := strings.Index(forged, "</ds:Signature>") + len("</ds:Signature>")
+				forged = forged[:start] + forged[end:]
+				document = strings.Replace(document, signed, signed+forged, 1)
+				return base64.StdEncoding.EncodeToString([]byte(document))
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			// a forged assertion with the ID of the signed one is hidden in the status
+			name: "Duplicate ID",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				require.NoError(t, err)
+				document := string(data)
+
+				forged := strings.Replace(signedAssertion(t, document), user.NameID, "admin", 1)
+				document = strings.Replace(document, "</samlp:Status>", "<samlp:StatusDetail>"+forged+"</samlp:StatusDetail></samlp:Status>", 1)
+				return base64.StdEncoding.EncodeToString([]byte(document))
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			// the signature is valid, but for the response rather than the assertion it sits in
+			name: "Reference To Another Element",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.SignAssertion = false
+				res.SignResponse = true
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+
+				data, err := base64.StdEncoding.DecodeString(encoded)
+				require.NoError(t, err)
+				document := string(data)
+				start := strings.Index(document, "<ds:Signature")
+				end := strings.Index(document, "</ds:Signature>") + len("</ds:Signature>")
+				signature := document[start:end]
+
+				document = document[:start] + document[end:]
+				document = strings.Replace(document, "<saml:Subject>", signature+"<saml:Subject>", 1)
+				return base64.StdEncoding.EncodeToString([]byte(document))
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Untrusted Certificate",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				sp.IdP.Certificates = []*x509.Certificate{otherCertificate(t)}
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Another Issuer",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.Issuer = "https://attacker.example.com"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Another Audience",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.Audience = "https://another.service.provider"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Another Recipient",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.Recipient = "https://another.service.provider/acs"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Another Destination",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.Destination = "https://another.service.provider/acs"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Expired",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.NotBefore = time.Now().Add(-time.Hour)
+				res.NotOnOrAfter = time.Now().Add(-30 * time.Minute)
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Not Valid Yet",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.NotBefore = time.Now().Add(30 * time.Minute)
+				res.NotOnOrAfter = time.Now().Add(time.Hour)
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Unsolicited",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.InResponseTo = ""
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Failed Status",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				res.Status = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+				encoded, err := idp.Encode(res)
+				require.NoError(t, err)
+				return encoded
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+		{
+			name: "Not Base64",
+			buildResponse: func(t *testing.T, res *samltest.Response) string {
+				return "<samlp:Response/>"
+			},
+			checkAssertion: func(t *testing.T, request *samltest.AuthnRequest, assertion *Assertion, err error) {
+				require.ErrorIs(t, err, ErrInvalidResponse)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			sp.IdP.Certificates = []*x509.Certificate{idp.Certificate}
+
+			request := startTestLogin(t, sp, idp)
+			encoded := tc.buildResponse(t, idp.NewResponse(request, user))
+
+			assertion, err := sp.ParseResponse(encoded)
+			tc.checkAssertion(t, request, assertion, err)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	sp, _ := newTestServiceProvider(t)
+
+	metadata, err := sp.Metadata()
+	require.NoError(t, err)
+
+	var descriptor entityDescriptor
+	require.NoError(t, xml.Unmarshal(metadata, &descriptor))
+	require.Equal(t, testEntityID, descriptor.EntityID)
+	require.True(t, descriptor.SPSSODescriptor.WantAssertionsSigned)
+	require.Len(t, descriptor.SPSSODescriptor.AssertionConsumerServices, 1)
+	require.Equal(t, BindingHTTPPost, descriptor.SPSSODescriptor.AssertionConsumerServices[0].Binding)
+	require.Equal(t, testACSURL, descriptor.SPSSODescriptor.AssertionConsumerServices[0].Location)
+}
+
+func TestParseCertificates(t *testing.T) {
+	_, idp := newTestServiceProvider(t)
+
+	certs, err := ParseCertificates(idp.CertificatePEM() + "\n" + idp.CertificatePEM())
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+
+	_, err = ParseCertificates("not a certificate")
+	require.Error(t, err)
+}
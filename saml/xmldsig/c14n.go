@@ -0,0 +1,126 @@
+package xmldsig
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Canonicalize serializes an element with Exclusive XML Canonicalization 1.0, omitting comments. A namespace
+// is only declared where it's visibly used, unless its prefix is in inclusivePrefixes, where "#default" stands
+// for the default namespace. See https://www.w3.org/TR/xml-exc-c14n/.
+func Canonicalize(el *Element, inclusivePrefixes []string) []byte {
+	var buf bytes.Buffer
+	canonicalize(&buf, el, map[string]string{}, inclusivePrefixes)
+	return buf.Bytes()
+}
+
+// canonicalize writes an element. rendered holds the namespaces declared by the ancestors in the output.
+func canonicalize(buf *bytes.Buffer, el *Element, rendered map[string]string, inclusivePrefixes []string) {
+	// the namespaces the element needs, keyed by prefix
+	used := map[string]bool{el.Prefix: true}
+	for _, attr := range el.Attrs {
+		if attr.Prefix != "" && !attr.isNamespaceDeclaration() {
+			used[attr.Prefix] = true
+		}
+	}
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := el.LookupNamespace(prefix); ok {
+			used[prefix] = true
+		}
+	}
+	delete(used, "xml")
+
+	var declarations []Attr
+	for prefix := range used {
+		namespace, _ := el.LookupNamespace(prefix)
+		renderedNamespace, ok := rendered[prefix]
+		if ok && renderedNamespace == namespace {
+			continue
+		}
+		// an empty default namespace is only declared to undo a declaration further up
+		if !ok && prefix == "" && namespace == "" {
+			continue
+		}
+		declarations = append(declarations, Attr{Prefix: "xmlns", Name: prefix, Value: namespace})
+	}
+	sort.Slice(declarations, func(i, j int) bool {
+		return declarations[i].Name < declarations[j].Name
+	})
+
+	var attrs []Attr
+	for _, attr := range el.Attrs {
+		if !attr.isNamespaceDeclaration() {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ni, nj := attrNamespace(el, attrs[i]), attrNamespace(el, attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Name < attrs[j].Name
+	})
+
+	childRendered := rendered
+	if len(declarations) != 0 {
+		childRendered = make(map[string]string, len(rendered)+len(declarations))
+		for prefix, namespace := range rendered {
+			childRendered[prefix] = namespace
+		}
+	}
+
+	buf.WriteByte('<')
+	buf.WriteString(el.qualifiedName())
+	for _, decl := range declarations {
+		if decl.Name == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + decl.Name + `="`)
+		}
+		buf.WriteString(escapeAttr(decl.Value))
+		buf.WriteByte('"')
+		childRendered[decl.Name] = decl.Value
+	}
+	for _, attr := range attrs {
+		buf.WriteString(" " + qualifiedName(attr.Prefix, attr.Name) + `="`)
+		buf.WriteString(escapeAttr(attr.Value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range el.Children {
+		switch child := child.(type) {
+		case *Element:
+			canonicalize(buf, child, childRendered, inclusivePrefixes)
+		case Text:
+			buf.WriteString(escapeText(string(child)))
+		}
+	}
+
+	buf.WriteString("</" + el.qualifiedName() + ">")
+}
+
+// attrNamespace returns the namespace of an attribute. Attributes without a prefix have no namespace.
+func attrNamespace(el *Element, attr Attr) string {
+	if attr.Prefix == "" {
+		return ""
+	}
+	namespace, _ := el.LookupNamespace(attr.Prefix)
+	return namespace
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,274 @@
+// Package xmldsig verifies and creates enveloped XML signatures, as used by SAML. Only exclusive XML
+// canonicalization, SHA-2 digests and RSA or ECDSA signatures are supported.
+package xmldsig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Namespaces with a fixed prefix
+const (
+	namespaceXML   = "http://www.w3.org/XML/1998/namespace"
+	namespaceXMLNS = "http://www.w3.org/2000/xmlns/"
+)
+
+// Attr is an attribute of an element, with the prefix it was written with. Namespace declarations are
+// attributes too, with the prefix "xmlns", or no prefix and the name "xmlns" for the default namespace.
+type Attr struct {
+	Prefix string
+	Name   string
+	Value  string
+}
+
+func (attr Attr) isNamespaceDeclaration() bool {
+	return attr.Prefix == "xmlns" || (attr.Prefix == "" && attr.Name == "xmlns")
+}
+
+// Text is character data in an element
+type Text string
+
+// Element is an element of a parsed document. Unlike encoding/xml, it keeps the prefixes and namespace
+// declarations as they were written, which canonicalization needs.
+type Element struct {
+	Prefix   string
+	Name     string
+	Attrs    []Attr
+	Children []interface{} // *Element or Text
+	Parent   *Element
+}
+
+// NewElement creates an element, declaring its namespace on it
+func NewElement(prefix string, name string, namespace string) *Element {
+	el := &Element{Prefix: prefix, Name: name}
+	if prefix == "" {
+		el.Attrs = append(el.Attrs, Attr{Name: "xmlns", Value: namespace})
+	} else {
+		el.Attrs = append(el.Attrs, Attr{Prefix: "xmlns", Name: prefix, Value: namespace})
+	}
+	return el
+}
+
+// Parse parses a document and returns its root element. Documents with a DTD are refused.
+func Parse(data []byte) (*Element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *Element
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if root != nil && current == nil {
+				return nil, errors.New("xmldsig: more than one root element")
+			}
+			el := &Element{Prefix: tok.Name.Space, Name: tok.Name.Local, Parent: current}
+			for _, attr := range tok.Attr {
+				el.Attrs = append(el.Attrs, Attr{Prefix: attr.Name.Space, Name: attr.Name.Local, Value: attr.Value})
+			}
+			if err := el.checkNamespaces(); err != nil {
+				return nil, err
+			}
+			if current == nil {
+				root = el
+			} else {
+				current.Children = append(current.Children, el)
+			}
+			current = el
+		case xml.EndElement:
+			// RawToken doesn't match end elements with start elements
+			if current == nil || tok.Name.Space != current.Prefix || tok.Name.Local != current.Name {
+				return nil, fmt.Errorf("xmldsig: unexpected end element %s", qualifiedName(tok.Name.Space, tok.Name.Local))
+			}
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, Text(tok))
+			} else if len(bytes.TrimSpace(tok)) != 0 {
+				return nil, errors.New("xmldsig: text outside the root element")
+			}
+		case xml.Directive:
+			return nil, errors.New("xmldsig: documents with a DTD are not supported")
+		}
+		// comments and processing instructions are dropped, they're never signed
+	}
+
+	if root == nil {
+		return nil, errors.New("xmldsig: document is empty")
+	}
+	if current != nil {
+		return nil, fmt.Errorf("xmldsig: element %s is not closed", current.qualifiedName())
+	}
+	return root, nil
+}
+
+// checkNamespaces makes sure the prefixes of the element and its attributes are declared
+func (el *Element) checkNamespaces() error {
+	if _, ok := el.LookupNamespace(el.Prefix); !ok && el.Prefix != "" {
+		return fmt.Errorf("xmldsig: undeclared namespace prefix %s", el.Prefix)
+	}
+	for _, attr := range el.Attrs {
+		if attr.Prefix == "" || attr.isNamespaceDeclaration() {
+			continue
+		}
+		if _, ok := el.LookupNamespace(attr.Prefix); !ok {
+			return fmt.Errorf("xmldsig: undeclared namespace prefix %s", attr.Prefix)
+		}
+	}
+	return nil
+}
+
+// LookupNamespace returns the namespace a prefix is bound to in the scope of the element. The empty prefix
+// is the default namespace.
+func (el *Element) LookupNamespace(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return namespaceXML, true
+	case "xmlns":
+		return namespaceXMLNS, true
+	}
+
+	for e := el; e != nil; e = e.Parent {
+		for _, attr := range e.Attrs {
+			if (prefix == "" && attr.Prefix == "" && attr.Name == "xmlns") || (attr.Prefix == "xmlns" && attr.Name == prefix) {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+// Namespace returns the namespace of the element
+func (el *Element) Namespace() string {
+	namespace, _ := el.LookupNamespace(el.Prefix)
+	return namespace
+}
+
+// Is checks the namespace and name of the element
+func (el *Element) Is(namespace string, name string) bool {
+	return el.Name == name && el.Namespace() == namespace
+}
+
+// Attr returns the value of an attribute without a prefix
+func (el *Element) Attr(name string) string {
+	for _, attr := range el.Attrs {
+		if attr.Prefix == "" && attr.Name == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// SetAttr sets an attribute without a prefix
+func (el *Element) SetAttr(name string, value string) {
+	for i, attr := range el.Attrs {
+		if attr.Prefix == "" && attr.Name == name {
+			el.Attrs[i].Value = value
+			return
+		}
+	}
+	el.Attrs = append(el.Attrs, Attr{Name: name, Value: value})
+}
+
+// ChildElements returns the child elements with a namespace and name
+func (el *Element) ChildElements(namespace string, name string) []*Element {
+	var children []*Element
+	for _, child := range el.Children {
+		if child, ok := child.(*Element); ok && child.Is(namespace, name) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// ChildElement returns the only child element with a namespace and name. It fails if there is none, or more than one.
+func (el *Element) ChildElement(namespace string, name string) (*Element, error) {
+	children := el.ChildElements(namespace, name)
+	if len(children) != 1 {
+		return nil, fmt.Errorf("xmldsig: expected one %s element in %s, found %d", name, el.Name, len(children))
+	}
+	return children[0], nil
+}
+
+// AddChild appends a child element
+func (el *Element) AddChild(child *Element) {
+	child.Parent = el
+	el.Children = append(el.Children, child)
+}
+
+// InsertChild inserts a child element before the child at index i
+func (el *Element) InsertChild(i int, child *Element) {
+	child.Parent = el
+	el.Children = append(el.Children[:i], append([]interface{}{child}, el.Children[i:]...)...)
+}
+
+// SetText replaces the children of the element with text
+func (el *Element) SetText(text string) {
+	el.Children = []interface{}{Text(text)}
+}
+
+// Text returns the text directly in the element
+func (el *Element) Text() string {
+	var sb strings.Builder
+	for _, child := range el.Children {
+		if text, ok := child.(Text); ok {
+			sb.WriteString(string(text))
+		}
+	}
+	return sb.String()
+}
+
+// root returns the root element of the document the element is in
+func (el *Element) root() *Element {
+	for el.Parent != nil {
+		el = el.Parent
+	}
+	return el
+}
+
+// countID counts the elements with an ID attribute, the element itself included
+func (el *Element) countID(id string) int {
+	count := 0
+	if el.Attr("ID") == id {
+		count++
+	}
+	for _, child := range el.Children {
+		if child, ok := child.(*Element); ok {
+			count += child.countID(id)
+		}
+	}
+	return count
+}
+
+// withoutChild returns a copy of the element without one of its children, for the enveloped signature transform
+func (el *Element) withoutChild(removed *Element) *Element {
+	copied := *el
+	copied.Children = make([]interface{}, 0, len(el.Children))
+	for _, child := range el.Children {
+		if child != interface{}(removed) {
+			copied.Children = append(copied.Children, child)
+		}
+	}
+	return &copied
+}
+
+func (el *Element) qualifiedName() string {
+	return qualifiedName(el.Prefix, el.Name)
+}
+
+func qualifiedName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + ":" + name
+}
@@ -0,0 +1,263 @@
+package xmldsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	// register the hashes signatures can use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Namespace of XML signatures
+const Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+// Algorithms
+const (
+	AlgorithmExclusiveC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	AlgorithmEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	AlgorithmSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	AlgorithmSHA512             = "http://www.w3.org/2001/04/xmlenc#sha512"
+	AlgorithmRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	AlgorithmRSASHA512          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	AlgorithmECDSASHA256        = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+)
+
+var (
+	// ErrMissingSignature is returned when an element isn't signed
+	ErrMissingSignature = errors.New("xmldsig: element is not signed")
+	// ErrInvalidSignature is returned for signatures that fail any check
+	ErrInvalidSignature = errors.New("xmldsig: invalid signature")
+)
+
+var digestMethods = map[string]crypto.Hash{
+	AlgorithmSHA256: crypto.SHA256,
+	AlgorithmSHA512: crypto.SHA512,
+}
+
+// SHA-1 is left out on purpose, as its collisions are practical
+var signatureMethods = map[string]crypto.Hash{
+	AlgorithmRSASHA256:   crypto.SHA256,
+	AlgorithmRSASHA512:   crypto.SHA512,
+	AlgorithmECDSASHA256: crypto.SHA256,
+}
+
+// namespaceExclusiveC14N is the namespace of the InclusiveNamespaces element
+const namespaceExclusiveC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+// Verify checks the enveloped signature of an element against the certificates of the signer. The signature
+// must be a child of the element and refer to it by its ID attribute. Keys found in the signature itself
+// are never trusted.
+//
+// It returns the canonical form of the element without its signature, which is exactly what was signed.
+// Callers should read the signed content from it rather than from the element, so that content smuggled
+// next to the signed element can never be mistaken for signed content.
+func Verify(el *Element, certs []*x509.Certificate) ([]byte, error) {
+	signatures := el.ChildElements(Namespace, "Signature")
+	if len(signatures) == 0 {
+		return nil, ErrMissingSignature
+	}
+	if len(signatures) > 1 {
+		return nil, fmt.Errorf("%w: element has more than one signature", ErrInvalidSignature)
+	}
+	signature := signatures[0]
+
+	signedInfo, err := signature.ChildElement(Namespace, "SignedInfo")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	signedInfoPrefixes, err := canonicalizationMethod(signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	signatureMethod, err := signedInfo.ChildElement(Namespace, "SignatureMethod")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	signatureHash, ok := signatureMethods[signatureMethod.Attr("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported signature method %s", ErrInvalidSignature, signatureMethod.Attr("Algorithm"))
+	}
+
+	reference, err := signedInfo.ChildElement(Namespace, "Reference")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	id := el.Attr("ID")
+	if id == "" || reference.Attr("URI") != "#"+id {
+		return nil, fmt.Errorf("%w: signature does not refer to the element", ErrInvalidSignature)
+	}
+	// another element with the same ID could be taken for the signed one by whoever reads the document next
+	if el.root().countID(id) != 1 {
+		return nil, fmt.Errorf("%w: ID %s is not unique", ErrInvalidSignature, id)
+	}
+	prefixes, err := referenceTransforms(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	digestMethod, err := reference.ChildElement(Namespace, "DigestMethod")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	digestHash, ok := digestMethods[digestMethod.Attr("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported digest method %s", ErrInvalidSignature, digestMethod.Attr("Algorithm"))
+	}
+	digestValue, err := reference.ChildElement(Namespace, "DigestValue")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	expectedDigest, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	signed := Canonicalize(el.withoutChild(signature), prefixes)
+	digest := digestHash.New()
+	digest.Write(signed)
+	if subtle.ConstantTimeCompare(digest.Sum(nil), expectedDigest) != 1 {
+		return nil, fmt.Errorf("%w: digest does not match", ErrInvalidSignature)
+	}
+
+	signatureValue, err := signature.ChildElement(Namespace, "SignatureValue")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	sig, err := decodeBase64(signatureValue.Text())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	hash := signatureHash.New()
+	hash.Write(Canonicalize(signedInfo, signedInfoPrefixes))
+	hashed := hash.Sum(nil)
+	for _, cert := range certs {
+		if verifySignature(cert.PublicKey, signatureHash, hashed, sig) {
+			return signed, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: not signed by a trusted certificate", ErrInvalidSignature)
+}
+
+// canonicalizationMethod checks that SignedInfo is canonicalized with exclusive canonicalization, and returns
+// the inclusive namespace prefixes
+func canonicalizationMethod(signedInfo *Element) ([]string, error) {
+	method, err := signedInfo.ChildElement(Namespace, "CanonicalizationMethod")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if method.Attr("Algorithm") != AlgorithmExclusiveC14N {
+		return nil, fmt.Errorf("%w: unsupported canonicalization method %s", ErrInvalidSignature, method.Attr("Algorithm"))
+	}
+	return inclusivePrefixes(method), nil
+}
+
+// referenceTransforms checks that the reference is an enveloped signature canonicalized with exclusive
+// canonicalization, and returns the inclusive namespace prefixes
+func referenceTransforms(reference *Element) ([]string, error) {
+	transforms, err := reference.ChildElement(Namespace, "Transforms")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var enveloped, canonicalized bool
+	var prefixes []string
+	for _, transform := range transforms.ChildElements(Namespace, "Transform") {
+		switch transform.Attr("Algorithm") {
+		case AlgorithmEnvelopedSignature:
+			enveloped = true
+		case AlgorithmExclusiveC14N:
+			canonicalized = true
+			prefixes = inclusivePrefixes(transform)
+		default:
+			return nil, fmt.Errorf("%w: unsupported transform %s", ErrInvalidSignature, transform.Attr("Algorithm"))
+		}
+	}
+	if !enveloped || !canonicalized {
+		return nil, fmt.Errorf("%w: signature must be enveloped and exclusively canonicalized", ErrInvalidSignature)
+	}
+	return prefixes, nil
+}
+
+func inclusivePrefixes(method *Element) []string {
+	namespaces := method.ChildElements(namespaceExclusiveC14N, "InclusiveNamespaces")
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return strings.Fields(namespaces[0].Attr("PrefixList"))
+}
+
+func verifySignature(publicKey crypto.PublicKey, hash crypto.Hash, hashed []byte, sig []byte) bool {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, hash, hashed, sig) == nil
+	case *ecdsa.PublicKey:
+		// XML signatures hold r and s side by side rather than DER encoded
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		return ecdsa.Verify(publicKey, hashed, r, s)
+	}
+	return false
+}
+
+// decodeBase64 decodes base64 content, which is often wrapped over several lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// Sign signs an element with an enveloped RSA SHA-256 signature, which refers to the element by its ID
+// attribute. It returns the signature without adding it, as where it goes depends on the schema of the element.
+func Sign(el *Element, key *rsa.PrivateKey, cert *x509.Certificate) (*Element, error) {
+	id := el.Attr("ID")
+	if id == "" {
+		return nil, errors.New("xmldsig: element has no ID")
+	}
+
+	digest := crypto.SHA256.New()
+	digest.Write(Canonicalize(el, nil))
+
+	signature := NewElement("ds", "Signature", Namespace)
+	signedInfo := newSignatureElement(signature, "SignedInfo")
+	newSignatureElement(signedInfo, "CanonicalizationMethod").SetAttr("Algorithm", AlgorithmExclusiveC14N)
+	newSignatureElement(signedInfo, "SignatureMethod").SetAttr("Algorithm", AlgorithmRSASHA256)
+	reference := newSignatureElement(signedInfo, "Reference")
+	reference.SetAttr("URI", "#"+id)
+	transforms := newSignatureElement(reference, "Transforms")
+	newSignatureElement(transforms, "Transform").SetAttr("Algorithm", AlgorithmEnvelopedSignature)
+	newSignatureElement(transforms, "Transform").SetAttr("Algorithm", AlgorithmExclusiveC14N)
+	newSignatureElement(reference, "DigestMethod").SetAttr("Algorithm", AlgorithmSHA256)
+	newSignatureElement(reference, "DigestValue").SetText(base64.StdEncoding.EncodeToString(digest.Sum(nil)))
+
+	hash := crypto.SHA256.New()
+	hash.Write(Canonicalize(signedInfo, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	newSignatureElement(signature, "SignatureValue").SetText(base64.StdEncoding.EncodeToString(sig))
+
+	keyInfo := newSignatureElement(signature, "KeyInfo")
+	x509Data := newSignatureElement(keyInfo, "X509Data")
+	newSignatureElement(x509Data, "X509Certificate").SetText(base64.StdEncoding.EncodeToString(cert.Raw))
+
+	return signature, nil
+}
+
+func newSignatureElement(parent *Element, name string) *Element {
+	el := &Element{Prefix: "ds", Name: name}
+	parent.AddChild(el)
+	return el
+}
@@ -0,0 +1,269 @@
+package xmldsig
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		document string
+		// path picks the element to canonicalize by the index of each child element on the way down
+		path              []int
+		inclusivePrefixes []string
+		canonical         string
+	}{
+		{
+			name:      "Attributes Sorted By Namespace",
+			document:  `<a:root xmlns:b="urn:b" xmlns:a="urn:a" z="1" b:y="2" a:x="3"/>`,
+			canonical: `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:x="3" b:y="2"></a:root>`,
+		},
+		{
+			name:      "Unused Namespaces Dropped",
+			document:  `<a:root xmlns:a="urn:a" xmlns:unused="urn:u"><a:child/></a:root>`,
+			canonical: `<a:root xmlns:a="urn:a"><a:child></a:child></a:root>`,
+		},
+		{
+			name:      "Namespaces Of Ancestors Declared",
+			document:  `<a:root xmlns:a="urn:a" xmlns:b="urn:b"><b:child a:attr="1"/></a:root>`,
+			path:      []int{0},
+			canonical: `<b:child xmlns:a="urn:a" xmlns:b="urn:b" a:attr="1"></b:child>`,
+		},
+		{
+			name:      "Redeclared Namespace",
+			document:  `<a:root xmlns:a="urn:a"><a:child xmlns:a="urn:a"><a:inner xmlns:a="urn:other"/></a:child></a:root>`,
+			canonical: `<a:root xmlns:a="urn:a"><a:child><a:inner xmlns:a="urn:other"></a:inner></a:child></a:root>`,
+		},
+		{
+			name:      "Default Namespace Undone",
+			document:  `<root xmlns="urn:x"><inner xmlns=""><deeper/></inner></root>`,
+			canonical: `<root xmlns="urn:x"><inner xmlns=""><deeper></deeper></inner></root>`,
+		},
+		{
+			name:      "Empty Default Namespace Not Declared",
+			document:  `<root xmlns=""><inner/></root>`,
+			canonical: `<root><inner></inner></root>`,
+		},
+		{
+			name:              "Inclusive Prefixes",
+			document:          `<root xmlns:xs="urn:xs" xmlns:xsi="urn:xsi"><value xsi:type="xs:string">text</value></root>`,
+			path:              []int{0},
+			inclusivePrefixes: []string{"xs"},
+			canonical:         `<value xmlns:xs="urn:xs" xmlns:xsi="urn:xsi" xsi:type="xs:string">text</value>`,
+		},
+		{
+			name:      "XML Namespace Never Declared",
+			document:  `<root xml:lang="en"/>`,
+			canonical: `<root xml:lang="en"></root>`,
+		},
+		{
+			name:      "Escaping",
+			document:  `<root a="&lt;&amp;&gt;&quot;&#9;&#10;&#13;">&lt;&amp;&gt;&quot;'&#13;</root>`,
+			canonical: `<root a="&lt;&amp;>&quot;&#x9;&#xA;&#xD;">&lt;&amp;&gt;"'&#xD;</root>`,
+		},
+		{
+			name:      "Comments And Declaration Dropped",
+			document:  "<?xml version=\"1.0\"?>\n<root><!-- comment -->text<?pi data?></root>",
+			canonical: `<root>text</root>`,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			el, err := Parse([]byte(tc.document))
+			require.NoError(t, err)
+
+			for _, index := range tc.path {
+				var children []*Element
+				for _, child := range el.Children {
+					if child, ok := child.(*Element); ok {
+						children = append(children, child)
+					}
+				}
+				el = children[index]
+			}
+
+			require.Equal(t, tc.canonical, string(Canonicalize(el, tc.inclusivePrefixes)))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	documents := []string{
+		``,
+		`<root>`,
+		`<root></other>`,
+		`<a:root/>`,
+		`<root a:attr="1"/>`,
+		`<root/><root/>`,
+		`<!DOCTYPE root [<!ENTITY e "entity">]><root>&e;</root>`,
+	}
+
+	for _, document := range documents {
+		_, err := Parse([]byte(document))
+		require.Error(t, err, document)
+	}
+}
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "xmldsig test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return key, cert
+}
+
+const testDocument = `<p:Response xmlns:p="urn:p" xmlns:a="urn:a" ID="response">` +
+	`<a:Assertion ID="assertion"><a:Issuer>issuer</a:Issuer><a:Subject>alice</a:Subject></a:Assertion>` +
+	`</p:Response>`
+
+// signTestDocument signs the assertion of the test document, and returns the document as it would be sent
+func signTestDocument(t *testing.T, key *rsa.PrivateKey, cert *x509.Certificate) string {
+	root, err := Parse([]byte(testDocument))
+	require.NoError(t, err)
+	assertion := root.Children[0].(*Element)
+
+	signature, err := Sign(assertion, key, cert)
+	require.NoError(t, err)
+	assertion.InsertChild(1, signature)
+
+	return string(Canonicalize(root, nil))
+}
+
+func verifyTestDocument(document string, cert *x509.Certificate) ([]byte, error) {
+	root, err := Parse([]byte(document))
+	if err != nil {
+		return nil, err
+	}
+	return Verify(root.Children[0].(*Element), []*x509.Certificate{cert})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	document := signTestDocument(t, key, cert)
+
+	signed, err := verifyTestDocument(document, cert)
+	require.NoError(t, err)
+	require.Equal(t, `<a:Assertion xmlns:a="urn:a" ID="assertion"><a:Issuer>issuer</a:Issuer><a:Subject>alice</a:Subject></a:Assertion>`, string(signed))
+
+	// even whitespace is signed
+	_, err = verifyTestDocument(strings.Replace(document, "<a:Subject>", "\n<a:Subject>", 1), cert)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// comments aren't signed, but they can't cut the signed text short either
+	signed, err = verifyTestDocument(strings.Replace(document, "alice", "al<!-- comment -->ice", 1), cert)
+	require.NoError(t, err)
+	require.Contains(t, string(signed), "<a:Subject>alice</a:Subject>")
+}
+
+// signResponseIntoAssertion signs the response of the test document, but puts the signature in the assertion
+func signResponseIntoAssertion(t *testing.T, key *rsa.PrivateKey, cert *x509.Certificate) string {
+	root, err := Parse([]byte(testDocument))
+	require.NoError(t, err)
+	assertion := root.Children[0].(*Element)
+
+	signature, err := Sign(root, key, cert)
+	require.NoError(t, err)
+	assertion.InsertChild(1, signature)
+
+	return string(Canonicalize(root, nil))
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	_, otherCert := newTestCertificate(t)
+	otherKey, _ := newTestCertificate(t)
+	document := signTestDocument(t, key, cert)
+
+	testCases := []struct {
+		name     string
+		document string
+		cert     *x509.Certificate
+		err      error
+	}{
+		{
+			name:     "Not Signed",
+			document: testDocument,
+			cert:     cert,
+			err:      ErrMissingSignature,
+		},
+		{
+			name:     "Content Changed",
+			document: strings.Replace(document, "alice", "mallory", 1),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "ID Changed",
+			document: strings.Replace(document, `ID="assertion"`, `ID="other"`, 1),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "Reference To Another Element",
+			document: signResponseIntoAssertion(t, key, cert),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "Duplicate ID",
+			document: strings.Replace(document, "</p:Response>", `<a:Assertion xmlns:a="urn:a" ID="assertion"><a:Subject>mallory</a:Subject></a:Assertion></p:Response>`, 1),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "Untrusted Certificate",
+			document: document,
+			cert:     otherCert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "Signed With Another Key",
+			document: signTestDocument(t, otherKey, cert),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "SHA-1 Signature",
+			document: strings.Replace(document, AlgorithmRSASHA256, "http://www.w3.org/2000/09/xmldsig#rsa-sha1", 1),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+		{
+			name:     "Inclusive Canonicalization",
+			document: strings.Replace(document, `<ds:CanonicalizationMethod Algorithm="`+AlgorithmExclusiveC14N, `<ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315`, 1),
+			cert:     cert,
+			err:      ErrInvalidSignature,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyTestDocument(tc.document, tc.cert)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA signs JWTs with Ed25519 keys
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEd25519 struct{}
+
+// Alg returns the name of the signing method as used in the JWT header
+func (m *signingMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+// Sign signs the header and claims of a JWT with an ed25519.PrivateKey
+func (m *signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	signature := ed25519.Sign(privateKey, []byte(signingString))
+	return jwt.EncodeSegment(signature), nil
+}
+
+// Verify checks the signature of a JWT with an ed25519.PublicKey
+func (m *signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// AsymmetricJWTMaker creates EdDSA signed JWTs that can be verified with a public key
+type AsymmetricJWTMaker struct {
+	keyID      string
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewAsymmetricJWTMaker creates a new AsymmetricJWTMaker
+func NewAsymmetricJWTMaker(keyID string, privateKey ed25519.PrivateKey) (Maker, error) {
+	if len(keyID) == 0 {
+		return nil, fmt.Errorf("key id must not be empty")
+	}
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid key size: must be exactly %d bytes", ed25519.PrivateKeySize)
+	}
+
+	maker := &AsymmetricJWTMaker{
+		keyID:      keyID,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+	return maker, nil
+}
+
+// CreateToken creates a new signed token for a specific user and duration
+func (maker *AsymmetricJWTMaker) CreateToken(userId int64, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(userId, duration, opts...)
+	if err != nil {
+		return "", payload, err
+	}
+
+	jwtToken := jwt.NewWithClaims(SigningMethodEdDSA, payload)
+	jwtToken.Header["kid"] = maker.keyID
+	token, err := jwtToken.SignedString(maker.privateKey)
+	return token, payload, err
+}
+
+// VerifyToken checks if a given token is valid
+func (maker *AsymmetricJWTMaker) VerifyToken(token string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if token.Method != SigningMethodEdDSA {
+			return nil, ErrInvalidToken
+		}
+		if kid, _ := token.Header["kid"].(string); kid != maker.keyID {
+			return nil, ErrInvalidToken
+		}
+		return maker.publicKey, nil
+	}
+
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
+	if err != nil {
+		verr, ok := err.(*jwt.ValidationError)
+		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	payload, ok := jwtToken.Claims.(*Payload)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return payload, nil
+}
+
+// PublicKeys returns the key that verifies tokens created by the maker
+func (maker *AsymmetricJWTMaker) PublicKeys() JSONWebKeySet {
+	return JSONWebKeySet{
+		Keys: []JSONWebKey{newEd25519JSONWebKey(maker.keyID, maker.publicKey)},
+	}
+}
@@ -0,0 +1,129 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func randomEd25519Key(t *testing.T) ed25519.PrivateKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return privateKey
+}
+
+func TestAsymmetricJWTMaker(t *testing.T) {
+	keyID := util.RandomString(8)
+	privateKey := randomEd25519Key(t)
+
+	maker, err := NewAsymmetricJWTMaker(keyID, privateKey)
+	require.NoError(t, err)
+
+	userId := util.RandomInt(1, 100)
+	duration := time.Minute
+
+	issuedAt := time.Now()
+	expiredAt := issuedAt.Add(duration)
+
+	token, payload, err := maker.CreateToken(userId, duration)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+
+	// the token should be verifiable with nothing but the published key
+	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, func(token *jwt.Token) (interface{}, error) {
+		require.Equal(t, "EdDSA", token.Header["alg"])
+		require.Equal(t, keyID, token.Header["kid"])
+
+		keys := maker.(KeySetProvider).PublicKeys().Keys
+		require.Len(t, keys, 1)
+		require.Equal(t, keyID, keys[0].KeyID)
+
+		publicKey, err := base64.RawURLEncoding.DecodeString(keys[0].X)
+		require.NoError(t, err)
+		return ed25519.PublicKey(publicKey), nil
+	})
+	require.NoError(t, err)
+	require.True(t, jwtToken.Valid)
+
+	payload, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, payload)
+
+	require.NotZero(t, payload.ID)
+	require.Equal(t, userId, payload.UserId)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+}
+
+func TestExpiredAsymmetricJWTToken(t *testing.T) {
+	maker, err := NewAsymmetricJWTMaker(util.RandomString(8), randomEd25519Key(t))
+	require.NoError(t, err)
+
+	token, payload, err := maker.CreateToken(util.RandomInt(1, 2), -time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+
+	payload, err = maker.VerifyToken(token)
+	require.Error(t, err)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestAsymmetricJWTTokenWrongKey(t *testing.T) {
+	keyID := util.RandomString(8)
+	maker, err := NewAsymmetricJWTMaker(keyID, randomEd25519Key(t))
+	require.NoError(t, err)
+
+	// same key id, different key
+	forger, err := NewAsymmetricJWTMaker(keyID, randomEd25519Key(t))
+	require.NoError(t, err)
+
+	token, _, err := forger.CreateToken(util.RandomInt(1, 2), time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestAsymmetricJWTTokenHMACConfusion(t *testing.T) {
+	privateKey := randomEd25519Key(t)
+	maker, err := NewAsymmetricJWTMaker("key", privateKey)
+	require.NoError(t, err)
+
+	payload, err := NewPayload(util.RandomInt(1, 2), time.Minute)
+	require.NoError(t, err)
+
+	// sign with HS256 using the public key as the secret
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	jwtToken.Header["kid"] = "key"
+	token, err := jwtToken.SignedString([]byte(privateKey.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+
+	payload, err = maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestParseEd25519PrivateKey(t *testing.T) {
+	privateKey := randomEd25519Key(t)
+
+	key, err := ParseEd25519PrivateKey(base64.StdEncoding.EncodeToString(privateKey.Seed()))
+	require.NoError(t, err)
+	require.Equal(t, privateKey, key)
+
+	key, err = ParseEd25519PrivateKey(base64.StdEncoding.EncodeToString(privateKey))
+	require.NoError(t, err)
+	require.Equal(t, privateKey, key)
+
+	_, err = ParseEd25519PrivateKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"github.com/o1egl/paseto"
+)
+
+// AsymmetricPasetoMaker creates v2.public PASETO tokens that can be verified with a public key
+type AsymmetricPasetoMaker struct {
+	paseto     *paseto.V2
+	keyID      string
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewAsymmetricPasetoMaker creates a new AsymmetricPasetoMaker
+func NewAsymmetricPasetoMaker(keyID string, privateKey ed25519.PrivateKey) (Maker, error) {
+	if len(keyID) == 0 {
+		return nil, fmt.Errorf("key id must not be empty")
+	}
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid key size: must be exactly %d bytes", ed25519.PrivateKeySize)
+	}
+
+	maker := &AsymmetricPasetoMaker{
+		paseto:     paseto.NewV2(),
+		keyID:      keyID,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+	return maker, nil
+}
+
+// CreateToken creates a new signed token for a specific user and duration
+func (maker *AsymmetricPasetoMaker) CreateToken(userId int64, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(userId, duration, opts...)
+	if err != nil {
+		return "", payload, err
+	}
+
+	footer := tokenFooter{KeyID: maker.keyID}
+	token, err := maker.paseto.Sign(maker.privateKey, payload, footer)
+	return token, payload, err
+}
+
+// VerifyToken checks the validity of a token
+func (maker *AsymmetricPasetoMaker) VerifyToken(token string) (*Payload, error) {
+	var footer tokenFooter
+	err := paseto.ParseFooter(token, &footer)
+	if err != nil || footer.KeyID != maker.keyID {
+		return nil, ErrInvalidToken
+	}
+
+	payload := &Payload{}
+	err = maker.paseto.Verify(token, maker.publicKey, payload, nil)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = payload.Valid()
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// PublicKeys returns the key that verifies tokens created by the maker
+func (maker *AsymmetricPasetoMaker) PublicKeys() JSONWebKeySet {
+	return JSONWebKeySet{
+		Keys: []JSONWebKey{newEd25519JSONWebKey(maker.keyID, maker.publicKey)},
+	}
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsymmetricPasetoMaker(t *testing.T) {
+	keyID := util.RandomString(8)
+	maker, err := NewAsymmetricPasetoMaker(keyID, randomEd25519Key(t))
+	require.NoError(t, err)
+
+	userId := util.RandomInt(1, 100)
+	duration := time.Minute
+
+	issuedAt := time.Now()
+	expiredAt := issuedAt.Add(duration)
+
+	token, payload, err := maker.CreateToken(userId, duration)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+	require.Contains(t, token, "v2.public.")
+
+	payload, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, payload)
+
+	require.NotZero(t, payload.ID)
+	require.Equal(t, userId, payload.UserId)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+
+	keys := maker.(KeySetProvider).PublicKeys().Keys
+	require.Len(t, keys, 1)
+	require.Equal(t, keyID, keys[0].KeyID)
+}
+
+func TestExpiredAsymmetricPasetoToken(t *testing.T) {
+	maker, err := NewAsymmetricPasetoMaker(util.RandomString(8), randomEd25519Key(t))
+	require.NoError(t, err)
+
+	token, payload, err := maker.CreateToken(util.RandomInt(1, 2), -time.Minute)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+
+	payload, err = maker.VerifyToken(token)
+	require.Error(t, err)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+func TestAsymmetricPasetoTokenUnknownKeyID(t *testing.T) {
+	privateKey := randomEd25519Key(t)
+	maker, err := NewAsymmetricPasetoMaker("current", privateKey)
+	require.NoError(t, err)
+
+	other, err := NewAsymmetricPasetoMaker("other", privateKey)
+	require.NoError(t, err)
+
+	token, _, err := other.CreateToken(util.RandomInt(1, 2), time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+}
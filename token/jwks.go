@@ -0,0 +1,57 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+)
+
+// JSONWebKey is the public half of a signing key as described in RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JSONWebKeySet is the document served on the JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySetProvider is implemented by makers whose tokens can be verified with public keys
+type KeySetProvider interface {
+	// PublicKeys returns the keys that verify tokens created by the maker
+	PublicKeys() JSONWebKeySet
+}
+
+// newEd25519JSONWebKey describes an Ed25519 public key as a JWK
+func newEd25519JSONWebKey(keyID string, publicKey ed25519.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(publicKey),
+		KeyID:     keyID,
+		Use:       "sig",
+		Algorithm: "EdDSA",
+	}
+}
+
+// ParseEd25519PrivateKey decodes a base64 encoded Ed25519 seed or private key
+func ParseEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode private key: %w", err)
+	}
+
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, fmt.Errorf("invalid key size: must be %d or %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize)
+	}
+}
@@ -11,28 +11,46 @@ import (
 const minSecretKeySize = 32
 
 type JWTMaker struct {
-	secretKey string
+	keyRing *KeyRing
 }
 
 // NewJWTMaker creates a new copy of a JWTMaker
 func NewJWTMaker(secretKey string) (Maker, error) {
-	if len(secretKey) < minSecretKeySize {
-		return nil, fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+	keyRing, err := NewKeyRing(SymmetricKey{ID: DefaultKeyID, Secret: []byte(secretKey)})
+	if err != nil {
+		return nil, err
 	}
-	return &JWTMaker{secretKey}, nil
+	return NewJWTMakerWithKeyRing(keyRing)
+}
+
+// NewJWTMakerWithKeyRing creates a JWTMaker that signs with the active key of a key ring
+// and verifies with any key in it that hasn't been retired
+func NewJWTMakerWithKeyRing(keyRing *KeyRing) (Maker, error) {
+	err := keyRing.validate(func(secret []byte) error {
+		if len(secret) < minSecretKeySize {
+			return fmt.Errorf("invalid key size: must be at least %d characters", minSecretKeySize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &JWTMaker{keyRing}, nil
 }
 
 // CreateToken creates a new token for a specific email
 // We need to implement CreateToken and VerifyToken for JWTMaker since
 // NewJWTMaker returns a Maker type
-func (maker *JWTMaker) CreateToken(userId int64, duration time.Duration) (string, *Payload, error) {
-	payload, err := NewPayload(userId, duration)
+func (maker *JWTMaker) CreateToken(userId int64, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(userId, duration, opts...)
 	if err != nil {
 		return "", payload, err
 	}
 
+	key := maker.keyRing.Active()
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	token, err := jwtToken.SignedString([]byte(maker.secretKey))
+	jwtToken.Header["kid"] = key.ID
+	token, err := jwtToken.SignedString(key.Secret)
 	return token, payload, err
 }
 
@@ -43,7 +61,18 @@ func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
 		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return []byte(maker.secretKey), nil
+
+		// tokens created before key IDs were introduced are signed with the active key
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return maker.keyRing.Active().Secret, nil
+		}
+
+		key, ok := maker.keyRing.Lookup(kid)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key.Secret, nil
 	}
 
 	jwtToken, err := jwt.ParseWithClaims(token, &Payload{}, keyFunc)
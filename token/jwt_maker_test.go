@@ -19,7 +19,10 @@ func TestJWTMaker(t *testing.T) {
 	issuedAt := time.Now()
 	expiredAt := issuedAt.Add(duration)
 
-	token, payload, err := maker.CreateToken(userId, duration)
+	role := util.AgentRole
+	permissions := util.PermissionsForRole(role)
+
+	token, payload, err := maker.CreateToken(userId, duration, WithRole(role, permissions))
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
 	require.NotEmpty(t, payload)
@@ -30,6 +33,10 @@ func TestJWTMaker(t *testing.T) {
 
 	require.NotZero(t, payload.ID)
 	require.Equal(t, userId, payload.UserId)
+	require.Equal(t, role, payload.Role)
+	require.Equal(t, permissions, payload.Permissions)
+	require.True(t, payload.HasPermission(util.PermissionUsersRead))
+	require.False(t, payload.HasPermission(util.PermissionUsersWrite))
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
 	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
 }
@@ -0,0 +1,103 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultKeyID is the ID given to a symmetric key that was configured without one
+const DefaultKeyID = "default"
+
+// SymmetricKey is a secret used to sign or encrypt tokens
+type SymmetricKey struct {
+	ID     string
+	Secret []byte
+	// RetireAt is the time after which the key no longer verifies tokens. A zero value never retires the key.
+	RetireAt time.Time
+}
+
+// retired checks if the key may no longer be used to verify tokens
+func (key SymmetricKey) retired(now time.Time) bool {
+	return !key.RetireAt.IsZero() && now.After(key.RetireAt)
+}
+
+// KeyRing holds the key that new tokens are created with, along with older keys
+// that are only used to verify tokens created before a rotation
+type KeyRing struct {
+	active SymmetricKey
+	keys   map[string]SymmetricKey
+}
+
+// NewKeyRing creates a new KeyRing. The active key never retires.
+func NewKeyRing(active SymmetricKey, verifyOnly ...SymmetricKey) (*KeyRing, error) {
+	if len(active.ID) == 0 {
+		return nil, fmt.Errorf("active key id must not be empty")
+	}
+	active.RetireAt = time.Time{}
+
+	ring := &KeyRing{
+		active: active,
+		keys:   map[string]SymmetricKey{active.ID: active},
+	}
+
+	for _, key := range verifyOnly {
+		if len(key.ID) == 0 {
+			return nil, fmt.Errorf("verification key id must not be empty")
+		}
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		ring.keys[key.ID] = key
+	}
+
+	return ring, nil
+}
+
+// Active returns the key that new tokens are created with
+func (ring *KeyRing) Active() SymmetricKey {
+	return ring.active
+}
+
+// Lookup returns the key with a specific ID, as long as it hasn't been retired
+func (ring *KeyRing) Lookup(id string) (SymmetricKey, bool) {
+	key, ok := ring.keys[id]
+	if !ok || key.retired(time.Now()) {
+		return SymmetricKey{}, false
+	}
+	return key, true
+}
+
+// validate checks every key in the ring against a secret size rule
+func (ring *KeyRing) validate(check func(secret []byte) error) error {
+	for id, key := range ring.keys {
+		if err := check(key.Secret); err != nil {
+			return fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// ParseSymmetricKey parses a verification key written as "id:secret", optionally followed by
+// "@" and the RFC 3339 time at which the key retires, e.g. "2023-01:secret@2023-03-01T00:00:00Z"
+func ParseSymmetricKey(spec string) (SymmetricKey, error) {
+	id, secret, ok := strings.Cut(spec, ":")
+	if !ok || len(id) == 0 || len(secret) == 0 {
+		return SymmetricKey{}, fmt.Errorf("invalid key %q: must be formatted as id:secret", id)
+	}
+
+	key := SymmetricKey{
+		ID:     id,
+		Secret: []byte(secret),
+	}
+
+	if at := strings.LastIndex(secret, "@"); at >= 0 {
+		retireAt, err := time.Parse(time.RFC3339, secret[at+1:])
+		if err == nil {
+			key.Secret = []byte(secret[:at])
+			key.RetireAt = retireAt
+		}
+	}
+
+	return key, nil
+}
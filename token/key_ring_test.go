@@ -0,0 +1,106 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func randomSymmetricKey() SymmetricKey {
+	return SymmetricKey{
+		ID:     util.RandomString(6),
+		Secret: []byte(util.RandomString(32)),
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	makers := map[string]func(keyRing *KeyRing) (Maker, error){
+		"JWT":    NewJWTMakerWithKeyRing,
+		"Paseto": NewPasetoMakerWithKeyRing,
+	}
+
+	for name, newMaker := range makers {
+		newMaker := newMaker
+
+		t.Run(name, func(t *testing.T) {
+			oldKey := randomSymmetricKey()
+			newKey := randomSymmetricKey()
+
+			oldRing, err := NewKeyRing(oldKey)
+			require.NoError(t, err)
+			oldMaker, err := newMaker(oldRing)
+			require.NoError(t, err)
+
+			oldToken, _, err := oldMaker.CreateToken(util.RandomInt(1, 100), time.Minute)
+			require.NoError(t, err)
+
+			// rotate: the new key signs, the old key still verifies
+			rotatedRing, err := NewKeyRing(newKey, oldKey)
+			require.NoError(t, err)
+			rotatedMaker, err := newMaker(rotatedRing)
+			require.NoError(t, err)
+
+			payload, err := rotatedMaker.VerifyToken(oldToken)
+			require.NoError(t, err)
+			require.NotNil(t, payload)
+
+			newToken, _, err := rotatedMaker.CreateToken(util.RandomInt(1, 100), time.Minute)
+			require.NoError(t, err)
+
+			_, err = oldMaker.VerifyToken(newToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+
+			// retire: the old key no longer verifies
+			oldKey.RetireAt = time.Now().Add(-time.Second)
+			retiredRing, err := NewKeyRing(newKey, oldKey)
+			require.NoError(t, err)
+			retiredMaker, err := newMaker(retiredRing)
+			require.NoError(t, err)
+
+			_, err = retiredMaker.VerifyToken(oldToken)
+			require.EqualError(t, err, ErrInvalidToken.Error())
+
+			payload, err = retiredMaker.VerifyToken(newToken)
+			require.NoError(t, err)
+			require.NotNil(t, payload)
+		})
+	}
+}
+
+func TestNewKeyRingDuplicateID(t *testing.T) {
+	key := randomSymmetricKey()
+
+	_, err := NewKeyRing(key, key)
+	require.Error(t, err)
+
+	_, err = NewKeyRing(SymmetricKey{Secret: key.Secret})
+	require.Error(t, err)
+}
+
+func TestNewJWTMakerWithKeyRingShortKey(t *testing.T) {
+	keyRing, err := NewKeyRing(randomSymmetricKey(), SymmetricKey{ID: "old", Secret: []byte("short")})
+	require.NoError(t, err)
+
+	_, err = NewJWTMakerWithKeyRing(keyRing)
+	require.Error(t, err)
+}
+
+func TestParseSymmetricKey(t *testing.T) {
+	secret := util.RandomString(32)
+
+	key, err := ParseSymmetricKey("2023-01:" + secret)
+	require.NoError(t, err)
+	require.Equal(t, "2023-01", key.ID)
+	require.Equal(t, []byte(secret), key.Secret)
+	require.True(t, key.RetireAt.IsZero())
+
+	key, err = ParseSymmetricKey("2023-01:" + secret + "@2023-03-01T00:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, []byte(secret), key.Secret)
+	require.Equal(t, time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), key.RetireAt)
+
+	_, err = ParseSymmetricKey(secret)
+	require.Error(t, err)
+}
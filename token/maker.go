@@ -5,7 +5,7 @@ import "time"
 // Maker is an interface for managing tokens
 type Maker interface {
 	// CreateToken creates a new token for a specific email and duration
-	CreateToken(userId int64, duration time.Duration) (string, *Payload, error)
+	CreateToken(userId int64, duration time.Duration, opts ...PayloadOption) (string, *Payload, error)
 
 	// VerifyToken checks if a token is valid or not
 	VerifyToken(token string) (*Payload, error)
@@ -8,42 +8,80 @@ import (
 	"golang.org/x/crypto/chacha20poly1305"
 )
 
+// tokenFooter is the unencrypted part of a PASETO token
+type tokenFooter struct {
+	KeyID string `json:"kid"`
+}
+
 // PasetoMaker returns a struct for a Paseto token Maker
 type PasetoMaker struct {
-	paseto       *paseto.V2
-	symmetricKey []byte
+	paseto  *paseto.V2
+	keyRing *KeyRing
 }
 
 // NewPasetoMaker creates a new PasetoMaker
 func NewPasetoMaker(symmetricKey string) (Maker, error) {
-	if len(symmetricKey) != chacha20poly1305.KeySize {
-		return nil, fmt.Errorf("invalid key size: must be exactly %d characters", chacha20poly1305.KeySize)
+	keyRing, err := NewKeyRing(SymmetricKey{ID: DefaultKeyID, Secret: []byte(symmetricKey)})
+	if err != nil {
+		return nil, err
+	}
+	return NewPasetoMakerWithKeyRing(keyRing)
+}
+
+// NewPasetoMakerWithKeyRing creates a PasetoMaker that encrypts with the active key of a key ring
+// and decrypts with any key in it that hasn't been retired
+func NewPasetoMakerWithKeyRing(keyRing *KeyRing) (Maker, error) {
+	err := keyRing.validate(func(secret []byte) error {
+		if len(secret) != chacha20poly1305.KeySize {
+			return fmt.Errorf("invalid key size: must be exactly %d characters", chacha20poly1305.KeySize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	maker := &PasetoMaker{
-		paseto:       paseto.NewV2(),
-		symmetricKey: []byte(symmetricKey),
+		paseto:  paseto.NewV2(),
+		keyRing: keyRing,
 	}
 
 	return maker, nil
 }
 
 // CreateToken creates a new token for a specific email and duration
-func (maker *PasetoMaker) CreateToken(userId int64, duration time.Duration) (string, *Payload, error) {
-	payload, err := NewPayload(userId, duration)
+func (maker *PasetoMaker) CreateToken(userId int64, duration time.Duration, opts ...PayloadOption) (string, *Payload, error) {
+	payload, err := NewPayload(userId, duration, opts...)
 	if err != nil {
 		return "", payload, err
 	}
 
-	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	key := maker.keyRing.Active()
+	footer := tokenFooter{KeyID: key.ID}
+	token, err := maker.paseto.Encrypt(key.Secret, payload, footer)
 	return token, payload, err
 }
 
 // VerifyToken checks the validity of a token
 func (maker *PasetoMaker) VerifyToken(token string) (*Payload, error) {
-	payload := &Payload{}
+	var footer tokenFooter
+	err := paseto.ParseFooter(token, &footer)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// tokens created before key IDs were introduced have no footer and use the active key
+	key := maker.keyRing.Active()
+	if footer.KeyID != "" {
+		var ok bool
+		key, ok = maker.keyRing.Lookup(footer.KeyID)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+	}
 
-	err := maker.paseto.Decrypt(token, maker.symmetricKey, payload, nil)
+	payload := &Payload{}
+	err = maker.paseto.Decrypt(token, key.Secret, payload, nil)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
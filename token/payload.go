@@ -13,16 +13,79 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
+// PurposeTwoFactorChallenge marks a token that only proves the password was checked.
+// It must be exchanged, together with a second factor, for an access token.
+const PurposeTwoFactorChallenge = "2fa_challenge"
+
+// PurposeRefresh marks a refresh token. It's only exchanged for new tokens and never grants access by itself.
+const PurposeRefresh = "refresh"
+
+// PurposeMagicLink marks a token emailed to sign a user in. It's exchanged once for a session.
+const PurposeMagicLink = "magic_link"
+
 // Payload contains the token data
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	UserId    int64     `json:"user_id"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
+	ID          uuid.UUID `json:"id"`
+	UserId      int64     `json:"user_id"`
+	SessionID   uuid.UUID `json:"session_id"`
+	Role        string    `json:"role"`
+	Permissions []string  `json:"permissions"`
+	Purpose     string    `json:"purpose,omitempty"`
+	// APIKeyID is set on the payloads of requests made with an API key instead of a token
+	APIKeyID int64 `json:"api_key_id,omitempty"`
+	// ClientID is set on tokens issued to an OAuth client
+	ClientID string `json:"client_id,omitempty"`
+	// ImpersonatorID is set on tokens an admin uses to act as the user, and names the admin
+	ImpersonatorID int64     `json:"impersonator_id,omitempty"`
+	IssuedAt       time.Time `json:"issued_at"`
+	ExpiredAt      time.Time `json:"expired_at"`
+}
+
+// PayloadOption sets an optional field on a new payload
+type PayloadOption func(payload *Payload)
+
+// WithSessionID ties the token to the session it was issued for.
+// Sessions keep the ID they started with across refresh token rotations.
+func WithSessionID(sessionID uuid.UUID) PayloadOption {
+	return func(payload *Payload) {
+		payload.SessionID = sessionID
+	}
+}
+
+// WithRole sets the role of the user and the permissions it grants
+func WithRole(role string, permissions []string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Role = role
+		payload.Permissions = permissions
+	}
+}
+
+// WithPurpose restricts the token to a single use, such as completing a two-factor login.
+// Tokens with a purpose are rejected as access tokens.
+func WithPurpose(purpose string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Purpose = purpose
+	}
+}
+
+// WithClientID marks the token as issued to an OAuth client, which acts for the user with the permissions
+// the user consented to
+func WithClientID(clientID string) PayloadOption {
+	return func(payload *Payload) {
+		payload.ClientID = clientID
+	}
+}
+
+// WithImpersonator marks the token as used by another user, such as a support agent, to act as its user.
+// The token carries the rights of its user, not those of the impersonator.
+func WithImpersonator(impersonatorID int64) PayloadOption {
+	return func(payload *Payload) {
+		payload.ImpersonatorID = impersonatorID
+	}
 }
 
 // NewPayload creates a new token with a specific email and duration
-func NewPayload(userId int64, duration time.Duration) (*Payload, error) {
+func NewPayload(userId int64, duration time.Duration, opts ...PayloadOption) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -35,9 +98,34 @@ func NewPayload(userId int64, duration time.Duration) (*Payload, error) {
 		IssuedAt:  time.Now(),
 		ExpiredAt: time.Now().Add(duration),
 	}
+
+	for _, opt := range opts {
+		opt(payload)
+	}
 	return payload, nil
 }
 
+// HasPermission checks if the token grants a specific permission
+func (payload *Payload) HasPermission(permission string) bool {
+	for _, p := range payload.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDelegated checks if the payload was issued to an API key or an OAuth client. Delegated payloads only grant
+// their permissions, and don't stand in for the user on their own account.
+func (payload *Payload) IsDelegated() bool {
+	return payload.APIKeyID != 0 || payload.ClientID != ""
+}
+
+// IsImpersonated checks if the payload is used by someone acting as its user
+func (payload *Payload) IsImpersonated() bool {
+	return payload.ImpersonatorID != 0
+}
+
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
 	if time.Now().After(payload.ExpiredAt) {
@@ -0,0 +1,134 @@
+package token
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStore keeps track of tokens that must be rejected before they expire
+type RevocationStore interface {
+	// RevokeToken rejects every token carrying an ID, either as its own ID or as its session ID, until expiresAt
+	RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
+
+	// IsTokenRevoked checks if an ID has been revoked
+	IsTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error)
+
+	// RevokeUserTokens rejects every token of a user issued before a specific time, until expiresAt
+	RevokeUserTokens(ctx context.Context, userId int64, issuedBefore time.Time, expiresAt time.Time) error
+
+	// UserTokensRevokedBefore returns the time before which tokens of a user are rejected.
+	// It returns a zero time if none of the user's tokens have been revoked.
+	UserTokensRevokedBefore(ctx context.Context, userId int64) (time.Time, error)
+}
+
+// IsPayloadRevoked checks a payload against every revocation rule of a store
+func IsPayloadRevoked(ctx context.Context, store RevocationStore, payload *Payload) (bool, error) {
+	for _, id := range []uuid.UUID{payload.ID, payload.SessionID} {
+		if id == uuid.Nil {
+			continue
+		}
+
+		revoked, err := store.IsTokenRevoked(ctx, id)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	// revoking the tokens of an impersonator also ends their impersonations
+	userIds := []int64{payload.UserId}
+	if payload.IsImpersonated() {
+		userIds = append(userIds, payload.ImpersonatorID)
+	}
+
+	for _, userId := range userIds {
+		revokedBefore, err := store.UserTokensRevokedBefore(ctx, userId)
+		if err != nil {
+			return false, err
+		}
+		if payload.IssuedAt.Before(revokedBefore) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryUserRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// MemoryRevocationStore keeps revocations in process memory. It suits tests and single instance deployments.
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]time.Time
+	users  map[int64]memoryUserRevocation
+}
+
+// NewMemoryRevocationStore creates a new MemoryRevocationStore
+func NewMemoryRevocationStore() RevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[uuid.UUID]time.Time),
+		users:  make(map[int64]memoryUserRevocation),
+	}
+}
+
+// RevokeToken rejects an ID until expiresAt
+func (store *MemoryRevocationStore) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.removeExpired(time.Now())
+	store.tokens[id] = expiresAt
+	return nil
+}
+
+// IsTokenRevoked checks if an ID has been revoked
+func (store *MemoryRevocationStore) IsTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	expiresAt, ok := store.tokens[id]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// RevokeUserTokens rejects every token of a user issued before a specific time
+func (store *MemoryRevocationStore) RevokeUserTokens(ctx context.Context, userId int64, issuedBefore time.Time, expiresAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.removeExpired(time.Now())
+	store.users[userId] = memoryUserRevocation{
+		issuedBefore: issuedBefore,
+		expiresAt:    expiresAt,
+	}
+	return nil
+}
+
+// UserTokensRevokedBefore returns the time before which tokens of a user are rejected
+func (store *MemoryRevocationStore) UserTokensRevokedBefore(ctx context.Context, userId int64) (time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	revocation, ok := store.users[userId]
+	if !ok || time.Now().After(revocation.expiresAt) {
+		return time.Time{}, nil
+	}
+	return revocation.issuedBefore, nil
+}
+
+// removeExpired drops revocations that no longer matter since the tokens they cover have expired
+func (store *MemoryRevocationStore) removeExpired(now time.Time) {
+	for id, expiresAt := range store.tokens {
+		if now.After(expiresAt) {
+			delete(store.tokens, id)
+		}
+	}
+	for userId, revocation := range store.users {
+		if now.After(revocation.expiresAt) {
+			delete(store.users, userId)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisRevocationStore keeps revocations in Redis so that every API instance sees them
+type RedisRevocationStore struct {
+	client *redis.Client
+}
+
+// NewRedisRevocationStore creates a new RedisRevocationStore
+func NewRedisRevocationStore(client *redis.Client) RevocationStore {
+	return &RedisRevocationStore{client}
+}
+
+func revokedTokenKey(id uuid.UUID) string {
+	return fmt.Sprintf("revoked-token:%s", id)
+}
+
+func revokedUserKey(userId int64) string {
+	return fmt.Sprintf("revoked-user:%d", userId)
+}
+
+// RevokeToken rejects an ID until expiresAt
+func (store *RedisRevocationStore) RevokeToken(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return store.client.Set(ctx, revokedTokenKey(id), 1, ttl).Err()
+}
+
+// IsTokenRevoked checks if an ID has been revoked
+func (store *RedisRevocationStore) IsTokenRevoked(ctx context.Context, id uuid.UUID) (bool, error) {
+	count, err := store.client.Exists(ctx, revokedTokenKey(id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RevokeUserTokens rejects every token of a user issued before a specific time
+func (store *RedisRevocationStore) RevokeUserTokens(ctx context.Context, userId int64, issuedBefore time.Time, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return store.client.Set(ctx, revokedUserKey(userId), issuedBefore.UnixNano(), ttl).Err()
+}
+
+// UserTokensRevokedBefore returns the time before which tokens of a user are rejected
+func (store *RedisRevocationStore) UserTokensRevokedBefore(ctx context.Context, userId int64) (time.Time, error) {
+	issuedBefore, err := store.client.Get(ctx, revokedUserKey(userId)).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Unix(0, issuedBefore), nil
+}
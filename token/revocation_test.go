@@ -0,0 +1,78 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sajitron/travel-agency/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	payload, err := NewPayload(util.RandomInt(1, 100), time.Minute, WithSessionID(uuid.New()))
+	require.NoError(t, err)
+
+	revoked, err := IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	err = store.RevokeToken(ctx, payload.SessionID, payload.ExpiredAt)
+	require.NoError(t, err)
+
+	revoked, err = IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	// revocations lapse once the tokens they cover have expired
+	err = store.RevokeToken(ctx, payload.SessionID, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	revoked, err = IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+func TestRevokeImpersonatorTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	impersonatorId := util.RandomInt(101, 200)
+	payload, err := NewPayload(util.RandomInt(1, 100), time.Minute, WithImpersonator(impersonatorId))
+	require.NoError(t, err)
+	require.True(t, payload.IsImpersonated())
+
+	// the tokens of the impersonator cover the tokens they act as someone else with
+	err = store.RevokeUserTokens(ctx, impersonatorId, payload.IssuedAt.Add(time.Second), payload.ExpiredAt)
+	require.NoError(t, err)
+
+	revoked, err := IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+}
+
+func TestMemoryRevocationStoreUserTokens(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+
+	payload, err := NewPayload(util.RandomInt(1, 100), time.Minute)
+	require.NoError(t, err)
+
+	err = store.RevokeUserTokens(ctx, payload.UserId, payload.IssuedAt.Add(-time.Second), payload.ExpiredAt)
+	require.NoError(t, err)
+
+	revoked, err := IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	err = store.RevokeUserTokens(ctx, payload.UserId, payload.IssuedAt.Add(time.Second), payload.ExpiredAt)
+	require.NoError(t, err)
+
+	revoked, err = IsPayloadRevoked(ctx, store, payload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// An API key looks like ta_<prefix>_<secret>. The prefix is stored in the clear to find the key
+// and tell keys apart, the whole key is only stored as a hash.
+const (
+	apiKeyTag          = "ta_"
+	apiKeyPrefixBytes  = 6
+	apiKeySecretBytes  = 32
+	apiKeyPrefixLength = len(apiKeyTag) + apiKeyPrefixBytes*2
+)
+
+// ErrInvalidAPIKey is returned for a key that isn't in the API key format
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// GenerateAPIKey returns a new random API key, along with the prefix it is identified by and the hash it is stored as
+func GenerateAPIKey() (key string, prefix string, keyHash string, err error) {
+	prefixBytes := make([]byte, apiKeyPrefixBytes)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyTag + hex.EncodeToString(prefixBytes)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// APIKeyPrefix returns the prefix an API key is identified by
+func APIKeyPrefix(key string) (string, error) {
+	if len(key) <= apiKeyPrefixLength+1 || !strings.HasPrefix(key, apiKeyTag) || key[apiKeyPrefixLength] != '_' {
+		return "", ErrInvalidAPIKey
+	}
+	return key[:apiKeyPrefixLength], nil
+}
+
+// HashAPIKey returns the hash an API key is stored as. Keys are long and random, so a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, keyHash, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.Equal(t, HashAPIKey(key), keyHash)
+
+	gotPrefix, err := APIKeyPrefix(key)
+	require.NoError(t, err)
+	require.Equal(t, prefix, gotPrefix)
+
+	otherKey, otherPrefix, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.NotEqual(t, key, otherKey)
+	require.NotEqual(t, prefix, otherPrefix)
+}
+
+func TestAPIKeyPrefixInvalid(t *testing.T) {
+	key, prefix, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+
+	invalidKeys := []string{
+		"",
+		prefix,
+		prefix + "_",
+		"xx" + key[2:],
+		prefix + "-" + key[len(prefix)+1:],
+	}
+	for _, invalidKey := range invalidKeys {
+		_, err := APIKeyPrefix(invalidKey)
+		require.ErrorIs(t, err, ErrInvalidAPIKey, invalidKey)
+	}
+}
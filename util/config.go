@@ -7,16 +7,63 @@ import (
 )
 
 type Config struct {
-	HTTPServerAddress    string        `mapstructure:"HTTP_SERVER_ADDRESS"`
-	Environment          string        `mapstructure:"ENVIRONMENT"`
-	DBDriver             string        `mapstructure:"DB_DRIVER"`
-	DBSource             string        `mapstructure:"DB_SOURCE"`
-	MigrationURL         string        `mapstructure:"MIGRATION_URL"`
-	GRPCServerAddress    string        `mapstructure:"GRPC_SERVER_ADDRESS"`
-	RedisAddress         string        `mapstructure:"REDIS_ADDRESS"`
-	TokenSymmetricKey    string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
-	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	HTTPServerAddress     string        `mapstructure:"HTTP_SERVER_ADDRESS"`
+	TrustedProxies        []string      `mapstructure:"TRUSTED_PROXIES"`
+	Environment           string        `mapstructure:"ENVIRONMENT"`
+	DBDriver              string        `mapstructure:"DB_DRIVER"`
+	DBSource              string        `mapstructure:"DB_SOURCE"`
+	MigrationURL          string        `mapstructure:"MIGRATION_URL"`
+	GRPCServerAddress     string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	RedisAddress          string        `mapstructure:"REDIS_ADDRESS"`
+	RedisPassword         string        `mapstructure:"REDIS_PASSWORD"`
+	RedisDB               int           `mapstructure:"REDIS_DB"`
+	RedisTLS              bool          `mapstructure:"REDIS_TLS"`
+	RedisPoolSize         int           `mapstructure:"REDIS_POOL_SIZE"`
+	TokenType             string        `mapstructure:"TOKEN_TYPE"`
+	TokenSymmetricKey     string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
+	TokenSymmetricKeyID   string        `mapstructure:"TOKEN_SYMMETRIC_KEY_ID"`
+	TokenVerifyKeys       []string      `mapstructure:"TOKEN_VERIFY_KEYS"`
+	TokenPrivateKey       string        `mapstructure:"TOKEN_PRIVATE_KEY"`
+	TokenKeyID            string        `mapstructure:"TOKEN_KEY_ID"`
+	AccessTokenDuration   time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration  time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	PasswordHashAlgorithm string        `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost            int           `mapstructure:"BCRYPT_COST"`
+	Argon2Memory          uint32        `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations      uint32        `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     uint8         `mapstructure:"ARGON2_PARALLELISM"`
+	HashConcurrency       int           `mapstructure:"HASH_CONCURRENCY"`
+	HashQueueTimeout      time.Duration `mapstructure:"HASH_QUEUE_TIMEOUT"`
+	PasswordMinLength     int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int           `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordMinClasses    int           `mapstructure:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	PasswordAllowPersonal bool          `mapstructure:"PASSWORD_ALLOW_PERSONAL_INFO"`
+	BreachedPasswordsFile string        `mapstructure:"BREACHED_PASSWORDS_FILE"`
+	TOTPEncryptionKey     string        `mapstructure:"TOTP_ENCRYPTION_KEY"`
+	TOTPIssuer            string        `mapstructure:"TOTP_ISSUER"`
+	TwoFactorDuration     time.Duration `mapstructure:"TWO_FACTOR_DURATION"`
+	AppBaseURL            string        `mapstructure:"APP_BASE_URL"`
+	EmailTokenDuration    time.Duration `mapstructure:"EMAIL_TOKEN_DURATION"`
+	PasswordResetDuration time.Duration `mapstructure:"PASSWORD_RESET_DURATION"`
+	MagicLinkDuration     time.Duration `mapstructure:"MAGIC_LINK_DURATION"`
+	ImpersonationDuration time.Duration `mapstructure:"IMPERSONATION_DURATION"`
+	MailerType            string        `mapstructure:"MAILER_TYPE"`
+	MailerFrom            string        `mapstructure:"MAILER_FROM"`
+	MailerFileDir         string        `mapstructure:"MAILER_FILE_DIR"`
+	SMTPHost              string        `mapstructure:"SMTP_HOST"`
+	SMTPPort              int           `mapstructure:"SMTP_PORT"`
+	SMTPUsername          string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword          string        `mapstructure:"SMTP_PASSWORD"`
+	OIDCIssuer            string        `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID          string        `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret      string        `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL       string        `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes            []string      `mapstructure:"OIDC_SCOPES"`
+	SAMLBaseURL           string        `mapstructure:"SAML_BASE_URL"`
+	WebAuthnRPID          string        `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName        string        `mapstructure:"WEBAUTHN_RP_NAME"`
+	WebAuthnOrigins       []string      `mapstructure:"WEBAUTHN_ORIGINS"`
+	IntrospectionClients  []string      `mapstructure:"INTROSPECTION_CLIENT_IDS"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -1,21 +1,225 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the bcrypt hash of a given password
+// Supported password hashing algorithms
+const (
+	PasswordAlgorithmArgon2id = "argon2id"
+	PasswordAlgorithmBcrypt   = "bcrypt"
+)
+
+// bcryptMaxPasswordLength is the number of bytes bcrypt reads. It ignores anything after them.
+const bcryptMaxPasswordLength = 72
+
+var (
+	// ErrMismatchedPassword is returned when a password doesn't match its hash
+	ErrMismatchedPassword = errors.New("password does not match")
+	// ErrUnsupportedHash is returned for a hash in an unknown format
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	// ErrPasswordTooLong is returned when bcrypt would cut a password short
+	ErrPasswordTooLong = fmt.Errorf("password is longer than %d bytes", bcryptMaxPasswordLength)
+)
+
+// Argon2idParams are the cost parameters of an argon2id hash
+type Argon2idParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHashParams picks the algorithm new passwords are hashed with, along with its cost
+type PasswordHashParams struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2id   Argon2idParams
+}
+
+// DefaultPasswordHashParams hashes with argon2id, using the parameters recommended by OWASP
+var DefaultPasswordHashParams = PasswordHashParams{
+	Algorithm:  PasswordAlgorithmArgon2id,
+	BcryptCost: bcrypt.DefaultCost,
+	Argon2id: Argon2idParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+}
+
+// Validate checks the parameters of the configured algorithm
+func (params PasswordHashParams) Validate() error {
+	switch params.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		if params.Argon2id.Memory == 0 || params.Argon2id.Iterations == 0 || params.Argon2id.Parallelism == 0 {
+			return fmt.Errorf("argon2id memory, iterations and parallelism must be positive")
+		}
+		if params.Argon2id.SaltLength < 8 || params.Argon2id.KeyLength < 16 {
+			return fmt.Errorf("argon2id salts must be at least 8 bytes and keys at least 16 bytes")
+		}
+	case PasswordAlgorithmBcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unsupported password hashing algorithm %s", params.Algorithm)
+	}
+	return nil
+}
+
+// HashPassword returns the hash of a given password, using DefaultPasswordHashParams
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("unable to hash password %w", err)
+	return HashPasswordWithParams(password, DefaultPasswordHashParams)
+}
+
+// HashPasswordWithParams returns the hash of a given password as a PHC string,
+// e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>. bcrypt hashes keep their own $2a$ format.
+func HashPasswordWithParams(password string, params PasswordHashParams) (string, error) {
+	switch params.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		return hashArgon2id(password, params.Argon2id)
+	case PasswordAlgorithmBcrypt:
+		if len(password) > bcryptMaxPasswordLength {
+			return "", ErrPasswordTooLong
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), params.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("unable to hash password %w", err)
+		}
+		return string(hashedPassword), nil
 	}
-	return string(hashedPassword), nil
+	return "", fmt.Errorf("unsupported password hashing algorithm %s", params.Algorithm)
 }
 
-// ValidatePassword checks if a given password is correct
+// ValidatePassword checks if a given password is correct. It accepts hashes of every supported algorithm,
+// whatever the parameters new passwords are hashed with.
 func ValidatePassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	switch passwordHashAlgorithm(hashedPassword) {
+	case PasswordAlgorithmArgon2id:
+		hash, err := parseArgon2idHash(hashedPassword)
+		if err != nil {
+			return err
+		}
+
+		key := argon2.IDKey([]byte(password), hash.salt, hash.params.Iterations, hash.params.Memory, hash.params.Parallelism, hash.params.KeyLength)
+		if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+			return ErrMismatchedPassword
+		}
+		return nil
+	case PasswordAlgorithmBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrMismatchedPassword
+		}
+		return err
+	}
+	return ErrUnsupportedHash
+}
+
+// NeedsRehash checks if a hash was made with another algorithm or other parameters than params,
+// in which case the password should be hashed again the next time it's known
+func NeedsRehash(hashedPassword string, params PasswordHashParams) bool {
+	if passwordHashAlgorithm(hashedPassword) != params.Algorithm {
+		return true
+	}
+
+	switch params.Algorithm {
+	case PasswordAlgorithmArgon2id:
+		hash, err := parseArgon2idHash(hashedPassword)
+		if err != nil {
+			return true
+		}
+		return hash.params.Memory != params.Argon2id.Memory ||
+			hash.params.Iterations != params.Argon2id.Iterations ||
+			hash.params.Parallelism != params.Argon2id.Parallelism ||
+			hash.params.KeyLength != params.Argon2id.KeyLength
+	case PasswordAlgorithmBcrypt:
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		return err != nil || cost != params.BcryptCost
+	}
+	return true
+}
+
+// passwordHashAlgorithm returns the algorithm of a hash from its prefix
+func passwordHashAlgorithm(hashedPassword string) string {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		return PasswordAlgorithmArgon2id
+	case strings.HasPrefix(hashedPassword, "$2a$"),
+		strings.HasPrefix(hashedPassword, "$2b$"),
+		strings.HasPrefix(hashedPassword, "$2y$"):
+		return PasswordAlgorithmBcrypt
+	}
+	return ""
+}
+
+type argon2idHash struct {
+	params Argon2idParams
+	salt   []byte
+	key    []byte
+}
+
+func hashArgon2id(password string, params Argon2idParams) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("unable to hash password %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func parseArgon2idHash(hashedPassword string) (argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=19456,t=2,p=1", salt, key
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 {
+		return argon2idHash{}, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idHash{}, ErrUnsupportedHash
+	}
+
+	var hash argon2idHash
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Iterations, &hash.params.Parallelism)
+	if err != nil {
+		return argon2idHash{}, ErrUnsupportedHash
+	}
+
+	hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2idHash{}, ErrUnsupportedHash
+	}
+
+	hash.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash.key) == 0 {
+		return argon2idHash{}, ErrUnsupportedHash
+	}
+
+	hash.params.SaltLength = uint32(len(hash.salt))
+	hash.params.KeyLength = uint32(len(hash.key))
+	return hash, nil
 }
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultHashQueueTimeout is how long a password waits for a free hashing slot unless configured otherwise
+const DefaultHashQueueTimeout = time.Second
+
+// ErrHasherBusy is returned when no hashing slot frees up before the queue timeout
+var ErrHasherBusy = errors.New("too many passwords are being hashed, try again later")
+
+// PasswordHasher hashes passwords on a bounded number of goroutines at a time, so that a burst of logins
+// or sign ups queues up instead of taking every core away from the rest of the API
+type PasswordHasher struct {
+	params       PasswordHashParams
+	queueTimeout time.Duration
+	slots        chan struct{}
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// NewPasswordHasher creates a new PasswordHasher that hashes new passwords with params. A zero concurrency
+// allows one hash per CPU and a zero queue timeout uses DefaultHashQueueTimeout.
+func NewPasswordHasher(params PasswordHashParams, concurrency int, queueTimeout time.Duration) (*PasswordHasher, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	if concurrency == 0 {
+		concurrency = runtime.NumCPU()
+	}
+	if concurrency < 0 {
+		return nil, fmt.Errorf("hashing concurrency must be positive")
+	}
+
+	if queueTimeout == 0 {
+		queueTimeout = DefaultHashQueueTimeout
+	}
+
+	return &PasswordHasher{
+		params:       params,
+		queueTimeout: queueTimeout,
+		slots:        make(chan struct{}, concurrency),
+	}, nil
+}
+
+// acquire waits for a free hashing slot. The slot must be handed back with release.
+func (hasher *PasswordHasher) acquire(ctx context.Context) error {
+	timer := time.NewTimer(hasher.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case hasher.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrHasherBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (hasher *PasswordHasher) release() {
+	<-hasher.slots
+}
+
+// Hash returns the hash of a given password
+func (hasher *PasswordHasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := hasher.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer hasher.release()
+
+	return HashPasswordWithParams(password, hasher.params)
+}
+
+// Validate checks if a given password is correct. It returns ErrHasherBusy rather than a mismatch
+// when the password couldn't be checked, so callers must not count that as a wrong password.
+func (hasher *PasswordHasher) Validate(ctx context.Context, password string, hashedPassword string) error {
+	if err := hasher.acquire(ctx); err != nil {
+		return err
+	}
+	defer hasher.release()
+
+	return ValidatePassword(password, hashedPassword)
+}
+
+// NeedsRehash checks if a hash was made with another algorithm or other parameters than new passwords are
+func (hasher *PasswordHasher) NeedsRehash(hashedPassword string) bool {
+	return NeedsRehash(hashedPassword, hasher.params)
+}
+
+// CompareDummy checks a password against a hash no password matches. Checking it for unknown users
+// makes rejecting them take about as long as rejecting a wrong password.
+func (hasher *PasswordHasher) CompareDummy(ctx context.Context, password string) error {
+	if err := hasher.acquire(ctx); err != nil {
+		return err
+	}
+	defer hasher.release()
+
+	hasher.dummyHashOnce.Do(func() {
+		hasher.dummyHash, _ = HashPasswordWithParams(RandomString(32), hasher.params)
+	})
+	_ = ValidatePassword(password, hasher.dummyHash)
+	return nil
+}
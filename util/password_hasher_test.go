@@ -0,0 +1,173 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestPasswordHasher(t *testing.T, concurrency int, queueTimeout time.Duration) *PasswordHasher {
+	hasher, err := NewPasswordHasher(testBcryptParams, concurrency, queueTimeout)
+	require.NoError(t, err)
+	return hasher
+}
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := newTestPasswordHasher(t, 1, time.Second)
+	password := RandomString(12)
+
+	hashedPassword, err := hasher.Hash(context.Background(), password)
+	require.NoError(t, err)
+	require.NotEqual(t, password, hashedPassword)
+
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	require.NoError(t, err)
+	require.Equal(t, bcrypt.MinCost, cost)
+
+	err = hasher.Validate(context.Background(), password, hashedPassword)
+	require.NoError(t, err)
+
+	err = hasher.Validate(context.Background(), RandomString(8), hashedPassword)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	// hashes made elsewhere are checked with their own algorithm and parameters
+	defaultHash, err := HashPassword(password)
+	require.NoError(t, err)
+	err = hasher.Validate(context.Background(), password, defaultHash)
+	require.NoError(t, err)
+
+	require.False(t, hasher.NeedsRehash(hashedPassword))
+	require.True(t, hasher.NeedsRehash(defaultHash))
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	hasher, err := NewPasswordHasher(DefaultPasswordHashParams, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, DefaultHashQueueTimeout, hasher.queueTimeout)
+	require.Positive(t, cap(hasher.slots))
+
+	invalidParams := testBcryptParams
+	invalidParams.BcryptCost = bcrypt.MinCost - 1
+	_, err = NewPasswordHasher(invalidParams, 1, time.Second)
+	require.Error(t, err)
+
+	_, err = NewPasswordHasher(testBcryptParams, -1, time.Second)
+	require.Error(t, err)
+}
+
+func TestPasswordHasherBusy(t *testing.T) {
+	hasher := newTestPasswordHasher(t, 1, 50*time.Millisecond)
+
+	// take the only slot
+	err := hasher.acquire(context.Background())
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = hasher.Hash(context.Background(), RandomString(12))
+	require.ErrorIs(t, err, ErrHasherBusy)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	err = hasher.Validate(context.Background(), RandomString(12), "")
+	require.ErrorIs(t, err, ErrHasherBusy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = hasher.CompareDummy(ctx, RandomString(12))
+	require.ErrorIs(t, err, context.Canceled)
+
+	// once the slot is free again the queue moves on
+	hasher.release()
+	_, err = hasher.Hash(context.Background(), RandomString(12))
+	require.NoError(t, err)
+}
+
+func TestPasswordHasherCompareDummy(t *testing.T) {
+	hasher, err := NewPasswordHasher(DefaultPasswordHashParams, 1, time.Second)
+	require.NoError(t, err)
+
+	password := RandomString(9)
+	hashedPassword, err := hasher.Hash(context.Background(), password)
+	require.NoError(t, err)
+
+	// the dummy comparison has to cost about as much as a real one
+	start := time.Now()
+	_ = hasher.Validate(context.Background(), RandomString(9), hashedPassword)
+	realDuration := time.Since(start)
+
+	err = hasher.CompareDummy(context.Background(), password) // hashes the dummy password on first use
+	require.NoError(t, err)
+	start = time.Now()
+	err = hasher.CompareDummy(context.Background(), password)
+	require.NoError(t, err)
+	dummyDuration := time.Since(start)
+
+	require.Greater(t, dummyDuration, realDuration/4)
+}
+
+func benchmarkHash(b *testing.B, params PasswordHashParams) {
+	hasher, err := NewPasswordHasher(params, 1, time.Minute)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := hasher.Hash(context.Background(), "benchmark-password")
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkPasswordHasherCost shows how long a single hash takes at each cost, to pick BCRYPT_COST.
+// Run it with `go test ./util -run XXX -bench PasswordHasher`.
+func BenchmarkPasswordHasherCost(b *testing.B) {
+	for cost := bcrypt.DefaultCost; cost <= bcrypt.DefaultCost+3; cost++ {
+		params := PasswordHashParams{
+			Algorithm:  PasswordAlgorithmBcrypt,
+			BcryptCost: cost,
+		}
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			benchmarkHash(b, params)
+		})
+	}
+}
+
+// BenchmarkPasswordHasherArgon2id shows how long a single hash takes with different argon2id parameters,
+// to pick ARGON2_MEMORY and ARGON2_ITERATIONS
+func BenchmarkPasswordHasherArgon2id(b *testing.B) {
+	for _, memory := range []uint32{19 * 1024, 46 * 1024, 64 * 1024} {
+		for _, iterations := range []uint32{1, 2, 3} {
+			params := DefaultPasswordHashParams
+			params.Argon2id.Memory = memory
+			params.Argon2id.Iterations = iterations
+
+			b.Run(fmt.Sprintf("m=%d,t=%d", memory, iterations), func(b *testing.B) {
+				benchmarkHash(b, params)
+			})
+		}
+	}
+}
+
+// BenchmarkPasswordHasherConcurrency shows the throughput of a burst of logins at each concurrency limit,
+// to pick HASH_CONCURRENCY. Throughput stops growing once the limit passes the number of cores.
+func BenchmarkPasswordHasherConcurrency(b *testing.B) {
+	hashedPassword, err := HashPassword("benchmark-password")
+	require.NoError(b, err)
+
+	for _, concurrency := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			hasher, err := NewPasswordHasher(DefaultPasswordHashParams, concurrency, time.Minute)
+			require.NoError(b, err)
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					err := hasher.Validate(context.Background(), "benchmark-password", hashedPassword)
+					require.NoError(b, err)
+				}
+			})
+		})
+	}
+}
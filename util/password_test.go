@@ -1,12 +1,18 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var testBcryptParams = PasswordHashParams{
+	Algorithm:  PasswordAlgorithmBcrypt,
+	BcryptCost: bcrypt.MinCost,
+}
+
 func TestHashPassword(t *testing.T) {
 	password := RandomString(12)
 
@@ -14,13 +20,14 @@ func TestHashPassword(t *testing.T) {
 	require.NoError(t, err)
 	require.NotEmpty(t, hashedPassword)
 	require.NotEqual(t, password, hashedPassword)
+	require.True(t, strings.HasPrefix(hashedPassword, "$argon2id$v=19$m=19456,t=2,p=1$"))
 
 	err = ValidatePassword(password, hashedPassword)
 	require.NoError(t, err)
 
 	wrongPassword := RandomString(8)
 	err = ValidatePassword(wrongPassword, hashedPassword)
-	require.EqualError(t, err, bcrypt.ErrMismatchedHashAndPassword.Error())
+	require.EqualError(t, err, ErrMismatchedPassword.Error())
 
 	hashedWrongPassword, err := HashPassword(wrongPassword)
 	require.NoError(t, err)
@@ -39,3 +46,97 @@ func TestWrongPassword(t *testing.T) {
 	err = ValidatePassword(password, hashedPassword)
 	require.Error(t, err)
 }
+
+func TestBcryptPassword(t *testing.T) {
+	password := RandomString(12)
+
+	hashedPassword, err := HashPasswordWithParams(password, testBcryptParams)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashedPassword, "$2a$04$"))
+
+	err = ValidatePassword(password, hashedPassword)
+	require.NoError(t, err)
+
+	err = ValidatePassword(RandomString(12), hashedPassword)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	// bcrypt would ignore everything after the first 72 bytes
+	_, err = HashPasswordWithParams(RandomString(73), testBcryptParams)
+	require.ErrorIs(t, err, ErrPasswordTooLong)
+}
+
+func TestLongPassword(t *testing.T) {
+	password := RandomString(100)
+
+	hashedPassword, err := HashPassword(password)
+	require.NoError(t, err)
+
+	// argon2id reads the whole password
+	err = ValidatePassword(password[:72]+RandomString(28), hashedPassword)
+	require.ErrorIs(t, err, ErrMismatchedPassword)
+
+	err = ValidatePassword(password, hashedPassword)
+	require.NoError(t, err)
+}
+
+func TestValidatePasswordUnsupportedHash(t *testing.T) {
+	hashes := []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=19456$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5a2V5a2V5a2V5a2V5a2V5",
+	}
+
+	for _, hash := range hashes {
+		err := ValidatePassword(RandomString(8), hash)
+		require.ErrorIs(t, err, ErrUnsupportedHash, hash)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	password := RandomString(12)
+
+	hashedPassword, err := HashPassword(password)
+	require.NoError(t, err)
+	require.False(t, NeedsRehash(hashedPassword, DefaultPasswordHashParams))
+
+	strongerParams := DefaultPasswordHashParams
+	strongerParams.Argon2id.Iterations++
+	require.True(t, NeedsRehash(hashedPassword, strongerParams))
+
+	require.True(t, NeedsRehash(hashedPassword, testBcryptParams))
+
+	bcryptHash, err := HashPasswordWithParams(password, testBcryptParams)
+	require.NoError(t, err)
+	require.False(t, NeedsRehash(bcryptHash, testBcryptParams))
+	require.True(t, NeedsRehash(bcryptHash, DefaultPasswordHashParams))
+
+	strongerBcryptParams := testBcryptParams
+	strongerBcryptParams.BcryptCost++
+	require.True(t, NeedsRehash(bcryptHash, strongerBcryptParams))
+
+	require.True(t, NeedsRehash("plaintext", DefaultPasswordHashParams))
+}
+
+func TestPasswordHashParamsValidate(t *testing.T) {
+	require.NoError(t, DefaultPasswordHashParams.Validate())
+	require.NoError(t, testBcryptParams.Validate())
+
+	params := DefaultPasswordHashParams
+	params.Algorithm = "md5"
+	require.Error(t, params.Validate())
+
+	params = DefaultPasswordHashParams
+	params.Argon2id.Memory = 0
+	require.Error(t, params.Validate())
+
+	params = DefaultPasswordHashParams
+	params.Argon2id.SaltLength = 4
+	require.Error(t, params.Validate())
+
+	params = testBcryptParams
+	params.BcryptCost = bcrypt.MaxCost + 1
+	require.Error(t, params.Validate())
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// PKCEMethodS256 is the only PKCE method accepted. The plain method would send the verifier in the clear.
+const PKCEMethodS256 = "S256"
+
+// PKCE code verifiers are 43 to 128 unreserved characters, see RFC 7636
+const (
+	pkceMinVerifierLength = 43
+	pkceMaxVerifierLength = 128
+)
+
+// PKCEChallenge returns the S256 challenge of a code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code verifier against the S256 challenge it was sent with
+func VerifyPKCE(verifier string, challenge string) bool {
+	if !validPKCEVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// validPKCEVerifier checks the length and the characters of a code verifier
+func validPKCEVerifier(verifier string) bool {
+	if len(verifier) < pkceMinVerifierLength || len(verifier) > pkceMaxVerifierLength {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
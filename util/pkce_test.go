@@ -0,0 +1,32 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	require.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", PKCEChallenge(verifier))
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := RandomString(64)
+	challenge := PKCEChallenge(verifier)
+
+	require.True(t, VerifyPKCE(verifier, challenge))
+	require.False(t, VerifyPKCE(RandomString(64), challenge))
+
+	// verifiers that break RFC 7636 are refused even if they match
+	shortVerifier := RandomString(42)
+	require.False(t, VerifyPKCE(shortVerifier, PKCEChallenge(shortVerifier)))
+
+	longVerifier := RandomString(129)
+	require.False(t, VerifyPKCE(longVerifier, PKCEChallenge(longVerifier)))
+
+	invalidVerifier := strings.Repeat("a", 42) + "/"
+	require.False(t, VerifyPKCE(invalidVerifier, PKCEChallenge(invalidVerifier)))
+}
@@ -0,0 +1,68 @@
+package util
+
+// Roles a user can hold
+const (
+	TravelerRole = "traveler"
+	AgentRole    = "agent"
+	AdminRole    = "admin"
+)
+
+// Permissions that can be granted to a role
+const (
+	PermissionBookingsRead     = "bookings:read"
+	PermissionBookingsWrite    = "bookings:write"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersWrite       = "users:write"
+	PermissionUsersManageRole  = "users:manage_role"
+	PermissionSessionsManage   = "sessions:manage"
+	PermissionAPIKeysManage    = "api_keys:manage"
+	PermissionOrgsManage       = "organizations:manage"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionAuditRead        = "audit:read"
+)
+
+var rolePermissions = map[string][]string{
+	TravelerRole: {
+		PermissionBookingsRead,
+		PermissionBookingsWrite,
+	},
+	AgentRole: {
+		PermissionBookingsRead,
+		PermissionBookingsWrite,
+		PermissionUsersRead,
+	},
+	AdminRole: {
+		PermissionBookingsRead,
+		PermissionBookingsWrite,
+		PermissionUsersRead,
+		PermissionUsersWrite,
+		PermissionUsersManageRole,
+		PermissionSessionsManage,
+		PermissionAPIKeysManage,
+		PermissionOrgsManage,
+		PermissionUsersImpersonate,
+		PermissionAuditRead,
+	},
+}
+
+// IsSupportedRole checks if a role is known
+func IsSupportedRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsForRole returns the permissions granted to a role
+func PermissionsForRole(role string) []string {
+	permissions := rolePermissions[role]
+	return append([]string(nil), permissions...)
+}
+
+// RoleHasPermission checks if a role grants a permission
+func RoleHasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// secret of the RFC 6238 SHA1 test vectors, "12345678901234567890" base32 encoded
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTPCode(t *testing.T) {
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := GenerateTOTPCode(rfcTOTPSecret, time.Unix(tc.unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, tc.code, code)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+
+	now := time.Now()
+	code, err := GenerateTOTPCode(secret, now)
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTPCode(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, TOTPStep(now), step)
+
+	// one step of clock drift either way is accepted, and the step of the code is returned
+	step, ok = ValidateTOTPCode(secret, code, now.Add(TOTPPeriod))
+	require.True(t, ok)
+	require.Equal(t, TOTPStep(now), step)
+
+	step, ok = ValidateTOTPCode(secret, code, now.Add(-TOTPPeriod))
+	require.True(t, ok)
+	require.Equal(t, TOTPStep(now), step)
+
+	_, ok = ValidateTOTPCode(secret, code, now.Add(3*TOTPPeriod))
+	require.False(t, ok)
+
+	_, ok = ValidateTOTPCode(secret, "", now)
+	require.False(t, ok)
+	_, ok = ValidateTOTPCode(secret, "12345", now)
+	require.False(t, ok)
+	_, ok = ValidateTOTPCode("not base32!", code, now)
+	require.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Travel Agency", "jane@email.com", rfcTOTPSecret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/Travel Agency:jane@email.com", uri.Path)
+	require.Equal(t, rfcTOTPSecret, uri.Query().Get("secret"))
+	require.Equal(t, "Travel Agency", uri.Query().Get("issuer"))
+	require.Equal(t, "6", uri.Query().Get("digits"))
+	require.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := RandomString(32)
+	secret := RandomString(16)
+
+	encrypted, err := EncryptSecret(key, secret)
+	require.NoError(t, err)
+	require.NotEqual(t, secret, encrypted)
+
+	decrypted, err := DecryptSecret(key, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, secret, decrypted)
+
+	_, err = DecryptSecret(RandomString(32), encrypted)
+	require.Error(t, err)
+
+	_, err = EncryptSecret(RandomString(16), secret)
+	require.Error(t, err)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		require.Len(t, code, 11)
+		require.False(t, seen[code])
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode(codes[0])
+	require.Len(t, hash, 64)
+	require.NotEqual(t, HashRecoveryCode(codes[1]), hash)
+	require.Equal(t, hash, HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" "))
+}
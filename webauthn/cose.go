@@ -0,0 +1,118 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of credential keys, see the IANA COSE Algorithms registry
+const (
+	AlgorithmES256 int64 = -7
+	AlgorithmEdDSA int64 = -8
+	AlgorithmRS256 int64 = -257
+)
+
+// SupportedAlgorithms are the algorithms credentials may use, by preference
+var SupportedAlgorithms = []int64{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+// Labels and values of COSE keys, see RFC 9053
+const (
+	coseKeyType   int64 = 1
+	coseAlgorithm int64 = 3
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurve   int64 = -1
+	coseX       int64 = -2
+	coseY       int64 = -3
+	coseRSAN    int64 = -1
+	coseRSAE    int64 = -2
+	coseP256    int64 = 1
+	coseEd25519 int64 = 6
+)
+
+// minRSAKeyBits is the smallest RSA key accepted
+const minRSAKeyBits = 2048
+
+var errInvalidPublicKey = errors.New("webauthn: invalid credential public key")
+
+// publicKey is a credential public key decoded from its COSE form
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE key. The key must be for one of the supported algorithms.
+func parsePublicKey(data []byte) (*publicKey, error) {
+	m, err := decodeCBORMap(data)
+	if err != nil {
+		return nil, err
+	}
+
+	keyType, ok := m.int(coseKeyType)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing key type", errInvalidPublicKey)
+	}
+	alg, ok := m.int(coseAlgorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing algorithm", errInvalidPublicKey)
+	}
+
+	switch alg {
+	case AlgorithmES256:
+		crv, _ := m.int(coseCurve)
+		x, _ := m.bytes(coseX)
+		y, _ := m.bytes(coseY)
+		if keyType != coseKeyTypeEC2 || crv != coseP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: not a P-256 key", errInvalidPublicKey)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point is not on the curve", errInvalidPublicKey)
+		}
+		return &publicKey{algorithm: alg, key: key}, nil
+	case AlgorithmEdDSA:
+		crv, _ := m.int(coseCurve)
+		x, _ := m.bytes(coseX)
+		if keyType != coseKeyTypeOKP || crv != coseEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: not an Ed25519 key", errInvalidPublicKey)
+		}
+		return &publicKey{algorithm: alg, key: ed25519.PublicKey(x)}, nil
+	case AlgorithmRS256:
+		n, _ := m.bytes(coseRSAN)
+		e, _ := m.bytes(coseRSAE)
+		if keyType != coseKeyTypeRSA || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: not an RSA key", errInvalidPublicKey)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeyBits || key.E < 3 || key.E%2 == 0 {
+			return nil, fmt.Errorf("%w: weak RSA key", errInvalidPublicKey)
+		}
+		return &publicKey{algorithm: alg, key: key}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported algorithm %d", errInvalidPublicKey, alg)
+}
+
+// verify checks a signature over data made with the key
+func (k *publicKey) verify(data []byte, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,625 @@
+// Package webauthn implements the relying party side of the WebAuthn registration and authentication
+// ceremonies, see https://www.w3.org/TR/webauthn-2/. Credentials must verify the user, as they stand in for
+// the password and the second factor. Attestation isn't asked for, so authenticators aren't vetted.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long the browser waits for the user when the config doesn't say
+const DefaultTimeout = 5 * time.Minute
+
+// Values of the options and responses
+const (
+	credentialTypePublicKey = "public-key"
+	clientDataTypeCreate    = "webauthn.create"
+	clientDataTypeGet       = "webauthn.get"
+	requirementRequired     = "required"
+	attestationNone         = "none"
+	attestationPacked       = "packed"
+)
+
+// maxCredentialIDLength is the longest credential ID allowed by the spec
+const maxCredentialIDLength = 1023
+
+// Flags of the authenticator data
+const (
+	flagUserPresent            byte = 0x01
+	flagUserVerified           byte = 0x04
+	flagBackupEligible         byte = 0x08
+	flagBackedUp               byte = 0x10
+	flagAttestedCredentialData byte = 0x40
+	flagExtensionData          byte = 0x80
+)
+
+var (
+	// ErrInvalidResponse is returned when a response fails any check of a ceremony
+	ErrInvalidResponse = errors.New("webauthn: invalid response")
+	// ErrClonedAuthenticator is returned when the signature counter of a credential goes backwards, which
+	// means the credential's key is being used by more than one authenticator
+	ErrClonedAuthenticator = errors.New("webauthn: the signature counter went backwards, the authenticator may have been cloned")
+)
+
+// knownTransports are the transports stored with a credential. Others are dropped, as the client can send anything.
+var knownTransports = map[string]bool{
+	"ble": true, "hybrid": true, "internal": true, "nfc": true, "smart-card": true, "usb": true,
+}
+
+// Config describes the relying party
+type Config struct {
+	// RPID is the domain credentials are scoped to, e.g. travel.agency. It must be the origins' domain or one
+	// they are under.
+	RPID   string
+	RPName string
+	// Origins are the origins of the pages and apps allowed to run the ceremonies, e.g. https://travel.agency
+	Origins []string
+	Timeout time.Duration
+}
+
+// RelyingParty runs the ceremonies for the apps of one domain
+type RelyingParty struct {
+	config   Config
+	rpIDHash [32]byte
+}
+
+// NewRelyingParty creates a relying party from its config
+func NewRelyingParty(config Config) (*RelyingParty, error) {
+	if config.RPID == "" || config.RPName == "" || len(config.Origins) == 0 {
+		return nil, errors.New("webauthn: relying party ID, name and origins are required")
+	}
+	for _, origin := range config.Origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" && u.Opaque == "" {
+			return nil, fmt.Errorf("webauthn: invalid origin %q", origin)
+		}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &RelyingParty{
+		config:   config,
+		rpIDHash: sha256.Sum256([]byte(config.RPID)),
+	}, nil
+}
+
+// RelyingPartyEntity names the relying party to the user
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is the account a credential is created for. The ID is the user handle, base64url encoded. It
+// comes back with assertions made with the credential.
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is a kind of credential the relying party accepts
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a credential. The ID is base64url encoded.
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection tells the browser which authenticators may be used
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() to register a credential, in the JSON form of
+// PublicKeyCredentialCreationOptions
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get() to sign in, in the JSON form of
+// PublicKeyCredentialRequestOptions
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// User is the account a credential is registered for
+type User struct {
+	Handle      []byte
+	Name        string
+	DisplayName string
+}
+
+// CreationOptions returns the options to register a credential for a user. The credentials the user already
+// has are excluded, so the same authenticator isn't registered twice. Credentials are discoverable, so users
+// can sign in without typing their email.
+func (rp *RelyingParty) CreationOptions(challenge string, user User, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: credentialTypePublicKey, Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CreationOptions{
+		RP: RelyingPartyEntity{ID: rp.config.RPID, Name: rp.config.RPName},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(user.Handle),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.config.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        requirementRequired,
+			RequireResidentKey: true,
+			UserVerification:   requirementRequired,
+		},
+		Attestation: attestationNone,
+	}
+}
+
+// RequestOptions returns the options to sign in with any discoverable credential of the relying party
+func (rp *RelyingParty) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.config.Timeout.Milliseconds(),
+		RPID:             rp.config.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: requirementRequired,
+	}
+}
+
+// NewCredentialDescriptor describes a stored credential
+func NewCredentialDescriptor(id []byte, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{
+		Type:       credentialTypePublicKey,
+		ID:         base64.RawURLEncoding.EncodeToString(id),
+		Transports: transports,
+	}
+}
+
+// AttestationResponse is the response of the authenticator to a registration
+type AttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+}
+
+// RegistrationResponse is the credential returned by navigator.credentials.create(), in the JSON form of
+// PublicKeyCredential. Binary fields are base64url encoded.
+type RegistrationResponse struct {
+	ID       string              `json:"id"`
+	RawID    string              `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// Challenge returns the challenge the response answers. It's only trusted once the response is verified.
+func (res *RegistrationResponse) Challenge() (string, error) {
+	clientData, _, err := parseClientData(res.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// AssertionResponse is the response of the authenticator to a sign in
+type AssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// AuthenticationResponse is the credential returned by navigator.credentials.get(), in the JSON form of
+// PublicKeyCredential. Binary fields are base64url encoded.
+type AuthenticationResponse struct {
+	ID       string            `json:"id"`
+	RawID    string            `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// Challenge returns the challenge the response answers. It's only trusted once the response is verified.
+func (res *AuthenticationResponse) Challenge() (string, error) {
+	clientData, _, err := parseClientData(res.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// CredentialID returns the ID of the credential that signed in
+func (res *AuthenticationResponse) CredentialID() ([]byte, error) {
+	return credentialID(res.ID, res.RawID, res.Type)
+}
+
+// UserHandle returns the user handle stored with the credential. Discoverable credentials always return one.
+func (res *AuthenticationResponse) UserHandle() ([]byte, error) {
+	return decodeBase64(res.Response.UserHandle)
+}
+
+// Credential is a registered credential, as it's stored
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE form of the key
+	PublicKey      []byte
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// VerifyRegistration checks the response to a registration that was started with challenge, and returns the
+// new credential. See section 7.1 of the spec.
+func (rp *RelyingParty) VerifyRegistration(res *RegistrationResponse, challenge string) (*Credential, error) {
+	id, err := credentialID(res.ID, res.RawID, res.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, clientDataHash, err := parseClientData(res.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkClientData(clientData, clientDataTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decodeBase64(res.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrInvalidResponse)
+	}
+	attestation, err := decodeCBORMap(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	format, _ := attestation.string("fmt")
+	statement, ok := attestation.mapValue("attStmt")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing attestation statement", ErrInvalidResponse)
+	}
+	rawAuthData, ok := attestation.bytes("authData")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrInvalidResponse)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: missing attested credential", ErrInvalidResponse)
+	}
+	if !bytes.Equal(authData.credentialID, id) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	key, err := parsePublicKey(authData.credentialPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifyAttestation(format, statement, key, signed); err != nil {
+		return nil, err
+	}
+
+	transports := []string{}
+	for _, transport := range res.Response.Transports {
+		if knownTransports[transport] {
+			transports = append(transports, transport)
+		}
+	}
+
+	return &Credential{
+		ID:             id,
+		PublicKey:      authData.credentialPublicKey,
+		SignCount:      authData.signCount,
+		AAGUID:         authData.aaguid,
+		Transports:     transports,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// Assertion is the outcome of a sign in, to be stored with the credential
+type Assertion struct {
+	SignCount uint32
+	BackedUp  bool
+}
+
+// VerifyAssertion checks the response to a sign in that was started with challenge, made with a stored
+// credential. The caller must have found the credential by the response's ID and checked it belongs to the
+// user of the response's user handle. See section 7.2 of the spec.
+func (rp *RelyingParty) VerifyAssertion(res *AuthenticationResponse, challenge string, credential Credential) (*Assertion, error) {
+	id, err := res.CredentialID()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(id, credential.ID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	clientData, clientDataHash, err := parseClientData(res.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkClientData(clientData, clientDataTypeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeBase64(res.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid authenticator data", ErrInvalidResponse)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64(res.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature", ErrInvalidResponse)
+	}
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+
+	// authenticators that don't count always send 0. Once one has counted, each use must count up.
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return nil, ErrClonedAuthenticator
+	}
+
+	return &Assertion{
+		SignCount: authData.signCount,
+		BackedUp:  authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// clientData is the data the browser signs over, see section 5.8.1 of the spec
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// parseClientData decodes the client data and returns its hash, which the authenticator signs
+func parseClientData(encoded string) (*clientData, [32]byte, error) {
+	raw, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, [32]byte{}, fmt.Errorf("%w: invalid client data", ErrInvalidResponse)
+	}
+
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, [32]byte{}, fmt.Errorf("%w: invalid client data", ErrInvalidResponse)
+	}
+	return &data, sha256.Sum256(raw), nil
+}
+
+func (rp *RelyingParty) checkClientData(data *clientData, ceremony string, challenge string) error {
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: client data is for %q", ErrInvalidResponse, data.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if !containsString(rp.config.Origins, data.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, data.Origin)
+	}
+	// a page of another site embedding ours in an iframe must not get to use the credentials
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin ceremony", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// authenticatorData is the data the authenticator signs over, see section 6.1 of the spec
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// set when the attested credential data flag is
+	aaguid              []byte
+	credentialID        []byte
+	credentialPublicKey []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrInvalidResponse)
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data is too short", ErrInvalidResponse)
+		}
+		authData.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > maxCredentialIDLength || len(rest) < idLength {
+			return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// the key is only delimited by its own encoding
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		authData.credentialPublicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		extensions, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		if _, ok := extensions.(map[interface{}]interface{}); !ok {
+			return nil, fmt.Errorf("%w: invalid extensions", ErrInvalidResponse)
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrInvalidResponse)
+	}
+	return authData, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(authData *authenticatorData) error {
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rp.rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: credential is for another relying party", ErrInvalidResponse)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user was not present", ErrInvalidResponse)
+	}
+	if authData.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user was not verified", ErrInvalidResponse)
+	}
+	if authData.flags&flagBackedUp != 0 && authData.flags&flagBackupEligible == 0 {
+		return fmt.Errorf("%w: credential is backed up but not eligible for backup", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// verifyAttestation checks the attestation statement of a new credential. Since attestation isn't asked for,
+// browsers send none, but some authenticators send a packed statement anyway. Its signature is checked, but
+// its certificates aren't trusted for anything.
+func verifyAttestation(format string, statement cborMap, key *publicKey, signed []byte) error {
+	switch format {
+	case attestationNone:
+		if len(statement) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrInvalidResponse)
+		}
+		return nil
+	case attestationPacked:
+		alg, _ := statement.int("alg")
+		sig, ok := statement.bytes("sig")
+		if !ok {
+			return fmt.Errorf("%w: missing attestation signature", ErrInvalidResponse)
+		}
+
+		chain, ok := statement["x5c"].([]interface{})
+		if !ok {
+			// self attestation is signed with the credential's own key
+			if alg != key.algorithm || !key.verify(signed, sig) {
+				return fmt.Errorf("%w: bad attestation signature", ErrInvalidResponse)
+			}
+			return nil
+		}
+
+		if len(chain) == 0 {
+			return fmt.Errorf("%w: empty attestation certificate chain", ErrInvalidResponse)
+		}
+		der, ok := chain[0].([]byte)
+		if !ok {
+			return fmt.Errorf("%w: invalid attestation certificate", ErrInvalidResponse)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%w: invalid attestation certificate", ErrInvalidResponse)
+		}
+		var signatureAlgorithm x509.SignatureAlgorithm
+		switch alg {
+		case AlgorithmES256:
+			signatureAlgorithm = x509.ECDSAWithSHA256
+		case AlgorithmEdDSA:
+			signatureAlgorithm = x509.PureEd25519
+		case AlgorithmRS256:
+			signatureAlgorithm = x509.SHA256WithRSA
+		default:
+			return fmt.Errorf("%w: unsupported attestation algorithm %d", ErrInvalidResponse, alg)
+		}
+		if err := cert.CheckSignature(signatureAlgorithm, signed, sig); err != nil {
+			return fmt.Errorf("%w: bad attestation signature", ErrInvalidResponse)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unsupported attestation format %q", ErrInvalidResponse, format)
+}
+
+// credentialID decodes the ID of a credential, which is sent twice
+func credentialID(id string, rawID string, credentialType string) ([]byte, error) {
+	if credentialType != credentialTypePublicKey {
+		return nil, fmt.Errorf("%w: not a public key credential", ErrInvalidResponse)
+	}
+	decoded, err := decodeBase64(rawID)
+	if err != nil || len(decoded) == 0 || len(decoded) > maxCredentialIDLength {
+		return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+	}
+	if fromID, err := decodeBase64(id); err != nil || !bytes.Equal(fromID, decoded) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+	return decoded, nil
+}
+
+// decodeBase64 decodes base64url, with or without padding, as browsers and libraries differ
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/sajitron/travel-agency/util"
+	"github.com/sajitron/travel-agency/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "travel.agency"
+	testOrigin = "https://travel.agency"
+)
+
+func newTestRelyingParty(t *testing.T) *RelyingParty {
+	rp, err := NewRelyingParty(Config{
+		RPID:    testRPID,
+		RPName:  "Travel Agency",
+		Origins: []string{testOrigin, "android:apk-key-hash:abc"},
+	})
+	require.NoError(t, err)
+	return rp
+}
+
+// convert sends a response of the authenticator through JSON, as a browser would
+func convert(t *testing.T, from interface{}, to interface{}) {
+	data, err := json.Marshal(from)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, to))
+}
+
+// register registers a new credential of the authenticator with the relying party
+func register(t *testing.T, rp *RelyingParty, authenticator *webauthntest.Authenticator) *Credential {
+	challenge := util.RandomString(32)
+	res, err := authenticator.Register(testRPID, testOrigin, challenge, []byte{0, 0, 0, 0, 0, 0, 0, 1})
+	require.NoError(t, err)
+
+	var registration RegistrationResponse
+	convert(t, res, &registration)
+
+	credential, err := rp.VerifyRegistration(&registration, challenge)
+	require.NoError(t, err)
+	return credential
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	_, err := NewRelyingParty(Config{RPID: testRPID, RPName: "Travel Agency"})
+	require.Error(t, err)
+
+	_, err = NewRelyingParty(Config{RPID: testRPID, RPName: "Travel Agency", Origins: []string{"travel.agency"}})
+	require.Error(t, err)
+
+	rp := newTestRelyingParty(t)
+	options := rp.CreationOptions("challenge", User{Handle: []byte{1}, Name: "jane@travel.agency"}, nil)
+	require.Equal(t, testRPID, options.RP.ID)
+	require.Equal(t, "AQ", options.User.ID)
+	require.Equal(t, DefaultTimeout.Milliseconds(), options.Timeout)
+	require.Len(t, options.PubKeyCredParams, len(SupportedAlgorithms))
+	require.NotNil(t, options.ExcludeCredentials)
+	require.Equal(t, "required", options.AuthenticatorSelection.UserVerification)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator()
+	authenticator.SyncedCredentials = true
+
+	credential := register(t, rp, authenticator)
+	require.Len(t, credential.ID, 16)
+	require.Len(t, credential.AAGUID, 16)
+	require.Equal(t, []string{"internal", "hybrid"}, credential.Transports)
+	require.True(t, credential.BackupEligible)
+	require.True(t, credential.BackedUp)
+	require.Zero(t, credential.SignCount)
+
+	for i := 1; i <= 2; i++ {
+		challenge := util.RandomString(32)
+		res, err := authenticator.Login(testRPID, testOrigin, challenge)
+		require.NoError(t, err)
+
+		var authentication AuthenticationResponse
+		convert(t, res, &authentication)
+
+		gotChallenge, err := authentication.Challenge()
+		require.NoError(t, err)
+		require.Equal(t, challenge, gotChallenge)
+		userHandle, err := authentication.UserHandle()
+		require.NoError(t, err)
+		require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1}, userHandle)
+
+		assertion, err := rp.VerifyAssertion(&authentication, challenge, *credential)
+		require.NoError(t, err)
+		require.Equal(t, uint32(i), assertion.SignCount)
+		require.True(t, assertion.BackedUp)
+		credential.SignCount = assertion.SignCount
+	}
+}
+
+func TestRegisterSelfAttestation(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator()
+	authenticator.SelfAttestation = true
+
+	credential := register(t, rp, authenticator)
+	require.NotEmpty(t, credential.PublicKey)
+}
+
+func TestVerifyRegistrationInvalid(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := util.RandomString(32)
+
+	testCases := []struct {
+		name           string
+		rpID           string
+		clientData     webauthntest.ClientData
+		modify         func(authenticator *webauthntest.Authenticator)
+		modifyResponse func(res *RegistrationResponse)
+	}{
+		{
+			name:       "Wrong Challenge",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: util.RandomString(32), Origin: testOrigin},
+		},
+		{
+			name:       "Wrong Origin",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: "https://travel.agency.evil.com"},
+		},
+		{
+			name:       "Wrong Type",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: testOrigin},
+		},
+		{
+			name:       "Cross Origin",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin, CrossOrigin: true},
+		},
+		{
+			name:       "Other Relying Party",
+			rpID:       "evil.com",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+		},
+		{
+			name:       "User Not Verified",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+			modify: func(authenticator *webauthntest.Authenticator) {
+				authenticator.UserVerified = false
+			},
+		},
+		{
+			name:       "Mismatched ID",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+			modifyResponse: func(res *RegistrationResponse) {
+				res.ID = "AAAA"
+			},
+		},
+		{
+			name:       "Bad Self Attestation",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+			modify: func(authenticator *webauthntest.Authenticator) {
+				authenticator.SelfAttestation = true
+			},
+			modifyResponse: func(res *RegistrationResponse) {
+				// the client data no longer matches what the attestation signed
+				res.Response.ClientDataJSON = encodeClientData(t, clientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: "android:apk-key-hash:abc"})
+			},
+		},
+		{
+			name:       "Garbled Attestation Object",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+			modifyResponse: func(res *RegistrationResponse) {
+				res.Response.AttestationObject = res.Response.AttestationObject[:len(res.Response.AttestationObject)/2]
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator()
+			if tc.modify != nil {
+				tc.modify(authenticator)
+			}
+			rpID := testRPID
+			if tc.rpID != "" {
+				rpID = tc.rpID
+			}
+
+			res, err := authenticator.RegisterWith(rpID, tc.clientData, []byte{1})
+			require.NoError(t, err)
+
+			var registration RegistrationResponse
+			convert(t, res, &registration)
+			if tc.modifyResponse != nil {
+				tc.modifyResponse(&registration)
+			}
+
+			_, err = rp.VerifyRegistration(&registration, challenge)
+			require.ErrorIs(t, err, ErrInvalidResponse)
+		})
+	}
+}
+
+func TestVerifyAssertionInvalid(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := util.RandomString(32)
+
+	testCases := []struct {
+		name           string
+		clientData     webauthntest.ClientData
+		modify         func(authenticator *webauthntest.Authenticator)
+		modifyResponse func(res *AuthenticationResponse)
+		signCount      uint32
+		err            error
+	}{
+		{
+			name:       "Wrong Challenge",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: util.RandomString(32), Origin: testOrigin},
+			err:        ErrInvalidResponse,
+		},
+		{
+			name:       "Wrong Origin",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: "http://travel.agency"},
+			err:        ErrInvalidResponse,
+		},
+		{
+			name:       "Wrong Type",
+			clientData: webauthntest.ClientData{Type: clientDataTypeCreate, Challenge: challenge, Origin: testOrigin},
+			err:        ErrInvalidResponse,
+		},
+		{
+			name:       "User Not Verified",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: testOrigin},
+			modify: func(authenticator *webauthntest.Authenticator) {
+				authenticator.UserVerified = false
+			},
+			err: ErrInvalidResponse,
+		},
+		{
+			name:       "Bad Signature",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: testOrigin},
+			modifyResponse: func(res *AuthenticationResponse) {
+				res.Response.ClientDataJSON = encodeClientData(t, clientData{Type: clientDataTypeGet, Challenge: challenge, Origin: "android:apk-key-hash:abc"})
+			},
+			err: ErrInvalidResponse,
+		},
+		{
+			name:       "Other Credential",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: testOrigin},
+			modifyResponse: func(res *AuthenticationResponse) {
+				res.ID = "AAAAAAAAAAAAAAAAAAAAAA"
+				res.RawID = res.ID
+			},
+			err: ErrInvalidResponse,
+		},
+		{
+			name:       "Cloned Authenticator",
+			clientData: webauthntest.ClientData{Type: clientDataTypeGet, Challenge: challenge, Origin: testOrigin},
+			// a copy of the key has already signed in twice, so the original's next count is behind
+			signCount: 2,
+			err:       ErrClonedAuthenticator,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator()
+			credential := register(t, rp, authenticator)
+			if tc.modify != nil {
+				tc.modify(authenticator)
+			}
+			credential.SignCount = tc.signCount
+
+			res, err := authenticator.LoginWith(testRPID, tc.clientData)
+			require.NoError(t, err)
+
+			var authentication AuthenticationResponse
+			convert(t, res, &authentication)
+			if tc.modifyResponse != nil {
+				tc.modifyResponse(&authentication)
+			}
+
+			_, err = rp.VerifyAssertion(&authentication, challenge, *credential)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestVerifyAssertionWithoutSignCount(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator()
+	authenticator.NoSignCount = true
+	credential := register(t, rp, authenticator)
+
+	for i := 0; i < 2; i++ {
+		challenge := util.RandomString(32)
+		res, err := authenticator.Login(testRPID, testOrigin, challenge)
+		require.NoError(t, err)
+
+		var authentication AuthenticationResponse
+		convert(t, res, &authentication)
+
+		assertion, err := rp.VerifyAssertion(&authentication, challenge, *credential)
+		require.NoError(t, err)
+		require.Zero(t, assertion.SignCount)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	value, rest, err := decodeCBOR([]byte{0xa2, 0x01, 0x02, 0x20, 0x43, 1, 2, 3, 0xff})
+	require.NoError(t, err)
+	require.Equal(t, map[interface{}]interface{}{int64(1): int64(2), int64(-1): []byte{1, 2, 3}}, value)
+	require.Equal(t, []byte{0xff}, rest)
+
+	value, _, err = decodeCBOR([]byte{0x83, 0xf5, 0xf6, 0x19, 0x01, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{true, nil, int64(256)}, value)
+
+	invalid := map[string][]byte{
+		"Truncated":          {0x43, 1, 2},
+		"Indefinite Length":  {0x5f, 0x41, 1, 0xff},
+		"Duplicate Key":      {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"Huge Array":         {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"Float":              {0xfb, 0, 0, 0, 0, 0, 0, 0, 0},
+		"Tag":                {0xc1, 0x01},
+		"Integer Overflow":   {0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"Array As Map Key":   {0xa1, 0x80, 0x01},
+		"Empty":              {},
+		"Nested Too Deep":    append(repeat(0x81, maxCBORDepth+2), 0x01),
+		"Map Missing Values": {0xa2, 0x01},
+	}
+	for name, data := range invalid {
+		_, _, err := decodeCBOR(data)
+		require.ErrorIs(t, err, errInvalidCBOR, name)
+	}
+}
+
+func repeat(b byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = b
+	}
+	return data
+}
+
+func encodeClientData(t *testing.T, data clientData) string {
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,240 @@
+// Package webauthntest is a software authenticator, so that WebAuthn registration and sign in can be tested
+// end to end without hardware. It answers ceremonies the way a browser and a platform authenticator would.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Flags of the authenticator data
+const (
+	flagUserPresent            byte = 0x01
+	flagUserVerified           byte = 0x04
+	flagBackupEligible         byte = 0x08
+	flagBackedUp               byte = 0x10
+	flagAttestedCredentialData byte = 0x40
+)
+
+// algorithmES256 is the only algorithm the authenticator makes keys for
+const algorithmES256 = -7
+
+// AttestationResponse is the response of the authenticator to a registration
+type AttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+}
+
+// RegistrationResponse is a new credential, in the JSON form browsers send
+type RegistrationResponse struct {
+	ID       string              `json:"id"`
+	RawID    string              `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is the response of the authenticator to a sign in
+type AssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// AuthenticationResponse is a sign in, in the JSON form browsers send
+type AuthenticationResponse struct {
+	ID       string            `json:"id"`
+	RawID    string            `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// ClientData is what the browser signs over. Tests can change it before it's signed, to make a bad response.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Authenticator is a platform authenticator holding discoverable ES256 credentials
+type Authenticator struct {
+	AAGUID [16]byte
+	// UserVerified sets whether the user passed a biometric or PIN check. It's true by default.
+	UserVerified bool
+	// SyncedCredentials makes backed up credentials, like passkeys synced across devices
+	SyncedCredentials bool
+	// NoSignCount makes the authenticator always send a signature counter of 0, as synced passkeys do
+	NoSignCount bool
+	// SelfAttestation makes registrations return a packed self attestation instead of none
+	SelfAttestation bool
+
+	credentials []*credential
+}
+
+// NewAuthenticator creates an authenticator without credentials
+func NewAuthenticator() *Authenticator {
+	return &Authenticator{UserVerified: true}
+}
+
+// Clone returns an authenticator holding copies of the same keys and counters, as a cloned device would
+func (a *Authenticator) Clone() *Authenticator {
+	clone := *a
+	clone.credentials = make([]*credential, 0, len(a.credentials))
+	for _, cred := range a.credentials {
+		c := *cred
+		clone.credentials = append(clone.credentials, &c)
+	}
+	return &clone
+}
+
+// Register creates a credential for a user at the relying party, answering a registration started with challenge
+func (a *Authenticator) Register(rpID, origin, challenge string, userHandle []byte) (*RegistrationResponse, error) {
+	return a.RegisterWith(rpID, ClientData{Type: "webauthn.create", Challenge: challenge, Origin: origin}, userHandle)
+}
+
+// RegisterWith creates a credential, signing over the given client data
+func (a *Authenticator) RegisterWith(rpID string, clientData ClientData, userHandle []byte) (*RegistrationResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, rpID: rpID, userHandle: userHandle, key: key}
+
+	clientDataJSON, err := json.Marshal(clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	// the attested credential data follows the common header
+	authData := a.authenticatorData(cred, flagAttestedCredentialData)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, cosePublicKey(key)...)
+
+	format := "none"
+	statement := encodeMap()
+	if a.SelfAttestation {
+		sig, err := sign(key, authData, clientDataJSON)
+		if err != nil {
+			return nil, err
+		}
+		format = "packed"
+		statement = encodeMap(pair{"alg", algorithmES256}, pair{"sig", sig})
+	}
+	attestationObject := encodeMap(pair{"fmt", format}, pair{"attStmt", rawCBOR(statement)}, pair{"authData", authData})
+
+	a.credentials = append(a.credentials, cred)
+
+	return &RegistrationResponse{
+		ID:    encode(id),
+		RawID: encode(id),
+		Type:  "public-key",
+		Response: AttestationResponse{
+			ClientDataJSON:    encode(clientDataJSON),
+			AttestationObject: encode(attestationObject),
+			Transports:        []string{"internal", "hybrid"},
+		},
+	}, nil
+}
+
+// Login signs in with the newest credential of the relying party, answering a sign in started with challenge
+func (a *Authenticator) Login(rpID, origin, challenge string) (*AuthenticationResponse, error) {
+	return a.LoginWith(rpID, ClientData{Type: "webauthn.get", Challenge: challenge, Origin: origin})
+}
+
+// LoginWith signs in with the newest credential of the relying party, signing over the given client data
+func (a *Authenticator) LoginWith(rpID string, clientData ClientData) (*AuthenticationResponse, error) {
+	var cred *credential
+	for _, c := range a.credentials {
+		if c.rpID == rpID {
+			cred = c
+		}
+	}
+	if cred == nil {
+		return nil, errors.New("webauthntest: no credential for the relying party")
+	}
+
+	clientDataJSON, err := json.Marshal(clientData)
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.NoSignCount {
+		cred.signCount++
+	}
+	authData := a.authenticatorData(cred, 0)
+	sig, err := sign(cred.key, authData, clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthenticationResponse{
+		ID:    encode(cred.id),
+		RawID: encode(cred.id),
+		Type:  "public-key",
+		Response: AssertionResponse{
+			ClientDataJSON:    encode(clientDataJSON),
+			AuthenticatorData: encode(authData),
+			Signature:         encode(sig),
+			UserHandle:        encode(cred.userHandle),
+		},
+	}, nil
+}
+
+// authenticatorData writes the header of the authenticator data: the relying party, the flags and the counter
+func (a *Authenticator) authenticatorData(cred *credential, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+	if a.SyncedCredentials {
+		flags |= flagBackupEligible | flagBackedUp
+	}
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, cred.signCount)
+}
+
+// sign signs the authenticator data and the hash of the client data, as assertions and attestations are
+func sign(key *ecdsa.PrivateKey, authData []byte, clientDataJSON []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
+
+// cosePublicKey writes the COSE form of a P-256 key
+func cosePublicKey(key *ecdsa.PrivateKey) []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeMap(pair{1, 2}, pair{3, algorithmES256}, pair{-1, 1}, pair{-2, x}, pair{-3, y})
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,58 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// pair is an entry of a CBOR map. Maps are written in the order of their entries, which callers keep canonical.
+type pair struct {
+	key   interface{}
+	value interface{}
+}
+
+// rawCBOR is an item that has already been encoded
+type rawCBOR []byte
+
+// encodeMap writes a CBOR map of integers, strings, byte strings and encoded items
+func encodeMap(entries ...pair) []byte {
+	data := encodeHead(5, uint64(len(entries)))
+	for _, entry := range entries {
+		data = append(data, encodeItem(entry.key)...)
+		data = append(data, encodeItem(entry.value)...)
+	}
+	return data
+}
+
+func encodeItem(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return encodeHead(1, uint64(-1-v))
+		}
+		return encodeHead(0, uint64(v))
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case rawCBOR:
+		return v
+	}
+	panic(fmt.Sprintf("webauthntest: can't encode %T", value))
+}
+
+// encodeHead writes the initial byte of an item and its argument in the shortest form
+func encodeHead(major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major | 27}, arg)
+}